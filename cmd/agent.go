@@ -5,7 +5,7 @@ Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
 You may obtain a copy of the License at
 
-    http://www.apache.org/licenses/LICENSE-2.0
+	http://www.apache.org/licenses/LICENSE-2.0
 
 Unless required by applicable law or agreed to in writing, software
 distributed under the License is distributed on an "AS IS" BASIS,
@@ -16,36 +16,73 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/ncode/port53/internal/agent"
+	_ "github.com/ncode/port53/internal/agent/bind"
+	_ "github.com/ncode/port53/internal/agent/files"
+	_ "github.com/ncode/port53/internal/agent/nsd"
+	_ "github.com/ncode/port53/internal/agent/powerdns"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // agentCmd represents the agent command
 var agentCmd = &cobra.Command{
 	Use:   "agent",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("agent called")
+	Short: "Reconcile the zones of a backend into a DNS server",
+	Long: `Run the agent of a backend.
+
+The agent registers itself with the port53 server as a backend, polls the
+server for the zones assigned to it and applies them to the DNS server through
+a driver whenever their serial differs from the one last applied. The applied
+serial and any error are reported back to the server, see
+/v1/backends/:id/status.
+
+The driver and its settings come from the type and config of the backend on
+the server. Until the backend has a type the driver given by --driver is used.
+Local driver settings can be set in the agent.<driver> section of the config
+file, the config held by the server takes precedence over them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		interval := viper.GetDuration("agent.interval")
+		if interval <= 0 {
+			return fmt.Errorf("invalid interval %s, it must be positive", interval)
+		}
+		driverName := viper.GetString("agent.driver")
+		driver, err := agent.NewDriver(driverName, viper.Sub("agent."+driverName))
+		if err != nil {
+			return err
+		}
+		client := agent.NewClient(viper.GetString("serviceUrl"))
+		client.APIKey = viper.GetString("apiKey")
+		a := agent.New(viper.GetString("agent.name"), client, driver, interval)
+		if local := viper.Sub("agent"); local != nil {
+			a.Config = local
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err = a.Run(ctx)
+		if err == context.Canceled {
+			return nil
+		}
+		return err
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(agentCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// agentCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// agentCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	hostname, _ := os.Hostname()
+	agentCmd.Flags().String("name", hostname, "name of the backend the agent registers as")
+	agentCmd.Flags().String("driver", "files", "driver used to apply the zones while the backend has no type")
+	agentCmd.Flags().Duration("interval", 30*time.Second, "time between two reconciliations")
+	_ = viper.BindPFlag("agent.name", agentCmd.Flags().Lookup("name"))
+	_ = viper.BindPFlag("agent.driver", agentCmd.Flags().Lookup("driver"))
+	_ = viper.BindPFlag("agent.interval", agentCmd.Flags().Lookup("interval"))
 }
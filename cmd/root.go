@@ -57,6 +57,8 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.trutinha.yaml)")
+	rootCmd.PersistentFlags().String("api-key", "", "API key authenticating the requests to the port53 API")
+	_ = viper.BindPFlag("apiKey", rootCmd.PersistentFlags().Lookup("api-key"))
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
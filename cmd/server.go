@@ -16,22 +16,87 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"log"
+
 	"github.com/ncode/port53/internal/api"
+	"github.com/ncode/port53/internal/dnsserver"
+	"github.com/ncode/port53/pkg/database"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // serverCmd represents the server command
 var serverCmd = &cobra.Command{
 	Use:   "server",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+	Short: "Serve the port53 API",
+	Long: `Serve the port53 API on bindAddr.
+
+Every request to the API must be authenticated with the API key of a user as
+an "Authorization: Bearer <key>" header. Keys are created through
+/v1/users/:id/api-keys, the first one with "port53 user create-key --role admin".
+What a user may do is given by the grants of /v1/grants, roles granted on
+every zone or on one zone, optionally restricted to names and record types.
+
+With --dns-listen the server also listens over UDP and TCP, answering
+authoritative queries for the zones of the database, so small deployments
+need no separate DNS daemon and a zone can be checked with dig, e.g.
+dig @127.0.0.1 -p 5353 www.example.com A
+
+It accepts RFC 2136 dynamic updates on the same address as well, so zones
+can be managed with nsupdate. Updates must be signed with a TSIG key attached
+to the zone, see /v1/tsig-keys, or with one of the keys of the tsigKeys
+section of the config file, which may update any zone:
+
+  tsigKeys:
+    update-key:
+      algorithm: hmac-sha256.
+      secret: <base64 secret>
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+Secondaries may pull the zones over AXFR and IXFR, signing the transfer with
+a TSIG key attached to the zone or to one of its backends, or from one of the
+networks of the allowTransfer section of the config file:
+
+  allowTransfer:
+    - 192.0.2.53
+    - 10.0.0.0/8
+
+Operators may transfer zones from a primary through the API, primaries in
+the loopback, private or link-local networks of the server are refused
+unless they are in the transferPrimaries section of the config file:
+
+  transferPrimaries:
+    - 10.0.0.53
+
+Secondary backends with a notify address in their config get a NOTIFY every
+time the serial of one of their zones changes, the state of each NOTIFY shows
+up on /v1/zones/:id/backends.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		db, err := database.Database()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err = dnsserver.ParseACL(viper.GetStringSlice("transferPrimaries")); err != nil {
+			log.Fatal(err)
+		}
+		if addr := viper.GetString("dnsListen"); addr != "" {
+			configKeys := dnsserver.Keys{}
+			if err = viper.UnmarshalKey("tsigKeys", &configKeys); err != nil {
+				log.Fatal(err)
+			}
+			keys := dnsserver.KeyStores{dnsserver.DatabaseKeys{DB: db}, configKeys}
+			dnsServer := dnsserver.New(db, keys)
+			dnsServer.AllowTransfer, err = dnsserver.ParseACL(viper.GetStringSlice("allowTransfer"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			go func() {
+				log.Fatal(dnsServer.ListenAndServe(addr))
+			}()
+		}
+		// The secondaries are notified of the changes of their zones whether the DNS server is enabled or not
+		go dnsserver.NewNotifier(db).Run(context.Background())
 		api.Server()
 	},
 }
@@ -39,6 +104,9 @@ to quickly create a Cobra application.`,
 func init() {
 	rootCmd.AddCommand(serverCmd)
 
+	serverCmd.Flags().String("dns-listen", "", "address to answer DNS queries and updates on, e.g. :5353, disabled when empty")
+	_ = viper.BindPFlag("dnsListen", serverCmd.Flags().Lookup("dns-listen"))
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
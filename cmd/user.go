@@ -0,0 +1,106 @@
+/*
+Copyright © 2023 Juliano Martinez <juliano@martinez.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// userCmd represents the user command
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage users straight in the port53 database",
+}
+
+// userCreateKeyCmd represents the user create-key command
+var userCreateKeyCmd = &cobra.Command{
+	Use:   "create-key <name>",
+	Short: "Create an API key for a user",
+	Long: `Create an API key for a user straight in the database of the server,
+creating the user with --email when it doesn't exist.
+
+It is meant to bootstrap the first key on the host of the server, further
+users and keys can then be managed through /v1/users. The key is printed
+once, only its hash is stored.
+
+--role grants the user a role on every zone, use --role admin for the
+first key and for the keys of the agents.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		email, err := cmd.Flags().GetString("email")
+		if err != nil {
+			return err
+		}
+		keyName, err := cmd.Flags().GetString("key-name")
+		if err != nil {
+			return err
+		}
+		role, err := cmd.Flags().GetString("role")
+		if err != nil {
+			return err
+		}
+		db, err := database.Database()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		key, err := createUserKey(db, args[0], email, keyName, role)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), key.Token)
+		return nil
+	},
+}
+
+// createUserKey creates an API key for the user called name, the user is created when email is set and granted
+// role on every zone when role is set
+func createUserKey(db *gorm.DB, name string, email string, keyName string, role string) (key *model.APIKey, err error) {
+	user, err := model.FindUser(db, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if email == "" {
+			return nil, fmt.Errorf("user %s not found, set --email to create it", name)
+		}
+		user = &model.User{Name: name, Email: email}
+		err = db.Create(user).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	if role != "" {
+		err = db.Create(&model.Grant{Role: role, UserID: user.ID}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return user.CreateAPIKey(db, keyName)
+}
+
+func init() {
+	rootCmd.AddCommand(userCmd)
+	userCmd.AddCommand(userCreateKeyCmd)
+
+	userCreateKeyCmd.Flags().String("email", "", "email of the user, creates the user when it doesn't exist")
+	userCreateKeyCmd.Flags().String("key-name", "", "name describing what the key is used for")
+	userCreateKeyCmd.Flags().String("role", "", "role granted to the user on every zone, one of read-only, record-editor, zone-admin or admin")
+}
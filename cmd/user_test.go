@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUser_createUserKey(t *testing.T) {
+	viper.Set("database", "file:cmd_user?mode=memory&cache=shared")
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	defer database.Close()
+
+	_, err = createUserKey(db, "juliano", "", "", "")
+	assert.ErrorContains(t, err, "--email", "unknown users need an email")
+
+	key, err := createUserKey(db, "juliano", "juliano@martinez.io", "bootstrap", model.RoleAdmin)
+	if assert.NoError(t, err) {
+		authenticated, err := model.AuthenticateAPIKey(db, key.Token)
+		assert.NoError(t, err)
+		assert.Equal(t, "juliano", authenticated.User.Name)
+		permissions, err := model.UserPermissions(db, authenticated.User)
+		assert.NoError(t, err)
+		assert.True(t, permissions.IsAdmin())
+	}
+
+	_, err = createUserKey(db, "juliano", "", "", "owner")
+	assert.ErrorIs(t, err, model.ErrInvalidRole)
+
+	// Existing users get another key
+	other, err := createUserKey(db, "juliano", "", "", "")
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, key.Token, other.Token)
+		assert.Equal(t, key.UserID, other.UserID)
+	}
+}
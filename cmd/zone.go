@@ -0,0 +1,199 @@
+/*
+Copyright © 2023 Juliano Martinez <juliano@martinez.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// zoneCmd represents the zone command
+var zoneCmd = &cobra.Command{
+	Use:   "zone",
+	Short: "Manage zones through the port53 API",
+}
+
+// zoneImportCmd represents the zone import command
+var zoneImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a RFC 1035 master file into a zone",
+	Long: `Import a RFC 1035 master file into an existing zone.
+
+The SOA fields of the zone are taken from the file and every record of the
+zone is replaced by the records found in it. With --merge only the RRsets
+present in the file are replaced.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		zoneID, err := cmd.Flags().GetString("zone")
+		if err != nil {
+			return err
+		}
+		merge, err := cmd.Flags().GetBool("merge")
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		zone, err := importZone(viper.GetString("serviceUrl"), zoneID, file, merge)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Imported %d records into %s (serial %d)\n", len(zone.Records), zone.Name, zone.Serial)
+		return nil
+	},
+}
+
+// zoneTransferCmd represents the zone transfer command
+var zoneTransferCmd = &cobra.Command{
+	Use:   "transfer <primary>",
+	Short: "Transfer a zone from a primary server over AXFR",
+	Long: `Transfer an existing zone from a primary server over AXFR.
+
+port53 performs the AXFR of the zone from the primary, given as host or
+host:port, and reconciles the transferred SOA fields and records into the
+zone. The RRsets added, changed and removed are printed. With --tsig-key
+the transfer is signed with the port53 TSIG key of that name. Only
+operators may transfer zones.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		zoneID, err := cmd.Flags().GetString("zone")
+		if err != nil {
+			return err
+		}
+		key, err := cmd.Flags().GetString("tsig-key")
+		if err != nil {
+			return err
+		}
+
+		transfer, err := transferZone(viper.GetString("serviceUrl"), zoneID, args[0], key)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		for _, change := range transfer.Added {
+			fmt.Fprintf(out, "+ %s %d %s %s\n", change.Name, change.TTL, change.Type, strings.Join(change.Contents, ", "))
+		}
+		for _, change := range transfer.Changed {
+			fmt.Fprintf(out, "~ %s %d %s %s\n", change.Name, change.TTL, change.Type, strings.Join(change.Contents, ", "))
+		}
+		for _, change := range transfer.Removed {
+			fmt.Fprintf(out, "- %s %d %s %s\n", change.Name, change.TTL, change.Type, strings.Join(change.Contents, ", "))
+		}
+		fmt.Fprintf(out, "Transferred from %s (serial %d): %d added, %d changed, %d removed\n",
+			transfer.Primary, transfer.Serial, len(transfer.Added), len(transfer.Changed), len(transfer.Removed))
+		return nil
+	},
+}
+
+// importZone sends a master file to the import endpoint of the zone
+func importZone(serviceURL string, zoneID string, body io.Reader, merge bool) (zone *model.Zone, err error) {
+	url := fmt.Sprintf("%s/v1/zones/%s/import", serviceURL, zoneID)
+	if merge {
+		url += "?merge=true"
+	}
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", binder.MIMETextDNS)
+	req.Header.Set("Accept", binder.MIMEApplicationJSONApi)
+	return doZoneRequest(req)
+}
+
+// transferZone asks the API to transfer the zone from primary, signed with the TSIG key named key when set
+func transferZone(serviceURL string, zoneID string, primary string, key string) (transfer *model.ZoneTransfer, err error) {
+	body, err := jsonapi.Marshal(&model.ZoneTransfer{Primary: primary, TSIGKey: key}, jsonapi.MarshalClientMode())
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v1/zones/%s/transfer", serviceURL, zoneID), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", binder.MIMEApplicationJSONApi)
+	req.Header.Set("Accept", binder.MIMEApplicationJSONApi)
+
+	setAPIKey(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, payload)
+	}
+	transfer = &model.ZoneTransfer{}
+	err = jsonapi.Unmarshal(payload, transfer)
+	return transfer, err
+}
+
+// doZoneRequest performs a request against the API and decodes the zone it returns
+func doZoneRequest(req *http.Request) (zone *model.Zone, err error) {
+	setAPIKey(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, payload)
+	}
+	zone = &model.Zone{}
+	err = jsonapi.Unmarshal(payload, zone)
+	return zone, err
+}
+
+// setAPIKey authenticates req with the API key of the configuration, if any
+func setAPIKey(req *http.Request) {
+	if key := viper.GetString("apiKey"); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(zoneCmd)
+	zoneCmd.AddCommand(zoneImportCmd)
+	zoneCmd.AddCommand(zoneTransferCmd)
+
+	zoneCmd.PersistentFlags().String("zone", "", "ID of the zone")
+	_ = zoneCmd.MarkPersistentFlagRequired("zone")
+	zoneImportCmd.Flags().Bool("merge", false, "only replace the RRsets present in the file")
+	zoneTransferCmd.Flags().String("tsig-key", "", "name of the TSIG key signing the transfer")
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZone_importZone(t *testing.T) {
+	tests := []struct {
+		name          string
+		merge         bool
+		status        int
+		response      string
+		expectedQuery string
+		expectedError bool
+	}{
+		{
+			name:     "import zone",
+			status:   http.StatusOK,
+			response: `{"data":{"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX","type":"zones","attributes":{"name":"martinez.io","serial":2023010101}}}`,
+		},
+		{
+			name:          "merge zone",
+			merge:         true,
+			status:        http.StatusOK,
+			response:      `{"data":{"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX","type":"zones","attributes":{"name":"martinez.io","serial":2023010101}}}`,
+			expectedQuery: "merge=true",
+		},
+		{
+			name:          "invalid zone file",
+			status:        http.StatusBadRequest,
+			response:      `{"errors":[{"status":"400","title":"Invalid zone file","detail":"no SOA record found"}]}`,
+			expectedError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/v1/zones/01F1ZQZJXQXZJXZJXZJXZJXZJX/import", r.URL.Path)
+				assert.Equal(t, tt.expectedQuery, r.URL.RawQuery)
+				assert.Equal(t, binder.MIMETextDNS, r.Header.Get("Content-Type"))
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(t, "$TTL 300\n", string(body))
+				w.Header().Set("Content-Type", binder.MIMEApplicationJSONApi)
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			zone, err := importZone(server.URL, "01F1ZQZJXQXZJXZJXZJXZJXZJX", strings.NewReader("$TTL 300\n"), tt.merge)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, "martinez.io", zone.Name)
+				assert.Equal(t, 2023010101, zone.Serial)
+			}
+		})
+	}
+}
+
+func TestZone_transferZone(t *testing.T) {
+	tests := []struct {
+		name          string
+		key           string
+		status        int
+		response      string
+		expectedError bool
+	}{
+		{
+			name:     "transfer zone",
+			status:   http.StatusOK,
+			response: `{"data":{"id":"01F1ZQZJXQXZJXZJXZJXZJXZZZ","type":"zone-transfers","attributes":{"primary":"192.0.2.53:53","serial":2023010101,"added":[{"name":"www.martinez.io","type":"A","ttl":300,"contents":["192.168.0.1"]}],"changed":[],"removed":[]}}}`,
+		},
+		{
+			name:     "transfer signed with a key",
+			key:      "primary-key",
+			status:   http.StatusOK,
+			response: `{"data":{"id":"01F1ZQZJXQXZJXZJXZJXZJXZZZ","type":"zone-transfers","attributes":{"primary":"192.0.2.53:53","tsig_key":"primary-key","serial":2023010101,"added":[{"name":"www.martinez.io","type":"A","ttl":300,"contents":["192.168.0.1"]}],"changed":[],"removed":[]}}}`,
+		},
+		{
+			name:          "failed transfer",
+			status:        http.StatusBadGateway,
+			response:      `{"errors":[{"status":"502","title":"Zone transfer failed","detail":"dns: bad xfr rcode: 5"}]}`,
+			expectedError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/v1/zones/01F1ZQZJXQXZJXZJXZJXZJXZJX/transfer", r.URL.Path)
+				assert.Equal(t, binder.MIMEApplicationJSONApi, r.Header.Get("Content-Type"))
+				body, _ := io.ReadAll(r.Body)
+				var request model.ZoneTransfer
+				if assert.NoError(t, jsonapi.Unmarshal(body, &request)) {
+					assert.Equal(t, "192.0.2.53", request.Primary)
+					assert.Equal(t, tt.key, request.TSIGKey)
+				}
+				w.Header().Set("Content-Type", binder.MIMEApplicationJSONApi)
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			transfer, err := transferZone(server.URL, "01F1ZQZJXQXZJXZJXZJXZJXZJX", "192.0.2.53", tt.key)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, 2023010101, transfer.Serial)
+				if assert.Len(t, transfer.Added, 1) {
+					assert.Equal(t, "www.martinez.io", transfer.Added[0].Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/zonefile"
+	"github.com/spf13/viper"
+)
+
+// Agent reconciles the zones assigned to a backend into the DNS server managed by its driver
+type Agent struct {
+	// Name is the name of the backend the agent registers as
+	Name string
+	// Interval is the time between two reconciliations
+	Interval time.Duration
+	// Logger receives the errors found while reconciling
+	Logger *log.Logger
+	// Config holds the local settings of the drivers, by driver name. The configuration
+	// the server holds for the backend takes precedence over it.
+	Config *viper.Viper
+
+	client   *Client
+	driver   Driver
+	fallback Driver
+	backend  *model.Backend
+	// configured identifies the type and configuration of the backend the driver was built from
+	configured     string
+	configuredOnce bool
+	// reapply forces every zone to be applied again, e.g. after the driver changed
+	reapply bool
+	// keys identifies the TSIG keys last handed to the driver
+	keys string
+	// known holds the zones assigned to the backend on the last reconciliation, by id. Drivers implementing
+	// ZoneLister are asked for the zones they hold as well, known is empty after a restart.
+	known map[string]*model.Zone
+}
+
+// New returns an agent registering as the backend name. Zones are applied through the driver matching
+// the type of the backend on the server, or through driver while the backend has no type.
+func New(name string, client *Client, driver Driver, interval time.Duration) *Agent {
+	return &Agent{
+		Name:     name,
+		Interval: interval,
+		Logger:   log.Default(),
+		Config:   viper.New(),
+		client:   client,
+		driver:   driver,
+		fallback: driver,
+		known:    make(map[string]*model.Zone),
+	}
+}
+
+// Backend returns the backend the agent is registered as, nil before Register is called
+func (a *Agent) Backend() *model.Backend {
+	return a.backend
+}
+
+// Register registers the agent with the server as a backend
+func (a *Agent) Register(ctx context.Context) (err error) {
+	a.backend, err = a.client.Register(ctx, a.Name)
+	return err
+}
+
+// Run registers the agent and reconciles the backend every interval until ctx is done
+func (a *Agent) Run(ctx context.Context) error {
+	if a.Interval <= 0 {
+		return fmt.Errorf("invalid interval %s, it must be positive", a.Interval)
+	}
+	for a.backend == nil {
+		err := a.Register(ctx)
+		if err == nil {
+			break
+		}
+		a.Logger.Printf("unable to register backend %s: %s", a.Name, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(a.Interval):
+		}
+	}
+	a.Logger.Printf("registered as backend %s (%s)", a.backend.Name, a.backend.ID)
+
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	for {
+		if err := a.Reconcile(ctx); err != nil {
+			a.Logger.Printf("reconciliation failed: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile applies every zone whose serial differs from the one last applied, removes the zones
+// no longer assigned to the backend and reports the outcome of each zone back to the server
+func (a *Agent) Reconcile(ctx context.Context) error {
+	if a.backend == nil {
+		return errors.New("agent is not registered")
+	}
+	backend, err := a.client.Backend(ctx, a.backend.ID)
+	if err != nil {
+		return err
+	}
+	err = a.configure(backend)
+	if err != nil {
+		return err
+	}
+	zones, err := a.client.Zones(ctx, backend)
+	if err != nil {
+		return err
+	}
+	statuses, err := a.client.Statuses(ctx, a.backend.ID)
+	if err != nil {
+		return err
+	}
+	applied := make(map[string]*model.BackendZone, len(statuses))
+	for _, status := range statuses {
+		applied[status.ZoneID] = status
+	}
+
+	removed, err := a.removed(ctx, zones)
+	if err != nil {
+		return err
+	}
+	for _, zone := range removed {
+		if err := a.driver.Remove(ctx, zone, zones); err != nil {
+			a.Logger.Printf("unable to remove zone %s: %s", zone.Name, err)
+			continue
+		}
+		a.Logger.Printf("removed zone %s", zone.Name)
+	}
+	a.known = make(map[string]*model.Zone, len(zones))
+	for _, zone := range zones {
+		a.known[zone.ID] = zone
+	}
+
+	if keyDriver, ok := a.driver.(KeyDriver); ok {
+		if err := a.setKeys(ctx, keyDriver, zones); err != nil {
+			return fmt.Errorf("unable to set the TSIG keys: %w", err)
+		}
+	}
+
+	var failed []string
+	reapply := a.reapply
+	a.reapply = false
+	for _, zone := range zones {
+		status, ok := applied[zone.ID]
+		if !ok {
+			status = &model.BackendZone{ZoneID: zone.ID}
+		}
+		if status.AppliedSerial == zone.Serial && status.Error == "" && !reapply {
+			continue
+		}
+		if err := a.apply(ctx, zone, zones, status); err != nil {
+			failed = append(failed, zone.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to apply zones: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// removed returns the zones held by the driver that are no longer assigned to the backend, out of the zones
+// known from the last reconciliation and the zones the driver reports when it implements ZoneLister
+func (a *Agent) removed(ctx context.Context, zones []*model.Zone) ([]*model.Zone, error) {
+	ids := make(map[string]bool, len(zones))
+	names := make(map[string]bool, len(zones))
+	for _, zone := range zones {
+		ids[zone.ID] = true
+		names[zoneKey(zone.Name)] = true
+	}
+	var removed []*model.Zone
+	for id, zone := range a.known {
+		if ids[id] || names[zoneKey(zone.Name)] {
+			continue
+		}
+		names[zoneKey(zone.Name)] = true
+		removed = append(removed, zone)
+	}
+	lister, ok := a.driver.(ZoneLister)
+	if !ok {
+		return removed, nil
+	}
+	loaded, err := lister.Zones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the zones of the driver: %w", err)
+	}
+	sort.Strings(loaded)
+	for _, name := range loaded {
+		if names[zoneKey(name)] {
+			continue
+		}
+		names[zoneKey(name)] = true
+		removed = append(removed, &model.Zone{Name: zonefile.Name(name)})
+	}
+	return removed, nil
+}
+
+// zoneKey identifies a zone by its name, whatever the case and trailing dot
+func zoneKey(name string) string {
+	return dns.CanonicalName(name)
+}
+
+// configure builds the driver matching the type and configuration the server holds for the backend.
+// Backends without a type use the driver the agent was created with.
+func (a *Agent) configure(backend *model.Backend) error {
+	configured := ""
+	if backend.Type != "" {
+		fingerprint, err := json.Marshal(backend.Config)
+		if err != nil {
+			return err
+		}
+		configured = fmt.Sprintf("%s %s", backend.Type, fingerprint)
+	}
+	if a.configuredOnce && configured == a.configured {
+		return nil
+	}
+
+	driver := a.fallback
+	if backend.Type != "" {
+		var err error
+		driver, err = NewDriver(backend.Type, DriverConfig(backend, a.Config.Sub(backend.Type)))
+		if err != nil {
+			return err
+		}
+		a.Logger.Printf("using the %s driver configured on the server", backend.Type)
+	}
+	// Zones applied through a previous driver must be applied again, and the new driver needs the keys
+	a.reapply = a.configuredOnce
+	a.driver, a.configured, a.configuredOnce = driver, configured, true
+	a.keys = ""
+	return nil
+}
+
+// setKeys hands the TSIG keys attached to the backend to the driver whenever they change
+func (a *Agent) setKeys(ctx context.Context, driver KeyDriver, zones []*model.Zone) error {
+	keys, err := a.client.TSIGKeys(ctx, a.backend.ID)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	if string(fingerprint) == a.keys {
+		return nil
+	}
+	err = driver.SetKeys(ctx, keys, zones)
+	if err != nil {
+		return err
+	}
+	a.keys = string(fingerprint)
+	return nil
+}
+
+// DriverConfig returns the driver configuration of the backend, layered on top of the local settings
+func DriverConfig(backend *model.Backend, local *viper.Viper) *viper.Viper {
+	config := viper.New()
+	if local != nil {
+		_ = config.MergeConfigMap(local.AllSettings())
+	}
+	_ = config.MergeConfigMap(backend.Config.Map())
+	return config
+}
+
+// apply loads a single zone through the driver and reports the outcome to the server
+func (a *Agent) apply(ctx context.Context, zone *model.Zone, zones []*model.Zone, status *model.BackendZone) error {
+	report := &model.BackendZone{ZoneID: zone.ID, AppliedSerial: status.AppliedSerial}
+	exported, err := a.client.Export(ctx, zone)
+	if err == nil {
+		err = a.driver.Apply(ctx, exported, zones)
+	}
+	if err != nil {
+		a.Logger.Printf("unable to apply zone %s: %s", zone.Name, err)
+		report.Error = err.Error()
+	} else {
+		a.Logger.Printf("applied zone %s with serial %d", zone.Name, exported.Serial)
+		report.AppliedSerial = exported.Serial
+	}
+	if reportErr := a.client.Report(ctx, a.backend.ID, report); reportErr != nil {
+		return reportErr
+	}
+	return err
+}
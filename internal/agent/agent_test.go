@@ -0,0 +1,250 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ncode/port53/internal/api"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDriver struct {
+	applied map[string]*model.Zone
+	loaded  []string
+	removed []string
+	keys    []*model.TSIGKey
+	keysSet int
+	err     error
+}
+
+func (d *fakeDriver) Apply(ctx context.Context, zone *model.Zone, zones []*model.Zone) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.applied[zone.Name] = zone
+	return nil
+}
+
+func (d *fakeDriver) Remove(ctx context.Context, zone *model.Zone, zones []*model.Zone) error {
+	d.removed = append(d.removed, zone.Name)
+	return nil
+}
+
+func (d *fakeDriver) Zones(ctx context.Context) ([]string, error) {
+	return d.loaded, nil
+}
+
+func (d *fakeDriver) SetKeys(ctx context.Context, keys []*model.TSIGKey, zones []*model.Zone) error {
+	d.keys = keys
+	d.keysSet++
+	return nil
+}
+
+func TestAgent_Reconcile(t *testing.T) {
+	viper.Set("database", "file:agent?mode=memory&cache=shared")
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	defer database.Close()
+	server := httptest.NewServer(api.New(db))
+	defer server.Close()
+	user := model.User{Name: "agent", Email: "agent@martinez.io"}
+	assert.NoError(t, db.Create(&user).Error)
+	// Agents create their backend and read the keys of the backends, which takes the admin role
+	assert.NoError(t, db.Create(&model.Grant{Role: model.RoleAdmin, UserID: user.ID}).Error)
+	apiKey, err := user.CreateAPIKey(db, "agent")
+	assert.NoError(t, err)
+
+	zone := model.Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io"}
+	assert.NoError(t, db.Create(&zone).Error)
+	record := model.Record{Name: "www.martinez.io", Type: "A", Content: "192.168.0.1", ZoneID: zone.ID}
+	assert.NoError(t, record.Create(db))
+
+	driver := &fakeDriver{applied: make(map[string]*model.Zone)}
+	client := NewClient(server.URL)
+	client.APIKey = apiKey.Token
+	a := New("bind", client, driver, time.Second)
+	a.Logger = log.New(io.Discard, "", 0)
+	ctx := context.Background()
+
+	assert.Error(t, a.Reconcile(ctx), "reconcile before register")
+	assert.NoError(t, a.Register(ctx))
+	backend := a.Backend()
+	assert.NotEmpty(t, backend.ID)
+
+	// Registering again returns the same backend
+	other := New("bind", client, driver, time.Second)
+	assert.NoError(t, other.Register(ctx))
+
+	// Requests without the key are rejected
+	unauthenticated := New("bind", NewClient(server.URL), driver, time.Second)
+	assert.ErrorContains(t, unauthenticated.Register(ctx), "401")
+	assert.Equal(t, backend.ID, other.Backend().ID)
+
+	// Nothing is assigned yet
+	assert.NoError(t, a.Reconcile(ctx))
+	assert.Empty(t, driver.applied)
+
+	assert.NoError(t, backend.AddZone(db, &zone))
+	assert.NoError(t, zone.Get(db, false))
+	assert.NoError(t, a.Reconcile(ctx))
+	if assert.Contains(t, driver.applied, "martinez.io") {
+		applied := driver.applied["martinez.io"]
+		assert.Equal(t, zone.ID, applied.ID)
+		assert.Equal(t, zone.Serial, applied.Serial)
+		assert.Equal(t, "ns1.martinez.io", applied.MName)
+		if assert.Len(t, applied.Records, 1) {
+			assert.Equal(t, "192.168.0.1", applied.Records[0].Content)
+		}
+	}
+	statuses, err := backend.Statuses(db)
+	assert.NoError(t, err)
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, zone.Serial, statuses[0].AppliedSerial)
+		assert.Empty(t, statuses[0].Error)
+	}
+
+	// The serial didn't change, nothing is applied
+	delete(driver.applied, "martinez.io")
+	assert.NoError(t, a.Reconcile(ctx))
+	assert.Empty(t, driver.applied)
+
+	// A failure is reported and the previous serial kept
+	second := model.Record{Name: "mail.martinez.io", Type: "A", Content: "192.168.0.2", ZoneID: zone.ID}
+	assert.NoError(t, second.Create(db))
+	previousSerial := zone.Serial
+	assert.NoError(t, zone.Get(db, false))
+	driver.err = errors.New("reload failed")
+	assert.Error(t, a.Reconcile(ctx))
+	statuses, err = backend.Statuses(db)
+	assert.NoError(t, err)
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, previousSerial, statuses[0].AppliedSerial)
+		assert.Equal(t, "reload failed", statuses[0].Error)
+	}
+
+	// The zone is retried until it is applied
+	driver.err = nil
+	assert.NoError(t, a.Reconcile(ctx))
+	if assert.Contains(t, driver.applied, "martinez.io") {
+		assert.Equal(t, zone.Serial, driver.applied["martinez.io"].Serial)
+		assert.Len(t, driver.applied["martinez.io"].Records, 2)
+	}
+	statuses, err = backend.Statuses(db)
+	assert.NoError(t, err)
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, zone.Serial, statuses[0].AppliedSerial)
+		assert.Empty(t, statuses[0].Error)
+	}
+
+	// The TSIG keys attached to the backend are handed to the driver when they change
+	key := model.TSIGKey{Name: "transfer.martinez.io"}
+	assert.NoError(t, db.Create(&key).Error)
+	assert.NoError(t, key.AddBackend(db, backend))
+	keysSet := driver.keysSet
+	assert.NoError(t, a.Reconcile(ctx))
+	if assert.Len(t, driver.keys, 1) {
+		assert.Equal(t, "transfer.martinez.io", driver.keys[0].Name)
+		assert.Equal(t, key.Secret, driver.keys[0].Secret)
+	}
+	assert.NoError(t, a.Reconcile(ctx))
+	assert.Equal(t, keysSet+1, driver.keysSet)
+
+	// Zones no longer assigned are removed
+	assert.NoError(t, backend.RemoveZone(db, &zone))
+	assert.NoError(t, a.Reconcile(ctx))
+	assert.Equal(t, []string{"martinez.io"}, driver.removed)
+
+	// Zones unassigned while the agent wasn't running are removed from what the driver holds
+	restartedDriver := &fakeDriver{applied: make(map[string]*model.Zone), loaded: []string{"stale.martinez.io."}}
+	restarted := New("bind", client, restartedDriver, time.Second)
+	restarted.Logger = log.New(io.Discard, "", 0)
+	assert.NoError(t, restarted.Register(ctx))
+	assert.NoError(t, restarted.Reconcile(ctx))
+	assert.Equal(t, []string{"stale.martinez.io"}, restartedDriver.removed)
+
+	// The interval must be positive
+	assert.ErrorContains(t, New("bind", client, driver, 0).Run(ctx), "interval")
+}
+
+func TestNewDriver(t *testing.T) {
+	RegisterDriver("fake", func(config *viper.Viper) (Driver, error) {
+		return &fakeDriver{}, nil
+	})
+	driver, err := NewDriver("fake", nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &fakeDriver{}, driver)
+	assert.Contains(t, Drivers(), "fake")
+
+	_, err = NewDriver("bogus", nil)
+	assert.Error(t, err)
+	assert.Panics(t, func() {
+		RegisterDriver("fake", nil)
+	})
+}
+
+func TestAgent_Configure(t *testing.T) {
+	viper.Set("database", "file:agent_configure?mode=memory&cache=shared")
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	defer database.Close()
+	server := httptest.NewServer(api.New(db))
+	defer server.Close()
+	user := model.User{Name: "agent", Email: "agent@martinez.io"}
+	assert.NoError(t, db.Create(&user).Error)
+	assert.NoError(t, db.Create(&model.Grant{Role: model.RoleAdmin, UserID: user.ID}).Error)
+	apiKey, err := user.CreateAPIKey(db, "agent")
+	assert.NoError(t, err)
+
+	// The files driver isn't linked in this package, a recording driver stands in for it
+	configured := &fakeDriver{applied: make(map[string]*model.Zone)}
+	var settings map[string]interface{}
+	RegisterDriver(model.BackendFiles, func(config *viper.Viper) (Driver, error) {
+		settings = config.AllSettings()
+		return configured, nil
+	})
+
+	zone := model.Zone{Name: "configure.martinez.io"}
+	assert.NoError(t, db.Create(&zone).Error)
+	fallback := &fakeDriver{applied: make(map[string]*model.Zone)}
+	client := NewClient(server.URL)
+	client.APIKey = apiKey.Token
+	a := New("configure", client, fallback, time.Second)
+	a.Logger = log.New(io.Discard, "", 0)
+	a.Config.Set("files.directory", "/var/lib/local")
+	a.Config.Set("files.mode", "local")
+	ctx := context.Background()
+	assert.NoError(t, a.Register(ctx))
+	backend := a.Backend()
+	assert.NoError(t, backend.AddZone(db, &zone))
+
+	// Without a type the driver given to the agent is used
+	assert.NoError(t, a.Reconcile(ctx))
+	assert.Contains(t, fallback.applied, "configure.martinez.io")
+	assert.Empty(t, configured.applied)
+
+	// Once the server holds a type and config the matching driver is built and every zone applied again
+	assert.NoError(t, backend.Update(db, model.Backend{Type: model.BackendFiles, Config: model.BackendConfig{Directory: "/var/lib/port53"}}))
+	assert.NoError(t, a.Reconcile(ctx))
+	assert.Contains(t, configured.applied, "configure.martinez.io")
+	assert.Equal(t, "/var/lib/port53", settings["directory"])
+	assert.Equal(t, "local", settings["mode"])
+
+	// The driver is kept while the configuration doesn't change
+	settings = nil
+	delete(configured.applied, "configure.martinez.io")
+	assert.NoError(t, a.Reconcile(ctx))
+	assert.Nil(t, settings)
+	assert.Empty(t, configured.applied)
+}
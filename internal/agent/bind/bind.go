@@ -0,0 +1,171 @@
+// Package bind implements an agent driver for BIND. It writes a master file per zone along with
+// a named.conf include holding the zone statements of every zone assigned to the backend,
+// validates them with named-checkzone/named-checkconf when available and reloads them with rndc
+package bind
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ncode/port53/internal/agent"
+	"github.com/ncode/port53/internal/agent/files"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/zonefile"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	agent.RegisterDriver("bind", New)
+}
+
+// Driver manages the zones of a BIND server
+type Driver struct {
+	// Directory holds the master files of the zones
+	Directory string
+	// Include is the path of the named.conf include listing the zones, it must be included from named.conf
+	Include string
+	// ZoneType is the type of the zone statements, primary by default
+	ZoneType string
+	// Rndc, CheckZone and CheckConf are the commands used to reload and validate the configuration,
+	// they may carry arguments, e.g. "rndc -c /etc/bind/rndc.conf"
+	Rndc      string
+	CheckZone string
+	CheckConf string
+	// Keys are the TSIG keys attached to the backend, rendered as key statements in the include
+	Keys []*model.TSIGKey
+}
+
+// New returns a BIND driver configured from the directory, include, zone_type, rndc,
+// named_checkzone and named_checkconf keys of config
+func New(config *viper.Viper) (agent.Driver, error) {
+	config.SetDefault("directory", "/tmp/port53/bind")
+	config.SetDefault("zone_type", "primary")
+	config.SetDefault("rndc", "rndc")
+	config.SetDefault("named_checkzone", "named-checkzone")
+	config.SetDefault("named_checkconf", "named-checkconf")
+	directory := config.GetString("directory")
+	config.SetDefault("include", filepath.Join(directory, "named.conf.port53"))
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, err
+	}
+	return &Driver{
+		Directory: directory,
+		Include:   config.GetString("include"),
+		ZoneType:  config.GetString("zone_type"),
+		Rndc:      config.GetString("rndc"),
+		CheckZone: config.GetString("named_checkzone"),
+		CheckConf: config.GetString("named_checkconf"),
+	}, nil
+}
+
+// Path returns the path of the master file of the zone
+func (d *Driver) Path(zone *model.Zone) string {
+	return filepath.Join(d.Directory, files.FileName(zone))
+}
+
+// Zones returns the names of the zones with a master file in the directory
+func (d *Driver) Zones(ctx context.Context) ([]string, error) {
+	return files.Names(d.Directory)
+}
+
+// Apply writes the master file of the zone, adds it to the include when needed and reloads it
+func (d *Driver) Apply(ctx context.Context, zone *model.Zone, zones []*model.Zone) error {
+	content, err := zonefile.Render(zone)
+	if err != nil {
+		return err
+	}
+	err = agent.Check(ctx, d.Directory, d.CheckZone, content, func(path string) []string {
+		return []string{zonefile.Name(zone.Name), path}
+	})
+	if err != nil {
+		return err
+	}
+	err = agent.WriteFile(d.Path(zone), content, 0o644)
+	if err != nil {
+		return err
+	}
+	changed, err := d.writeInclude(ctx, zones)
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err := agent.Command(ctx, d.Rndc, "reconfig"); err != nil {
+			return err
+		}
+	}
+	return agent.Command(ctx, d.Rndc, "reload", zonefile.Name(zone.Name))
+}
+
+// Remove drops the zone from the include, reconfigures the server and deletes the master file of the zone
+func (d *Driver) Remove(ctx context.Context, zone *model.Zone, zones []*model.Zone) error {
+	changed, err := d.writeInclude(ctx, zones)
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err := agent.Command(ctx, d.Rndc, "reconfig"); err != nil {
+			return err
+		}
+	}
+	err = os.Remove(d.Path(zone))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SetKeys replaces the TSIG keys rendered in the include and reconfigures the server when the include changed
+func (d *Driver) SetKeys(ctx context.Context, keys []*model.TSIGKey, zones []*model.Zone) error {
+	d.Keys = keys
+	changed, err := d.writeInclude(ctx, zones)
+	if err != nil || !changed {
+		return err
+	}
+	return agent.Command(ctx, d.Rndc, "reconfig")
+}
+
+// Config renders the key statements of the TSIG keys and the zone statements of zones
+func (d *Driver) Config(zones []*model.Zone) []byte {
+	sorted := make([]*model.Zone, len(zones))
+	copy(sorted, zones)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	var buf bytes.Buffer
+	buf.WriteString("# Managed by port53, changes will be overwritten\n")
+	for _, key := range d.Keys {
+		fmt.Fprintf(&buf, "key %q {\n\talgorithm %s;\n\tsecret %q;\n};\n", key.Name, key.Algorithm, key.Secret)
+	}
+	for _, zone := range sorted {
+		fmt.Fprintf(&buf, "zone %q {\n\ttype %s;\n\tfile %q;\n};\n", zonefile.Name(zone.Name), d.ZoneType, d.Path(zone))
+	}
+	return buf.Bytes()
+}
+
+// writeInclude renders the include for zones and replaces the current one when they differ
+func (d *Driver) writeInclude(ctx context.Context, zones []*model.Zone) (changed bool, err error) {
+	content := d.Config(zones)
+	current, err := os.ReadFile(d.Include)
+	if err == nil && bytes.Equal(current, content) {
+		return false, nil
+	}
+	err = agent.Check(ctx, d.Directory, d.CheckConf, content, func(path string) []string {
+		return []string{path}
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, agent.WriteFile(d.Include, content, includeMode(d.Keys))
+}
+
+// includeMode returns the permissions of the include, it isn't world readable once it holds secrets
+func includeMode(keys []*model.TSIGKey) os.FileMode {
+	if len(keys) > 0 {
+		return 0o640
+	}
+	return 0o644
+}
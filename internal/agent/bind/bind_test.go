@@ -0,0 +1,162 @@
+package bind
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// stub writes a shell script logging its name and arguments into log and exiting with code
+func stub(t *testing.T, dir string, name string, log string, code int) string {
+	path := filepath.Join(dir, name)
+	script := fmt.Sprintf("#!/bin/sh\necho \"%s $*\" >> %s\nexit %d\n", name, log, code)
+	assert.NoError(t, os.WriteFile(path, []byte(script), 0o755))
+	return path
+}
+
+func testZone(name string, serial int) *model.Zone {
+	return &model.Zone{
+		Name:    name,
+		TTL:     3600,
+		MName:   "ns1." + name,
+		RName:   "hostmaster." + name,
+		Serial:  serial,
+		Records: []*model.Record{{Name: "www." + name, TTL: 300, Type: "A", Content: "192.168.0.1"}},
+	}
+}
+
+func TestDriver(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "commands.log")
+	config := viper.New()
+	config.Set("directory", filepath.Join(dir, "zones"))
+	config.Set("rndc", stub(t, dir, "rndc", log, 0)+" -c rndc.conf")
+	config.Set("named_checkzone", stub(t, dir, "named-checkzone", log, 0))
+	config.Set("named_checkconf", stub(t, dir, "named-checkconf", log, 0))
+	driver, err := New(config)
+	assert.NoError(t, err)
+	bind := driver.(*Driver)
+	ctx := context.Background()
+
+	first := testZone("martinez.io", 1)
+	second := testZone("example.com", 1)
+	commands := func() []string {
+		content, err := os.ReadFile(log)
+		assert.NoError(t, err)
+		assert.NoError(t, os.Remove(log))
+		return strings.Split(strings.TrimSpace(string(content)), "\n")
+	}
+
+	// A new zone is validated, added to the include and loaded
+	assert.NoError(t, driver.Apply(ctx, first, []*model.Zone{first}))
+	calls := commands()
+	if assert.Len(t, calls, 4) {
+		assert.True(t, strings.HasPrefix(calls[0], "named-checkzone martinez.io "))
+		assert.True(t, strings.HasPrefix(calls[1], "named-checkconf "))
+		assert.Equal(t, "rndc -c rndc.conf reconfig", calls[2])
+		assert.Equal(t, "rndc -c rndc.conf reload martinez.io", calls[3])
+	}
+	content, err := os.ReadFile(bind.Path(first))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "www.martinez.io.\t300\tIN\tA\t192.168.0.1")
+
+	// An updated zone is only reloaded
+	first.Serial = 2
+	assert.NoError(t, driver.Apply(ctx, first, []*model.Zone{first}))
+	calls = commands()
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "rndc -c rndc.conf reload martinez.io", calls[1])
+	}
+
+	assert.NoError(t, driver.Apply(ctx, second, []*model.Zone{first, second}))
+	commands()
+	include, err := os.ReadFile(bind.Include)
+	assert.NoError(t, err)
+	expected := fmt.Sprintf("# Managed by port53, changes will be overwritten\n"+
+		"zone \"example.com\" {\n\ttype primary;\n\tfile %q;\n};\n"+
+		"zone \"martinez.io\" {\n\ttype primary;\n\tfile %q;\n};\n", bind.Path(second), bind.Path(first))
+	assert.Equal(t, expected, string(include))
+
+	// Removing a zone reconfigures the server and deletes its file
+	assert.NoError(t, driver.Remove(ctx, second, []*model.Zone{first}))
+	calls = commands()
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "rndc -c rndc.conf reconfig", calls[1])
+	}
+	_, err = os.Stat(bind.Path(second))
+	assert.True(t, os.IsNotExist(err))
+	names, err := bind.Zones(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"martinez.io"}, names)
+	include, err = os.ReadFile(bind.Include)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(include), "example.com")
+
+	// A zone failing validation is neither written nor loaded
+	bind.CheckZone = stub(t, dir, "failing-checkzone", log, 1)
+	invalid := testZone("invalid.io", 1)
+	assert.Error(t, driver.Apply(ctx, invalid, []*model.Zone{first, invalid}))
+	calls = commands()
+	if assert.Len(t, calls, 1) {
+		assert.True(t, strings.HasPrefix(calls[0], "failing-checkzone invalid.io "))
+	}
+	_, err = os.Stat(bind.Path(invalid))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDriver_MissingTools(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "commands.log")
+	config := viper.New()
+	config.Set("directory", dir)
+	config.Set("rndc", stub(t, dir, "rndc", log, 0))
+	config.Set("named_checkzone", filepath.Join(dir, "missing-checkzone"))
+	config.Set("named_checkconf", filepath.Join(dir, "missing-checkconf"))
+	driver, err := New(config)
+	assert.NoError(t, err)
+
+	zone := testZone("martinez.io", 1)
+	assert.NoError(t, driver.Apply(context.Background(), zone, []*model.Zone{zone}))
+	content, err := os.ReadFile(log)
+	assert.NoError(t, err)
+	assert.Equal(t, "rndc reconfig\nrndc reload martinez.io\n", string(content))
+}
+
+func TestDriver_SetKeys(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "commands.log")
+	config := viper.New()
+	config.Set("directory", filepath.Join(dir, "zones"))
+	config.Set("rndc", stub(t, dir, "rndc", log, 0))
+	config.Set("named_checkconf", stub(t, dir, "named-checkconf", log, 0))
+	driver, err := New(config)
+	assert.NoError(t, err)
+	bind := driver.(*Driver)
+	ctx := context.Background()
+
+	zone := testZone("martinez.io", 1)
+	keys := []*model.TSIGKey{{Name: "transfer.martinez.io", Algorithm: "hmac-sha256", Secret: "c2VjcmV0"}}
+	assert.NoError(t, bind.SetKeys(ctx, keys, []*model.Zone{zone}))
+	include, err := os.ReadFile(bind.Include)
+	assert.NoError(t, err)
+	assert.Contains(t, string(include), "key \"transfer.martinez.io\" {\n\talgorithm hmac-sha256;\n\tsecret \"c2VjcmV0\";\n};\n")
+	info, err := os.Stat(bind.Include)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm(), "the include holding secrets isn't world readable")
+	content, err := os.ReadFile(log)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "rndc reconfig")
+
+	// The same keys don't reconfigure the server
+	assert.NoError(t, os.Remove(log))
+	assert.NoError(t, bind.SetKeys(ctx, keys, []*model.Zone{zone}))
+	_, err = os.Stat(log)
+	assert.True(t, os.IsNotExist(err))
+}
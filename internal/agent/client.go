@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/zonefile"
+)
+
+// Client talks to the port53 API on behalf of the agent
+type Client struct {
+	// URL is the base url of the port53 API, e.g. http://localhost:9023
+	URL string
+	// APIKey authenticates the requests of the agent as a bearer token when set
+	APIKey string
+	HTTP   *http.Client
+}
+
+// NewClient returns a client for the port53 API at serviceURL
+func NewClient(serviceURL string) *Client {
+	return &Client{URL: serviceURL, HTTP: http.DefaultClient}
+}
+
+// StatusError is returned when the API answers with an unexpected status code
+type StatusError struct {
+	Code int
+	Body string
+}
+
+// Error implements the error interface
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.Code, e.Body)
+}
+
+// Register returns the backend with the given name, creating it when it doesn't exist yet
+func (c *Client) Register(ctx context.Context, name string) (backend *model.Backend, err error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		var backends []*model.Backend
+		query := url.Values{"filter[name]": []string{name}}
+		err = c.do(ctx, http.MethodGet, "/v1/backends?"+query.Encode(), "", nil, http.StatusOK, &backends)
+		if err != nil {
+			return nil, err
+		}
+		for _, existing := range backends {
+			if existing.Name == name {
+				return existing, nil
+			}
+		}
+
+		payload, err := jsonapi.Marshal(&model.Backend{Name: name}, jsonapi.MarshalClientMode())
+		if err != nil {
+			return nil, err
+		}
+		backend = &model.Backend{}
+		err = c.do(ctx, http.MethodPost, "/v1/backends", binder.MIMEApplicationJSONApi, payload, http.StatusCreated, backend)
+		if err == nil {
+			return backend, nil
+		}
+		// Another agent registered the same name in the meantime, look it up again
+		if statusErr, ok := err.(*StatusError); !ok || statusErr.Code != http.StatusConflict {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("unable to register backend %s", name)
+}
+
+// Backend returns the backend with the given id along with the secrets of its config, its zones only carry their ids
+func (c *Client) Backend(ctx context.Context, backendID string) (backend *model.Backend, err error) {
+	backend = &model.Backend{}
+	err = c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/backends/%s/config", backendID), "", nil, http.StatusOK, backend)
+	return backend, err
+}
+
+// Zones returns the zones assigned to the backend, without their records
+func (c *Client) Zones(ctx context.Context, backend *model.Backend) (zones []*model.Zone, err error) {
+	if len(backend.Zones) == 0 {
+		return []*model.Zone{}, nil
+	}
+	err = c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/backends/%s/zones", backend.ID), "", nil, http.StatusOK, &zones)
+	return zones, err
+}
+
+// Statuses returns the state last reported for every zone assigned to the backend
+func (c *Client) Statuses(ctx context.Context, backendID string) (statuses []*model.BackendZone, err error) {
+	err = c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/backends/%s/status", backendID), "", nil, http.StatusOK, &statuses)
+	return statuses, err
+}
+
+// TSIGKeys returns the TSIG keys attached to the backend, along with their secrets
+func (c *Client) TSIGKeys(ctx context.Context, backendID string) (keys []*model.TSIGKey, err error) {
+	err = c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/backends/%s/tsig-keys", backendID), "", nil, http.StatusOK, &keys)
+	return keys, err
+}
+
+// Report sends the serial applied for a zone and the error found applying it, if any
+func (c *Client) Report(ctx context.Context, backendID string, status *model.BackendZone) (err error) {
+	payload, err := jsonapi.Marshal(status, jsonapi.MarshalClientMode())
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/v1/backends/%s/status/%s", backendID, status.ZoneID)
+	return c.do(ctx, http.MethodPatch, path, binder.MIMEApplicationJSONApi, payload, http.StatusOK, status)
+}
+
+// Export returns the zone along with its records, read from its master file export
+func (c *Client) Export(ctx context.Context, zone *model.Zone) (exported *model.Zone, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v1/zones/%s/export", c.URL, zone.ID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", binder.MIMETextDNS)
+	body, err := c.send(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	exported, err = zonefile.Parse(bytes.NewReader(body), zone.Name)
+	if err != nil {
+		return nil, err
+	}
+	exported.ID = zone.ID
+	exported.Name = zone.Name
+	exported.SerialScheme = zone.SerialScheme
+	return exported, nil
+}
+
+// do performs a JSON:API request and decodes the response into v
+func (c *Client) do(ctx context.Context, method string, path string, contentType string, payload []byte, expected int, v interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", binder.MIMEApplicationJSONApi)
+	data, err := c.send(req, expected)
+	if err != nil {
+		return err
+	}
+	if emptyCollection(data) {
+		return nil
+	}
+	return jsonapi.Unmarshal(data, v)
+}
+
+// emptyCollection reports whether the document holds an empty collection, which jsonapi refuses to unmarshal
+func emptyCollection(data []byte) bool {
+	var document struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return false
+	}
+	return string(bytes.TrimSpace(document.Data)) == "[]"
+}
+
+// send performs the request and returns the body of the response
+func (c *Client) send(req *http.Request, expected int) ([]byte, error) {
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != expected {
+		return nil, &StatusError{Code: resp.StatusCode, Body: string(data)}
+	}
+	return data, nil
+}
@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/viper"
+)
+
+// Driver loads the zones assigned to a backend into the DNS server it manages
+type Driver interface {
+	// Apply loads zone, along with its records, into the DNS server.
+	// zones lists every zone assigned to the backend so drivers can render their global configuration.
+	Apply(ctx context.Context, zone *model.Zone, zones []*model.Zone) error
+	// Remove unloads a zone that is no longer assigned to the backend, zones lists the zones still assigned
+	Remove(ctx context.Context, zone *model.Zone, zones []*model.Zone) error
+}
+
+// KeyDriver is implemented by drivers rendering the TSIG keys attached to the backend into the configuration
+// of their DNS server, e.g. to sign zone transfers and notifies
+type KeyDriver interface {
+	// SetKeys replaces the keys known to the driver, zones lists every zone assigned to the backend
+	SetKeys(ctx context.Context, keys []*model.TSIGKey, zones []*model.Zone) error
+}
+
+// ZoneLister is implemented by drivers able to tell which zones they loaded into their DNS server, so the zones
+// unassigned while the agent wasn't running are removed as well
+type ZoneLister interface {
+	// Zones returns the names of the zones loaded by the driver
+	Zones(ctx context.Context) ([]string, error)
+}
+
+// DriverFactory builds a driver from its configuration
+type DriverFactory func(config *viper.Viper) (Driver, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]DriverFactory)
+)
+
+// RegisterDriver makes a driver available by name, it panics if the name is already taken
+func RegisterDriver(name string, factory DriverFactory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if _, ok := drivers[name]; ok {
+		panic(fmt.Sprintf("agent: driver %s registered twice", name))
+	}
+	drivers[name] = factory
+}
+
+// Drivers returns the sorted names of the registered drivers
+func Drivers() (names []string) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewDriver builds the driver registered under name
+func NewDriver(name string, config *viper.Viper) (Driver, error) {
+	driversMu.RLock()
+	factory, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown driver %q, must be one of %v", name, Drivers())
+	}
+	if config == nil {
+		config = viper.New()
+	}
+	return factory(config)
+}
+
+// WriteFile atomically replaces the file at path with data, it is meant to be used by drivers
+// so the DNS server never reads a partially written file
+func WriteFile(path string, data []byte, perm os.FileMode) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), fmt.Sprintf(".%s.*", filepath.Base(path)))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
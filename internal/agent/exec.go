@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Command runs command, which may carry arguments such as "rndc -c /etc/bind/rndc.conf", appending args to it.
+// The output of the command is returned as part of the error when it fails.
+func Command(ctx context.Context, command string, args ...string) error {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, fields[0], append(fields[1:], args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %s: %s", fields[0], strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Available reports whether the executable of command can be found
+func Available(command string) bool {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false
+	}
+	_, err := exec.LookPath(fields[0])
+	return err == nil
+}
+
+// Check writes content into a temporary file of directory and validates it with command when it is available.
+// args builds the arguments of the command from the path of the temporary file.
+func Check(ctx context.Context, directory string, command string, content []byte, args func(path string) []string) (err error) {
+	if !Available(command) {
+		return nil
+	}
+	tmp, err := os.CreateTemp(directory, ".check.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return Command(ctx, command, args(tmp.Name())...)
+}
@@ -0,0 +1,86 @@
+// Package files implements an agent driver writing every zone as a RFC 1035 master file into a directory,
+// it is meant for DNS servers port53 doesn't manage yet and as a reference for other drivers
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ncode/port53/internal/agent"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/zonefile"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	agent.RegisterDriver("files", New)
+}
+
+// Driver writes master files into Directory
+type Driver struct {
+	Directory string
+}
+
+// New returns a files driver, the directory is read from the directory key of config
+func New(config *viper.Viper) (agent.Driver, error) {
+	config.SetDefault("directory", "/tmp/port53/zones")
+	directory := config.GetString("directory")
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, err
+	}
+	return &Driver{Directory: directory}, nil
+}
+
+// Path returns the path of the master file of the zone
+func (d *Driver) Path(zone *model.Zone) string {
+	return filepath.Join(d.Directory, FileName(zone))
+}
+
+// Apply writes the master file of the zone
+func (d *Driver) Apply(ctx context.Context, zone *model.Zone, zones []*model.Zone) error {
+	content, err := zonefile.Render(zone)
+	if err != nil {
+		return err
+	}
+	return agent.WriteFile(d.Path(zone), content, 0o644)
+}
+
+// Remove deletes the master file of the zone
+func (d *Driver) Remove(ctx context.Context, zone *model.Zone, zones []*model.Zone) error {
+	err := os.Remove(d.Path(zone))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Zones returns the names of the zones with a master file in the directory
+func (d *Driver) Zones(ctx context.Context) ([]string, error) {
+	return Names(d.Directory)
+}
+
+// Names returns the names of the zones with a master file in directory, as named by FileName
+func Names(directory string) (names []string, err error) {
+	paths, err := filepath.Glob(filepath.Join(directory, "*.zone"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".zone")
+		if name == "root" {
+			name = "."
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// FileName returns the name of the master file of the zone
+func FileName(zone *model.Zone) string {
+	if zone.Name == "." || zone.Name == "" {
+		return "root.zone"
+	}
+	return zonefile.Name(zone.Name) + ".zone"
+}
@@ -0,0 +1,46 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriver(t *testing.T) {
+	config := viper.New()
+	config.Set("directory", filepath.Join(t.TempDir(), "zones"))
+	driver, err := New(config)
+	assert.NoError(t, err)
+
+	zone := &model.Zone{
+		Name:    "martinez.io",
+		TTL:     3600,
+		MName:   "ns1.martinez.io",
+		RName:   "hostmaster.martinez.io",
+		Serial:  2,
+		Records: []*model.Record{{Name: "www.martinez.io", TTL: 300, Type: "A", Content: "192.168.0.1"}},
+	}
+	path := filepath.Join(config.GetString("directory"), "martinez.io.zone")
+	ctx := context.Background()
+
+	assert.NoError(t, driver.Apply(ctx, zone, []*model.Zone{zone}))
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "www.martinez.io.\t300\tIN\tA\t192.168.0.1")
+	names, err := driver.(*Driver).Zones(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"martinez.io"}, names)
+
+	assert.NoError(t, driver.Remove(ctx, zone, []*model.Zone{}))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	names, err = driver.(*Driver).Zones(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+	assert.NoError(t, driver.Remove(ctx, zone, []*model.Zone{}), "removing twice")
+}
@@ -0,0 +1,171 @@
+// Package nsd implements an agent driver for NSD. It writes a master file per zone along with an nsd.conf
+// include holding a pattern and the zone entries of every zone assigned to the backend, validates the zones
+// with nsd-checkzone when available and applies changes with nsd-control so NSD never has to restart
+package nsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ncode/port53/internal/agent"
+	"github.com/ncode/port53/internal/agent/files"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/zonefile"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	agent.RegisterDriver("nsd", New)
+}
+
+// Driver manages the zones of a NSD server
+type Driver struct {
+	// Directory holds the master files of the zones
+	Directory string
+	// Include is the path of the nsd.conf include listing the zones, it must be included from nsd.conf
+	Include string
+	// Pattern is the name of the pattern shared by the zones
+	Pattern string
+	// CheckZone and Control are the commands used to validate and load the zones,
+	// they may carry arguments, e.g. "nsd-control -c /etc/nsd/nsd.conf"
+	CheckZone string
+	Control   string
+	// Keys are the TSIG keys attached to the backend, rendered as key clauses in the include
+	Keys []*model.TSIGKey
+}
+
+// New returns a NSD driver configured from the directory, include, pattern, nsd_checkzone and nsd_control keys of config
+func New(config *viper.Viper) (agent.Driver, error) {
+	config.SetDefault("directory", "/tmp/port53/nsd")
+	config.SetDefault("pattern", "port53")
+	config.SetDefault("nsd_checkzone", "nsd-checkzone")
+	config.SetDefault("nsd_control", "nsd-control")
+	directory := config.GetString("directory")
+	config.SetDefault("include", filepath.Join(directory, "nsd.conf.port53"))
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, err
+	}
+	return &Driver{
+		Directory: directory,
+		Include:   config.GetString("include"),
+		Pattern:   config.GetString("pattern"),
+		CheckZone: config.GetString("nsd_checkzone"),
+		Control:   config.GetString("nsd_control"),
+	}, nil
+}
+
+// Path returns the path of the master file of the zone, it matches the zonefile of the pattern
+func (d *Driver) Path(zone *model.Zone) string {
+	return filepath.Join(d.Directory, zonefile.Name(zone.Name)+".zone")
+}
+
+// Zones returns the names of the zones with a master file in the directory
+func (d *Driver) Zones(ctx context.Context) ([]string, error) {
+	return files.Names(d.Directory)
+}
+
+// Apply writes the master file of the zone and adds it to NSD, or reloads it when NSD already serves it
+func (d *Driver) Apply(ctx context.Context, zone *model.Zone, zones []*model.Zone) error {
+	name := zonefile.Name(zone.Name)
+	content, err := zonefile.Render(zone)
+	if err != nil {
+		return err
+	}
+	err = agent.Check(ctx, d.Directory, d.CheckZone, content, func(path string) []string {
+		return []string{name, path}
+	})
+	if err != nil {
+		return err
+	}
+	err = agent.WriteFile(d.Path(zone), content, 0o644)
+	if err != nil {
+		return err
+	}
+	current, _ := os.ReadFile(d.Include)
+	if bytes.Contains(current, entry(name)) {
+		err = agent.Command(ctx, d.Control, "reload", name)
+	} else {
+		err = agent.Command(ctx, d.Control, "addzone", name, d.Pattern)
+		if err != nil && strings.Contains(err.Error(), "already exists") {
+			err = agent.Command(ctx, d.Control, "reload", name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = d.writeInclude(zones)
+	return err
+}
+
+// Remove deletes the zone from NSD, drops it from the include and deletes its master file
+func (d *Driver) Remove(ctx context.Context, zone *model.Zone, zones []*model.Zone) error {
+	err := agent.Command(ctx, d.Control, "delzone", zonefile.Name(zone.Name))
+	if err != nil && !strings.Contains(err.Error(), "not present") {
+		return err
+	}
+	_, err = d.writeInclude(zones)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(d.Path(zone))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SetKeys replaces the TSIG keys rendered in the include and reconfigures NSD when the include changed
+func (d *Driver) SetKeys(ctx context.Context, keys []*model.TSIGKey, zones []*model.Zone) error {
+	d.Keys = keys
+	changed, err := d.writeInclude(zones)
+	if err != nil || !changed {
+		return err
+	}
+	return agent.Command(ctx, d.Control, "reconfig")
+}
+
+// Config renders the key clauses of the TSIG keys, the pattern and the zone entries of zones
+func (d *Driver) Config(zones []*model.Zone) []byte {
+	names := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		names = append(names, zonefile.Name(zone.Name))
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	buf.WriteString("# Managed by port53, changes will be overwritten\n")
+	for _, key := range d.Keys {
+		fmt.Fprintf(&buf, "key:\n\tname: %q\n\talgorithm: %s\n\tsecret: %q\n\n", key.Name, key.Algorithm, key.Secret)
+	}
+	fmt.Fprintf(&buf, "pattern:\n\tname: %q\n\tzonefile: %q\n", d.Pattern, filepath.Join(d.Directory, "%s.zone"))
+	for _, name := range names {
+		buf.WriteString("\n")
+		buf.Write(entry(name))
+		fmt.Fprintf(&buf, "\tinclude-pattern: %q\n", d.Pattern)
+	}
+	return buf.Bytes()
+}
+
+// writeInclude renders the include for zones and replaces the current one when they differ
+func (d *Driver) writeInclude(zones []*model.Zone) (changed bool, err error) {
+	content := d.Config(zones)
+	current, err := os.ReadFile(d.Include)
+	if err == nil && bytes.Equal(current, content) {
+		return false, nil
+	}
+	mode := os.FileMode(0o644)
+	if len(d.Keys) > 0 {
+		// The include holds secrets
+		mode = 0o640
+	}
+	return true, agent.WriteFile(d.Include, content, mode)
+}
+
+// entry returns the beginning of the zone entry in the include
+func entry(name string) []byte {
+	return []byte(fmt.Sprintf("zone:\n\tname: %q\n", name))
+}
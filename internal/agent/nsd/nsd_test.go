@@ -0,0 +1,139 @@
+package nsd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// stub writes a shell script logging its name and arguments into log and exiting with code
+func stub(t *testing.T, dir string, name string, log string, code int) string {
+	path := filepath.Join(dir, name)
+	script := fmt.Sprintf("#!/bin/sh\necho \"%s $*\" >> %s\nexit %d\n", name, log, code)
+	assert.NoError(t, os.WriteFile(path, []byte(script), 0o755))
+	return path
+}
+
+func testZone(name string, serial int) *model.Zone {
+	return &model.Zone{
+		Name:    name,
+		TTL:     3600,
+		MName:   "ns1." + name,
+		RName:   "hostmaster." + name,
+		Serial:  serial,
+		Records: []*model.Record{{Name: "www." + name, TTL: 300, Type: "A", Content: "192.168.0.1"}},
+	}
+}
+
+func TestDriver(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "commands.log")
+	config := viper.New()
+	config.Set("directory", filepath.Join(dir, "zones"))
+	config.Set("nsd_control", stub(t, dir, "nsd-control", log, 0)+" -c nsd.conf")
+	config.Set("nsd_checkzone", stub(t, dir, "nsd-checkzone", log, 0))
+	driver, err := New(config)
+	assert.NoError(t, err)
+	nsd := driver.(*Driver)
+	ctx := context.Background()
+
+	first := testZone("martinez.io", 1)
+	second := testZone("example.com", 1)
+	commands := func() []string {
+		content, err := os.ReadFile(log)
+		assert.NoError(t, err)
+		assert.NoError(t, os.Remove(log))
+		return strings.Split(strings.TrimSpace(string(content)), "\n")
+	}
+
+	// A new zone is validated and added
+	assert.NoError(t, driver.Apply(ctx, first, []*model.Zone{first}))
+	calls := commands()
+	if assert.Len(t, calls, 2) {
+		assert.True(t, strings.HasPrefix(calls[0], "nsd-checkzone martinez.io "))
+		assert.Equal(t, "nsd-control -c nsd.conf addzone martinez.io port53", calls[1])
+	}
+	content, err := os.ReadFile(nsd.Path(first))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "www.martinez.io.\t300\tIN\tA\t192.168.0.1")
+
+	// An updated zone is reloaded
+	first.Serial = 2
+	assert.NoError(t, driver.Apply(ctx, first, []*model.Zone{first}))
+	calls = commands()
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "nsd-control -c nsd.conf reload martinez.io", calls[1])
+	}
+
+	assert.NoError(t, driver.Apply(ctx, second, []*model.Zone{first, second}))
+	commands()
+	include, err := os.ReadFile(nsd.Include)
+	assert.NoError(t, err)
+	expected := fmt.Sprintf("# Managed by port53, changes will be overwritten\n"+
+		"pattern:\n\tname: \"port53\"\n\tzonefile: %q\n"+
+		"\nzone:\n\tname: \"example.com\"\n\tinclude-pattern: \"port53\"\n"+
+		"\nzone:\n\tname: \"martinez.io\"\n\tinclude-pattern: \"port53\"\n", filepath.Join(nsd.Directory, "%s.zone"))
+	assert.Equal(t, expected, string(include))
+
+	// A removed zone is deleted from NSD and the include
+	assert.NoError(t, driver.Remove(ctx, second, []*model.Zone{first}))
+	assert.Equal(t, []string{"nsd-control -c nsd.conf delzone example.com"}, commands())
+	_, err = os.Stat(nsd.Path(second))
+	assert.True(t, os.IsNotExist(err))
+	names, err := nsd.Zones(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"martinez.io"}, names)
+	include, err = os.ReadFile(nsd.Include)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(include), "example.com")
+
+	// A zone failing validation is neither written nor added
+	nsd.CheckZone = stub(t, dir, "failing-checkzone", log, 1)
+	invalid := testZone("invalid.io", 1)
+	assert.Error(t, driver.Apply(ctx, invalid, []*model.Zone{first, invalid}))
+	calls = commands()
+	if assert.Len(t, calls, 1) {
+		assert.True(t, strings.HasPrefix(calls[0], "failing-checkzone invalid.io "))
+	}
+	_, err = os.Stat(nsd.Path(invalid))
+	assert.True(t, os.IsNotExist(err))
+
+	// A failing nsd-control is reported and the include left untouched
+	nsd.CheckZone = filepath.Join(dir, "missing-checkzone")
+	nsd.Control = stub(t, dir, "failing-control", log, 1)
+	assert.Error(t, driver.Apply(ctx, invalid, []*model.Zone{first, invalid}))
+	assert.Equal(t, []string{"failing-control addzone invalid.io port53"}, commands())
+	include, err = os.ReadFile(nsd.Include)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(include), "invalid.io")
+}
+
+func TestDriver_SetKeys(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "commands.log")
+	config := viper.New()
+	config.Set("directory", filepath.Join(dir, "zones"))
+	config.Set("nsd_control", stub(t, dir, "nsd-control", log, 0))
+	driver, err := New(config)
+	assert.NoError(t, err)
+	nsd := driver.(*Driver)
+	ctx := context.Background()
+
+	zone := testZone("martinez.io", 1)
+	keys := []*model.TSIGKey{{Name: "transfer.martinez.io", Algorithm: "hmac-sha256", Secret: "c2VjcmV0"}}
+	assert.NoError(t, nsd.SetKeys(ctx, keys, []*model.Zone{zone}))
+	include, err := os.ReadFile(nsd.Include)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(include), "# Managed by port53, changes will be overwritten\n"+
+		"key:\n\tname: \"transfer.martinez.io\"\n\talgorithm: hmac-sha256\n\tsecret: \"c2VjcmV0\"\n\npattern:\n"))
+	content, err := os.ReadFile(log)
+	assert.NoError(t, err)
+	assert.Equal(t, "nsd-control reconfig\n", string(content))
+}
@@ -0,0 +1,310 @@
+// Package powerdns implements an agent driver for the PowerDNS Authoritative Server. Zones are pushed through
+// its HTTP API, sending only the RRsets that differ from the ones reported by the server
+package powerdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/internal/agent"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/rdata"
+	"github.com/ncode/port53/pkg/zonefile"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	agent.RegisterDriver("powerdns", New)
+}
+
+// Account marks the zones created by the driver, only them are removed once no longer assigned
+const Account = "port53"
+
+// Changetypes of the RRsets sent to PowerDNS
+const (
+	ChangeReplace = "REPLACE"
+	ChangeDelete  = "DELETE"
+)
+
+// Zone is a zone as represented by the PowerDNS API
+type Zone struct {
+	ID          string   `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	Kind        string   `json:"kind,omitempty"`
+	Account     string   `json:"account,omitempty"`
+	Nameservers []string `json:"nameservers"`
+	RRSets      []RRSet  `json:"rrsets"`
+}
+
+// RRSet is a RRset as represented by the PowerDNS API
+type RRSet struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	TTL        int      `json:"ttl,omitempty"`
+	ChangeType string   `json:"changetype,omitempty"`
+	Records    []Record `json:"records"`
+}
+
+// Record is a record of a RRset as represented by the PowerDNS API
+type Record struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+// Driver pushes zones to the PowerDNS API
+type Driver struct {
+	// URL is the base url of the API, e.g. http://127.0.0.1:8081
+	URL string
+	// APIKey is sent in the X-API-Key header
+	APIKey string
+	// ServerID is the id of the server in the API, localhost unless PowerDNS is behind a proxy
+	ServerID string
+	// Kind is the kind of the zones created by the driver, Native by default
+	Kind string
+	HTTP *http.Client
+}
+
+// New returns a PowerDNS driver configured from the api_url, api_key, server_id and kind keys of config
+func New(config *viper.Viper) (agent.Driver, error) {
+	config.SetDefault("api_url", "http://127.0.0.1:8081")
+	config.SetDefault("server_id", "localhost")
+	config.SetDefault("kind", "Native")
+	return &Driver{
+		URL:      strings.TrimSuffix(config.GetString("api_url"), "/"),
+		APIKey:   config.GetString("api_key"),
+		ServerID: config.GetString("server_id"),
+		Kind:     config.GetString("kind"),
+		HTTP:     http.DefaultClient,
+	}, nil
+}
+
+// Apply creates the zone in PowerDNS or patches the RRsets that changed since the last push
+func (d *Driver) Apply(ctx context.Context, zone *model.Zone, zones []*model.Zone) error {
+	desired, err := RRSets(zone)
+	if err != nil {
+		return err
+	}
+	current, err := d.zone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return d.request(ctx, http.MethodPost, d.zonesPath(), &Zone{
+			Name:        dns.Fqdn(zonefile.Name(zone.Name)),
+			Kind:        d.Kind,
+			Account:     Account,
+			Nameservers: []string{},
+			RRSets:      desired,
+		}, http.StatusCreated, nil)
+	}
+	changes := Diff(current.RRSets, desired)
+	if len(changes) == 0 {
+		return nil
+	}
+	return d.request(ctx, http.MethodPatch, d.zonePath(zone), &Zone{RRSets: changes}, http.StatusNoContent, nil)
+}
+
+// Remove deletes the zone from PowerDNS
+func (d *Driver) Remove(ctx context.Context, zone *model.Zone, zones []*model.Zone) error {
+	err := d.request(ctx, http.MethodDelete, d.zonePath(zone), nil, http.StatusNoContent, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Zones returns the names of the zones of PowerDNS created by the driver
+func (d *Driver) Zones(ctx context.Context) (names []string, err error) {
+	var zones []Zone
+	err = d.request(ctx, http.MethodGet, d.zonesPath(), nil, http.StatusOK, &zones)
+	if err != nil {
+		return nil, err
+	}
+	for _, zone := range zones {
+		if zone.Account == Account {
+			names = append(names, zone.Name)
+		}
+	}
+	return names, nil
+}
+
+// RRSets returns the RRsets of the zone, SOA included, in the format of the PowerDNS API
+func RRSets(zone *model.Zone) (rrsets []RRSet, err error) {
+	rrs, err := zonefile.RRs(zone)
+	if err != nil {
+		return nil, err
+	}
+	positions := make(map[string]int)
+	for _, rr := range rrs {
+		header := rr.Header()
+		name := dns.CanonicalName(header.Name)
+		rrtype := dns.TypeToString[header.Rrtype]
+		key := rrsetKey(name, rrtype)
+		pos, ok := positions[key]
+		if !ok {
+			pos = len(rrsets)
+			positions[key] = pos
+			rrsets = append(rrsets, RRSet{Name: name, Type: rrtype, TTL: int(header.Ttl)})
+		}
+		rrsets[pos].Records = append(rrsets[pos].Records, Record{Content: rdata.Content(rr)})
+	}
+	return rrsets, nil
+}
+
+// Diff returns the changes turning the current RRsets into the desired ones.
+// RRsets missing or different in current are replaced and the ones not desired anymore are deleted.
+func Diff(current []RRSet, desired []RRSet) (changes []RRSet) {
+	existing := make(map[string]RRSet, len(current))
+	for _, rrset := range current {
+		existing[rrsetKey(rrset.Name, rrset.Type)] = rrset
+	}
+	wanted := make(map[string]bool, len(desired))
+	for _, rrset := range desired {
+		key := rrsetKey(rrset.Name, rrset.Type)
+		wanted[key] = true
+		if found, ok := existing[key]; ok && equal(found, rrset) {
+			continue
+		}
+		rrset.ChangeType = ChangeReplace
+		changes = append(changes, rrset)
+	}
+	for _, rrset := range current {
+		if wanted[rrsetKey(rrset.Name, rrset.Type)] {
+			continue
+		}
+		changes = append(changes, RRSet{Name: rrset.Name, Type: rrset.Type, ChangeType: ChangeDelete, Records: []Record{}})
+	}
+	return changes
+}
+
+// equal reports whether two RRsets hold the same TTL and records, regardless of their order and formatting
+func equal(a, b RRSet) bool {
+	if a.TTL != b.TTL || len(a.Records) != len(b.Records) {
+		return false
+	}
+	contents := func(rrset RRSet) []string {
+		values := make([]string, 0, len(rrset.Records))
+		for _, record := range rrset.Records {
+			value := canonical(rrset.Type, record.Content)
+			if record.Disabled {
+				value = "disabled " + value
+			}
+			values = append(values, value)
+		}
+		sort.Strings(values)
+		return values
+	}
+	x, y := contents(a), contents(b)
+	for pos := range x {
+		if x[pos] != y[pos] {
+			return false
+		}
+	}
+	return true
+}
+
+// canonical returns the presentation format of content, as port53 renders it
+func canonical(rrtype string, content string) string {
+	rr, err := dns.NewRR(fmt.Sprintf(". 0 IN %s %s", rrtype, content))
+	if err != nil || rr == nil {
+		return content
+	}
+	return rdata.Content(rr)
+}
+
+// rrsetKey identifies a RRset by its name and type
+func rrsetKey(name, rrtype string) string {
+	return fmt.Sprintf("%s/%s", strings.ToLower(dns.CanonicalName(name)), rrtype)
+}
+
+// zone returns the zone as reported by PowerDNS, nil when it doesn't exist
+func (d *Driver) zone(ctx context.Context, zone *model.Zone) (current *Zone, err error) {
+	current = &Zone{}
+	err = d.request(ctx, http.MethodGet, d.zonePath(zone), nil, http.StatusOK, current)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	return current, err
+}
+
+// zonesPath returns the path of the zones collection
+func (d *Driver) zonesPath() string {
+	return fmt.Sprintf("/api/v1/servers/%s/zones", url.PathEscape(d.ServerID))
+}
+
+// zonePath returns the path of the zone
+func (d *Driver) zonePath(zone *model.Zone) string {
+	return fmt.Sprintf("%s/%s", d.zonesPath(), url.PathEscape(dns.Fqdn(zonefile.Name(zone.Name))))
+}
+
+// Error is returned when the PowerDNS API answers with an unexpected status code
+type Error struct {
+	Code    int
+	Message string
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("powerdns: unexpected status %d: %s", e.Code, e.Message)
+}
+
+// isNotFound reports whether err is PowerDNS reporting a missing zone
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && (apiErr.Code == http.StatusNotFound || apiErr.Code == http.StatusUnprocessableEntity)
+}
+
+// request sends payload as JSON to the API and decodes the response into v
+func (d *Driver) request(ctx context.Context, method string, path string, payload interface{}, expected int, v interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, d.URL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if d.APIKey != "" {
+		req.Header.Set("X-API-Key", d.APIKey)
+	}
+	resp, err := d.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != expected {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			message = apiErr.Error
+		}
+		return &Error{Code: resp.StatusCode, Message: message}
+	}
+	if v == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,211 @@
+package powerdns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePowerDNS is an in-memory implementation of the zones endpoints of the PowerDNS API
+type fakePowerDNS struct {
+	mu      sync.Mutex
+	zones   map[string]*Zone
+	patches [][]RRSet
+}
+
+func (f *fakePowerDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("X-API-Key") != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	const prefix = "/api/v1/servers/localhost/zones"
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	zone, ok := f.zones[id]
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		zones := make([]Zone, 0, len(f.zones))
+		for _, zone := range f.zones {
+			zones = append(zones, Zone{ID: zone.ID, Name: zone.Name, Kind: zone.Kind, Account: zone.Account})
+		}
+		_ = json.NewEncoder(w).Encode(zones)
+	case r.Method == http.MethodPost && id == "":
+		var created Zone
+		if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, exists := f.zones[created.Name]; exists {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		created.ID = created.Name
+		f.zones[created.Name] = &created
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(created)
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error": "Could not find domain"}`))
+	case r.Method == http.MethodGet:
+		_ = json.NewEncoder(w).Encode(zone)
+	case r.Method == http.MethodDelete:
+		delete(f.zones, id)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPatch:
+		var patch Zone
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.patches = append(f.patches, patch.RRSets)
+		for _, change := range patch.RRSets {
+			rrsets := make([]RRSet, 0, len(zone.RRSets))
+			for _, rrset := range zone.RRSets {
+				if rrset.Name != change.Name || rrset.Type != change.Type {
+					rrsets = append(rrsets, rrset)
+				}
+			}
+			if change.ChangeType == ChangeReplace {
+				change.ChangeType = ""
+				rrsets = append(rrsets, change)
+			}
+			zone.RRSets = rrsets
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func testZone() *model.Zone {
+	return &model.Zone{
+		Name:   "martinez.io",
+		TTL:    3600,
+		MName:  "ns1.martinez.io",
+		RName:  "hostmaster.martinez.io",
+		Serial: 1,
+		Records: []*model.Record{
+			{Name: "martinez.io", TTL: 3600, Type: "NS", Content: "ns1.martinez.io."},
+			{Name: "www.martinez.io", TTL: 300, Type: "A", Content: "192.168.0.1"},
+			{Name: "www.martinez.io", TTL: 300, Type: "A", Content: "192.168.0.2"},
+			{Name: "martinez.io", TTL: 300, Type: "MX", Content: "10 mail.martinez.io."},
+		},
+	}
+}
+
+func TestDriver(t *testing.T) {
+	fake := &fakePowerDNS{zones: make(map[string]*Zone)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	config := viper.New()
+	config.Set("api_url", server.URL+"/")
+	config.Set("api_key", "secret")
+	driver, err := New(config)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	zone := testZone()
+
+	// The zone is created with every RRset
+	assert.NoError(t, driver.Apply(ctx, zone, []*model.Zone{zone}))
+	if assert.Contains(t, fake.zones, "martinez.io.") {
+		created := fake.zones["martinez.io."]
+		assert.Equal(t, "Native", created.Kind)
+		assert.Len(t, created.RRSets, 4)
+	}
+
+	// Only the zones created by the driver are listed
+	fake.zones["other.io."] = &Zone{ID: "other.io.", Name: "other.io."}
+	names, err := driver.(*Driver).Zones(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"martinez.io."}, names)
+	delete(fake.zones, "other.io.")
+
+	// Nothing changed, nothing is sent
+	assert.NoError(t, driver.Apply(ctx, zone, []*model.Zone{zone}))
+	assert.Empty(t, fake.patches)
+
+	// Only the changed RRsets are sent
+	zone.Serial = 2
+	zone.Records = []*model.Record{
+		{Name: "martinez.io", TTL: 3600, Type: "NS", Content: "ns1.martinez.io."},
+		{Name: "www.martinez.io", TTL: 300, Type: "A", Content: "192.168.0.1"},
+		{Name: "www.martinez.io", TTL: 300, Type: "A", Content: "192.168.0.2"},
+		{Name: "mail.martinez.io", TTL: 300, Type: "A", Content: "192.168.0.3"},
+	}
+	assert.NoError(t, driver.Apply(ctx, zone, []*model.Zone{zone}))
+	if assert.Len(t, fake.patches, 1) {
+		changes := make(map[string]string)
+		for _, change := range fake.patches[0] {
+			changes[change.Name+"/"+change.Type] = change.ChangeType
+		}
+		assert.Equal(t, map[string]string{
+			"martinez.io./SOA":    ChangeReplace,
+			"mail.martinez.io./A": ChangeReplace,
+			"martinez.io./MX":     ChangeDelete,
+		}, changes)
+	}
+	assert.Empty(t, Diff(fake.zones["martinez.io."].RRSets, mustRRSets(t, zone)))
+
+	// Removing the zone deletes it, removing it twice is fine
+	assert.NoError(t, driver.Remove(ctx, zone, []*model.Zone{}))
+	assert.NotContains(t, fake.zones, "martinez.io.")
+	assert.NoError(t, driver.Remove(ctx, zone, []*model.Zone{}))
+
+	// Errors from the API are reported
+	driver.(*Driver).APIKey = "wrong"
+	assert.Error(t, driver.Apply(ctx, zone, []*model.Zone{zone}))
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  []RRSet
+		desired  []RRSet
+		expected []RRSet
+	}{
+		{
+			name:    "Same records in a different order and format",
+			current: []RRSet{{Name: "www.martinez.io.", Type: "MX", TTL: 300, Records: []Record{{Content: "20 mx2.martinez.io."}, {Content: "10  mx1.martinez.io."}}}},
+			desired: []RRSet{{Name: "www.martinez.io.", Type: "MX", TTL: 300, Records: []Record{{Content: "10 mx1.martinez.io."}, {Content: "20 mx2.martinez.io."}}}},
+		},
+		{
+			name:     "Different TTL",
+			current:  []RRSet{{Name: "www.martinez.io.", Type: "A", TTL: 300, Records: []Record{{Content: "192.168.0.1"}}}},
+			desired:  []RRSet{{Name: "www.martinez.io.", Type: "A", TTL: 600, Records: []Record{{Content: "192.168.0.1"}}}},
+			expected: []RRSet{{Name: "www.martinez.io.", Type: "A", TTL: 600, ChangeType: ChangeReplace, Records: []Record{{Content: "192.168.0.1"}}}},
+		},
+		{
+			name:     "Disabled record",
+			current:  []RRSet{{Name: "www.martinez.io.", Type: "A", TTL: 300, Records: []Record{{Content: "192.168.0.1", Disabled: true}}}},
+			desired:  []RRSet{{Name: "www.martinez.io.", Type: "A", TTL: 300, Records: []Record{{Content: "192.168.0.1"}}}},
+			expected: []RRSet{{Name: "www.martinez.io.", Type: "A", TTL: 300, ChangeType: ChangeReplace, Records: []Record{{Content: "192.168.0.1"}}}},
+		},
+		{
+			name:     "Case of the TXT content matters",
+			current:  []RRSet{{Name: "www.martinez.io.", Type: "TXT", TTL: 300, Records: []Record{{Content: `"hello"`}}}},
+			desired:  []RRSet{{Name: "www.martinez.io.", Type: "TXT", TTL: 300, Records: []Record{{Content: `"Hello"`}}}},
+			expected: []RRSet{{Name: "www.martinez.io.", Type: "TXT", TTL: 300, ChangeType: ChangeReplace, Records: []Record{{Content: `"Hello"`}}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Diff(test.current, test.desired))
+		})
+	}
+}
+
+func mustRRSets(t *testing.T, zone *model.Zone) []RRSet {
+	rrsets, err := RRSets(zone)
+	assert.NoError(t, err)
+	return rrsets
+}
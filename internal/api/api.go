@@ -1,6 +1,9 @@
 package api
 
 import (
+	"fmt"
+	"net/http"
+
 	"github.com/DataDog/jsonapi"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -8,11 +11,16 @@ import (
 	"github.com/ncode/port53/pkg/binder"
 	"github.com/ncode/port53/pkg/database"
 	"github.com/spf13/viper"
+	"gorm.io/gorm"
 )
 
 // Server is the main entry point for the API
 func Server() {
-	e := echo.New()
+	db, err := database.Database()
+	if err != nil {
+		log.Fatal(err)
+	}
+	e := New(db)
 
 	switch viper.GetString("logLevel") {
 	case "DEBUG":
@@ -27,28 +35,45 @@ func Server() {
 	case "OFF":
 		e.Logger.SetLevel(log.OFF)
 	}
+	// Pre logs the requests rejected by the authentication too
+	e.Pre(middleware.LoggerWithConfig(middleware.DefaultLoggerConfig))
+
+	e.Logger.Fatal(e.Start(viper.GetString("bindAddr")))
+}
+
+// New returns the echo instance serving the API on top of db, every request is authenticated
+func New(db *gorm.DB) *echo.Echo {
+	e := echo.New()
 	e.Binder = &binder.JsonApiBinder{}
+	e.HTTPErrorHandler = HTTPErrorHandler
 
 	e.Use(middleware.RequestID())
 	e.Use(middleware.Recover())
-	e.Use(middleware.LoggerWithConfig(middleware.DefaultLoggerConfig))
-
-	db, err := database.Database()
-	if err != nil {
-		e.Logger.Fatal(err)
-	}
+	e.Use(Authenticate(db))
 
 	backend := &BackendRoute{db: db}
 	backend.Register(e)
 	zone := &ZoneRoute{db: db}
 	zone.Register(e)
+	record := &RecordRoute{db: db}
+	record.Register(e)
+	tsigKey := &TSIGKeyRoute{db: db}
+	tsigKey.Register(e)
+	user := &UserRoute{db: db}
+	user.Register(e)
+	grant := &GrantRoute{db: db}
+	grant.Register(e)
+	organization := &OrganizationRoute{db: db}
+	organization.Register(e)
 
-	e.Logger.Fatal(e.Start(viper.GetString("bindAddr")))
+	return e
 }
 
-// JSONAPI serializes jsonapi responses and set the proper content type
-func JSONAPI(c echo.Context, code int, data interface{}) error {
-	marshal, err := jsonapi.Marshal(data)
+// JSONAPI serializes jsonapi responses and set the proper content type, the sparse fieldsets of the request
+// are applied to the response
+func JSONAPI(c echo.Context, code int, data interface{}, opts ...jsonapi.MarshalOption) error {
+	opts = append(opts, jsonapi.MarshalFields(c.QueryParams()))
+	marshal, err := jsonapi.Marshal(data, opts...)
 	if err != nil {
 		return err
 	}
@@ -56,10 +81,56 @@ func JSONAPI(c echo.Context, code int, data interface{}) error {
 }
 
 // JSONAPIPaginated serializes jsonapi responses and set the proper content type along with pagination Links
-func JSONAPIPaginated(c echo.Context, code int, data interface{}, link *jsonapi.Link) error {
-	marshal, err := jsonapi.Marshal(data, []jsonapi.MarshalOption{jsonapi.MarshalLinks(link)}...)
+func JSONAPIPaginated(c echo.Context, code int, data interface{}, link *jsonapi.Link, opts ...jsonapi.MarshalOption) error {
+	opts = append(opts, jsonapi.MarshalLinks(link), jsonapi.MarshalFields(c.QueryParams()))
+	marshal, err := jsonapi.Marshal(data, opts...)
 	if err != nil {
 		return err
 	}
 	return c.Blob(code, binder.MIMEApplicationJSONApi, marshal)
 }
+
+// JSONAPIError serializes jsonapi error objects and set the proper content type, errors without status, code
+// or title get the ones of code
+func JSONAPIError(c echo.Context, code int, errs ...*jsonapi.Error) error {
+	for _, e := range errs {
+		if e.Status == nil {
+			e.Status = jsonapi.Status(code)
+		}
+		if e.Code == "" {
+			e.Code = statusCode(code)
+		}
+		if e.Title == "" {
+			e.Title = http.StatusText(code)
+		}
+	}
+	marshal, err := jsonapi.Marshal(errs)
+	if err != nil {
+		return err
+	}
+	return c.Blob(code, binder.MIMEApplicationJSONApi, marshal)
+}
+
+// compound collects the resources included in a compound document, each resource is included once
+type compound struct {
+	seen      map[string]bool
+	resources []interface{}
+}
+
+// add includes resource, id identifies it among the resources of its type
+func (d *compound) add(id string, resource interface{}) {
+	if d.seen == nil {
+		d.seen = make(map[string]bool)
+	}
+	key := fmt.Sprintf("%T/%s", resource, id)
+	if d.seen[key] {
+		return
+	}
+	d.seen[key] = true
+	d.resources = append(d.resources, resource)
+}
+
+// option returns the marshal option including the collected resources
+func (d *compound) option() jsonapi.MarshalOption {
+	return jsonapi.MarshalInclude(d.resources...)
+}
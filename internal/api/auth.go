@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/model"
+	"gorm.io/gorm"
+)
+
+const (
+	// principalKey is the key of the authenticated user in the echo context
+	principalKey = "principal"
+	// permissionsKey is the key of the permissions of the principal in the echo context
+	permissionsKey = "permissions"
+	// loginPath is where users trade their name and password for an API key, the only route open without a key
+	loginPath = "/v1/login"
+)
+
+// Authenticate returns a middleware authenticating the requests with the API key given as an
+// `Authorization: Bearer` token. The user owning the key is set as the principal of the request,
+// requests without a valid key are rejected. Logging in is the only request going through without a key.
+func Authenticate(db *gorm.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Method == http.MethodPost && c.Path() == loginPath {
+				return next(c)
+			}
+			scheme, token, found := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " ")
+			if !found || !strings.EqualFold(scheme, "Bearer") {
+				return unauthorized(c, "An API key is required as a Bearer token")
+			}
+			key, err := model.AuthenticateAPIKey(db, strings.TrimSpace(token))
+			if err != nil {
+				if errors.Is(err, model.ErrInvalidAPIKey) {
+					return unauthorized(c, "Invalid API key")
+				}
+				return err
+			}
+			c.Set(principalKey, key.User)
+			return next(c)
+		}
+	}
+}
+
+// Principal returns the user authenticated for the request, nil when the request went through no authentication
+func Principal(c echo.Context) *model.User {
+	user, _ := c.Get(principalKey).(*model.User)
+	return user
+}
+
+// permissions returns the permissions of the principal of the request, loading them once per request. Requests
+// without a principal are allowed nothing.
+func permissions(c echo.Context, db *gorm.DB) (*model.Permissions, error) {
+	if p, ok := c.Get(permissionsKey).(*model.Permissions); ok {
+		return p, nil
+	}
+	user := Principal(c)
+	if user == nil {
+		p := &model.Permissions{}
+		c.Set(permissionsKey, p)
+		return p, nil
+	}
+	p, err := model.UserPermissions(db, user)
+	if err != nil {
+		return nil, err
+	}
+	c.Set(permissionsKey, p)
+	return p, nil
+}
+
+// forbidden rejects the request with a 403 jsonapi error
+func forbidden(c echo.Context) error {
+	return JSONAPIError(c, http.StatusForbidden, &jsonapi.Error{Title: "Forbidden", Detail: "The grants of the user don't allow this request"})
+}
+
+// unauthorized rejects the request with a 401 jsonapi error
+func unauthorized(c echo.Context, detail string) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+	return JSONAPIError(c, http.StatusUnauthorized, &jsonapi.Error{Title: "Unauthorized", Detail: detail})
+}
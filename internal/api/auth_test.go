@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	user := model.User{Name: "juliano", Email: "juliano@martinez.io"}
+	assert.NoError(t, db.Create(&user).Error)
+	key, err := user.CreateAPIKey(db, "")
+	assert.NoError(t, err)
+
+	var principal *model.User
+	handler := Authenticate(db)(func(c echo.Context) error {
+		principal = Principal(c)
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name               string
+		authorization      string
+		expectedStatusCode int
+	}{
+		{
+			name:               "missing key",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "basic authentication",
+			authorization:      "Basic anVsaWFubzpzZWNyZXQ=",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "invalid key",
+			authorization:      "Bearer p53_invalid",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "valid key",
+			authorization:      "Bearer " + key.Token,
+			expectedStatusCode: http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal = nil
+			req := httptest.NewRequest(http.MethodGet, "/v1/zones", nil)
+			if test.authorization != "" {
+				req.Header.Set(echo.HeaderAuthorization, test.authorization)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			assert.NoError(t, handler(c))
+			assert.Equal(t, test.expectedStatusCode, rec.Code)
+			if test.expectedStatusCode != http.StatusUnauthorized {
+				if assert.NotNil(t, principal) {
+					assert.Equal(t, user.ID, principal.ID)
+				}
+				return
+			}
+			assert.Nil(t, principal)
+			assert.Equal(t, "Bearer", rec.Header().Get(echo.HeaderWWWAuthenticate))
+			assert.Equal(t, binder.MIMEApplicationJSONApi, rec.Header().Get(echo.HeaderContentType))
+			var document struct {
+				Errors []struct {
+					Status string `json:"status"`
+				} `json:"errors"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+			if assert.Len(t, document.Errors, 1) {
+				assert.Equal(t, "401", document.Errors[0].Status)
+			}
+		})
+	}
+}
+
+func TestNew_FailsClosed(t *testing.T) {
+	defer TearDown()
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	zone := model.Zone{Name: "martinez.io"}
+	assert.NoError(t, db.Create(&zone).Error)
+
+	// Every route of the API authenticates its requests
+	e := New(db)
+	for _, target := range []string{"/v1/zones", "/v1/backends/01F1ZQZJXQXZJXZJXZJXZJXZJX/config", "/v1/users"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, target)
+	}
+
+	// Requests authenticated with the key of an operator are allowed everything
+	req := httptest.NewRequest(http.MethodGet, "/v1/zones/"+zone.ID, nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+operatorKey(t, db))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Handlers reached without a principal are allowed nothing
+	route := &ZoneRoute{db: db}
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodDelete, "/v1/zones/:id", nil), httptest.NewRecorder())
+	perms, err := permissions(c, db)
+	assert.NoError(t, err)
+	if assert.NotNil(t, perms) {
+		assert.False(t, perms.IsAdmin())
+		assert.False(t, perms.CanRead(zone.ID))
+	}
+	rec = httptest.NewRecorder()
+	c = echo.New().NewContext(httptest.NewRequest(http.MethodDelete, "/v1/zones/:id", nil), rec)
+	c.SetParamNames("id")
+	c.SetParamValues(zone.ID)
+	assert.NoError(t, route.Delete(c))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NoError(t, zone.Get(db, false))
+}
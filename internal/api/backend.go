@@ -2,11 +2,13 @@ package api
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 
+	"github.com/DataDog/jsonapi"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
 
@@ -18,114 +20,244 @@ type BackendRoute struct {
 	db *gorm.DB
 }
 
+// backendSorting maps the fields backends may be sorted by to their columns
+var backendSorting = map[string]string{
+	"name":       "name",
+	"type":       "type",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// backendFilters maps the fields backends may be filtered by to their columns
+var backendFilters = map[string]filterField{
+	"name":       textFilter("name"),
+	"type":       textFilter("type"),
+	"created_at": timeFilter("created_at"),
+	"updated_at": timeFilter("updated_at"),
+}
+
 // Create creates a new backend
 func (r *BackendRoute) Create(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
 	var backend model.Backend
 	if err := c.Bind(&backend); err != nil {
 		return err
 	}
 	if backend.Name == "" {
-		return c.String(http.StatusBadRequest, "Name is required")
+		return JSONAPIError(c, http.StatusBadRequest, required("Name", "/data/attributes/name"))
 	}
+	backend.OrganizationID = tenant(c)
 	err = r.db.Create(&backend).Error
 	if err != nil {
+		var configErr *model.ConfigError
+		if errors.As(err, &configErr) {
+			return JSONAPIError(c, http.StatusBadRequest, backendConfigError(configErr))
+		}
 		if err.Error() == "UNIQUE constraint failed: backends.name" {
 			var existingBackend model.Backend
 			err = r.db.First(&existingBackend, "name = ?", backend.Name).Error
 			if err != nil {
 				return err
 			}
+			// The names of backends are unique across organizations, the backends of others aren't disclosed
+			if !backendVisible(c, &existingBackend) {
+				return JSONAPIError(c, http.StatusConflict, alreadyExists("Backend"))
+			}
 			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/backends/%s", viper.GetString("serviceUrl"), existingBackend.ID))
-			return c.String(http.StatusConflict, "Backend already exists")
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("Backend"))
 		} else if err.Error() == "UNIQUE constraint failed: backends.id" {
 			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/backends/%s", viper.GetString("serviceUrl"), backend.ID))
-			return c.String(http.StatusConflict, "Backend already exists")
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("Backend"))
 		}
-		return c.String(http.StatusInternalServerError, err.Error())
+		return err
 	}
+	redactBackends(c, &backend)
 	return JSONAPI(c, http.StatusCreated, backend)
 }
 
-// List lists all backends
+// List lists all backends, their zones are only loaded when included
 func (r *BackendRoute) List(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.CanRead("") {
+		return forbidden(c)
+	}
 	var backends []model.Backend
 	query, err := ParseQuery(c)
 	if err != nil {
-		return c.String(http.StatusBadRequest, "invalid query parameters")
+		return JSONAPIError(c, http.StatusBadRequest, invalidQuery(err))
+	}
+	sorting, jsonErr := query.Sorting(backendSorting)
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+	filtering, jsonErr := query.Filtering(backendFilters)
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+	included, jsonErr := query.Included("zones")
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
 	}
 
-	p := &pagination{Number: 0, Size: 10}
-	if query.Page != nil {
-		p = &pagination{Number: query.Page.Number, Size: query.Page.Size}
+	p, jsonErr := query.Pagination()
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
 	}
 
-	if len(query.Filters) > 0 {
-		tx := r.db
-		for filter, content := range query.Filters {
-			for _, c := range content {
-				var f string
-				switch filter {
-				case "name":
-					f = "name = ?"
-				}
-				tx = tx.Where(f, c)
-			}
-		}
-		err = tx.Scopes(paginate(backends, p, tx)).Preload("Zones").Find(&backends).Error
-	} else {
-		err = r.db.Scopes(paginate(backends, p, r.db)).Preload("Zones").Find(&backends).Error
+	db := r.db
+	if organizationID := tenant(c); organizationID != "" {
+		db = db.Where("organization_id IN ?", []string{organizationID, ""})
 	}
+	if included["zones"] {
+		db = db.Preload("Zones")
+	}
+	tx := db.Scopes(filtering)
+	err = tx.Scopes(paginate(backends, p, tx), sorting).Find(&backends).Error
 	if err != nil {
 		return err
 	}
+	p.Window(&backends)
 
+	var document compound
 	for pos, backend := range backends {
-		if len(backend.Zones) == 0 {
+		backends[pos].Zones = visibleZones(c, backend.Zones)
+		if len(backends[pos].Zones) == 0 {
 			backends[pos].Zones = nil
 		}
+		redactBackends(c, &backends[pos])
+		includeBackend(&document, &backends[pos], included)
 	}
 
-	p.SetLinks(fmt.Sprintf("/v1/backends?%s", query.BuildQuery()))
+	p.SetLinks(query.Link("/v1/backends"))
 	if len(backends) == 0 {
 		return JSONAPI(c, http.StatusOK, backends)
 	}
-	return JSONAPIPaginated(c, http.StatusOK, backends, p.Link())
+	return JSONAPIPaginated(c, http.StatusOK, backends, p.Link(), p.Meta(), document.option())
+}
+
+// includeBackend includes the zones of backend in document when included asks for them
+func includeBackend(document *compound, backend *model.Backend, included map[string]bool) {
+	if included["zones"] {
+		for _, zone := range backend.Zones {
+			document.add(zone.ID, zone)
+		}
+	}
 }
 
 // Update updates a backend
 func (r *BackendRoute) Update(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
 	backend := &model.Backend{ID: c.Param("id")}
 	err = backend.Get(r.db, false)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Backend not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
 		}
 		return err
 	}
+	if !backendVisible(c, backend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	// Shared backends are seen by every organization but only managed by the operators
+	if !reaches(c, backend.OrganizationID) {
+		return forbidden(c)
+	}
 	newBackend := model.Backend{}
 	if err := c.Bind(&newBackend); err != nil {
 		return err
 	}
-	if newBackend.Name == "" {
-		return c.String(http.StatusBadRequest, "Name is required")
+	if newBackend.Name == "" && newBackend.Type == "" && newBackend.Config.IsZero() {
+		return JSONAPIError(c, http.StatusBadRequest, required("Name", "/data/attributes/name"))
 	}
 	err = backend.Update(r.db, newBackend)
 	if err != nil {
+		var configErr *model.ConfigError
+		if errors.As(err, &configErr) {
+			return JSONAPIError(c, http.StatusBadRequest, backendConfigError(configErr))
+		}
 		return err
 	}
+	redactBackends(c, backend)
 	return JSONAPI(c, http.StatusOK, backend)
 }
 
-// Get gets a backend
+// Get gets a backend, the secrets of its config aside
 func (r *BackendRoute) Get(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.CanRead("") {
+		return forbidden(c)
+	}
+	query, err := ParseQuery(c)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, invalidQuery(err))
+	}
+	included, jsonErr := query.Included("zones")
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
 	backend := &model.Backend{ID: c.Param("id")}
 	err = backend.Get(r.db, true)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Backend not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
 		}
 		return err
 	}
+	if !backendVisible(c, backend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	backend.Zones = visibleZones(c, backend.Zones)
+	if len(backend.Zones) == 0 {
+		backend.Zones = nil
+	}
+	redactBackends(c, backend)
+	var document compound
+	includeBackend(&document, backend, included)
+	return JSONAPI(c, http.StatusOK, backend, document.option())
+}
+
+// GetConfig gets a backend along with the secrets of its config, it is meant for the agent of the backend
+// to configure its driver
+func (r *BackendRoute) GetConfig(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	backend := &model.Backend{ID: c.Param("id")}
+	err = backend.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+		}
+		return err
+	}
+	if !backendVisible(c, backend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	if !reaches(c, backend.OrganizationID) {
+		return forbidden(c)
+	}
 	if len(backend.Zones) == 0 {
 		backend.Zones = nil
 	}
@@ -134,7 +266,27 @@ func (r *BackendRoute) Get(c echo.Context) (err error) {
 
 // Delete deletes a backend
 func (r *BackendRoute) Delete(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
 	backend := &model.Backend{ID: c.Param("id")}
+	err = backend.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return c.NoContent(http.StatusNoContent)
+		}
+		return err
+	}
+	if !backendVisible(c, backend) {
+		return c.NoContent(http.StatusNoContent)
+	}
+	if !reaches(c, backend.OrganizationID) {
+		return forbidden(c)
+	}
 	err = backend.Delete(r.db)
 	if err != nil && err.Error() != "record not found" {
 		return err
@@ -144,50 +296,80 @@ func (r *BackendRoute) Delete(c echo.Context) (err error) {
 
 // GetZones gets all zones for a backend
 func (r *BackendRoute) GetZones(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.CanRead("") {
+		return forbidden(c)
+	}
 	backend := &model.Backend{ID: c.Param("id")}
 	err = backend.Get(r.db, true)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Backend not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
 		}
 		return err
 	}
+	if !backendVisible(c, backend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	backend.Zones = visibleZones(c, backend.Zones)
 	if len(backend.Zones) == 0 {
-		return c.String(http.StatusNotFound, "Backend doesn't have any zones")
+		return JSONAPIError(c, http.StatusNotFound, &jsonapi.Error{Detail: "Backend doesn't have any zones"})
 	}
 	return JSONAPI(c, http.StatusOK, backend.Zones)
 }
 
 // AddZone adds a zone to a backend
 func (r *BackendRoute) AddZone(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
 	backend := &model.Backend{ID: c.Param("id")}
 	err = backend.Get(r.db, false)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Backend not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
 		}
 		return err
 	}
+	if !backendVisible(c, backend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	if !reaches(c, backend.OrganizationID) {
+		return forbidden(c)
+	}
 	var zone model.Zone
 	if err := c.Bind(&zone); err != nil {
 		if strings.Contains(err.Error(), "body is not a json:api representation") {
-			return c.String(http.StatusBadRequest, "Zone ID is required")
+			return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
 		}
 		return err
 	}
 	if zone.ID == "" {
-		return c.String(http.StatusBadRequest, "Zone ID is required")
+		return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
 	}
 	existingZone := model.Zone{ID: zone.ID}
 	err = existingZone.Get(r.db, false)
 	if err != nil && err.Error() == "record not found" {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Zone not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
 		}
 		return err
 	}
+	if !reaches(c, existingZone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
 	err = backend.AddZone(r.db, &existingZone)
 	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
 		return err
 	}
 	return JSONAPI(c, http.StatusOK, existingZone)
@@ -195,23 +377,36 @@ func (r *BackendRoute) AddZone(c echo.Context) (err error) {
 
 // RemoveZone removes a zone from a backend
 func (r *BackendRoute) RemoveZone(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
 	backend := &model.Backend{ID: c.Param("id")}
 	err = backend.Get(r.db, false)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Backend not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
 		}
 		return err
 	}
+	if !backendVisible(c, backend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	if !reaches(c, backend.OrganizationID) {
+		return forbidden(c)
+	}
 	var zone model.Zone
 	if err := c.Bind(&zone); err != nil {
 		if strings.Contains(err.Error(), "body is not a json:api representation") {
-			return c.String(http.StatusBadRequest, "Zone ID is required")
+			return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
 		}
 		return err
 	}
 	if zone.ID == "" {
-		return c.String(http.StatusBadRequest, "Zone ID is required")
+		return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
 	}
 	err = backend.RemoveZone(r.db, &zone)
 	if err != nil {
@@ -222,21 +417,34 @@ func (r *BackendRoute) RemoveZone(c echo.Context) (err error) {
 		return err
 	}
 	if len(backend.Zones) == 0 {
-		return c.String(http.StatusNoContent, "Backend doesn't have any zones")
+		return c.NoContent(http.StatusNoContent)
 	}
 	return JSONAPI(c, http.StatusOK, backend.Zones)
 }
 
 // UpdateZones updates zones for a backend
 func (r *BackendRoute) UpdateZones(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
 	backend := &model.Backend{ID: c.Param("id")}
 	err = backend.Get(r.db, true)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Backend not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
 		}
 		return err
 	}
+	if !backendVisible(c, backend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	if !reaches(c, backend.OrganizationID) {
+		return forbidden(c)
+	}
 	var zones []model.Zone
 	if err := c.Bind(&zones); err != nil {
 		if strings.Contains(err.Error(), "body is not a json:api representation") {
@@ -247,7 +455,7 @@ func (r *BackendRoute) UpdateZones(c echo.Context) (err error) {
 					if err != nil {
 						return err
 					}
-					return c.String(http.StatusNoContent, "Removed all zones from backend")
+					return c.NoContent(http.StatusNoContent)
 				}
 			}
 		}
@@ -257,7 +465,7 @@ func (r *BackendRoute) UpdateZones(c echo.Context) (err error) {
 	for _, zone := range zones {
 		ids = append(ids, zone.ID)
 		if zone.ID == "" {
-			return c.String(http.StatusBadRequest, "Zone ID is required")
+			return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
 		}
 	}
 	existingZones := make([]*model.Zone, 0)
@@ -266,15 +474,291 @@ func (r *BackendRoute) UpdateZones(c echo.Context) (err error) {
 		return err
 	}
 	if len(existingZones) == 0 || len(existingZones) != len(zones) {
-		return c.String(http.StatusNotFound, "All zones must exist")
+		return JSONAPIError(c, http.StatusNotFound, missingResources("zones"))
+	}
+	if len(visibleZones(c, existingZones)) != len(existingZones) {
+		return JSONAPIError(c, http.StatusNotFound, missingResources("zones"))
 	}
 	err = backend.ReplaceZones(r.db, existingZones)
 	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
 		return err
 	}
 	return JSONAPI(c, http.StatusOK, existingZones)
 }
 
+// GetZonesRelationship gets the linkage of the zones of a backend
+func (r *BackendRoute) GetZonesRelationship(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.CanRead("") {
+		return forbidden(c)
+	}
+	backend := &model.Backend{ID: c.Param("id")}
+	err = backend.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+		}
+		return err
+	}
+	if !backendVisible(c, backend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	return JSONAPILinkage(c, http.StatusOK, backend.LinkRelation("zones"), zoneIdentifiers(visibleZones(c, backend.Zones)))
+}
+
+// AddZonesRelationship adds the zones of the linkage to a backend, zones the backend already serves are kept
+func (r *BackendRoute) AddZonesRelationship(c echo.Context) (err error) {
+	backend, zones, err := r.linkedZones(c)
+	if backend == nil {
+		return err
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		for _, zone := range zones {
+			err := backend.AddZone(tx, zone)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateZonesRelationship replaces the zones of a backend with the ones of the linkage, an empty linkage
+// removes every zone
+func (r *BackendRoute) UpdateZonesRelationship(c echo.Context) (err error) {
+	backend, zones, err := r.linkedZones(c)
+	if backend == nil {
+		return err
+	}
+	err = backend.ReplaceZones(r.db, zones)
+	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RemoveZonesRelationship removes the zones of the linkage from a backend, zones it doesn't serve are ignored
+func (r *BackendRoute) RemoveZonesRelationship(c echo.Context) (err error) {
+	backend, zones, err := r.linkedZones(c)
+	if backend == nil {
+		return err
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		for _, zone := range zones {
+			err := backend.RemoveZone(tx, zone)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// linkedZones loads the backend of a request changing its zones and the zones of the linkage of the request.
+// The backend is nil when the request was already answered, err is then the one of writing the response.
+func (r *BackendRoute) linkedZones(c echo.Context) (backend *model.Backend, zones []*model.Zone, err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !perms.IsAdmin() {
+		return nil, nil, forbidden(c)
+	}
+	backend = &model.Backend{ID: c.Param("id")}
+	err = backend.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return nil, nil, JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+		}
+		return nil, nil, err
+	}
+	if !backendVisible(c, backend) {
+		return nil, nil, JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	if !reaches(c, backend.OrganizationID) {
+		return nil, nil, forbidden(c)
+	}
+	ids, jsonErr := toManyLinkage(c, "zones")
+	if jsonErr != nil {
+		return nil, nil, JSONAPIError(c, *jsonErr.Status, jsonErr)
+	}
+	zones, found, err := findZones(c, r.db, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, JSONAPIError(c, http.StatusNotFound, missingResources("zones"))
+	}
+	return backend, zones, nil
+}
+
+// GetStatus gets the state reported by the agent for every zone of a backend
+func (r *BackendRoute) GetStatus(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.CanRead("") {
+		return forbidden(c)
+	}
+	backend := &model.Backend{ID: c.Param("id")}
+	err = backend.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+		}
+		return err
+	}
+	if !backendVisible(c, backend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	statuses, err := backend.Statuses(r.db)
+	if err != nil {
+		return err
+	}
+	// Shared backends serve the zones of many organizations, only the statuses of the zones of the principal are shown
+	if organizationID := tenant(c); organizationID != "" {
+		var zoneIDs []string
+		err = r.db.Model(&model.Zone{}).Where("organization_id = ?", organizationID).Pluck("id", &zoneIDs).Error
+		if err != nil {
+			return err
+		}
+		owned := make(map[string]bool, len(zoneIDs))
+		for _, id := range zoneIDs {
+			owned[id] = true
+		}
+		visible := make([]*model.BackendZone, 0, len(statuses))
+		for _, status := range statuses {
+			if owned[status.ZoneID] {
+				visible = append(visible, status)
+			}
+		}
+		statuses = visible
+	}
+	return JSONAPI(c, http.StatusOK, statuses)
+}
+
+// ReportStatus stores the serial applied by the agent of a backend for a zone and the error it found, if any
+func (r *BackendRoute) ReportStatus(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	backend := &model.Backend{ID: c.Param("id")}
+	err = backend.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+		}
+		return err
+	}
+	if !backendVisible(c, backend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	if !reaches(c, backend.OrganizationID) {
+		return forbidden(c)
+	}
+	var status model.BackendZone
+	if err := c.Bind(&status); err != nil {
+		return err
+	}
+	status.ZoneID = c.Param("zone_id")
+	err = backend.ReportStatus(r.db, &status)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, &jsonapi.Error{Detail: "Zone not assigned to the backend"})
+		}
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, status)
+}
+
+// GetTSIGKeys gets the keys attached to a backend along with their secrets, it is meant for the agent of the
+// backend to render the keys into the configuration of its DNS server
+func (r *BackendRoute) GetTSIGKeys(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	backend := &model.Backend{ID: c.Param("id")}
+	err = backend.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+		}
+		return err
+	}
+	if !backendVisible(c, backend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	if !reaches(c, backend.OrganizationID) {
+		return forbidden(c)
+	}
+	keys, err := backend.TSIGKeys(r.db)
+	if err != nil {
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, keys)
+}
+
+// redactBackends clears the secrets held in the config of backends, the agents read them from /v1/backends/:id/config.
+// Tenants only see the id, name and type of the shared backends, along with their own zones served by them.
+func redactBackends(c echo.Context, backends ...*model.Backend) {
+	shared := tenant(c) != ""
+	for _, backend := range backends {
+		backend.Config.APIKey = ""
+		if shared && backend.OrganizationID == "" {
+			*backend = model.Backend{
+				ID:     backend.ID,
+				Name:   backend.Name,
+				Type:   backend.Type,
+				Zones:  backend.Zones,
+				Status: backend.Status,
+			}
+		}
+	}
+}
+
+// backendVisible reports whether the principal may see the backend, shared backends are seen by every organization
+func backendVisible(c echo.Context, backend *model.Backend) bool {
+	return backend.OrganizationID == "" || reaches(c, backend.OrganizationID)
+}
+
+// backendConfigError converts an invalid backend type or configuration into a jsonapi error pointing at the offending attribute
+func backendConfigError(err *model.ConfigError) *jsonapi.Error {
+	return &jsonapi.Error{
+		Title:  "Invalid backend " + err.Field,
+		Detail: err.Reason,
+		Source: &jsonapi.ErrorSource{Pointer: "/data/attributes/" + err.Field},
+	}
+}
+
 // Register registers the routes for the backend
 func (r *BackendRoute) Register(e *echo.Echo) {
 	e.GET("/v1/backends/:id", r.Get)
@@ -287,4 +771,13 @@ func (r *BackendRoute) Register(e *echo.Echo) {
 	e.POST("/v1/backends/:id/zones", r.AddZone)
 	e.PATCH("/v1/backends/:id/zones", r.UpdateZones)
 	e.DELETE("/v1/backends/:id/zones", r.RemoveZone)
+	e.GET("/v1/backends/:id/relationships/zones", r.GetZonesRelationship)
+	e.POST("/v1/backends/:id/relationships/zones", r.AddZonesRelationship)
+	e.PATCH("/v1/backends/:id/relationships/zones", r.UpdateZonesRelationship)
+	e.DELETE("/v1/backends/:id/relationships/zones", r.RemoveZonesRelationship)
+	// Agent status
+	e.GET("/v1/backends/:id/status", r.GetStatus)
+	e.PATCH("/v1/backends/:id/status/:zone_id", r.ReportStatus)
+	e.GET("/v1/backends/:id/tsig-keys", r.GetTSIGKeys)
+	e.GET("/v1/backends/:id/config", r.GetConfig)
 }
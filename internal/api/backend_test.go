@@ -1,8 +1,10 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/DataDog/jsonapi"
@@ -691,3 +693,229 @@ func TestBackendRoute_RemoveZone(t *testing.T) {
 		})
 	}
 }
+
+func TestBackendRoute_Status(t *testing.T) {
+	defer TearDown()
+
+	tests := []struct {
+		name                  string
+		zoneID                string
+		payload               string
+		expectedStatusCode    int
+		expectedAppliedSerial int
+		expectedError         string
+	}{
+		{
+			name:                  "applied serial",
+			zoneID:                "01F1ZQZJXQXZJXZJXZJXZJZONE",
+			payload:               `{"data": {"type": "backend-zones", "attributes": {"applied_serial": 2}}}`,
+			expectedStatusCode:    http.StatusOK,
+			expectedAppliedSerial: 2,
+		},
+		{
+			name:                  "error applying",
+			zoneID:                "01F1ZQZJXQXZJXZJXZJXZJZONE",
+			payload:               `{"data": {"type": "backend-zones", "attributes": {"applied_serial": 2, "error": "reload failed"}}}`,
+			expectedStatusCode:    http.StatusOK,
+			expectedAppliedSerial: 2,
+			expectedError:         "reload failed",
+		},
+		{
+			name:               "zone not assigned",
+			zoneID:             "01F1ZQZJXQXZJXZJXZJXZJX0NE",
+			payload:            `{"data": {"type": "backend-zones", "attributes": {"applied_serial": 2}}}`,
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	routeBackend := &BackendRoute{db: db}
+	c, _ := postTestRequest("/v1/backends", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "backends", "attributes": {"name": "bind"}}}`, e)
+	assert.NoError(t, routeBackend.Create(c))
+	routeZone := &ZoneRoute{db: db}
+	c, _ = postTestRequest("/v1/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJZONE", "type": "zones", "attributes": {"name": "martinez.io"}}}`, e)
+	assert.NoError(t, routeZone.Create(c))
+	c, _ = postTestRequest("/v1/backends/:id/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJZONE", "type": "zones"}}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX")
+	assert.NoError(t, routeBackend.AddZone(c))
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, recPatch := patchTestRequest("/v1/backends/:id/status/:zone_id", test.payload, e)
+			c.SetParamNames("id", "zone_id")
+			c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX", test.zoneID)
+			assert.NoError(t, routeBackend.ReportStatus(c))
+			assert.Equal(t, test.expectedStatusCode, recPatch.Code)
+			if test.expectedStatusCode != http.StatusOK {
+				return
+			}
+
+			c, recGet := getTestRequest("/v1/backends/:id/status", e)
+			c.SetParamNames("id")
+			c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX")
+			if assert.NoError(t, routeBackend.GetStatus(c)) {
+				assert.Equal(t, http.StatusOK, recGet.Code)
+				var statuses []model.BackendZone
+				assert.NoError(t, jsonapi.Unmarshal(recGet.Body.Bytes(), &statuses))
+				if assert.Len(t, statuses, 1) {
+					assert.Equal(t, test.zoneID, statuses[0].ZoneID)
+					assert.Equal(t, test.expectedAppliedSerial, statuses[0].AppliedSerial)
+					assert.Equal(t, test.expectedError, statuses[0].Error)
+					assert.NotNil(t, statuses[0].ReportedAt)
+				}
+			}
+		})
+	}
+}
+
+func TestBackendRoute_Config(t *testing.T) {
+	defer TearDown()
+
+	tests := []struct {
+		name               string
+		method             string
+		payload            string
+		expectedType       string
+		expectedConfig     model.BackendConfig
+		expectedPointer    string
+		expectedStatusCode int
+	}{
+		{
+			name:               "create with type and config",
+			method:             http.MethodPost,
+			payload:            `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "backends", "attributes": {"name": "bind", "type": "bind", "config": {"directory": "/var/named", "rndc": "rndc -c /etc/rndc.conf"}}}}`,
+			expectedType:       model.BackendBind,
+			expectedConfig:     model.BackendConfig{Directory: "/var/named", Rndc: "rndc -c /etc/rndc.conf"},
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "update bind zone type",
+			method:             http.MethodPatch,
+			payload:            `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "backends", "attributes": {"config": {"directory": "/var/named", "zone_type": "secondary"}}}}`,
+			expectedType:       model.BackendBind,
+			expectedConfig:     model.BackendConfig{Directory: "/var/named", ZoneType: "secondary"},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "create with unknown type",
+			method:             http.MethodPost,
+			payload:            `{"data": {"type": "backends", "attributes": {"name": "knot", "type": "knot"}}}`,
+			expectedPointer:    "/data/attributes/type",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "update with a field of another type",
+			method:             http.MethodPatch,
+			payload:            `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "backends", "attributes": {"config": {"api_url": "http://127.0.0.1:8081"}}}}`,
+			expectedPointer:    "/data/attributes/config/api_url",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "update type and config",
+			method:             http.MethodPatch,
+			payload:            `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "backends", "attributes": {"type": "powerdns", "config": {"api_url": "http://127.0.0.1:8081", "api_key": "secret"}}}}`,
+			expectedType:       model.BackendPowerDNS,
+			expectedConfig:     model.BackendConfig{APIURL: "http://127.0.0.1:8081"},
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			routeBackend := &BackendRoute{db: db}
+			var c echo.Context
+			var rec *httptest.ResponseRecorder
+			if test.method == http.MethodPost {
+				c, rec = postTestRequest("/v1/backends", test.payload, e)
+				assert.NoError(t, routeBackend.Create(c))
+			} else {
+				c, rec = patchTestRequest("/v1/backends/:id", test.payload, e)
+				c.SetParamNames("id")
+				c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX")
+				assert.NoError(t, routeBackend.Update(c))
+			}
+			assert.Equal(t, test.expectedStatusCode, rec.Code)
+			if test.expectedPointer != "" {
+				var document struct {
+					Errors []struct {
+						Status string `json:"status"`
+						Source struct {
+							Pointer string `json:"pointer"`
+						} `json:"source"`
+					} `json:"errors"`
+				}
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+				if assert.Len(t, document.Errors, 1) {
+					assert.Equal(t, test.expectedPointer, document.Errors[0].Source.Pointer)
+				}
+				return
+			}
+			var backend model.Backend
+			assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &backend))
+			assert.Equal(t, test.expectedType, backend.Type)
+			assert.Equal(t, test.expectedConfig, backend.Config)
+		})
+	}
+}
+
+func TestBackendRoute_GetConfig(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	routeBackend := &BackendRoute{db: db}
+	c, rec := postTestRequest("/v1/backends", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "backends", "attributes": {"name": "powerdns", "type": "powerdns", "config": {"api_url": "http://127.0.0.1:8081", "api_key": "SECRET123"}}}}`, e)
+	assert.NoError(t, routeBackend.Create(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "SECRET123")
+
+	// The API key is stored but left out of the responses
+	c, rec = getTestRequest("/v1/backends/:id", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX")
+	assert.NoError(t, routeBackend.Get(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "SECRET123")
+	assert.Contains(t, rec.Body.String(), "http://127.0.0.1:8081")
+
+	c, rec = getTestRequest("/v1/backends", e)
+	assert.NoError(t, routeBackend.List(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "SECRET123")
+
+	// The agent reads it from the config of the backend
+	c, rec = getTestRequest("/v1/backends/:id/config", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX")
+	assert.NoError(t, routeBackend.GetConfig(c))
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var backend model.Backend
+		assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &backend))
+		assert.Equal(t, "SECRET123", backend.Config.APIKey)
+	}
+
+	c, rec = getTestRequest("/v1/backends/:id/config", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZNF")
+	assert.NoError(t, routeBackend.GetConfig(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Codes of the JSON:API errors of the API. Errors without a more specific code get the snake cased text of
+// their status, such as not_found or conflict.
+const (
+	codeRequired         = "required"
+	codeInvalidDocument  = "invalid_document"
+	codeInvalidParameter = "invalid_parameter"
+	codeUnknownFilter    = "unknown_filter"
+	codeMissingResources = "missing_resources"
+)
+
+// statusCode returns the default code of the errors of status
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// notFound is the error of a resource that doesn't exist or is out of reach of the caller
+func notFound(resource string) *jsonapi.Error {
+	return &jsonapi.Error{Detail: resource + " not found"}
+}
+
+// missingResources is the error of a request document referring to resources of which some don't exist or are
+// out of reach of the caller, resources is their type such as zones
+func missingResources(resources string) *jsonapi.Error {
+	return &jsonapi.Error{
+		Code:   codeMissingResources,
+		Title:  "Missing resources",
+		Detail: "All " + resources + " must exist",
+		Source: &jsonapi.ErrorSource{Pointer: "/data"},
+	}
+}
+
+// alreadyExists is the error of a resource conflicting with an existing one
+func alreadyExists(resource string) *jsonapi.Error {
+	return &jsonapi.Error{Detail: resource + " already exists"}
+}
+
+// required is the error of a request document missing member, pointer locates it in the document
+func required(member string, pointer string) *jsonapi.Error {
+	return &jsonapi.Error{
+		Code:   codeRequired,
+		Title:  "Missing member",
+		Detail: member + " is required",
+		Source: &jsonapi.ErrorSource{Pointer: pointer},
+	}
+}
+
+// invalidQuery is the error of a query string that can't be parsed
+func invalidQuery(err error) *jsonapi.Error {
+	return &jsonapi.Error{
+		Code:   codeInvalidParameter,
+		Title:  "Invalid query parameters",
+		Detail: err.Error(),
+	}
+}
+
+// unknownFilter is the error of a filter the listed resources can't be filtered by
+func unknownFilter(filter string) *jsonapi.Error {
+	return &jsonapi.Error{
+		Code:   codeUnknownFilter,
+		Title:  "Unknown filter",
+		Detail: fmt.Sprintf("The resources can't be filtered by %s", filter),
+		Source: &jsonapi.ErrorSource{Parameter: fmt.Sprintf("filter[%s]", filter)},
+	}
+}
+
+// HTTPErrorHandler renders the errors returned by handlers and middlewares as JSON:API error documents, so
+// clients get the same media type whether a request succeeds or fails
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	status, jsonErr := errorDocument(err)
+	if status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = JSONAPIError(c, status, jsonErr)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// errorDocument returns the status and the JSON:API error of err
+func errorDocument(err error) (int, *jsonapi.Error) {
+	var (
+		jsonErr    *jsonapi.Error
+		httpErr    *echo.HTTPError
+		bodyErr    *jsonapi.RequestBodyError
+		typeErr    *jsonapi.TypeError
+		linkageErr *jsonapi.PartialLinkageError
+		syntaxErr  *json.SyntaxError
+		valueErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &jsonErr):
+		if jsonErr.Status == nil {
+			return http.StatusInternalServerError, jsonErr
+		}
+		return *jsonErr.Status, jsonErr
+	case errors.As(err, &httpErr):
+		// Errors of echo itself, such as unknown routes or the unsupported media types refused by the binder
+		detail := http.StatusText(httpErr.Code)
+		if message, ok := httpErr.Message.(string); ok {
+			detail = message
+		}
+		if httpErr.Code == http.StatusBadRequest {
+			return httpErr.Code, &jsonapi.Error{Code: codeInvalidDocument, Title: "Invalid document", Detail: detail}
+		}
+		return httpErr.Code, &jsonapi.Error{Detail: detail}
+	case errors.As(err, &bodyErr), errors.As(err, &typeErr), errors.As(err, &linkageErr), errors.As(err, &syntaxErr),
+		errors.As(err, &valueErr), errors.Is(err, jsonapi.ErrEmptyPrimaryField), errors.Is(err, io.ErrUnexpectedEOF):
+		// Errors of the binder decoding the request document
+		return http.StatusBadRequest, &jsonapi.Error{
+			Code:   codeInvalidDocument,
+			Title:  "Invalid document",
+			Detail: err.Error(),
+			Source: &jsonapi.ErrorSource{Pointer: "/data"},
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound, notFound("Resource")
+	}
+	return http.StatusInternalServerError, &jsonapi.Error{Detail: "The server failed to process the request"}
+}
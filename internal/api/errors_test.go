@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	defer TearDown()
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	e := New(db)
+	token := operatorKey(t, db)
+	zone := model.Zone{ID: "01F1ZQZJXQXZJXZJXZJXZJZONE", Name: "martinez.io"}
+	assert.NoError(t, db.Create(&zone).Error)
+
+	tests := []struct {
+		name               string
+		method             string
+		target             string
+		contentType        string
+		payload            string
+		expectedStatusCode int
+		expectedCode       string
+		expectedPointer    string
+		expectedParameter  string
+		expectedDetail     string
+	}{
+		{
+			name:               "unknown route",
+			method:             http.MethodGet,
+			target:             "/v1/unknown",
+			expectedStatusCode: http.StatusNotFound,
+			expectedCode:       "not_found",
+		},
+		{
+			name:               "missing resource",
+			method:             http.MethodGet,
+			target:             "/v1/backends/01F1ZQZJXQXZJXZJXZJXZJXZJX",
+			expectedStatusCode: http.StatusNotFound,
+			expectedCode:       "not_found",
+		},
+		{
+			name:               "missing zone",
+			method:             http.MethodGet,
+			target:             "/v1/zones/01F1ZQZJXQXZJXZJXZJXZJXZJX/backends",
+			expectedStatusCode: http.StatusNotFound,
+			expectedCode:       "not_found",
+			expectedDetail:     "Zone not found",
+		},
+		{
+			name:               "missing resources of a linkage",
+			method:             http.MethodPatch,
+			target:             "/v1/zones/01F1ZQZJXQXZJXZJXZJXZJZONE/relationships/backends",
+			payload:            `{"data": [{"type": "backends", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX"}]}`,
+			expectedStatusCode: http.StatusNotFound,
+			expectedCode:       codeMissingResources,
+			expectedPointer:    "/data",
+			expectedDetail:     "All backends must exist",
+		},
+		{
+			name:               "missing resources of a list",
+			method:             http.MethodPatch,
+			target:             "/v1/zones/01F1ZQZJXQXZJXZJXZJXZJZONE/backends",
+			payload:            `{"data": [{"type": "backends", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX"}]}`,
+			expectedStatusCode: http.StatusNotFound,
+			expectedCode:       codeMissingResources,
+			expectedPointer:    "/data",
+			expectedDetail:     "All backends must exist",
+		},
+		{
+			name:               "unknown filter",
+			method:             http.MethodGet,
+			target:             "/v1/zones?filter[soa]=ns1.martinez.io",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedCode:       codeUnknownFilter,
+			expectedParameter:  "filter[soa]",
+		},
+		{
+			name:               "invalid query",
+			method:             http.MethodGet,
+			target:             "/v1/zones?page[size]=a",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedCode:       codeInvalidParameter,
+		},
+		{
+			name:               "unsupported media type",
+			method:             http.MethodPost,
+			target:             "/v1/backends",
+			contentType:        echo.MIMEApplicationJSON,
+			payload:            `{"name": "bind"}`,
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+			expectedCode:       "unsupported_media_type",
+		},
+		{
+			name:               "malformed document",
+			method:             http.MethodPost,
+			target:             "/v1/backends",
+			payload:            `{"data": {`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedCode:       codeInvalidDocument,
+			expectedPointer:    "/data",
+		},
+		{
+			name:               "wrong resource type",
+			method:             http.MethodPost,
+			target:             "/v1/backends",
+			payload:            `{"data": {"type": "zones", "attributes": {"name": "bind"}}}`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedCode:       codeInvalidDocument,
+			expectedPointer:    "/data",
+		},
+		{
+			name:               "missing attribute",
+			method:             http.MethodPost,
+			target:             "/v1/backends",
+			payload:            `{"data": {"type": "backends", "attributes": {}}}`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedCode:       codeRequired,
+			expectedPointer:    "/data/attributes/name",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.payload))
+			if test.contentType == "" {
+				test.contentType = binder.MIMEApplicationJSONApi
+			}
+			req.Header.Set(echo.HeaderContentType, test.contentType)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.expectedStatusCode, rec.Code)
+			assert.Equal(t, binder.MIMEApplicationJSONApi, rec.Header().Get(echo.HeaderContentType))
+			var document struct {
+				Errors []struct {
+					Status string `json:"status"`
+					Code   string `json:"code"`
+					Title  string `json:"title"`
+					Detail string `json:"detail"`
+					Source struct {
+						Pointer   string `json:"pointer"`
+						Parameter string `json:"parameter"`
+					} `json:"source"`
+				} `json:"errors"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+			if assert.Len(t, document.Errors, 1) {
+				jsonErr := document.Errors[0]
+				assert.Equal(t, strconv.Itoa(test.expectedStatusCode), jsonErr.Status)
+				assert.Equal(t, test.expectedCode, jsonErr.Code)
+				assert.NotEmpty(t, jsonErr.Title)
+				assert.NotEmpty(t, jsonErr.Detail)
+				if test.expectedDetail != "" {
+					assert.Equal(t, test.expectedDetail, jsonErr.Detail)
+				}
+				assert.Equal(t, test.expectedPointer, jsonErr.Source.Pointer)
+				assert.Equal(t, test.expectedParameter, jsonErr.Source.Parameter)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/jsonapi"
+	"gorm.io/gorm"
+)
+
+// filterKind is the kind of the values of a filter, it decides the operators the filter supports
+type filterKind int
+
+const (
+	filterText filterKind = iota
+	filterNumber
+	filterTime
+)
+
+// filterOperators are the operators each kind of filter supports, eq is used when the filter names none
+var filterOperators = map[filterKind][]string{
+	filterText:   {"eq", "ne", "in", "prefix", "suffix", "contains"},
+	filterNumber: {"eq", "ne", "in", "lt", "lte", "gt", "gte"},
+	filterTime:   {"eq", "ne", "lt", "lte", "gt", "gte"},
+}
+
+// filterField is a field the resources of a list may be filtered by
+type filterField struct {
+	column string
+	kind   filterKind
+	// normalize turns the values of the filter into the form they are stored in, when set
+	normalize func(string) string
+}
+
+// textFilter, numberFilter and timeFilter return filters on column
+func textFilter(column string) filterField   { return filterField{column: column, kind: filterText} }
+func numberFilter(column string) filterField { return filterField{column: column, kind: filterNumber} }
+func timeFilter(column string) filterField   { return filterField{column: column, kind: filterTime} }
+
+// Filtering returns a scope applying the filters of the query, fields maps the fields the resources may be
+// filtered by. A filter is given as filter[field]=value or filter[field][operator]=value, filters are combined
+// with AND and the in operator takes a comma separated list of values.
+func (q *Query) Filtering(fields map[string]filterField) (func(db *gorm.DB) *gorm.DB, *jsonapi.Error) {
+	var conditions []func(db *gorm.DB) *gorm.DB
+	for _, key := range q.filterKeys() {
+		name, operator, found := strings.Cut(key, "][")
+		if !found {
+			operator = "eq"
+		}
+		field, ok := fields[name]
+		if !ok {
+			return nil, unknownFilter(name)
+		}
+		if !supports(field.kind, operator) {
+			return nil, &jsonapi.Error{
+				Code:   codeInvalidParameter,
+				Title:  "Unsupported filter operator",
+				Detail: fmt.Sprintf("The %s filter supports the operators %s", name, strings.Join(filterOperators[field.kind], ", ")),
+				Source: &jsonapi.ErrorSource{Parameter: fmt.Sprintf("filter[%s]", key)},
+			}
+		}
+		for _, value := range q.Filters[key] {
+			condition, err := field.condition(operator, value)
+			if err != nil {
+				return nil, &jsonapi.Error{
+					Code:   codeInvalidParameter,
+					Title:  "Invalid filter value",
+					Detail: fmt.Sprintf("Invalid value for the %s filter: %s", name, err),
+					Source: &jsonapi.ErrorSource{Parameter: fmt.Sprintf("filter[%s]", key)},
+				}
+			}
+			conditions = append(conditions, condition)
+		}
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		for _, condition := range conditions {
+			db = condition(db)
+		}
+		return db
+	}, nil
+}
+
+// supports reports whether filters of kind support operator
+func supports(kind filterKind, operator string) bool {
+	for _, supported := range filterOperators[kind] {
+		if supported == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// condition returns the condition of the filter on f with operator and value
+func (f filterField) condition(operator string, value string) (func(db *gorm.DB) *gorm.DB, error) {
+	values := []string{value}
+	if operator == "in" {
+		values = strings.Split(value, ",")
+	}
+	args := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		arg, err := f.parse(v)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	var clause string
+	switch operator {
+	case "eq":
+		clause = "= ?"
+	case "ne":
+		clause = "<> ?"
+	case "lt":
+		clause = "< ?"
+	case "lte":
+		clause = "<= ?"
+	case "gt":
+		clause = "> ?"
+	case "gte":
+		clause = ">= ?"
+	case "in":
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where(f.column+" IN ?", args)
+		}, nil
+	case "prefix":
+		clause, args[0] = `LIKE ? ESCAPE '\'`, escapeLike(args[0].(string))+"%"
+	case "suffix":
+		clause, args[0] = `LIKE ? ESCAPE '\'`, "%"+escapeLike(args[0].(string))
+	case "contains":
+		clause, args[0] = `LIKE ? ESCAPE '\'`, "%"+escapeLike(args[0].(string))+"%"
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(f.column+" "+clause, args[0])
+	}, nil
+}
+
+// parse returns the value of the filter as compared to the column
+func (f filterField) parse(value string) (interface{}, error) {
+	if f.normalize != nil {
+		value = f.normalize(value)
+	}
+	switch f.kind {
+	case filterNumber:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return n, nil
+	case filterTime:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+			t, err := time.ParseInLocation(layout, value, time.Local)
+			if err == nil {
+				// Timestamps are stored in local time, comparing them as text needs the same offset
+				return t.Local(), nil
+			}
+		}
+		return nil, fmt.Errorf("%q is neither an RFC 3339 timestamp nor a date", value)
+	}
+	return value, nil
+}
+
+// escapeLike escapes the wildcards of LIKE patterns in value
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
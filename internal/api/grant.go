@@ -0,0 +1,248 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/DataDog/jsonapi"
+	"gorm.io/gorm"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/model"
+)
+
+type GrantRoute struct {
+	db *gorm.DB
+}
+
+// grantFilters maps the fields grants may be filtered by to their columns
+var grantFilters = map[string]filterField{
+	"role":       textFilter("role"),
+	"user":       textFilter("user_id"),
+	"tsig_key":   textFilter("tsig_key_id"),
+	"zone":       textFilter("zone_id"),
+	"created_at": timeFilter("created_at"),
+	"updated_at": timeFilter("updated_at"),
+}
+
+// Create gives a role to a user or a TSIG key
+func (r *GrantRoute) Create(c echo.Context) (err error) {
+	var grant model.Grant
+	if err := c.Bind(&grant); err != nil {
+		return err
+	}
+	if grant.Role == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Role", "/data/attributes/role"))
+	}
+	err = grant.Validate()
+	if err != nil {
+		if jsonErr := grantError(err); jsonErr != nil {
+			return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+		}
+		return err
+	}
+	allowed, err := r.manages(c, &grant)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	if grant.ZoneID != "" {
+		zone := &model.Zone{ID: grant.ZoneID}
+		if err = zone.Get(r.db, false); err != nil {
+			if err.Error() == "record not found" {
+				return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+			}
+			return err
+		}
+		if !reaches(c, zone.OrganizationID) {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+	}
+	visible, err := r.holderVisible(c, &grant)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		if grant.UserID != "" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	err = r.db.Create(&grant).Error
+	if err != nil {
+		if jsonErr := grantError(err); jsonErr != nil {
+			return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+		}
+		return err
+	}
+	return JSONAPI(c, http.StatusCreated, grant)
+}
+
+// List lists the grants, admins see every grant while other users see their own and the ones of the zones they administer
+func (r *GrantRoute) List(c echo.Context) (err error) {
+	var grants []model.Grant
+	query, err := ParseQuery(c)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, invalidQuery(err))
+	}
+	filtering, jsonErr := query.Filtering(grantFilters)
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	p, jsonErr := query.Pagination()
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	tx := r.db
+	if ids, all := perms.AdministeredZones(); !all {
+		tx = tx.Where("zone_id IN ? OR user_id = ?", ids, Principal(c).ID)
+	}
+	if organizationID := tenant(c); organizationID != "" {
+		tx = tx.Where("user_id IN (?) OR tsig_key_id IN (?)",
+			r.db.Model(&model.User{}).Select("id").Where("organization_id = ?", organizationID),
+			r.db.Model(&model.TSIGKey{}).Select("id").Where("organization_id = ?", organizationID))
+	}
+	tx = tx.Scopes(filtering)
+	err = tx.Scopes(paginate(grants, p, tx)).Find(&grants).Error
+	if err != nil {
+		return err
+	}
+	p.Window(&grants)
+
+	p.SetLinks(query.Link("/v1/grants"))
+	if len(grants) == 0 {
+		return JSONAPI(c, http.StatusOK, grants)
+	}
+	return JSONAPIPaginated(c, http.StatusOK, grants, p.Link(), p.Meta())
+}
+
+// Get gets a grant
+func (r *GrantRoute) Get(c echo.Context) (err error) {
+	grant := &model.Grant{ID: c.Param("id")}
+	err = grant.Get(r.db)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Grant"))
+		}
+		return err
+	}
+	visible, err := r.holderVisible(c, grant)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Grant"))
+	}
+	allowed, err := r.manages(c, grant)
+	if err != nil {
+		return err
+	}
+	if user := Principal(c); !allowed && (user == nil || user.ID != grant.UserID) {
+		return forbidden(c)
+	}
+	return JSONAPI(c, http.StatusOK, grant)
+}
+
+// Delete revokes a grant
+func (r *GrantRoute) Delete(c echo.Context) (err error) {
+	grant := &model.Grant{ID: c.Param("id")}
+	err = grant.Get(r.db)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return c.NoContent(http.StatusNoContent)
+		}
+		return err
+	}
+	visible, err := r.holderVisible(c, grant)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return c.NoContent(http.StatusNoContent)
+	}
+	allowed, err := r.manages(c, grant)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	err = r.db.Delete(grant).Error
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// manages reports whether the principal may give or revoke the grant, admins manage every grant and zone-admins
+// the grants restricted to the zones they administer
+func (r *GrantRoute) manages(c echo.Context, grant *model.Grant) (bool, error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return false, err
+	}
+	if perms.IsAdmin() {
+		return true, nil
+	}
+	return grant.ZoneID != "" && grant.Role != model.RoleAdmin && perms.Allows(model.RoleZoneAdmin, grant.ZoneID), nil
+}
+
+// holderVisible reports whether the user or TSIG key holding the grant exists and the principal reaches its organization
+func (r *GrantRoute) holderVisible(c echo.Context, grant *model.Grant) (bool, error) {
+	var err error
+	organizationID := ""
+	if grant.UserID != "" {
+		user := &model.User{ID: grant.UserID}
+		err = user.Get(r.db, false)
+		organizationID = user.OrganizationID
+	} else {
+		key := &model.TSIGKey{ID: grant.TSIGKeyID}
+		err = key.Get(r.db, false)
+		organizationID = key.OrganizationID
+	}
+	if err != nil {
+		if err.Error() == "record not found" {
+			return false, nil
+		}
+		return false, err
+	}
+	return reaches(c, organizationID), nil
+}
+
+// grantError converts an invalid grant attribute into a jsonapi error pointing at it, other errors give nil
+func grantError(err error) *jsonapi.Error {
+	var pointer string
+	switch {
+	case errors.Is(err, model.ErrInvalidRole), errors.Is(err, model.ErrInvalidGrantScope):
+		pointer = "/data/attributes/role"
+	case errors.Is(err, model.ErrInvalidGrantName):
+		pointer = "/data/attributes/names"
+	case errors.Is(err, model.ErrInvalidGrantType):
+		pointer = "/data/attributes/types"
+	case errors.Is(err, model.ErrInvalidGrantHolder):
+		pointer = "/data/relationships"
+	default:
+		return nil
+	}
+	return &jsonapi.Error{
+		Title:  "Invalid grant",
+		Detail: err.Error(),
+		Source: &jsonapi.ErrorSource{Pointer: pointer},
+	}
+}
+
+// Register registers the routes for the grants
+func (r *GrantRoute) Register(e *echo.Echo) {
+	e.GET("/v1/grants/:id", r.Get)
+	e.DELETE("/v1/grants/:id", r.Delete)
+	e.POST("/v1/grants", r.Create)
+	e.GET("/v1/grants", r.List)
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrantRoute_Create(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	route := &GrantRoute{db: db}
+
+	admin := model.User{Name: "admin", Email: "admin@martinez.io"}
+	owner := model.User{Name: "owner", Email: "owner@martinez.io"}
+	dev := model.User{Name: "dev", Email: "dev@martinez.io"}
+	for _, user := range []*model.User{&admin, &owner, &dev} {
+		assert.NoError(t, db.Create(user).Error)
+	}
+	assert.NoError(t, db.Create(&model.Grant{Role: model.RoleAdmin, UserID: admin.ID}).Error)
+	zone := model.Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io"}
+	other := model.Zone{Name: "other.io", MName: "ns1.other.io", RName: "hostmaster.other.io"}
+	assert.NoError(t, db.Create(&zone).Error)
+	assert.NoError(t, db.Create(&other).Error)
+	assert.NoError(t, owner.AddZone(db, &zone))
+
+	grantPayload := func(role string, zoneID string) string {
+		return fmt.Sprintf(`{"data": {"type": "grants", "attributes": {"role": %q, "names": ["*.dev.martinez.io"]}, "relationships": {"user": {"data": {"type": "users", "id": %q}}, "zone": {"data": {"type": "zones", "id": %q}}}}}`, role, dev.ID, zoneID)
+	}
+	tests := []struct {
+		name               string
+		principal          *model.User
+		payload            string
+		expectedStatusCode int
+	}{
+		{
+			name:               "zone-admin granting on its zone",
+			principal:          &owner,
+			payload:            grantPayload(model.RoleRecordEditor, zone.ID),
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "zone-admin granting on another zone",
+			principal:          &owner,
+			payload:            grantPayload(model.RoleRecordEditor, other.ID),
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "user without grants",
+			principal:          &dev,
+			payload:            grantPayload(model.RoleZoneAdmin, zone.ID),
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "admin granting on any zone",
+			principal:          &admin,
+			payload:            grantPayload(model.RoleReadOnly, other.ID),
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "admin restricted to a zone",
+			principal:          &admin,
+			payload:            grantPayload(model.RoleAdmin, other.ID),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "unknown zone",
+			principal:          &admin,
+			payload:            grantPayload(model.RoleReadOnly, "01F1ZQZJXQXZJXZJXZJXZJXZJX"),
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, rec := postTestRequest("/v1/grants", test.payload, e)
+			setPrincipal(c, test.principal)
+			assert.NoError(t, route.Create(c))
+			assert.Equal(t, test.expectedStatusCode, rec.Code)
+			if test.expectedStatusCode == http.StatusCreated {
+				var grant model.Grant
+				assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &grant))
+				if assert.NotNil(t, grant.User) {
+					assert.Equal(t, dev.ID, grant.User.ID)
+				}
+				assert.Equal(t, []string{"*.dev.martinez.io."}, grant.Names)
+			}
+		})
+	}
+
+	grants, err := dev.Grants(db)
+	assert.NoError(t, err)
+	assert.Len(t, grants, 2)
+}
+
+func TestPermissions_Enforced(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	zoneRoute := &ZoneRoute{db: db}
+	recordRoute := &RecordRoute{db: db}
+	backendRoute := &BackendRoute{db: db}
+
+	dev := model.User{Name: "dev", Email: "dev@martinez.io"}
+	assert.NoError(t, db.Create(&dev).Error)
+	zone := model.Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io"}
+	other := model.Zone{Name: "other.io", MName: "ns1.other.io", RName: "hostmaster.other.io"}
+	assert.NoError(t, db.Create(&zone).Error)
+	assert.NoError(t, db.Create(&other).Error)
+	assert.NoError(t, db.Create(&model.Grant{Role: model.RoleRecordEditor, UserID: dev.ID, ZoneID: zone.ID, Names: []string{"*.dev.martinez.io"}}).Error)
+
+	t.Run("list only the zones of the grants", func(t *testing.T) {
+		c, rec := getTestRequest("/v1/zones", e)
+		setPrincipal(c, &dev)
+		assert.NoError(t, zoneRoute.List(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var zones []model.Zone
+		assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &zones))
+		if assert.Len(t, zones, 1) {
+			assert.Equal(t, zone.ID, zones[0].ID)
+		}
+	})
+
+	t.Run("read a zone of the grants", func(t *testing.T) {
+		c, rec := getTestRequest("/v1/zones/"+zone.ID, e)
+		setPrincipal(c, &dev)
+		c.SetParamNames("id")
+		c.SetParamValues(zone.ID)
+		assert.NoError(t, zoneRoute.Get(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("read another zone", func(t *testing.T) {
+		c, rec := getTestRequest("/v1/zones/"+other.ID, e)
+		setPrincipal(c, &dev)
+		c.SetParamNames("id")
+		c.SetParamValues(other.ID)
+		assert.NoError(t, zoneRoute.Get(c))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("update a zone with a scoped grant", func(t *testing.T) {
+		c, rec := patchTestRequest("/v1/zones/"+zone.ID, `{"data": {"type": "zones", "id": "`+zone.ID+`", "attributes": {"name": "martinez.io", "ttl": 60}}}`, e)
+		setPrincipal(c, &dev)
+		c.SetParamNames("id")
+		c.SetParamValues(zone.ID)
+		assert.NoError(t, zoneRoute.Update(c))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	recordPayload := func(name string, rrtype string, content string) string {
+		return fmt.Sprintf(`{"data": {"type": "records", "attributes": {"name": %q, "type": %q, "ttl": 300, "content": %q}, "relationships": {"zones": {"data": {"type": "zones", "id": %q}}}}}`, name, rrtype, content, zone.ID)
+	}
+	var created model.Record
+	t.Run("create a record inside the grant", func(t *testing.T) {
+		c, rec := postTestRequest("/v1/records", recordPayload("www.dev", "A", "192.168.0.1"), e)
+		setPrincipal(c, &dev)
+		assert.NoError(t, recordRoute.Create(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &created))
+	})
+
+	t.Run("create a record outside the grant", func(t *testing.T) {
+		c, rec := postTestRequest("/v1/records", recordPayload("www.martinez.io", "A", "192.168.0.2"), e)
+		setPrincipal(c, &dev)
+		assert.NoError(t, recordRoute.Create(c))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("move a record outside the grant", func(t *testing.T) {
+		c, rec := patchTestRequest("/v1/records/"+created.ID, `{"data": {"type": "records", "id": "`+created.ID+`", "attributes": {"name": "www.martinez.io"}}}`, e)
+		setPrincipal(c, &dev)
+		c.SetParamNames("id")
+		c.SetParamValues(created.ID)
+		assert.NoError(t, recordRoute.Update(c))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("delete a record inside the grant", func(t *testing.T) {
+		c, rec := deleteTestRequest("/v1/records/"+created.ID, "", e)
+		setPrincipal(c, &dev)
+		c.SetParamNames("id")
+		c.SetParamValues(created.ID)
+		assert.NoError(t, recordRoute.Delete(c))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("create a backend", func(t *testing.T) {
+		c, rec := postTestRequest("/v1/backends", `{"data": {"type": "backends", "attributes": {"name": "bind"}}}`, e)
+		setPrincipal(c, &dev)
+		assert.NoError(t, backendRoute.Create(c))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
@@ -0,0 +1,437 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/model"
+)
+
+type OrganizationRoute struct {
+	db *gorm.DB
+}
+
+// organizationFilters maps the fields organizations may be filtered by to their columns
+var organizationFilters = map[string]filterField{
+	"name":       {column: "name", kind: filterText, normalize: strings.ToLower},
+	"created_at": timeFilter("created_at"),
+	"updated_at": timeFilter("updated_at"),
+}
+
+// Create creates a new organization, only the operators of port53 manage organizations
+func (r *OrganizationRoute) Create(c echo.Context) (err error) {
+	allowed, err := r.operator(c)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	var organization model.Organization
+	if err := c.Bind(&organization); err != nil {
+		return err
+	}
+	if organization.Name == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Name", "/data/attributes/name"))
+	}
+	err = r.db.Create(&organization).Error
+	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		if err.Error() == "UNIQUE constraint failed: organizations.name" {
+			var existingOrganization model.Organization
+			err = r.db.First(&existingOrganization, "name = ?", organization.Name).Error
+			if err != nil {
+				return err
+			}
+			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/organizations/%s", viper.GetString("serviceUrl"), existingOrganization.ID))
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("Organization"))
+		} else if err.Error() == "UNIQUE constraint failed: organizations.id" {
+			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/organizations/%s", viper.GetString("serviceUrl"), organization.ID))
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("Organization"))
+		}
+		return err
+	}
+	return JSONAPI(c, http.StatusCreated, organization)
+}
+
+// List lists the organizations, users of an organization only see their own
+func (r *OrganizationRoute) List(c echo.Context) (err error) {
+	var organizations []model.Organization
+	query, err := ParseQuery(c)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, invalidQuery(err))
+	}
+	filtering, jsonErr := query.Filtering(organizationFilters)
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	p, jsonErr := query.Pagination()
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	tx := r.db
+	if organizationID := tenant(c); organizationID != "" {
+		tx = tx.Where("id = ?", organizationID)
+	}
+	tx = tx.Scopes(filtering)
+	err = tx.Scopes(paginate(organizations, p, tx)).Find(&organizations).Error
+	if err != nil {
+		return err
+	}
+	p.Window(&organizations)
+
+	p.SetLinks(query.Link("/v1/organizations"))
+	if len(organizations) == 0 {
+		return JSONAPI(c, http.StatusOK, organizations)
+	}
+	return JSONAPIPaginated(c, http.StatusOK, organizations, p.Link(), p.Meta())
+}
+
+// Get gets an organization along with its quotas
+func (r *OrganizationRoute) Get(c echo.Context) (err error) {
+	organization := &model.Organization{ID: c.Param("id")}
+	err = organization.Get(r.db)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Organization"))
+		}
+		return err
+	}
+	if !reaches(c, organization.ID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Organization"))
+	}
+	return JSONAPI(c, http.StatusOK, organization)
+}
+
+// Update renames an organization and sets its quotas, the quotas left out are lifted
+func (r *OrganizationRoute) Update(c echo.Context) (err error) {
+	allowed, err := r.operator(c)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	organization := &model.Organization{ID: c.Param("id")}
+	err = organization.Get(r.db)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Organization"))
+		}
+		return err
+	}
+	var newOrganization model.Organization
+	if err := c.Bind(&newOrganization); err != nil {
+		return err
+	}
+	err = organization.Update(r.db, newOrganization)
+	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		if err.Error() == "UNIQUE constraint failed: organizations.name" {
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("Organization"))
+		}
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, organization)
+}
+
+// Delete deletes an organization, it must not own zones, backends, TSIG keys or users anymore
+func (r *OrganizationRoute) Delete(c echo.Context) (err error) {
+	allowed, err := r.operator(c)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	organization := &model.Organization{ID: c.Param("id")}
+	err = organization.Delete(r.db)
+	if err != nil && err.Error() != "record not found" {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetZones gets the zones of an organization the principal may read
+func (r *OrganizationRoute) GetZones(c echo.Context) (err error) {
+	organization := &model.Organization{ID: c.Param("id")}
+	err = organization.Get(r.db)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Organization"))
+		}
+		return err
+	}
+	if !reaches(c, organization.ID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Organization"))
+	}
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	zones, err := organization.Zones(r.db)
+	if err != nil {
+		return err
+	}
+	readable := make([]*model.Zone, 0, len(zones))
+	for _, zone := range zones {
+		if perms.CanRead(zone.ID) {
+			readable = append(readable, zone)
+		}
+	}
+	return JSONAPI(c, http.StatusOK, readable)
+}
+
+// AddZone moves a zone into an organization
+func (r *OrganizationRoute) AddZone(c echo.Context) (err error) {
+	allowed, err := r.operator(c)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	var zone model.Zone
+	if err := c.Bind(&zone); err != nil {
+		if strings.Contains(err.Error(), "body is not a json:api representation") {
+			return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+		}
+		return err
+	}
+	if zone.ID == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+	}
+	organization := &model.Organization{ID: c.Param("id")}
+	err = organization.AddZone(r.db, &zone)
+	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		if strings.Contains(err.Error(), "UNIQUE constraint failed: zones.organization_id, zones.name") {
+			return JSONAPIError(c, http.StatusConflict, &jsonapi.Error{Detail: "The organization already holds a zone with the same name"})
+		}
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Organization or zone"))
+		}
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, zone)
+}
+
+// GetBackends gets the backends of an organization, shared backends aside
+func (r *OrganizationRoute) GetBackends(c echo.Context) (err error) {
+	organization := &model.Organization{ID: c.Param("id")}
+	err = organization.Get(r.db)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Organization"))
+		}
+		return err
+	}
+	if !reaches(c, organization.ID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Organization"))
+	}
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.CanRead("") {
+		return forbidden(c)
+	}
+	backends, err := organization.Backends(r.db)
+	if err != nil {
+		return err
+	}
+	redactBackends(c, backends...)
+	return JSONAPI(c, http.StatusOK, backends)
+}
+
+// AddBackend moves a backend into an organization, a backend without organization is shared by all of them
+func (r *OrganizationRoute) AddBackend(c echo.Context) (err error) {
+	allowed, err := r.operator(c)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	var backend model.Backend
+	if err := c.Bind(&backend); err != nil {
+		if strings.Contains(err.Error(), "body is not a json:api representation") {
+			return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
+		}
+		return err
+	}
+	if backend.ID == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
+	}
+	organization := &model.Organization{ID: c.Param("id")}
+	err = organization.AddBackend(r.db, &backend)
+	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Organization or backend"))
+		}
+		return err
+	}
+	redactBackends(c, &backend)
+	return JSONAPI(c, http.StatusOK, backend)
+}
+
+// GetUsers gets the users of an organization
+func (r *OrganizationRoute) GetUsers(c echo.Context) (err error) {
+	organization := &model.Organization{ID: c.Param("id")}
+	err = organization.Get(r.db)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Organization"))
+		}
+		return err
+	}
+	if !reaches(c, organization.ID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Organization"))
+	}
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	users, err := organization.Users(r.db)
+	if err != nil {
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, users)
+}
+
+// AddUser moves a user into an organization, the user only sees the resources of the organization from then on
+func (r *OrganizationRoute) AddUser(c echo.Context) (err error) {
+	allowed, err := r.operator(c)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	var user model.User
+	if err := c.Bind(&user); err != nil {
+		if strings.Contains(err.Error(), "body is not a json:api representation") {
+			return JSONAPIError(c, http.StatusBadRequest, required("User ID", "/data"))
+		}
+		return err
+	}
+	if user.ID == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("User ID", "/data"))
+	}
+	organization := &model.Organization{ID: c.Param("id")}
+	err = organization.AddUser(r.db, &user)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Organization or user"))
+		}
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, user)
+}
+
+// operator reports whether the principal operates port53, that is an admin without organization
+func (r *OrganizationRoute) operator(c echo.Context) (bool, error) {
+	if tenant(c) != "" {
+		return false, nil
+	}
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return false, err
+	}
+	return perms.IsAdmin(), nil
+}
+
+// tenant returns the organization of the principal. Operators, users without organization, and requests without
+// a principal get an empty organization, they reach every organization within the limits of their permissions.
+func tenant(c echo.Context) string {
+	if user := Principal(c); user != nil {
+		return user.OrganizationID
+	}
+	return ""
+}
+
+// reaches reports whether the principal may see the resources of the organization, the resources of other
+// organizations are reported as not found
+func reaches(c echo.Context, organizationID string) bool {
+	return model.Reaches(tenant(c), organizationID)
+}
+
+// visibleZones keeps the zones the principal reaches, the zones of a shared backend belong to many organizations
+func visibleZones(c echo.Context, zones []*model.Zone) []*model.Zone {
+	if tenant(c) == "" {
+		return zones
+	}
+	visible := make([]*model.Zone, 0, len(zones))
+	for _, zone := range zones {
+		if reaches(c, zone.OrganizationID) {
+			visible = append(visible, zone)
+		}
+	}
+	return visible
+}
+
+// organizationError converts the errors keeping organizations apart into a jsonapi error and the status to
+// answer with, other errors give nil
+func organizationError(err error) (int, *jsonapi.Error) {
+	switch {
+	case errors.Is(err, model.ErrQuotaExceeded):
+		return http.StatusForbidden, &jsonapi.Error{Title: "Quota exceeded", Detail: err.Error()}
+	case errors.Is(err, model.ErrOrganizationMismatch), errors.Is(err, model.ErrZoneNameTaken):
+		return http.StatusConflict, &jsonapi.Error{Title: "Conflicting organizations", Detail: err.Error()}
+	case errors.Is(err, model.ErrOrganizationNotEmpty):
+		return http.StatusConflict, &jsonapi.Error{Title: "Organization not empty", Detail: err.Error()}
+	case errors.Is(err, model.ErrInvalidOrganizationName):
+		return http.StatusBadRequest, &jsonapi.Error{
+			Title:  "Invalid organization name",
+			Detail: err.Error(),
+			Source: &jsonapi.ErrorSource{Pointer: "/data/attributes/name"},
+		}
+	case errors.Is(err, model.ErrInvalidQuota):
+		return http.StatusBadRequest, &jsonapi.Error{
+			Title:  "Invalid organization quota",
+			Detail: err.Error(),
+			Source: &jsonapi.ErrorSource{Pointer: "/data/attributes"},
+		}
+	}
+	return 0, nil
+}
+
+// Register registers the routes for the organizations
+func (r *OrganizationRoute) Register(e *echo.Echo) {
+	e.GET("/v1/organizations/:id", r.Get)
+	e.DELETE("/v1/organizations/:id", r.Delete)
+	e.POST("/v1/organizations", r.Create)
+	e.PATCH("/v1/organizations/:id", r.Update)
+	e.GET("/v1/organizations", r.List)
+	// Relationships
+	e.GET("/v1/organizations/:id/zones", r.GetZones)
+	e.POST("/v1/organizations/:id/zones", r.AddZone)
+	e.GET("/v1/organizations/:id/backends", r.GetBackends)
+	e.POST("/v1/organizations/:id/backends", r.AddBackend)
+	e.GET("/v1/organizations/:id/users", r.GetUsers)
+	e.POST("/v1/organizations/:id/users", r.AddUser)
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrganizationRoute_Create(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	route := &OrganizationRoute{db: db}
+
+	operator := model.User{Name: "operator", Email: "operator@martinez.io"}
+	assert.NoError(t, db.Create(&operator).Error)
+	assert.NoError(t, db.Create(&model.Grant{Role: model.RoleAdmin, UserID: operator.ID}).Error)
+	acme := model.Organization{Name: "acme"}
+	assert.NoError(t, db.Create(&acme).Error)
+	tenant := model.User{Name: "tenant", Email: "tenant@acme.io", OrganizationID: acme.ID}
+	assert.NoError(t, db.Create(&tenant).Error)
+	assert.NoError(t, db.Create(&model.Grant{Role: model.RoleAdmin, UserID: tenant.ID}).Error)
+
+	tests := []struct {
+		name               string
+		principal          *model.User
+		payload            string
+		expectedStatusCode int
+	}{
+		{
+			name:               "operator creating an organization",
+			principal:          &operator,
+			payload:            `{"data": {"type": "organizations", "attributes": {"name": "Initech", "max_zones": 10}}}`,
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "existing organization",
+			principal:          &operator,
+			payload:            `{"data": {"type": "organizations", "attributes": {"name": "acme"}}}`,
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			name:               "negative quota",
+			principal:          &operator,
+			payload:            `{"data": {"type": "organizations", "attributes": {"name": "globex", "max_zones": -1}}}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "admin of an organization",
+			principal:          &tenant,
+			payload:            `{"data": {"type": "organizations", "attributes": {"name": "globex"}}}`,
+			expectedStatusCode: http.StatusForbidden,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, rec := postTestRequest("/v1/organizations", test.payload, e)
+			setPrincipal(c, test.principal)
+			assert.NoError(t, route.Create(c))
+			assert.Equal(t, test.expectedStatusCode, rec.Code)
+			if test.expectedStatusCode == http.StatusCreated {
+				var organization model.Organization
+				assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &organization))
+				assert.Equal(t, "initech", organization.Name)
+				assert.Equal(t, 10, organization.MaxZones)
+			}
+		})
+	}
+}
+
+func TestOrganization_Isolation(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	zoneRoute := &ZoneRoute{db: db}
+	organizationRoute := &OrganizationRoute{db: db}
+
+	acme := model.Organization{Name: "acme", MaxZones: 1}
+	initech := model.Organization{Name: "initech"}
+	assert.NoError(t, db.Create(&acme).Error)
+	assert.NoError(t, db.Create(&initech).Error)
+	acmeAdmin := model.User{Name: "acme", Email: "admin@acme.io", OrganizationID: acme.ID}
+	initechAdmin := model.User{Name: "initech", Email: "admin@initech.io", OrganizationID: initech.ID}
+	for _, user := range []*model.User{&acmeAdmin, &initechAdmin} {
+		assert.NoError(t, db.Create(user).Error)
+		assert.NoError(t, db.Create(&model.Grant{Role: model.RoleAdmin, UserID: user.ID}).Error)
+	}
+
+	createZone := func(principal *model.User, name string) (*model.Zone, int) {
+		c, rec := postTestRequest("/v1/zones", `{"data": {"type": "zones", "attributes": {"name": "`+name+`"}}}`, e)
+		setPrincipal(c, principal)
+		assert.NoError(t, zoneRoute.Create(c))
+		var zone model.Zone
+		if rec.Code == http.StatusCreated {
+			assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &zone))
+		}
+		return &zone, rec.Code
+	}
+	acmeZone, code := createZone(&acmeAdmin, "martinez.io")
+	assert.Equal(t, http.StatusCreated, code)
+	initechZone, code := createZone(&initechAdmin, "martinez.io")
+	assert.Equal(t, http.StatusCreated, code)
+	assert.NotEqual(t, acmeZone.ID, initechZone.ID)
+
+	t.Run("zone quota", func(t *testing.T) {
+		_, code := createZone(&acmeAdmin, "other.io")
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("list the zones of the organization", func(t *testing.T) {
+		c, rec := getTestRequest("/v1/zones", e)
+		setPrincipal(c, &acmeAdmin)
+		assert.NoError(t, zoneRoute.List(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var zones []model.Zone
+		assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &zones))
+		if assert.Len(t, zones, 1) {
+			assert.Equal(t, acmeZone.ID, zones[0].ID)
+		}
+	})
+
+	t.Run("read a zone of another organization", func(t *testing.T) {
+		c, rec := getTestRequest("/v1/zones/"+initechZone.ID, e)
+		setPrincipal(c, &acmeAdmin)
+		c.SetParamNames("id")
+		c.SetParamValues(initechZone.ID)
+		assert.NoError(t, zoneRoute.Get(c))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("delete a zone of another organization", func(t *testing.T) {
+		c, rec := deleteTestRequest("/v1/zones/"+initechZone.ID, "", e)
+		setPrincipal(c, &acmeAdmin)
+		c.SetParamNames("id")
+		c.SetParamValues(initechZone.ID)
+		assert.NoError(t, zoneRoute.Delete(c))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, initechZone.Get(db, false))
+	})
+
+	t.Run("read another organization", func(t *testing.T) {
+		c, rec := getTestRequest("/v1/organizations/"+initech.ID, e)
+		setPrincipal(c, &acmeAdmin)
+		c.SetParamNames("id")
+		c.SetParamValues(initech.ID)
+		assert.NoError(t, organizationRoute.Get(c))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("shared backends", func(t *testing.T) {
+		shared := model.Backend{Name: "shared", Type: model.BackendPowerDNS, Config: model.BackendConfig{APIURL: "http://127.0.0.1:8081", APIKey: "secret"}}
+		assert.NoError(t, db.Create(&shared).Error)
+		backendRoute := &BackendRoute{db: db}
+
+		c, rec := getTestRequest("/v1/backends/"+shared.ID, e)
+		setPrincipal(c, &acmeAdmin)
+		c.SetParamNames("id")
+		c.SetParamValues(shared.ID)
+		assert.NoError(t, backendRoute.Get(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"name": "shared", "type": "powerdns"}`, string(attributes(t, rec.Body.Bytes())))
+
+		c, rec = getTestRequest("/v1/backends", e)
+		setPrincipal(c, &acmeAdmin)
+		assert.NoError(t, backendRoute.List(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "127.0.0.1")
+
+		// The operators still see the config of the shared backends, the secrets aside
+		c, rec = getTestRequest("/v1/backends/"+shared.ID, e)
+		c.SetParamNames("id")
+		c.SetParamValues(shared.ID)
+		assert.NoError(t, backendRoute.Get(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "127.0.0.1")
+		assert.NotContains(t, rec.Body.String(), "secret")
+	})
+
+	t.Run("list organizations", func(t *testing.T) {
+		c, rec := getTestRequest("/v1/organizations", e)
+		setPrincipal(c, &acmeAdmin)
+		assert.NoError(t, organizationRoute.List(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var organizations []model.Organization
+		assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &organizations))
+		if assert.Len(t, organizations, 1) {
+			assert.Equal(t, acme.ID, organizations[0].ID)
+		}
+	})
+}
+
+// attributes returns the attributes of the resource of a jsonapi document
+func attributes(t *testing.T, body []byte) json.RawMessage {
+	var document struct {
+		Data struct {
+			Attributes json.RawMessage `json:"attributes"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &document))
+	return document.Data.Attributes
+}
@@ -3,7 +3,9 @@ package api
 import (
 	"fmt"
 	"math"
+	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/DataDog/jsonapi"
 	"gorm.io/gorm"
@@ -20,6 +22,18 @@ type pagination struct {
 	Type     string      `json:"-"`
 	Self     string      `json:"-"`
 	Data     interface{} `jsonapi:"primary,hosts"`
+
+	// After and Before are the cursors of cursor pagination, see Page
+	After  *string `json:"-"`
+	Before *string `json:"-"`
+	// Count asks paginate for Total, the last page of offset pagination is only linked when the total is known
+	Count bool `json:"-"`
+	// More is set by Window when resources follow the page, or precede it when paging backwards
+	More bool `json:"-"`
+	// firstID and lastID are the ids of the first and last resources of the page, the cursors of the pages
+	// around it
+	firstID string
+	lastID  string
 }
 
 func (p *pagination) AtoiNumber(Number string) (err error) {
@@ -40,22 +54,84 @@ func (p *pagination) AtoiSize(size string) (err error) {
 	return err
 }
 
+// SetLinks sets the links to the pages around the current one, baseURL may already hold query parameters
 func (p *pagination) SetLinks(baseURL string) {
-	totalPages := int(math.Ceil(float64(p.Total) / float64(p.Size)))
+	if strings.Contains(baseURL, "?") {
+		baseURL += "&"
+	} else {
+		baseURL += "?"
+	}
+	if p.After != nil || p.Before != nil {
+		p.setCursorLinks(baseURL)
+		return
+	}
 
+	p.First = p.link(baseURL, "page[number]=0")
+	p.Self = p.link(baseURL, fmt.Sprintf("page[number]=%d", p.Number))
 	if p.Number > 0 {
-		p.Previous = fmt.Sprintf("%s?page[number]=%d&page[size]=%d", baseURL, p.Number-1, p.Size)
+		p.Previous = p.link(baseURL, fmt.Sprintf("page[number]=%d", p.Number-1))
+	}
+	if !p.Count && p.Total == 0 {
+		// Without the total the last page is unknown, Window tells whether there is a next one
+		if p.More {
+			p.Next = p.link(baseURL, fmt.Sprintf("page[number]=%d", p.Number+1))
+		}
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(p.Total) / float64(p.Size)))
+	if totalPages == 0 {
+		totalPages = 1
 	}
 	if p.Number < totalPages-1 {
-		p.Next = fmt.Sprintf("%s?page[number]=%d&page[size]=%d", baseURL, p.Number+1, p.Size)
+		p.Next = p.link(baseURL, fmt.Sprintf("page[number]=%d", p.Number+1))
 	}
-	p.First = fmt.Sprintf("%s?page[number]=0&page[size]=%d", baseURL, p.Size)
-	p.Last = fmt.Sprintf("%s?page[number]=%d&page[size]=%d", baseURL, totalPages-1, p.Size)
+	p.Last = p.link(baseURL, fmt.Sprintf("page[number]=%d", totalPages-1))
 	if p.Number >= totalPages-1 {
-		p.Self = fmt.Sprintf("%s?page[number]=%d&page[size]=%d", baseURL, totalPages-1, p.Size)
-	} else {
-		p.Self = fmt.Sprintf("%s?page[number]=%d&page[size]=%d", baseURL, p.Number, p.Size)
+		p.Self = p.Last
+	}
+}
+
+// setCursorLinks sets the links of cursor pagination, none of them carries an empty cursor. The first page is
+// the first page of the unsorted resources, ordered by id as well, and the last page isn't linked as only an
+// empty cursor reaches it.
+func (p *pagination) setCursorLinks(baseURL string) {
+	after := func(id string) string { return p.link(baseURL, "page[after]="+id) }
+	before := func(id string) string { return p.link(baseURL, "page[before]="+id) }
+
+	p.First = p.link(baseURL, "")
+	forward := p.After != nil
+	switch {
+	case forward && *p.After == "":
+		p.Self = p.First
+	case forward:
+		p.Self = after(*p.After)
+	case *p.Before != "":
+		p.Self = before(*p.Before)
+	}
+	if p.firstID == "" {
+		// An empty page has no resource to start the pages around it from
+		return
 	}
+	if (forward && p.More) || (!forward && *p.Before != "") {
+		p.Next = after(p.lastID)
+	}
+	if (forward && *p.After != "") || (!forward && p.More) {
+		p.Previous = before(p.firstID)
+	}
+}
+
+// link returns the link to page, keeping the size and whether the resources are counted. The first page of
+// the resources needs no page parameter.
+func (p *pagination) link(baseURL string, page string) string {
+	if page != "" {
+		page += "&"
+	}
+	link := fmt.Sprintf("%s%spage[size]=%d", baseURL, page, p.Size)
+	if p.Count {
+		link += "&page[total]=true"
+	}
+	return link
 }
 
 func (p *pagination) Link() *jsonapi.Link {
@@ -68,10 +144,55 @@ func (p *pagination) Link() *jsonapi.Link {
 	}
 }
 
+// Meta returns the marshal option adding the total to the document, when counted
+func (p *pagination) Meta() jsonapi.MarshalOption {
+	if !p.Count {
+		return jsonapi.MarshalMeta(nil)
+	}
+	return jsonapi.MarshalMeta(map[string]int64{"total": p.Total})
+}
+
+// Window trims the resources found through paginate to the page, value points to the slice they were found
+// into. Resources are found one past the page to know whether more follow, and backwards when paging before a
+// cursor.
+func (p *pagination) Window(value interface{}) {
+	resources := reflect.ValueOf(value).Elem()
+	if resources.Len() > p.Size {
+		p.More = true
+		resources.Set(resources.Slice(0, p.Size))
+	}
+	if p.Before != nil {
+		swap := reflect.Swapper(resources.Interface())
+		for i, j := 0, resources.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+	if resources.Len() > 0 {
+		p.firstID = reflect.Indirect(resources.Index(0)).FieldByName("ID").String()
+		p.lastID = reflect.Indirect(resources.Index(resources.Len() - 1)).FieldByName("ID").String()
+	}
+}
+
+// paginate returns a scope limiting the results to the page, plus one resource telling whether more follow,
+// Window trims them once found. The resources are only counted when asked for, counting large tables is slow.
 func paginate(value interface{}, pages *pagination, db *gorm.DB) func(db *gorm.DB) *gorm.DB {
-	db.Model(value).Count(&pages.Total)
+	if pages.Count {
+		db.Model(value).Count(&pages.Total)
+	}
 
 	return func(db *gorm.DB) *gorm.DB {
-		return db.Offset(pages.Number).Limit(pages.Size)
+		switch {
+		case pages.After != nil:
+			if *pages.After != "" {
+				db = db.Where("id > ?", *pages.After)
+			}
+			return db.Order("id").Limit(pages.Size + 1)
+		case pages.Before != nil:
+			if *pages.Before != "" {
+				db = db.Where("id < ?", *pages.Before)
+			}
+			return db.Order("id DESC").Limit(pages.Size + 1)
+		}
+		return db.Offset(pages.Number * pages.Size).Limit(pages.Size + 1)
 	}
 }
@@ -3,6 +3,7 @@ package api
 import (
 	"testing"
 
+	"github.com/ncode/port53/pkg/model"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
@@ -118,6 +119,117 @@ func TestSetLinks(t *testing.T) {
 				self:     baseURL + "?page[number]=1&page[size]=10",
 			},
 		},
+		{
+			name: "counted page",
+			paginate: &pagination{
+				Number: 1,
+				Size:   10,
+				Total:  21,
+				Count:  true,
+			},
+			want: struct {
+				first    string
+				last     string
+				previous string
+				next     string
+				self     string
+			}{
+				first:    baseURL + "?page[number]=0&page[size]=10&page[total]=true",
+				last:     baseURL + "?page[number]=2&page[size]=10&page[total]=true",
+				previous: baseURL + "?page[number]=0&page[size]=10&page[total]=true",
+				next:     baseURL + "?page[number]=2&page[size]=10&page[total]=true",
+				self:     baseURL + "?page[number]=1&page[size]=10&page[total]=true",
+			},
+		},
+		{
+			name: "uncounted page followed by more",
+			paginate: &pagination{
+				Number: 1,
+				Size:   10,
+				More:   true,
+			},
+			want: struct {
+				first    string
+				last     string
+				previous string
+				next     string
+				self     string
+			}{
+				first:    baseURL + "?page[number]=0&page[size]=10",
+				last:     "",
+				previous: baseURL + "?page[number]=0&page[size]=10",
+				next:     baseURL + "?page[number]=2&page[size]=10",
+				self:     baseURL + "?page[number]=1&page[size]=10",
+			},
+		},
+		{
+			name: "first page of cursor pagination",
+			paginate: &pagination{
+				Size:    2,
+				After:   cursor(""),
+				More:    true,
+				firstID: "01F1ZQZJXQXZJXZJXZJXZJXZR1",
+				lastID:  "01F1ZQZJXQXZJXZJXZJXZJXZR2",
+			},
+			want: struct {
+				first    string
+				last     string
+				previous string
+				next     string
+				self     string
+			}{
+				first:    baseURL + "?page[size]=2",
+				last:     "",
+				previous: "",
+				next:     baseURL + "?page[after]=01F1ZQZJXQXZJXZJXZJXZJXZR2&page[size]=2",
+				self:     baseURL + "?page[size]=2",
+			},
+		},
+		{
+			name: "page after a cursor",
+			paginate: &pagination{
+				Size:    2,
+				After:   cursor("01F1ZQZJXQXZJXZJXZJXZJXZR1"),
+				More:    true,
+				firstID: "01F1ZQZJXQXZJXZJXZJXZJXZR2",
+				lastID:  "01F1ZQZJXQXZJXZJXZJXZJXZR3",
+			},
+			want: struct {
+				first    string
+				last     string
+				previous string
+				next     string
+				self     string
+			}{
+				first:    baseURL + "?page[size]=2",
+				last:     "",
+				previous: baseURL + "?page[before]=01F1ZQZJXQXZJXZJXZJXZJXZR2&page[size]=2",
+				next:     baseURL + "?page[after]=01F1ZQZJXQXZJXZJXZJXZJXZR3&page[size]=2",
+				self:     baseURL + "?page[after]=01F1ZQZJXQXZJXZJXZJXZJXZR1&page[size]=2",
+			},
+		},
+		{
+			name: "last page of cursor pagination",
+			paginate: &pagination{
+				Size:    2,
+				Before:  cursor(""),
+				firstID: "01F1ZQZJXQXZJXZJXZJXZJXZR4",
+				lastID:  "01F1ZQZJXQXZJXZJXZJXZJXZR5",
+			},
+			want: struct {
+				first    string
+				last     string
+				previous string
+				next     string
+				self     string
+			}{
+				first:    baseURL + "?page[size]=2",
+				last:     "",
+				previous: "",
+				next:     "",
+				self:     "",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -151,3 +263,24 @@ func TestLink(t *testing.T) {
 	assert.Equal(t, p.Next, link.Next)
 	assert.Equal(t, p.Self, link.Self)
 }
+
+func TestWindow(t *testing.T) {
+	records := []*model.Record{{ID: "01F1ZQZJXQXZJXZJXZJXZJXZR5"}, {ID: "01F1ZQZJXQXZJXZJXZJXZJXZR4"}, {ID: "01F1ZQZJXQXZJXZJXZJXZJXZR3"}}
+	before := "01F1ZQZJXQXZJXZJXZJXZJXZR6"
+	p := &pagination{Size: 2, Before: &before}
+	p.Window(&records)
+	assert.True(t, p.More)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "01F1ZQZJXQXZJXZJXZJXZJXZR4", records[0].ID)
+		assert.Equal(t, "01F1ZQZJXQXZJXZJXZJXZJXZR5", records[1].ID)
+	}
+	assert.Equal(t, "01F1ZQZJXQXZJXZJXZJXZJXZR4", p.firstID)
+	assert.Equal(t, "01F1ZQZJXQXZJXZJXZJXZJXZR5", p.lastID)
+
+	zones := []model.Zone{{ID: "01F1ZQZJXQXZJXZJXZJXZJXZJX"}}
+	p = &pagination{Size: 2}
+	p.Window(&zones)
+	assert.False(t, p.More)
+	assert.Len(t, zones, 1)
+	assert.Equal(t, "01F1ZQZJXQXZJXZJXZJXZJXZJX", p.lastID)
+}
@@ -1,11 +1,16 @@
 package api
 
 import (
+	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/DataDog/jsonapi"
 	"github.com/labstack/echo/v4"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
 )
 
 // Query is a struct that represents a query to the API
@@ -19,6 +24,8 @@ type Query struct {
 	Filters  map[string][]string
 	Sort     []string
 	Page     *Page
+	// Paths are the relationship paths of the include parameter, Includes also holds the types of the fieldsets
+	Paths []string
 }
 
 type Include struct {
@@ -28,6 +35,12 @@ type Include struct {
 type Page struct {
 	Size   int
 	Number int
+	// After and Before are the cursors of cursor pagination, the id of the resource the page starts after or
+	// ends before. An empty cursor starts from the first or the last resource.
+	After  *string
+	Before *string
+	// Total asks for the number of resources, they aren't counted otherwise
+	Total bool
 }
 
 // ParseQuery parses a query string into a Query struct
@@ -72,6 +85,7 @@ func ParseQuery(c echo.Context) (*Query, error) {
 				if _, ok := query.Includes[v]; !ok {
 					query.Includes[v] = &Include{}
 				}
+				query.Paths = append(query.Paths, v)
 			}
 
 		case key == "sort":
@@ -98,25 +112,148 @@ func ParseQuery(c echo.Context) (*Query, error) {
 				query.Page = &Page{}
 			}
 			query.Page.Number = n
+		case key == "page[after]":
+			// parse cursor
+			if query.Page == nil {
+				query.Page = &Page{}
+			}
+			query.Page.After = &value
+		case key == "page[before]":
+			// parse cursor
+			if query.Page == nil {
+				query.Page = &Page{}
+			}
+			query.Page.Before = &value
+		case key == "page[total]":
+			// parse total
+			total, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, err
+			}
+			if query.Page == nil {
+				query.Page = &Page{}
+			}
+			query.Page.Total = total
 		}
 	}
 	return query, nil
 }
 
+// Pagination returns the pagination of the query, pages hold ten resources unless sized. Pages of cursor
+// pagination are ordered by id, the ULIDs follow the creation of the resources, so cursors can't be combined
+// with sort.
+func (q *Query) Pagination() (*pagination, *jsonapi.Error) {
+	p := &pagination{Number: 0, Size: 10}
+	if q.Page == nil {
+		return p, nil
+	}
+	if q.Page.Size > 0 {
+		p.Size = q.Page.Size
+	}
+	p.Number, p.After, p.Before, p.Count = q.Page.Number, q.Page.After, q.Page.Before, q.Page.Total
+	invalid := func(parameter string, detail string) *jsonapi.Error {
+		return &jsonapi.Error{
+			Code:   codeInvalidParameter,
+			Title:  "Invalid page",
+			Detail: detail,
+			Source: &jsonapi.ErrorSource{Parameter: parameter},
+		}
+	}
+	switch {
+	case p.Number < 0:
+		return nil, invalid("page[number]", "The page number can't be negative")
+	case p.After != nil && p.Before != nil:
+		return nil, invalid("page[before]", "A page can't both start after and end before a cursor")
+	case (p.After != nil || p.Before != nil) && len(q.Sort) > 0:
+		return nil, invalid("sort", "Pages of cursor pagination are ordered by id and can't be sorted")
+	}
+	for parameter, cursor := range map[string]*string{"page[after]": p.After, "page[before]": p.Before} {
+		if cursor == nil || *cursor == "" {
+			continue
+		}
+		if _, err := ulid.Parse(*cursor); err != nil {
+			return nil, invalid(parameter, fmt.Sprintf("The cursor %s isn't the id of a resource", *cursor))
+		}
+	}
+	return p, nil
+}
+
+// Sorting returns a scope ordering the results by the sort parameter, columns maps the fields the resources may
+// be sorted by to their columns. Fields prefixed with a dash sort in descending order, the id breaks the ties
+// so pages stay stable. Unsorted resources are ordered by id, as the pages of cursor pagination are.
+func (q *Query) Sorting(columns map[string]string) (func(db *gorm.DB) *gorm.DB, *jsonapi.Error) {
+	var order []string
+	for _, field := range q.Sort {
+		direction := "ASC"
+		if strings.HasPrefix(field, "-") {
+			direction = "DESC"
+			field = strings.TrimPrefix(field, "-")
+		}
+		column, ok := columns[field]
+		if !ok {
+			return nil, &jsonapi.Error{
+				Code:   codeInvalidParameter,
+				Title:  "Unsupported sort field",
+				Detail: fmt.Sprintf("The resources can't be sorted by %s", field),
+				Source: &jsonapi.ErrorSource{Parameter: "sort"},
+			}
+		}
+		order = append(order, column+" "+direction)
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order(strings.Join(append(order, "id"), ", "))
+	}, nil
+}
+
+// Included returns the relationship paths of the include parameter, relationships lists the ones the resources
+// may include. Nested paths aren't supported.
+func (q *Query) Included(relationships ...string) (map[string]bool, *jsonapi.Error) {
+	included := make(map[string]bool)
+	for _, path := range q.Paths {
+		if path == "" {
+			continue
+		}
+		found := false
+		for _, relationship := range relationships {
+			if path == relationship {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, &jsonapi.Error{
+				Code:   codeInvalidParameter,
+				Title:  "Unsupported include",
+				Detail: fmt.Sprintf("The resources can't include %s", path),
+				Source: &jsonapi.ErrorSource{Parameter: "include"},
+			}
+		}
+		included[path] = true
+	}
+	return included, nil
+}
+
 func (q *Query) BuildQuery() (query string) {
 	var b strings.Builder
 
-	// Build filter parameters
-	for k, v := range q.Filters {
-		for _, vv := range v {
-			b.WriteString("filter[" + k + "]=" + vv + "&")
+	// Build filter parameters, values are escaped as they may hold the + of a time zone offset
+	for _, k := range q.filterKeys() {
+		for _, vv := range q.Filters[k] {
+			b.WriteString("filter[" + k + "]=" + url.QueryEscape(vv) + "&")
 		}
 	}
 
+	// Keys are sorted so the links of a query are always the same
+	includes := make([]string, 0, len(q.Includes))
+	for k := range q.Includes {
+		includes = append(includes, k)
+	}
+	sort.Strings(includes)
+
 	// Build include parameters
 	if len(q.Includes) > 0 {
 		b.WriteString("include=")
-		for k := range q.Includes {
+		for _, k := range includes {
 			b.WriteString(k + ",")
 		}
 		buff := b.String()
@@ -126,7 +263,8 @@ func (q *Query) BuildQuery() (query string) {
 	}
 
 	// Build field parameters
-	for k, v := range q.Includes {
+	for _, k := range includes {
+		v := q.Includes[k]
 		if len(v.Fields) == 0 {
 			continue
 		}
@@ -155,8 +293,39 @@ func (q *Query) BuildQuery() (query string) {
 	// Build page parameters
 	if q.Page != nil {
 		b.WriteString("page[size]=" + strconv.Itoa(q.Page.Size) + "&")
-		b.WriteString("page[number]=" + strconv.Itoa(q.Page.Number) + "&")
+		switch {
+		case q.Page.After != nil:
+			b.WriteString("page[after]=" + *q.Page.After + "&")
+		case q.Page.Before != nil:
+			b.WriteString("page[before]=" + *q.Page.Before + "&")
+		default:
+			b.WriteString("page[number]=" + strconv.Itoa(q.Page.Number) + "&")
+		}
+		if q.Page.Total {
+			b.WriteString("page[total]=true&")
+		}
 	}
 
 	return strings.TrimSuffix(b.String(), "&")
 }
+
+// Link returns the link to path along with the parameters of the query but the page ones, pagination links
+// add those of each page
+func (q *Query) Link(path string) string {
+	query := *q
+	query.Page = nil
+	if parameters := query.BuildQuery(); parameters != "" {
+		return path + "?" + parameters
+	}
+	return path
+}
+
+// filterKeys returns the sorted keys of the filters of the query
+func (q *Query) filterKeys() []string {
+	keys := make([]string, 0, len(q.Filters))
+	for key := range q.Filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -4,10 +4,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func TestParseQuery(t *testing.T) {
@@ -63,6 +68,22 @@ func TestParseQuery(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:        "parse cursor",
+			queryString: "page[size]=20&page[after]=01F1ZQZJXQXZJXZJXZJXZJXZJX&page[total]=true",
+			expected: &Query{
+				Page: &Page{
+					Size:  20,
+					After: cursor("01F1ZQZJXQXZJXZJXZJXZJXZJX"),
+					Total: true,
+				},
+			},
+		},
+		{
+			name:          "invalid total",
+			queryString:   "page[total]=maybe",
+			expectedError: `strconv.ParseBool: parsing "maybe": invalid syntax`,
+		},
 		{
 			name:          "parse pagination",
 			queryString:   "page[size]=a&page[number]=1",
@@ -225,6 +246,16 @@ func TestBuildQuery(t *testing.T) {
 			},
 			expected: "page[size]=10&page[number]=2",
 		},
+		{
+			name: "cursor query",
+			query: Query{
+				Filters:  make(map[string][]string),
+				Includes: make(map[string]*Include),
+				Sort:     []string{},
+				Page:     &Page{Size: 10, Before: cursor("01F1ZQZJXQXZJXZJXZJXZJXZJX"), Total: true},
+			},
+			expected: "page[size]=10&page[before]=01F1ZQZJXQXZJXZJXZJXZJXZJX&page[total]=true",
+		},
 		{
 			name: "all query",
 			query: Query{
@@ -242,12 +273,256 @@ func TestBuildQuery(t *testing.T) {
 		},
 	}
 
+	// Filters and includes are maps, their parameters are compared regardless of their order
+	parameters := func(query string) []string {
+		split := strings.Split(query, "&")
+		sort.Strings(split)
+		return split
+	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			result := tc.query.BuildQuery()
-			if result != tc.expected {
+			if !reflect.DeepEqual(parameters(result), parameters(tc.expected)) {
 				t.Errorf("BuildQuery() = %s; want %s", result, tc.expected)
 			}
 		})
 	}
 }
+
+func TestBuildQuery_Stable(t *testing.T) {
+	query := &Query{
+		Filters:  map[string][]string{"title": {"Hello"}, "body": {"Lorem"}, "author": {"Juliano"}},
+		Includes: map[string]*Include{"comments": {}, "author": {}},
+	}
+	// Pagination links are built from the query, they must not change from a request to the next
+	expected := "filter[author]=Juliano&filter[body]=Lorem&filter[title]=Hello&include=author,comments"
+	for i := 0; i < 10; i++ {
+		if result := query.BuildQuery(); result != expected {
+			t.Fatalf("BuildQuery() = %s; want %s", result, expected)
+		}
+	}
+}
+
+func TestQuery_Sorting(t *testing.T) {
+	columns := map[string]string{"name": "name", "ttl": "ttl"}
+	testCases := []struct {
+		name          string
+		sort          []string
+		expectedOrder string
+		expectedError bool
+	}{
+		{
+			name:          "no sort",
+			expectedOrder: "id",
+		},
+		{
+			name:          "multiple keys",
+			sort:          []string{"-name", "ttl"},
+			expectedOrder: "name DESC, ttl ASC, id",
+		},
+		{
+			name:          "field outside of the whitelist",
+			sort:          []string{"name", "-content"},
+			expectedError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query := &Query{Sort: tc.sort}
+			sorting, jsonErr := query.Sorting(columns)
+			if tc.expectedError {
+				if jsonErr == nil || jsonErr.Source == nil || jsonErr.Source.Parameter != "sort" {
+					t.Fatalf("expected an error on the sort parameter, got %v", jsonErr)
+				}
+				return
+			}
+			if jsonErr != nil {
+				t.Fatalf("unexpected error: %v", jsonErr)
+			}
+			db, err := gorm.Open(sqlite.Open("file:query_sorting?mode=memory&cache=shared"), &gorm.Config{DryRun: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			stmt := db.Scopes(sorting).Find(&[]model.Zone{}).Statement
+			order := ""
+			if clause, ok := stmt.Clauses["ORDER BY"]; ok {
+				stmt.SQL.Reset()
+				clause.Build(stmt)
+				order = strings.TrimPrefix(stmt.SQL.String(), "ORDER BY ")
+			}
+			if order != tc.expectedOrder {
+				t.Errorf("expected order %q but got %q", tc.expectedOrder, order)
+			}
+		})
+	}
+}
+
+func TestQuery_Included(t *testing.T) {
+	query := &Query{Paths: []string{"records", "backends"}}
+	included, jsonErr := query.Included("records", "backends")
+	if jsonErr != nil {
+		t.Fatalf("unexpected error: %v", jsonErr)
+	}
+	if !included["records"] || !included["backends"] {
+		t.Errorf("expected records and backends to be included, got %v", included)
+	}
+
+	query = &Query{Paths: []string{"records.zones"}}
+	_, jsonErr = query.Included("records", "backends")
+	if jsonErr == nil || jsonErr.Source == nil || jsonErr.Source.Parameter != "include" {
+		t.Errorf("expected an error on the include parameter, got %v", jsonErr)
+	}
+}
+
+func TestQuery_Filtering(t *testing.T) {
+	fields := map[string]filterField{
+		"name":       {column: "name", kind: filterText, normalize: strings.ToLower},
+		"ttl":        numberFilter("ttl"),
+		"updated_at": timeFilter("updated_at"),
+	}
+	testCases := []struct {
+		name              string
+		filters           map[string][]string
+		expectedWhere     string
+		expectedVars      []interface{}
+		expectedCode      string
+		expectedParameter string
+	}{
+		{
+			name:          "equality",
+			filters:       map[string][]string{"name": {"Martinez.io"}},
+			expectedWhere: "WHERE name = ?",
+			expectedVars:  []interface{}{"martinez.io"},
+		},
+		{
+			name:          "operators",
+			filters:       map[string][]string{"name][prefix": {"in_ternal"}, "ttl][lt": {"300"}, "ttl][in": {"60,120"}},
+			expectedWhere: `WHERE name LIKE ? ESCAPE '\' AND ttl IN (?,?) AND ttl < ?`,
+			expectedVars:  []interface{}{`in\_ternal%`, 60, 120, 300},
+		},
+		{
+			name:          "date",
+			filters:       map[string][]string{"updated_at][gte": {"2023-04-01"}},
+			expectedWhere: "WHERE updated_at >= ?",
+			expectedVars:  []interface{}{time.Date(2023, 4, 1, 0, 0, 0, 0, time.Local)},
+		},
+		{
+			name:              "field outside of the whitelist",
+			filters:           map[string][]string{"content][contains": {"10.1.2.3"}},
+			expectedCode:      codeUnknownFilter,
+			expectedParameter: "filter[content]",
+		},
+		{
+			name:              "unsupported operator",
+			filters:           map[string][]string{"name][lt": {"b"}},
+			expectedCode:      codeInvalidParameter,
+			expectedParameter: "filter[name][lt]",
+		},
+		{
+			name:              "invalid value",
+			filters:           map[string][]string{"ttl][gt": {"an hour"}},
+			expectedCode:      codeInvalidParameter,
+			expectedParameter: "filter[ttl][gt]",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query := &Query{Filters: tc.filters}
+			filtering, jsonErr := query.Filtering(fields)
+			if tc.expectedCode != "" {
+				if jsonErr == nil || jsonErr.Code != tc.expectedCode || jsonErr.Source == nil || jsonErr.Source.Parameter != tc.expectedParameter {
+					t.Fatalf("expected a %s error on %s, got %v", tc.expectedCode, tc.expectedParameter, jsonErr)
+				}
+				return
+			}
+			if jsonErr != nil {
+				t.Fatalf("unexpected error: %v", jsonErr)
+			}
+			db, err := gorm.Open(sqlite.Open("file:query_filtering?mode=memory&cache=shared"), &gorm.Config{DryRun: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			stmt := db.Table("zones").Scopes(filtering).Find(&[]map[string]interface{}{}).Statement
+			stmt.SQL.Reset()
+			stmt.Vars = nil
+			stmt.Clauses["WHERE"].Build(stmt)
+			if stmt.SQL.String() != tc.expectedWhere {
+				t.Errorf("expected %q but got %q", tc.expectedWhere, stmt.SQL.String())
+			}
+			if !reflect.DeepEqual(stmt.Vars, tc.expectedVars) {
+				t.Errorf("expected values %v but got %v", tc.expectedVars, stmt.Vars)
+			}
+		})
+	}
+}
+
+func TestQuery_Pagination(t *testing.T) {
+	testCases := []struct {
+		name              string
+		query             Query
+		expected          *pagination
+		expectedParameter string
+	}{
+		{
+			name:     "default",
+			expected: &pagination{Size: 10},
+		},
+		{
+			name:     "offset",
+			query:    Query{Page: &Page{Size: 25, Number: 3, Total: true}},
+			expected: &pagination{Size: 25, Number: 3, Count: true},
+		},
+		{
+			name:     "cursor",
+			query:    Query{Page: &Page{After: cursor("01F1ZQZJXQXZJXZJXZJXZJXZJX")}},
+			expected: &pagination{Size: 10, After: cursor("01F1ZQZJXQXZJXZJXZJXZJXZJX")},
+		},
+		{
+			name:     "cursor from the last resource",
+			query:    Query{Page: &Page{Before: cursor("")}},
+			expected: &pagination{Size: 10, Before: cursor("")},
+		},
+		{
+			name:              "negative number",
+			query:             Query{Page: &Page{Number: -1}},
+			expectedParameter: "page[number]",
+		},
+		{
+			name:              "both cursors",
+			query:             Query{Page: &Page{After: cursor(""), Before: cursor("")}},
+			expectedParameter: "page[before]",
+		},
+		{
+			name:              "sorted cursor",
+			query:             Query{Sort: []string{"name"}, Page: &Page{After: cursor("")}},
+			expectedParameter: "sort",
+		},
+		{
+			name:              "invalid cursor",
+			query:             Query{Page: &Page{After: cursor("martinez.io")}},
+			expectedParameter: "page[after]",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, jsonErr := tc.query.Pagination()
+			if tc.expectedParameter != "" {
+				if jsonErr == nil || jsonErr.Source == nil || jsonErr.Source.Parameter != tc.expectedParameter {
+					t.Fatalf("expected an error on %s, got %v", tc.expectedParameter, jsonErr)
+				}
+				return
+			}
+			if jsonErr != nil {
+				t.Fatalf("unexpected error: %v", jsonErr)
+			}
+			if !reflect.DeepEqual(p, tc.expected) {
+				t.Errorf("expected pagination %+v but got %+v", tc.expected, p)
+			}
+		})
+	}
+}
+
+// cursor returns a pointer to the cursor id
+func cursor(id string) *string {
+	return &id
+}
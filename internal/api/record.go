@@ -1,12 +1,17 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/DataDog/jsonapi"
 	"github.com/labstack/echo/v4"
+	"github.com/miekg/dns"
 	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/rdata"
+	"github.com/ncode/port53/pkg/zonefile"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
 )
@@ -15,6 +20,27 @@ type RecordRoute struct {
 	db *gorm.DB
 }
 
+// recordSorting maps the fields records may be sorted by to their columns
+var recordSorting = map[string]string{
+	"name":       "name",
+	"type":       "type",
+	"ttl":        "ttl",
+	"content":    "content",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// recordFilters maps the fields records may be filtered by to their columns
+var recordFilters = map[string]filterField{
+	"name":       textFilter("name"),
+	"type":       {column: "type", kind: filterText, normalize: strings.ToUpper},
+	"content":    textFilter("content"),
+	"zone":       textFilter("zone_id"),
+	"ttl":        numberFilter("ttl"),
+	"created_at": timeFilter("created_at"),
+	"updated_at": timeFilter("updated_at"),
+}
+
 // Create creates a new record
 func (r *RecordRoute) Create(c echo.Context) (err error) {
 	var record model.Record
@@ -22,91 +48,167 @@ func (r *RecordRoute) Create(c echo.Context) (err error) {
 		return err
 	}
 	if record.Name == "" {
-		return c.String(http.StatusBadRequest, "Name is required")
+		return JSONAPIError(c, http.StatusBadRequest, required("Name", "/data/attributes/name"))
 	}
 	if record.Zone == nil {
-		return c.String(http.StatusBadRequest, "Zone is required")
+		return JSONAPIError(c, http.StatusBadRequest, required("Zone", "/data/relationships/zones"))
 	}
 	record.ZoneID = record.Zone.ID
-	err = r.db.Create(&record).Error
+	visible, err := r.zoneVisible(c, record.ZoneID)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	allowed, err := r.allowed(c, record.ZoneID, record.Name, record.Type)
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed: ") {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	err = record.Create(r.db)
+	if err != nil {
+		var validationErr *rdata.Error
+		if errors.As(err, &validationErr) {
+			return JSONAPIError(c, http.StatusBadRequest, recordValidationError(validationErr))
+		}
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		if strings.Contains(err.Error(), "UNIQUE constraint failed: records.zone_id") {
+			var existingRecord model.Record
+			err = r.db.First(&existingRecord, "zone_id = ? AND name = ? AND type = ? AND content = ?", record.ZoneID, record.Name, record.Type, record.Content).Error
+			if err != nil {
+				return err
+			}
+			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/records/%s", viper.GetString("serviceUrl"), existingRecord.ID))
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("Record"))
+		} else if strings.Contains(err.Error(), "UNIQUE constraint failed: ") {
 			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/records/%s", viper.GetString("serviceUrl"), record.ID))
-			return c.String(http.StatusConflict, "Record already exists")
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("Record"))
 		}
-		return c.String(http.StatusInternalServerError, err.Error())
+		return err
 	}
 	return JSONAPI(c, http.StatusCreated, record)
 }
 
-// List lists all records
+// List lists all records, their zones are only loaded when included
 func (r *RecordRoute) List(c echo.Context) (err error) {
 	var records []model.Record
 	query, err := ParseQuery(c)
 	if err != nil {
-		return c.String(http.StatusBadRequest, "invalid query parameters")
-	}
-
-	p := &pagination{Number: 0, Size: 10}
-	if query.Page != nil {
-		p = &pagination{Number: query.Page.Number, Size: query.Page.Size}
-	}
-
-	if len(query.Filters) > 0 {
-		tx := r.db
-		for filter, content := range query.Filters {
-			for _, c := range content {
-				var f string
-				switch filter {
-				case "ttl":
-					f = "ttl = ?"
-				case "type":
-					f = "type = ?"
-				case "value":
-					f = "value = ?"
-				case "zone":
-					f = "zone_id = ?"
-				case "content":
-					f = "content = ?"
-				case "name":
-					f = "name = ?"
-				}
-				tx = tx.Where(f, c)
-			}
-		}
-		err = tx.Scopes(paginate(records, p, tx)).Find(&records).Error
-	} else {
-		err = r.db.Scopes(paginate(records, p, r.db)).Find(&records).Error
+		return JSONAPIError(c, http.StatusBadRequest, invalidQuery(err))
+	}
+	sorting, jsonErr := query.Sorting(recordSorting)
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
 	}
+	filtering, jsonErr := query.Filtering(recordFilters)
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+	included, jsonErr := query.Included("zones")
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	p, jsonErr := query.Pagination()
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	perms, err := permissions(c, r.db)
 	if err != nil {
 		return err
 	}
+	db := r.db
+	if ids, all := perms.ReadableZones(); !all {
+		db = db.Where("zone_id IN ?", ids)
+	}
+	if organizationID := tenant(c); organizationID != "" {
+		db = db.Where("zone_id IN (?)", r.db.Model(&model.Zone{}).Select("id").Where("organization_id = ?", organizationID))
+	}
+
+	tx := db.Scopes(filtering)
+	err = tx.Scopes(paginate(records, p, tx), sorting).Find(&records).Error
+	if err != nil {
+		return err
+	}
+	p.Window(&records)
 
 	if len(records) == 0 {
 		return JSONAPI(c, http.StatusOK, records)
 	}
 
+	// The zone linkage only needs the id, zones are loaded at once when included
+	zones := make(map[string]*model.Zone)
 	for pos := range records {
-		if err := records[pos].Get(r.db, true); err != nil {
+		zones[records[pos].ZoneID] = &model.Zone{ID: records[pos].ZoneID}
+	}
+	if included["zones"] {
+		ids := make([]string, 0, len(zones))
+		for id := range zones {
+			ids = append(ids, id)
+		}
+		var loaded []*model.Zone
+		err = r.db.Where("id IN ?", ids).Find(&loaded).Error
+		if err != nil {
 			return err
 		}
+		for _, zone := range loaded {
+			zones[zone.ID] = zone
+		}
 	}
+	var document compound
+	for pos := range records {
+		records[pos].Zone = zones[records[pos].ZoneID]
+		includeRecord(&document, &records[pos], included)
+	}
+
+	p.SetLinks(query.Link("/v1/records"))
+	return JSONAPIPaginated(c, http.StatusOK, records, p.Link(), p.Meta(), document.option())
+}
 
-	p.SetLinks(fmt.Sprintf("/v1/records?%s", query.BuildQuery()))
-	return JSONAPIPaginated(c, http.StatusOK, records, p.Link())
+// includeRecord includes the zone of record in document when included asks for it
+func includeRecord(document *compound, record *model.Record, included map[string]bool) {
+	if included["zones"] && record.Zone != nil {
+		document.add(record.Zone.ID, record.Zone)
+	}
 }
 
 // Get gets a record
 func (r *RecordRoute) Get(c echo.Context) (err error) {
+	query, err := ParseQuery(c)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, invalidQuery(err))
+	}
+	included, jsonErr := query.Included("zones")
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
 	record := model.Record{ID: c.Param("id")}
 	err = record.Get(r.db, true)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Record not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
 		}
 		return err
 	}
-	return JSONAPI(c, http.StatusOK, record)
+	if !reaches(c, record.Zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.CanRead(record.ZoneID) {
+		return forbidden(c)
+	}
+	var document compound
+	includeRecord(&document, &record, included)
+	return JSONAPI(c, http.StatusOK, record, document.option())
 }
 
 // Update updates a record
@@ -115,16 +217,47 @@ func (r *RecordRoute) Update(c echo.Context) (err error) {
 	err = record.Get(r.db, false)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Record not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
 		}
 		return err
 	}
+	visible, err := r.zoneVisible(c, record.ZoneID)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
+	}
 	var newRecord model.Record
 	if err := c.Bind(&newRecord); err != nil {
 		return err
 	}
+	name, rrtype := record.Name, record.Type
+	if newRecord.Name != "" {
+		name = newRecord.Name
+	}
+	if newRecord.Type != "" {
+		rrtype = newRecord.Type
+	}
+	allowed, err := r.allowed(c, record.ZoneID, record.Name, record.Type)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		allowed, err = r.allowed(c, record.ZoneID, name, rrtype)
+		if err != nil {
+			return err
+		}
+	}
+	if !allowed {
+		return forbidden(c)
+	}
 	err = record.Update(r.db, newRecord)
 	if err != nil {
+		var validationErr *rdata.Error
+		if errors.As(err, &validationErr) {
+			return JSONAPIError(c, http.StatusBadRequest, recordValidationError(validationErr))
+		}
 		return err
 	}
 	err = record.Get(r.db, true)
@@ -137,6 +270,27 @@ func (r *RecordRoute) Update(c echo.Context) (err error) {
 // Delete deletes a backend
 func (r *RecordRoute) Delete(c echo.Context) (err error) {
 	record := &model.Record{ID: c.Param("id")}
+	err = record.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return c.NoContent(http.StatusNoContent)
+		}
+		return err
+	}
+	visible, err := r.zoneVisible(c, record.ZoneID)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return c.NoContent(http.StatusNoContent)
+	}
+	allowed, err := r.allowed(c, record.ZoneID, record.Name, record.Type)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
 	err = record.Delete(r.db)
 	if err != nil && err.Error() != "record not found" {
 		return err
@@ -150,10 +304,20 @@ func (r *RecordRoute) GetZone(c echo.Context) (err error) {
 	err = record.Get(r.db, true)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Record not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
 		}
 		return err
 	}
+	if !reaches(c, record.Zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.CanRead(record.ZoneID) {
+		return forbidden(c)
+	}
 	return JSONAPI(c, http.StatusOK, record.Zone)
 }
 
@@ -163,16 +327,36 @@ func (r *RecordRoute) UpdateZone(c echo.Context) (err error) {
 	err = record.Get(r.db, true)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Record not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
 		}
 		return err
 	}
+	if !reaches(c, record.Zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
+	}
 	var newZone model.Zone
 	if err := c.Bind(&newZone); err != nil {
 		return err
 	}
+	visible, err := r.zoneVisible(c, newZone.ID)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	allowed, err := r.movable(c, &record, newZone.ID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
 	err = record.ReplaceZone(r.db, &newZone)
 	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
 		return err
 	}
 	err = record.Get(r.db, true)
@@ -183,6 +367,132 @@ func (r *RecordRoute) UpdateZone(c echo.Context) (err error) {
 	return JSONAPI(c, http.StatusOK, record.Zone)
 }
 
+// GetZoneRelationship gets the linkage of the zone of a record
+func (r *RecordRoute) GetZoneRelationship(c echo.Context) (err error) {
+	record := model.Record{ID: c.Param("id")}
+	err = record.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
+		}
+		return err
+	}
+	if !reaches(c, record.Zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.CanRead(record.ZoneID) {
+		return forbidden(c)
+	}
+	return JSONAPILinkage(c, http.StatusOK, record.LinkRelation("zones"), identifier{Type: "zones", ID: record.ZoneID})
+}
+
+// UpdateZoneRelationship moves a record to the zone of the linkage, records always belong to a zone so the
+// linkage can't be null
+func (r *RecordRoute) UpdateZoneRelationship(c echo.Context) (err error) {
+	record := model.Record{ID: c.Param("id")}
+	err = record.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
+		}
+		return err
+	}
+	if !reaches(c, record.Zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Record"))
+	}
+	zoneID, jsonErr := toOneLinkage(c, "zones")
+	if jsonErr != nil {
+		return JSONAPIError(c, *jsonErr.Status, jsonErr)
+	}
+	if zoneID == "" {
+		return JSONAPIError(c, http.StatusForbidden, &jsonapi.Error{
+			Title:  "Zone required",
+			Detail: "Records always belong to a zone, delete the record instead",
+			Source: &jsonapi.ErrorSource{Pointer: "/data"},
+		})
+	}
+	zones, found, err := findZones(c, r.db, []string{zoneID})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	allowed, err := r.movable(c, &record, zoneID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	err = record.ReplaceZone(r.db, zones[0])
+	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// movable reports whether the principal may move the record to the zone with the given id, the grants must
+// allow the record in both zones
+func (r *RecordRoute) movable(c echo.Context, record *model.Record, zoneID string) (bool, error) {
+	allowed, err := r.allowed(c, record.ZoneID, record.Name, record.Type)
+	if err != nil || !allowed {
+		return false, err
+	}
+	return r.allowed(c, zoneID, record.Name, record.Type)
+}
+
+// allowed reports whether the principal may change the records named name of type rrtype in the zone, names
+// relative to the zone are made absolute to match the names of the grants
+func (r *RecordRoute) allowed(c echo.Context, zoneID string, name string, rrtype string) (bool, error) {
+	p, err := permissions(c, r.db)
+	if err != nil || p == nil {
+		return true, err
+	}
+	zone := model.Zone{ID: zoneID}
+	err = zone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return p.AllowsRecord(zoneID, dns.Fqdn(name), strings.ToUpper(rrtype)), nil
+		}
+		return false, err
+	}
+	return p.AllowsRecord(zoneID, zonefile.Absolute(name, dns.Fqdn(zone.Name)), strings.ToUpper(rrtype)), nil
+}
+
+// zoneVisible reports whether the principal reaches the organization of the zone, missing zones are out of
+// reach of the users of an organization
+func (r *RecordRoute) zoneVisible(c echo.Context, zoneID string) (bool, error) {
+	if tenant(c) == "" {
+		return true, nil
+	}
+	zone := model.Zone{ID: zoneID}
+	err := zone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return false, nil
+		}
+		return false, err
+	}
+	return reaches(c, zone.OrganizationID), nil
+}
+
+// recordValidationError converts a record validation failure into a jsonapi error pointing at the offending attribute
+func recordValidationError(err *rdata.Error) *jsonapi.Error {
+	return &jsonapi.Error{
+		Title:  "Invalid record " + err.Field,
+		Detail: err.Reason,
+		Source: &jsonapi.ErrorSource{Pointer: "/data/attributes/" + err.Field},
+	}
+}
+
 // Register registers the routes
 func (r *RecordRoute) Register(e *echo.Echo) {
 	e.GET("/v1/records/:id", r.Get)
@@ -193,4 +503,6 @@ func (r *RecordRoute) Register(e *echo.Echo) {
 	// Relationships
 	e.GET("/v1/records/:id/zones", r.GetZone)
 	e.PATCH("/v1/records/:id/zones", r.UpdateZone)
+	e.GET("/v1/records/:id/relationships/zones", r.GetZoneRelationship)
+	e.PATCH("/v1/records/:id/relationships/zones", r.UpdateZoneRelationship)
 }
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/DataDog/jsonapi"
 	"github.com/labstack/echo/v4"
@@ -25,6 +28,7 @@ func TestRecordRoute_Create(t *testing.T) {
 		name                   string
 		input                  string
 		zoneInput              string
+		deleteID               string
 		expectedData           *model.Record
 		expectedLocationHeader string
 		expectedStatusCode     int
@@ -36,6 +40,13 @@ func TestRecordRoute_Create(t *testing.T) {
 			expectedData:       &model.Record{ID: "01F1ZQZJXQXZJXZJXZJXZJXZRE", Name: "internal.martinez.io", Type: "A", TTL: 300, Content: "192.168.0.1"},
 			expectedStatusCode: http.StatusCreated,
 		},
+		{
+			name:               "relative target",
+			input:              `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZMX", "type": "records", "attributes": {"name": "internal.martinez.io", "type": "MX", "ttl": 300, "content": "10 mail"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+			zoneInput:          `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "internal.martinez.io"}}}`,
+			expectedData:       &model.Record{ID: "01F1ZQZJXQXZJXZJXZJXZJXZMX", Name: "internal.martinez.io", Type: "MX", TTL: 300, Content: "10 mail.internal.martinez.io."},
+			expectedStatusCode: http.StatusCreated,
+		},
 		{
 			name:               "invalid input",
 			input:              `{"data": {"type": "records", "attributes": {"name": ""}}}`,
@@ -49,6 +60,14 @@ func TestRecordRoute_Create(t *testing.T) {
 			expectedLocationHeader: fmt.Sprintf("%s/v1/records/%s", viper.GetString("serviceUrl"), "01F1ZQZJXQXZJXZJXZJXZJXZRE"),
 			expectedStatusCode:     http.StatusConflict,
 		},
+		{
+			name:               "recreate after delete",
+			input:              `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZRF", "type": "records", "attributes": {"name": "internal.martinez.io", "type": "A", "ttl": 300, "content": "192.168.0.1"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+			zoneInput:          `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "internal.martinez.io"}}}`,
+			deleteID:           "01F1ZQZJXQXZJXZJXZJXZJXZRE",
+			expectedData:       &model.Record{ID: "01F1ZQZJXQXZJXZJXZJXZJXZRF", Name: "internal.martinez.io", Type: "A", TTL: 300, Content: "192.168.0.1"},
+			expectedStatusCode: http.StatusCreated,
+		},
 	}
 
 	e := echo.New()
@@ -69,6 +88,15 @@ func TestRecordRoute_Create(t *testing.T) {
 			}
 
 			routeRecord := &RecordRoute{db: db}
+			if test.deleteID != "" {
+				c, rec := deleteTestRequest("/v1/records", "", e)
+				c.SetParamNames("id")
+				c.SetParamValues(test.deleteID)
+				if assert.NoError(t, routeRecord.Delete(c)) {
+					assert.Equal(t, http.StatusNoContent, rec.Code)
+				}
+			}
+
 			c, rec := postTestRequest("/v1/records", test.input, e)
 			err = routeRecord.Create(c)
 			if assert.NoError(t, err) {
@@ -79,6 +107,7 @@ func TestRecordRoute_Create(t *testing.T) {
 					assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), record))
 					assert.Equal(t, test.expectedData.Name, record.Name)
 					assert.Equal(t, test.expectedData.ID, record.ID)
+					assert.Equal(t, test.expectedData.Content, record.Content)
 				}
 				if test.expectedLocationHeader != "" {
 					assert.Equal(t, test.expectedLocationHeader, rec.Header().Get(echo.HeaderLocation))
@@ -522,3 +551,269 @@ func TestRecordRoute_GetZone(t *testing.T) {
 		})
 	}
 }
+
+func TestRecordRoute_Validation(t *testing.T) {
+	defer TearDown()
+
+	tests := []struct {
+		name               string
+		input              string
+		patchInput         string
+		zoneInput          string
+		expectedPointer    string
+		expectedStatusCode int
+	}{
+		{
+			name:               "invalid content on create",
+			input:              `{"data": {"type": "records", "attributes": {"name": "internal.martinez.io", "type": "A", "ttl": 300, "content": "::1"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+			zoneInput:          `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "internal.martinez.io"}}}`,
+			expectedPointer:    "/data/attributes/content",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "unsupported type on create",
+			input:              `{"data": {"type": "records", "attributes": {"name": "internal.martinez.io", "type": "BOGUS", "ttl": 300, "content": "192.168.0.1"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+			zoneInput:          `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "internal.martinez.io"}}}`,
+			expectedPointer:    "/data/attributes/type",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "invalid content on update",
+			input:              `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZRE", "type": "records", "attributes": {"name": "internal.martinez.io", "type": "A", "ttl": 300, "content": "192.168.0.1"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+			patchInput:         `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZRE", "type": "records", "attributes": {"type": "MX"}}}`,
+			zoneInput:          `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "internal.martinez.io"}}}`,
+			expectedPointer:    "/data/attributes/content",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			routeZone := &ZoneRoute{db: db}
+			c, _ := postTestRequest("/v1/zones", test.zoneInput, e)
+			assert.NoError(t, routeZone.Create(c))
+
+			routeRecord := &RecordRoute{db: db}
+			c, rec := postTestRequest("/v1/records", test.input, e)
+			assert.NoError(t, routeRecord.Create(c))
+			if test.patchInput != "" {
+				assert.Equal(t, http.StatusCreated, rec.Code)
+				c, rec = patchTestRequest("/v1/records/:id", test.patchInput, e)
+				c.SetParamNames("id")
+				c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZRE")
+				assert.NoError(t, routeRecord.Update(c))
+			}
+
+			assert.Equal(t, test.expectedStatusCode, rec.Code)
+			assert.Equal(t, binder.MIMEApplicationJSONApi, rec.Header().Get(echo.HeaderContentType))
+			var document struct {
+				Errors []struct {
+					Status string               `json:"status"`
+					Source *jsonapi.ErrorSource `json:"source"`
+				} `json:"errors"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+			if assert.Len(t, document.Errors, 1) {
+				assert.Equal(t, fmt.Sprint(test.expectedStatusCode), document.Errors[0].Status)
+				assert.Equal(t, test.expectedPointer, document.Errors[0].Source.Pointer)
+			}
+		})
+	}
+}
+
+func TestRecordRoute_List_With_Operators(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	routeZone := &ZoneRoute{db: db}
+	c, _ := postTestRequest("/v1/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "martinez.io"}}}`, e)
+	assert.NoError(t, routeZone.Create(c))
+
+	routeRecord := &RecordRoute{db: db}
+	for _, record := range []string{
+		`{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZR1", "type": "records", "attributes": {"name": "internal.martinez.io", "type": "A", "ttl": 300, "content": "10.1.2.3"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+		`{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZR2", "type": "records", "attributes": {"name": "intranet.martinez.io", "type": "AAAA", "ttl": 60, "content": "fd00::1"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+		`{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZR3", "type": "records", "attributes": {"name": "martinez.io", "type": "TXT", "ttl": 3600, "content": "\"v=spf1 ip4:10.1.2.3 -all\""}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+	} {
+		c, rec := postTestRequest("/v1/records", record, e)
+		assert.NoError(t, routeRecord.Create(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	tests := []struct {
+		name               string
+		filter             string
+		expectedIDs        []string
+		expectedStatusCode int
+	}{
+		{
+			name:               "contains",
+			filter:             "filter[content][contains]=10.1.2.3",
+			expectedIDs:        []string{"01F1ZQZJXQXZJXZJXZJXZJXZR1", "01F1ZQZJXQXZJXZJXZJXZJXZR3"},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "prefix",
+			filter:             "filter[name][prefix]=intra",
+			expectedIDs:        []string{"01F1ZQZJXQXZJXZJXZJXZJXZR2"},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "in",
+			filter:             "filter[type][in]=a,AAAA",
+			expectedIDs:        []string{"01F1ZQZJXQXZJXZJXZJXZJXZR1", "01F1ZQZJXQXZJXZJXZJXZJXZR2"},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "lower than",
+			filter:             "filter[ttl][lt]=3600&filter[ttl][gt]=60",
+			expectedIDs:        []string{"01F1ZQZJXQXZJXZJXZJXZJXZR1"},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "changed since",
+			filter:             "filter[updated_at][gt]=" + url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339)),
+			expectedIDs:        []string{"01F1ZQZJXQXZJXZJXZJXZJXZR1", "01F1ZQZJXQXZJXZJXZJXZJXZR2", "01F1ZQZJXQXZJXZJXZJXZJXZR3"},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "changed later",
+			filter:             "filter[updated_at][gt]=" + url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "invalid number",
+			filter:             "filter[ttl][lt]=an+hour",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "unknown operator",
+			filter:             "filter[content][between]=10.1.2.3",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, rec := getTestRequest("/v1/records?"+test.filter, e)
+			if assert.NoError(t, routeRecord.List(c)) {
+				assert.Equal(t, test.expectedStatusCode, rec.Code)
+				if test.expectedStatusCode != http.StatusOK {
+					return
+				}
+				var records []model.Record
+				if len(test.expectedIDs) == 0 {
+					assert.Contains(t, rec.Body.String(), `"data":[]`)
+					return
+				}
+				assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &records))
+				ids := make([]string, 0, len(records))
+				for _, record := range records {
+					ids = append(ids, record.ID)
+				}
+				assert.ElementsMatch(t, test.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestRecordRoute_List_Pages(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	routeZone := &ZoneRoute{db: db}
+	c, _ := postTestRequest("/v1/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "martinez.io"}}}`, e)
+	assert.NoError(t, routeZone.Create(c))
+
+	routeRecord := &RecordRoute{db: db}
+	for pos, name := range []string{"a", "b", "c", "d", "e"} {
+		input := fmt.Sprintf(`{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZR%d", "type": "records", "attributes": {"name": "%s.martinez.io", "type": "A", "ttl": 300, "content": "10.1.2.%d"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`, pos+1, name, pos+1)
+		c, rec := postTestRequest("/v1/records", input, e)
+		assert.NoError(t, routeRecord.Create(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	type page struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+		Links map[string]string `json:"links"`
+		Meta  map[string]int    `json:"meta"`
+	}
+	list := func(target string) (p page) {
+		c, rec := getTestRequest(target, e)
+		if assert.NoError(t, routeRecord.List(c)) && assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		}
+		return p
+	}
+	ids := func(p page) (ids []string) {
+		for _, resource := range p.Data {
+			ids = append(ids, resource.ID)
+		}
+		return ids
+	}
+
+	t.Run("offset", func(t *testing.T) {
+		p := list("/v1/records?sort=name&page[number]=1&page[size]=2")
+		assert.Equal(t, []string{"01F1ZQZJXQXZJXZJXZJXZJXZR3", "01F1ZQZJXQXZJXZJXZJXZJXZR4"}, ids(p))
+		assert.Equal(t, "/v1/records?sort=name&page[number]=2&page[size]=2", p.Links["next"])
+		assert.Empty(t, p.Links["last"])
+		assert.Nil(t, p.Meta)
+	})
+
+	t.Run("offset with total", func(t *testing.T) {
+		p := list("/v1/records?sort=name&page[number]=2&page[size]=2&page[total]=true")
+		assert.Equal(t, []string{"01F1ZQZJXQXZJXZJXZJXZJXZR5"}, ids(p))
+		assert.Empty(t, p.Links["next"])
+		assert.Equal(t, "/v1/records?sort=name&page[number]=2&page[size]=2&page[total]=true", p.Links["last"])
+		assert.Equal(t, map[string]int{"total": 5}, p.Meta)
+	})
+
+	t.Run("forwards", func(t *testing.T) {
+		p := list("/v1/records?page[after]=&page[size]=2")
+		assert.Equal(t, []string{"01F1ZQZJXQXZJXZJXZJXZJXZR1", "01F1ZQZJXQXZJXZJXZJXZJXZR2"}, ids(p))
+		assert.Empty(t, p.Links["previous"])
+		assert.Empty(t, p.Links["last"])
+		// The first page needs no cursor
+		assert.Equal(t, "/v1/records?page[size]=2", p.Links["first"])
+		assert.Equal(t, ids(p), ids(list(p.Links["first"])))
+		p = list(p.Links["next"])
+		assert.Equal(t, []string{"01F1ZQZJXQXZJXZJXZJXZJXZR3", "01F1ZQZJXQXZJXZJXZJXZJXZR4"}, ids(p))
+		p = list(p.Links["next"])
+		assert.Equal(t, []string{"01F1ZQZJXQXZJXZJXZJXZJXZR5"}, ids(p))
+		assert.Empty(t, p.Links["next"])
+	})
+
+	t.Run("backwards", func(t *testing.T) {
+		p := list("/v1/records?page[before]=&page[size]=2")
+		assert.Equal(t, []string{"01F1ZQZJXQXZJXZJXZJXZJXZR4", "01F1ZQZJXQXZJXZJXZJXZJXZR5"}, ids(p))
+		assert.Empty(t, p.Links["next"])
+		p = list(p.Links["previous"])
+		assert.Equal(t, []string{"01F1ZQZJXQXZJXZJXZJXZJXZR2", "01F1ZQZJXQXZJXZJXZJXZJXZR3"}, ids(p))
+		p = list(p.Links["previous"])
+		assert.Equal(t, []string{"01F1ZQZJXQXZJXZJXZJXZJXZR1"}, ids(p))
+		assert.Empty(t, p.Links["previous"])
+	})
+}
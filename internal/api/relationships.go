@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/model"
+	"gorm.io/gorm"
+)
+
+// identifier is a JSON:API resource identifier object, the linkage of the relationship endpoints is made of them
+type identifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// JSONAPILinkage serializes the linkage of a relationship along with its links and set the proper content type,
+// data is an identifier, a slice of them or nil for an empty to-one relationship
+func JSONAPILinkage(c echo.Context, code int, link *jsonapi.Link, data interface{}) error {
+	marshal, err := json.Marshal(struct {
+		Links *jsonapi.Link `json:"links,omitempty"`
+		Data  interface{}   `json:"data"`
+	}{Links: link, Data: data})
+	if err != nil {
+		return err
+	}
+	return c.Blob(code, binder.MIMEApplicationJSONApi, marshal)
+}
+
+// toManyLinkage reads the ids of the linkage of a to-many relationship from the request, every resource
+// identifier must be of resourceType. Repeated ids are read once. The error holds its status.
+func toManyLinkage(c echo.Context, resourceType string) ([]string, *jsonapi.Error) {
+	data, jsonErr := linkageData(c)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+	var identifiers []identifier
+	if err := json.Unmarshal(data, &identifiers); err != nil || identifiers == nil {
+		return nil, invalidLinkage("The linkage of a to-many relationship is an array of resource identifiers")
+	}
+	seen := make(map[string]bool, len(identifiers))
+	ids := make([]string, 0, len(identifiers))
+	for pos, resource := range identifiers {
+		if jsonErr := checkIdentifier(resource, resourceType, fmt.Sprintf("/data/%d", pos)); jsonErr != nil {
+			return nil, jsonErr
+		}
+		if !seen[resource.ID] {
+			seen[resource.ID] = true
+			ids = append(ids, resource.ID)
+		}
+	}
+	return ids, nil
+}
+
+// toOneLinkage reads the id of the linkage of a to-one relationship from the request, the resource identifier
+// must be of resourceType. The id is empty when the linkage is null. The error holds its status.
+func toOneLinkage(c echo.Context, resourceType string) (string, *jsonapi.Error) {
+	data, jsonErr := linkageData(c)
+	if jsonErr != nil {
+		return "", jsonErr
+	}
+	var resource *identifier
+	if err := json.Unmarshal(data, &resource); err != nil {
+		return "", invalidLinkage("The linkage of a to-one relationship is a resource identifier or null")
+	}
+	if resource == nil {
+		return "", nil
+	}
+	if jsonErr := checkIdentifier(*resource, resourceType, "/data"); jsonErr != nil {
+		return "", jsonErr
+	}
+	return resource.ID, nil
+}
+
+// linkageData returns the data member of the relationship document of the request
+func linkageData(c echo.Context) (json.RawMessage, *jsonapi.Error) {
+	var document struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&document); err != nil {
+		return nil, invalidLinkage(err.Error())
+	}
+	if len(document.Data) == 0 {
+		jsonErr := required("Data", "/data")
+		jsonErr.Status = jsonapi.Status(http.StatusBadRequest)
+		return nil, jsonErr
+	}
+	return document.Data, nil
+}
+
+// checkIdentifier returns the error of a resource identifier without id or of another type than resourceType,
+// pointer locates the identifier in the document
+func checkIdentifier(resource identifier, resourceType string, pointer string) *jsonapi.Error {
+	if resource.ID == "" {
+		jsonErr := required("Resource ID", pointer+"/id")
+		jsonErr.Status = jsonapi.Status(http.StatusBadRequest)
+		return jsonErr
+	}
+	if resource.Type != resourceType {
+		return &jsonapi.Error{
+			Status: jsonapi.Status(http.StatusConflict),
+			Title:  "Conflicting resource type",
+			Detail: fmt.Sprintf("The relationship holds %s, not %s", resourceType, resource.Type),
+			Source: &jsonapi.ErrorSource{Pointer: pointer + "/type"},
+		}
+	}
+	return nil
+}
+
+// invalidLinkage is the error of a relationship document that can't be read
+func invalidLinkage(detail string) *jsonapi.Error {
+	return &jsonapi.Error{
+		Status: jsonapi.Status(http.StatusBadRequest),
+		Code:   codeInvalidDocument,
+		Title:  "Invalid document",
+		Detail: detail,
+		Source: &jsonapi.ErrorSource{Pointer: "/data"},
+	}
+}
+
+// findZones returns the zones with the given ids, found reports whether every one of them exists and is in
+// reach of the principal
+func findZones(c echo.Context, db *gorm.DB, ids []string) (zones []*model.Zone, found bool, err error) {
+	zones = make([]*model.Zone, 0, len(ids))
+	if len(ids) == 0 {
+		return zones, true, nil
+	}
+	err = db.Find(&zones, "id IN ?", ids).Error
+	if err != nil {
+		return nil, false, err
+	}
+	return zones, len(zones) == len(ids) && len(visibleZones(c, zones)) == len(zones), nil
+}
+
+// findBackends returns the backends with the given ids, found reports whether every one of them exists and is
+// in reach of the principal
+func findBackends(c echo.Context, db *gorm.DB, ids []string) (backends []*model.Backend, found bool, err error) {
+	backends = make([]*model.Backend, 0, len(ids))
+	if len(ids) == 0 {
+		return backends, true, nil
+	}
+	err = db.Find(&backends, "id IN ?", ids).Error
+	if err != nil || len(backends) != len(ids) {
+		return nil, false, err
+	}
+	for _, backend := range backends {
+		if !backendVisible(c, backend) {
+			return nil, false, nil
+		}
+	}
+	return backends, true, nil
+}
+
+// zoneIdentifiers returns the linkage of zones
+func zoneIdentifiers(zones []*model.Zone) []identifier {
+	linkage := make([]identifier, 0, len(zones))
+	for _, zone := range zones {
+		linkage = append(linkage, identifier{Type: "zones", ID: zone.ID})
+	}
+	return linkage
+}
+
+// backendIdentifiers returns the linkage of backends
+func backendIdentifiers(backends []*model.Backend) []identifier {
+	linkage := make([]identifier, 0, len(backends))
+	for _, backend := range backends {
+		linkage = append(linkage, identifier{Type: "backends", ID: backend.ID})
+	}
+	return linkage
+}
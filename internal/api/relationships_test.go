@@ -0,0 +1,569 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/stretchr/testify/assert"
+)
+
+type linkageDocument struct {
+	Links map[string]string `json:"links"`
+	Data  json.RawMessage   `json:"data"`
+}
+
+func TestBackendRoute_ZonesRelationship(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	routeBackend := &BackendRoute{db: db}
+	c, _ := postTestRequest("/v1/backends", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJBACK", "type": "backends", "attributes": {"name": "bind"}}}`, e)
+	assert.NoError(t, routeBackend.Create(c))
+	routeZone := &ZoneRoute{db: db}
+	for pos, name := range []string{"martinez.io", "martinez.dev"} {
+		c, _ := postTestRequest("/v1/zones", fmt.Sprintf(`{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJ%d", "type": "zones", "attributes": {"name": "%s"}}}`, pos, name), e)
+		assert.NoError(t, routeZone.Create(c))
+	}
+
+	linkage := func() (document linkageDocument) {
+		c, rec := getTestRequest("/v1/backends/:id/relationships/zones", e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJBACK")
+		if assert.NoError(t, routeBackend.GetZonesRelationship(c)) && assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.Equal(t, binder.MIMEApplicationJSONApi, rec.Header().Get(echo.HeaderContentType))
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+		}
+		return document
+	}
+
+	tests := []struct {
+		name               string
+		method             string
+		payload            string
+		id                 string
+		expectedStatusCode int
+		expectedLinkage    string
+	}{
+		{
+			name:               "add zones",
+			method:             http.MethodPost,
+			payload:            `{"data": [{"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ0"}, {"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ1"}]}`,
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJBACK",
+			expectedStatusCode: http.StatusNoContent,
+			expectedLinkage:    `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ0"},{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ1"}]`,
+		},
+		{
+			name:               "add a zone already served",
+			method:             http.MethodPost,
+			payload:            `{"data": [{"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ0"}]}`,
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJBACK",
+			expectedStatusCode: http.StatusNoContent,
+			expectedLinkage:    `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ0"},{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ1"}]`,
+		},
+		{
+			name:               "remove a zone",
+			method:             http.MethodDelete,
+			payload:            `{"data": [{"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ0"}]}`,
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJBACK",
+			expectedStatusCode: http.StatusNoContent,
+			expectedLinkage:    `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ1"}]`,
+		},
+		{
+			name:               "replace the zones",
+			method:             http.MethodPatch,
+			payload:            `{"data": [{"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ0"}]}`,
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJBACK",
+			expectedStatusCode: http.StatusNoContent,
+			expectedLinkage:    `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ0"}]`,
+		},
+		{
+			name:               "conflicting type",
+			method:             http.MethodPost,
+			payload:            `{"data": [{"type": "backends", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ1"}]}`,
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJBACK",
+			expectedStatusCode: http.StatusConflict,
+			expectedLinkage:    `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ0"}]`,
+		},
+		{
+			name:               "missing data",
+			method:             http.MethodPatch,
+			payload:            `{}`,
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJBACK",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedLinkage:    `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ0"}]`,
+		},
+		{
+			name:               "to-one linkage",
+			method:             http.MethodPatch,
+			payload:            `{"data": {"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ1"}}`,
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJBACK",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedLinkage:    `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ0"}]`,
+		},
+		{
+			name:               "nonexistent zone",
+			method:             http.MethodPost,
+			payload:            `{"data": [{"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJLALA"}]}`,
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJBACK",
+			expectedStatusCode: http.StatusNotFound,
+			expectedLinkage:    `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ0"}]`,
+		},
+		{
+			name:               "nonexistent backend",
+			method:             http.MethodPost,
+			payload:            `{"data": [{"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ1"}]}`,
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJLALA",
+			expectedStatusCode: http.StatusNotFound,
+			expectedLinkage:    `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ0"}]`,
+		},
+		{
+			name:               "clear the zones",
+			method:             http.MethodPatch,
+			payload:            `{"data": []}`,
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJBACK",
+			expectedStatusCode: http.StatusNoContent,
+			expectedLinkage:    `[]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var c echo.Context
+			var rec *httptest.ResponseRecorder
+			handler := map[string]echo.HandlerFunc{
+				http.MethodPost:   routeBackend.AddZonesRelationship,
+				http.MethodPatch:  routeBackend.UpdateZonesRelationship,
+				http.MethodDelete: routeBackend.RemoveZonesRelationship,
+			}[test.method]
+			switch test.method {
+			case http.MethodPost:
+				c, rec = postTestRequest("/v1/backends/:id/relationships/zones", test.payload, e)
+			case http.MethodPatch:
+				c, rec = patchTestRequest("/v1/backends/:id/relationships/zones", test.payload, e)
+			case http.MethodDelete:
+				c, rec = deleteTestRequest("/v1/backends/:id/relationships/zones", test.payload, e)
+			}
+			c.SetParamNames("id")
+			c.SetParamValues(test.id)
+			if assert.NoError(t, handler(c)) {
+				assert.Equal(t, test.expectedStatusCode, rec.Code)
+				document := linkage()
+				assert.JSONEq(t, test.expectedLinkage, string(document.Data))
+				assert.Equal(t, "/v1/backends/01F1ZQZJXQXZJXZJXZJXZJBACK/relationships/zones", document.Links["self"])
+				assert.Equal(t, "/v1/backends/01F1ZQZJXQXZJXZJXZJXZJBACK/zones", document.Links["related"])
+			}
+		})
+	}
+}
+
+func TestZoneRoute_BackendsRelationship(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	routeZone := &ZoneRoute{db: db}
+	c, _ := postTestRequest("/v1/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "martinez.io"}}}`, e)
+	assert.NoError(t, routeZone.Create(c))
+	routeBackend := &BackendRoute{db: db}
+	for pos, name := range []string{"bind", "knot"} {
+		c, _ := postTestRequest("/v1/backends", fmt.Sprintf(`{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJBAC%d", "type": "backends", "attributes": {"name": "%s"}}}`, pos, name), e)
+		assert.NoError(t, routeBackend.Create(c))
+	}
+
+	linkage := func() string {
+		c, rec := getTestRequest("/v1/zones/:id/relationships/backends", e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX")
+		var document linkageDocument
+		if assert.NoError(t, routeZone.GetBackendsRelationship(c)) && assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+			assert.Equal(t, "/v1/zones/01F1ZQZJXQXZJXZJXZJXZJXZJX/relationships/backends", document.Links["self"])
+		}
+		return string(document.Data)
+	}
+
+	c, rec := postTestRequest("/v1/zones/:id/relationships/backends", `{"data": [{"type": "backends", "id": "01F1ZQZJXQXZJXZJXZJXZJBAC0"}, {"type": "backends", "id": "01F1ZQZJXQXZJXZJXZJXZJBAC1"}]}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX")
+	if assert.NoError(t, routeZone.AddBackendsRelationship(c)) {
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.JSONEq(t, `[{"type":"backends","id":"01F1ZQZJXQXZJXZJXZJXZJBAC0"},{"type":"backends","id":"01F1ZQZJXQXZJXZJXZJXZJBAC1"}]`, linkage())
+	}
+
+	c, rec = deleteTestRequest("/v1/zones/:id/relationships/backends", `{"data": [{"type": "backends", "id": "01F1ZQZJXQXZJXZJXZJXZJBAC1"}]}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX")
+	if assert.NoError(t, routeZone.RemoveBackendsRelationship(c)) {
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.JSONEq(t, `[{"type":"backends","id":"01F1ZQZJXQXZJXZJXZJXZJBAC0"}]`, linkage())
+	}
+
+	c, rec = patchTestRequest("/v1/zones/:id/relationships/backends", `{"data": [{"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJBAC1"}]}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX")
+	if assert.NoError(t, routeZone.UpdateBackendsRelationship(c)) {
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	}
+
+	c, rec = patchTestRequest("/v1/zones/:id/relationships/backends", `{"data": []}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX")
+	if assert.NoError(t, routeZone.UpdateBackendsRelationship(c)) {
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.JSONEq(t, `[]`, linkage())
+	}
+}
+
+func TestRecordRoute_ZoneRelationship(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	routeZone := &ZoneRoute{db: db}
+	for pos, name := range []string{"martinez.io", "martinez.dev"} {
+		c, _ := postTestRequest("/v1/zones", fmt.Sprintf(`{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJ%d", "type": "zones", "attributes": {"name": "%s"}}}`, pos, name), e)
+		assert.NoError(t, routeZone.Create(c))
+	}
+	routeRecord := &RecordRoute{db: db}
+	for pos := 1; pos <= 2; pos++ {
+		input := fmt.Sprintf(`{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZR%d", "type": "records", "attributes": {"name": "www%d", "type": "A", "ttl": 300, "content": "10.1.2.%d"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ0" }}}}}`, pos, pos, pos)
+		c, rec := postTestRequest("/v1/records", input, e)
+		assert.NoError(t, routeRecord.Create(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	recordZone := func(id string) string {
+		c, rec := getTestRequest("/v1/records/:id/relationships/zones", e)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		var document linkageDocument
+		if assert.NoError(t, routeRecord.GetZoneRelationship(c)) && assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+			assert.Equal(t, fmt.Sprintf("/v1/records/%s/relationships/zones", id), document.Links["self"])
+		}
+		return string(document.Data)
+	}
+	zoneRecords := func(id string) string {
+		c, rec := getTestRequest("/v1/zones/:id/relationships/records", e)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		var document linkageDocument
+		if assert.NoError(t, routeZone.GetRecordsRelationship(c)) && assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+		}
+		return string(document.Data)
+	}
+
+	assert.JSONEq(t, `{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ0"}`, recordZone("01F1ZQZJXQXZJXZJXZJXZJXZR1"))
+	assert.JSONEq(t, `[{"type":"records","id":"01F1ZQZJXQXZJXZJXZJXZJXZR1"},{"type":"records","id":"01F1ZQZJXQXZJXZJXZJXZJXZR2"}]`, zoneRecords("01F1ZQZJXQXZJXZJXZJXZJXZJ0"))
+
+	tests := []struct {
+		name               string
+		payload            string
+		expectedStatusCode int
+		expectedLinkage    string
+	}{
+		{
+			name:               "move the record",
+			payload:            `{"data": {"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ1"}}`,
+			expectedStatusCode: http.StatusNoContent,
+			expectedLinkage:    `{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ1"}`,
+		},
+		{
+			name:               "null linkage",
+			payload:            `{"data": null}`,
+			expectedStatusCode: http.StatusForbidden,
+			expectedLinkage:    `{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ1"}`,
+		},
+		{
+			name:               "to-many linkage",
+			payload:            `{"data": [{"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ0"}]}`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedLinkage:    `{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ1"}`,
+		},
+		{
+			name:               "conflicting type",
+			payload:            `{"data": {"type": "records", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ0"}}`,
+			expectedStatusCode: http.StatusConflict,
+			expectedLinkage:    `{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ1"}`,
+		},
+		{
+			name:               "nonexistent zone",
+			payload:            `{"data": {"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJLALA"}}`,
+			expectedStatusCode: http.StatusNotFound,
+			expectedLinkage:    `{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJ1"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, rec := patchTestRequest("/v1/records/:id/relationships/zones", test.payload, e)
+			c.SetParamNames("id")
+			c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZR1")
+			if assert.NoError(t, routeRecord.UpdateZoneRelationship(c)) {
+				assert.Equal(t, test.expectedStatusCode, rec.Code)
+				assert.JSONEq(t, test.expectedLinkage, recordZone("01F1ZQZJXQXZJXZJXZJXZJXZR1"))
+			}
+		})
+	}
+
+	t.Run("move records to a zone", func(t *testing.T) {
+		c, rec := postTestRequest("/v1/zones/:id/relationships/records", `{"data": [{"type": "records", "id": "01F1ZQZJXQXZJXZJXZJXZJXZR2"}]}`, e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJ1")
+		if assert.NoError(t, routeZone.AddRecordsRelationship(c)) {
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.JSONEq(t, `[]`, zoneRecords("01F1ZQZJXQXZJXZJXZJXZJXZJ0"))
+			assert.JSONEq(t, `[{"type":"records","id":"01F1ZQZJXQXZJXZJXZJXZJXZR1"},{"type":"records","id":"01F1ZQZJXQXZJXZJXZJXZJXZR2"}]`, zoneRecords("01F1ZQZJXQXZJXZJXZJXZJXZJ1"))
+		}
+	})
+
+	t.Run("remove records from a zone", func(t *testing.T) {
+		c, rec := deleteTestRequest("/v1/zones/:id/relationships/records", `{"data": [{"type": "records", "id": "01F1ZQZJXQXZJXZJXZJXZJXZR2"}]}`, e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJ1")
+		if assert.NoError(t, routeZone.RemoveRecordsRelationship(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.JSONEq(t, `[{"type":"records","id":"01F1ZQZJXQXZJXZJXZJXZJXZR1"},{"type":"records","id":"01F1ZQZJXQXZJXZJXZJXZJXZR2"}]`, zoneRecords("01F1ZQZJXQXZJXZJXZJXZJXZJ1"))
+		}
+	})
+
+	t.Run("replace the records of a zone", func(t *testing.T) {
+		c, rec := patchTestRequest("/v1/zones/:id/relationships/records", `{"data": []}`, e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJ1")
+		if assert.NoError(t, routeZone.UpdateRecordsRelationship(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.Contains(t, rec.Body.String(), "Full replacement refused")
+			assert.Contains(t, rec.Body.String(), "would leave the records left out without a zone")
+			assert.JSONEq(t, `[{"type":"records","id":"01F1ZQZJXQXZJXZJXZJXZJXZR1"},{"type":"records","id":"01F1ZQZJXQXZJXZJXZJXZJXZR2"}]`, zoneRecords("01F1ZQZJXQXZJXZJXZJXZJXZJ1"))
+		}
+	})
+
+	t.Run("routes", func(t *testing.T) {
+		e := New(db)
+		token := operatorKey(t, db)
+		tests := []struct {
+			method             string
+			target             string
+			payload            string
+			expectedStatusCode int
+		}{
+			// Records always belong to a zone, there is nothing to add to or remove from their zone
+			{http.MethodPost, "/v1/records/01F1ZQZJXQXZJXZJXZJXZJXZR1/relationships/zones", `{"data": {"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ0"}}`, http.StatusMethodNotAllowed},
+			{http.MethodDelete, "/v1/records/01F1ZQZJXQXZJXZJXZJXZJXZR1/relationships/zones", `{"data": {"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJ0"}}`, http.StatusMethodNotAllowed},
+			{http.MethodPatch, "/v1/zones/01F1ZQZJXQXZJXZJXZJXZJXZJ1/relationships/records", `{"data": []}`, http.StatusForbidden},
+			{http.MethodPatch, "/v1/zones/01F1ZQZJXQXZJXZJXZJXZJXZJ1/backends", `{"data": []}`, http.StatusNoContent},
+		}
+		for _, test := range tests {
+			req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.payload))
+			req.Header.Set(echo.HeaderContentType, binder.MIMEApplicationJSONApi)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, test.expectedStatusCode, rec.Code, "%s %s", test.method, test.target)
+		}
+	})
+}
+
+func TestTSIGKeyRoute_ZonesAndBackendsRelationship(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	routeKey := &TSIGKeyRoute{db: db}
+	c, _ := postTestRequest("/v1/tsig-keys", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXKEY", "type": "tsig-keys", "attributes": {"name": "update.martinez.io"}}}`, e)
+	assert.NoError(t, routeKey.Create(c))
+	routeZone := &ZoneRoute{db: db}
+	c, _ = postTestRequest("/v1/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "martinez.io"}}}`, e)
+	assert.NoError(t, routeZone.Create(c))
+	routeBackend := &BackendRoute{db: db}
+	c, _ = postTestRequest("/v1/backends", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJBACK", "type": "backends", "attributes": {"name": "bind"}}}`, e)
+	assert.NoError(t, routeBackend.Create(c))
+
+	tests := []struct {
+		relation string
+		linkage  string
+		get      echo.HandlerFunc
+		add      echo.HandlerFunc
+		update   echo.HandlerFunc
+		remove   echo.HandlerFunc
+	}{
+		{
+			relation: "zones",
+			linkage:  `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJX"}]`,
+			get:      routeKey.GetZonesRelationship,
+			add:      routeKey.AddZonesRelationship,
+			update:   routeKey.UpdateZonesRelationship,
+			remove:   routeKey.RemoveZonesRelationship,
+		},
+		{
+			relation: "backends",
+			linkage:  `[{"type":"backends","id":"01F1ZQZJXQXZJXZJXZJXZJBACK"}]`,
+			get:      routeKey.GetBackendsRelationship,
+			add:      routeKey.AddBackendsRelationship,
+			update:   routeKey.UpdateBackendsRelationship,
+			remove:   routeKey.RemoveBackendsRelationship,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.relation, func(t *testing.T) {
+			path := "/v1/tsig-keys/:id/relationships/" + test.relation
+			linkage := func() string {
+				c, rec := getTestRequest(path, e)
+				c.SetParamNames("id")
+				c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+				var document linkageDocument
+				if assert.NoError(t, test.get(c)) && assert.Equal(t, http.StatusOK, rec.Code) {
+					assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+					assert.Equal(t, "/v1/tsig-keys/01F1ZQZJXQXZJXZJXZJXZJXKEY/relationships/"+test.relation, document.Links["self"])
+					assert.Equal(t, "/v1/tsig-keys/01F1ZQZJXQXZJXZJXZJXZJXKEY/"+test.relation, document.Links["related"])
+				}
+				return string(document.Data)
+			}
+			payload := fmt.Sprintf(`{"data": %s}`, test.linkage)
+
+			c, rec := postTestRequest(path, payload, e)
+			c.SetParamNames("id")
+			c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+			if assert.NoError(t, test.add(c)) {
+				assert.Equal(t, http.StatusNoContent, rec.Code)
+				assert.JSONEq(t, test.linkage, linkage())
+			}
+
+			c, rec = deleteTestRequest(path, payload, e)
+			c.SetParamNames("id")
+			c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+			if assert.NoError(t, test.remove(c)) {
+				assert.Equal(t, http.StatusNoContent, rec.Code)
+				assert.JSONEq(t, `[]`, linkage())
+			}
+
+			c, rec = patchTestRequest(path, payload, e)
+			c.SetParamNames("id")
+			c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+			if assert.NoError(t, test.update(c)) {
+				assert.Equal(t, http.StatusNoContent, rec.Code)
+				assert.JSONEq(t, test.linkage, linkage())
+			}
+
+			c, rec = patchTestRequest(path, `{"data": [{"type": "records", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX"}]}`, e)
+			c.SetParamNames("id")
+			c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+			if assert.NoError(t, test.update(c)) {
+				assert.Equal(t, http.StatusConflict, rec.Code)
+			}
+
+			c, rec = postTestRequest(path, payload, e)
+			c.SetParamNames("id")
+			c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJLALA")
+			if assert.NoError(t, test.add(c)) {
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			}
+		})
+	}
+}
+
+func TestUserRoute_ZonesRelationship(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	routeUser := &UserRoute{db: db}
+	c, _ := postTestRequest("/v1/users", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJUSER", "type": "users", "attributes": {"name": "juliano", "email": "juliano@martinez.io"}}}`, e)
+	assert.NoError(t, routeUser.Create(c))
+	routeZone := &ZoneRoute{db: db}
+	c, _ = postTestRequest("/v1/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "martinez.io"}}}`, e)
+	assert.NoError(t, routeZone.Create(c))
+
+	path := "/v1/users/:id/relationships/zones"
+	payload := `{"data": [{"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX"}]}`
+	linkage := func() string {
+		c, rec := getTestRequest(path, e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+		var document linkageDocument
+		if assert.NoError(t, routeUser.GetZonesRelationship(c)) && assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+			assert.Equal(t, "/v1/users/01F1ZQZJXQXZJXZJXZJXZJUSER/relationships/zones", document.Links["self"])
+			assert.Equal(t, "/v1/users/01F1ZQZJXQXZJXZJXZJXZJUSER/zones", document.Links["related"])
+		}
+		return string(document.Data)
+	}
+
+	c, rec := postTestRequest(path, payload, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	if assert.NoError(t, routeUser.AddZonesRelationship(c)) {
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.JSONEq(t, `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJX"}]`, linkage())
+	}
+
+	c, rec = deleteTestRequest(path, payload, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	if assert.NoError(t, routeUser.RemoveZonesRelationship(c)) {
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.JSONEq(t, `[]`, linkage())
+	}
+
+	c, rec = patchTestRequest(path, payload, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	if assert.NoError(t, routeUser.UpdateZonesRelationship(c)) {
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.JSONEq(t, `[{"type":"zones","id":"01F1ZQZJXQXZJXZJXZJXZJXZJX"}]`, linkage())
+	}
+
+	c, rec = patchTestRequest(path, `{"data": [{"type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJLALA"}]}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	if assert.NoError(t, routeUser.UpdateZonesRelationship(c)) {
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	}
+
+	c, rec = postTestRequest(path, payload, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJLALA")
+	if assert.NoError(t, routeUser.AddZonesRelationship(c)) {
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	}
+}
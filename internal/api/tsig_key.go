@@ -0,0 +1,809 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/model"
+)
+
+type TSIGKeyRoute struct {
+	db *gorm.DB
+}
+
+// tsigKeyFilters maps the fields TSIG keys may be filtered by to their columns
+var tsigKeyFilters = map[string]filterField{
+	"name":       {column: "name", kind: filterText, normalize: tsigKeyName},
+	"algorithm":  {column: "algorithm", kind: filterText, normalize: tsigKeyName},
+	"created_at": timeFilter("created_at"),
+	"updated_at": timeFilter("updated_at"),
+}
+
+// Create creates a new key, the response is the only one holding its secret
+func (r *TSIGKeyRoute) Create(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	var key model.TSIGKey
+	if err := c.Bind(&key); err != nil {
+		return err
+	}
+	if key.Name == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Name", "/data/attributes/name"))
+	}
+	key.OrganizationID = tenant(c)
+	err = r.db.Create(&key).Error
+	if err != nil {
+		if jsonErr := tsigKeyError(err); jsonErr != nil {
+			return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+		}
+		if err.Error() == "UNIQUE constraint failed: tsig_keys.name" {
+			existingKey, err := model.FindTSIGKey(r.db, key.Name)
+			if err != nil {
+				return err
+			}
+			// The names of keys are unique across organizations, the keys of others aren't disclosed
+			if !reaches(c, existingKey.OrganizationID) {
+				return JSONAPIError(c, http.StatusConflict, alreadyExists("TSIG key"))
+			}
+			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/tsig-keys/%s", viper.GetString("serviceUrl"), existingKey.ID))
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("TSIG key"))
+		} else if err.Error() == "UNIQUE constraint failed: tsig_keys.id" {
+			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/tsig-keys/%s", viper.GetString("serviceUrl"), key.ID))
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("TSIG key"))
+		}
+		return err
+	}
+	return JSONAPI(c, http.StatusCreated, key)
+}
+
+// List lists all keys, without their secrets
+func (r *TSIGKeyRoute) List(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	var keys []model.TSIGKey
+	query, err := ParseQuery(c)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, invalidQuery(err))
+	}
+	filtering, jsonErr := query.Filtering(tsigKeyFilters)
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	p, jsonErr := query.Pagination()
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	tx := r.db
+	if organizationID := tenant(c); organizationID != "" {
+		tx = tx.Where("organization_id = ?", organizationID)
+	}
+	tx = tx.Scopes(filtering)
+	err = tx.Scopes(paginate(keys, p, tx)).Find(&keys).Error
+	if err != nil {
+		return err
+	}
+	p.Window(&keys)
+	for pos := range keys {
+		keys[pos].Secret = ""
+	}
+
+	p.SetLinks(query.Link("/v1/tsig-keys"))
+	if len(keys) == 0 {
+		return JSONAPI(c, http.StatusOK, keys)
+	}
+	return JSONAPIPaginated(c, http.StatusOK, keys, p.Link(), p.Meta())
+}
+
+// Get gets a key, without its secret
+func (r *TSIGKeyRoute) Get(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	key := &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+		}
+		return err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	key.Secret = ""
+	if len(key.Zones) == 0 {
+		key.Zones = nil
+	}
+	if len(key.Backends) == 0 {
+		key.Backends = nil
+	}
+	return JSONAPI(c, http.StatusOK, key)
+}
+
+// Update renames a key
+func (r *TSIGKeyRoute) Update(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	key := &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+		}
+		return err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	var newKey model.TSIGKey
+	if err := c.Bind(&newKey); err != nil {
+		return err
+	}
+	if newKey.Name == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Name", "/data/attributes/name"))
+	}
+	if newKey.Algorithm != "" || newKey.Secret != "" {
+		return JSONAPIError(c, http.StatusBadRequest, &jsonapi.Error{
+			Title:  "Immutable attributes",
+			Detail: "Algorithm and secret can't be changed, create a new key instead",
+			Source: &jsonapi.ErrorSource{Pointer: "/data/attributes"},
+		})
+	}
+	err = key.Update(r.db, newKey)
+	if err != nil {
+		if jsonErr := tsigKeyError(err); jsonErr != nil {
+			return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+		}
+		if err.Error() == "UNIQUE constraint failed: tsig_keys.name" {
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("TSIG key"))
+		}
+		return err
+	}
+	key.Secret = ""
+	return JSONAPI(c, http.StatusOK, key)
+}
+
+// Delete deletes a key
+func (r *TSIGKeyRoute) Delete(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	key := &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return c.NoContent(http.StatusNoContent)
+		}
+		return err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return c.NoContent(http.StatusNoContent)
+	}
+	err = key.Delete(r.db)
+	if err != nil && err.Error() != "record not found" {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetZones gets the zones the key may update
+func (r *TSIGKeyRoute) GetZones(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	key := &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+		}
+		return err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	return JSONAPI(c, http.StatusOK, key.Zones)
+}
+
+// AddZone allows the key to update a zone
+func (r *TSIGKeyRoute) AddZone(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	key := &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+		}
+		return err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	var zone model.Zone
+	if err := c.Bind(&zone); err != nil {
+		if strings.Contains(err.Error(), "body is not a json:api representation") {
+			return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+		}
+		return err
+	}
+	if zone.ID == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+	}
+	existingZone := model.Zone{ID: zone.ID}
+	err = existingZone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return err
+	}
+	if !reaches(c, existingZone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	err = key.AddZone(r.db, &existingZone)
+	if err != nil {
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, existingZone)
+}
+
+// RemoveZone revokes the permission of the key to update a zone
+func (r *TSIGKeyRoute) RemoveZone(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	key := &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+		}
+		return err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	var zone model.Zone
+	if err := c.Bind(&zone); err != nil {
+		if strings.Contains(err.Error(), "body is not a json:api representation") {
+			return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+		}
+		return err
+	}
+	if zone.ID == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+	}
+	err = key.RemoveZone(r.db, &zone)
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateZones replaces the zones the key may update, an empty list revokes every zone
+func (r *TSIGKeyRoute) UpdateZones(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	key := &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+		}
+		return err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	ids, err := linkageIDs(c)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+	}
+	zones := make([]*model.Zone, 0)
+	if len(ids) > 0 {
+		err = r.db.Find(&zones, "id IN (?)", ids).Error
+		if err != nil {
+			return err
+		}
+		if len(zones) != len(ids) || len(visibleZones(c, zones)) != len(zones) {
+			return JSONAPIError(c, http.StatusNotFound, missingResources("zones"))
+		}
+	}
+	err = key.ReplaceZones(r.db, zones)
+	if err != nil {
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, zones)
+}
+
+// GetBackends gets the backends the key is attached to
+func (r *TSIGKeyRoute) GetBackends(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	key := &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+		}
+		return err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	redactBackends(c, key.Backends...)
+	return JSONAPI(c, http.StatusOK, key.Backends)
+}
+
+// AddBackend attaches the key to a backend
+func (r *TSIGKeyRoute) AddBackend(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	key := &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+		}
+		return err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	var backend model.Backend
+	if err := c.Bind(&backend); err != nil {
+		if strings.Contains(err.Error(), "body is not a json:api representation") {
+			return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
+		}
+		return err
+	}
+	if backend.ID == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
+	}
+	existingBackend := model.Backend{ID: backend.ID}
+	err = existingBackend.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+		}
+		return err
+	}
+	if !backendVisible(c, &existingBackend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
+	// The keys of a backend sign the transfers of all of its zones, keys are only attached to shared backends
+	// by the operators
+	if !reaches(c, existingBackend.OrganizationID) {
+		return forbidden(c)
+	}
+	err = key.AddBackend(r.db, &existingBackend)
+	if err != nil {
+		return err
+	}
+	redactBackends(c, &existingBackend)
+	return JSONAPI(c, http.StatusOK, existingBackend)
+}
+
+// RemoveBackend detaches the key from a backend
+func (r *TSIGKeyRoute) RemoveBackend(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	key := &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+		}
+		return err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	var backend model.Backend
+	if err := c.Bind(&backend); err != nil {
+		if strings.Contains(err.Error(), "body is not a json:api representation") {
+			return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
+		}
+		return err
+	}
+	if backend.ID == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
+	}
+	err = key.RemoveBackend(r.db, &backend)
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateBackends replaces the backends the key is attached to, an empty list detaches it from every backend
+func (r *TSIGKeyRoute) UpdateBackends(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	key := &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+		}
+		return err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	ids, err := linkageIDs(c)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
+	}
+	backends := make([]*model.Backend, 0)
+	if len(ids) > 0 {
+		err = r.db.Find(&backends, "id IN (?)", ids).Error
+		if err != nil {
+			return err
+		}
+		if len(backends) != len(ids) {
+			return JSONAPIError(c, http.StatusNotFound, missingResources("backends"))
+		}
+		for _, backend := range backends {
+			if !backendVisible(c, backend) {
+				return JSONAPIError(c, http.StatusNotFound, missingResources("backends"))
+			}
+			if !reaches(c, backend.OrganizationID) {
+				return forbidden(c)
+			}
+		}
+	}
+	err = key.ReplaceBackends(r.db, backends)
+	if err != nil {
+		return err
+	}
+	redactBackends(c, backends...)
+	return JSONAPI(c, http.StatusOK, backends)
+}
+
+// GetZonesRelationship gets the linkage of the zones the key may update
+func (r *TSIGKeyRoute) GetZonesRelationship(c echo.Context) (err error) {
+	key, err := r.linkedKey(c, true)
+	if key == nil {
+		return err
+	}
+	return JSONAPILinkage(c, http.StatusOK, key.LinkRelation("zones"), zoneIdentifiers(key.Zones))
+}
+
+// AddZonesRelationship allows the key to update the zones of the linkage, zones it may already update are kept
+func (r *TSIGKeyRoute) AddZonesRelationship(c echo.Context) (err error) {
+	key, zones, err := r.linkedZones(c)
+	if key == nil {
+		return err
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		for _, zone := range zones {
+			err := key.AddZone(tx, zone)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateZonesRelationship replaces the zones the key may update with the ones of the linkage, an empty linkage
+// revokes every zone
+func (r *TSIGKeyRoute) UpdateZonesRelationship(c echo.Context) (err error) {
+	key, zones, err := r.linkedZones(c)
+	if key == nil {
+		return err
+	}
+	err = key.ReplaceZones(r.db, zones)
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RemoveZonesRelationship revokes the permission of the key to update the zones of the linkage, zones it can't
+// update are ignored
+func (r *TSIGKeyRoute) RemoveZonesRelationship(c echo.Context) (err error) {
+	key, zones, err := r.linkedZones(c)
+	if key == nil {
+		return err
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		for _, zone := range zones {
+			err := key.RemoveZone(tx, zone)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetBackendsRelationship gets the linkage of the backends the key is attached to
+func (r *TSIGKeyRoute) GetBackendsRelationship(c echo.Context) (err error) {
+	key, err := r.linkedKey(c, true)
+	if key == nil {
+		return err
+	}
+	return JSONAPILinkage(c, http.StatusOK, key.LinkRelation("backends"), backendIdentifiers(key.Backends))
+}
+
+// AddBackendsRelationship attaches the key to the backends of the linkage, backends it is already attached to are kept
+func (r *TSIGKeyRoute) AddBackendsRelationship(c echo.Context) (err error) {
+	key, backends, err := r.linkedBackends(c)
+	if key == nil {
+		return err
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		for _, backend := range backends {
+			err := key.AddBackend(tx, backend)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateBackendsRelationship replaces the backends the key is attached to with the ones of the linkage, an empty
+// linkage detaches it from every backend
+func (r *TSIGKeyRoute) UpdateBackendsRelationship(c echo.Context) (err error) {
+	key, backends, err := r.linkedBackends(c)
+	if key == nil {
+		return err
+	}
+	err = key.ReplaceBackends(r.db, backends)
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RemoveBackendsRelationship detaches the key from the backends of the linkage, backends it isn't attached to
+// are ignored
+func (r *TSIGKeyRoute) RemoveBackendsRelationship(c echo.Context) (err error) {
+	key, backends, err := r.linkedBackends(c)
+	if key == nil {
+		return err
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		for _, backend := range backends {
+			err := key.RemoveBackend(tx, backend)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// linkedKey loads the key of a relationship request, keys are managed by the administrators. The key is nil
+// when the request was already answered, err is then the one of writing the response.
+func (r *TSIGKeyRoute) linkedKey(c echo.Context, preload bool) (key *model.TSIGKey, err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return nil, err
+	}
+	if !perms.IsAdmin() {
+		return nil, forbidden(c)
+	}
+	key = &model.TSIGKey{ID: c.Param("id")}
+	err = key.Get(r.db, preload)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return nil, JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+		}
+		return nil, err
+	}
+	if !reaches(c, key.OrganizationID) {
+		return nil, JSONAPIError(c, http.StatusNotFound, notFound("TSIG key"))
+	}
+	return key, nil
+}
+
+// linkedZones loads the key of a request changing its zones and the zones of the linkage of the request.
+// The key is nil when the request was already answered, err is then the one of writing the response.
+func (r *TSIGKeyRoute) linkedZones(c echo.Context) (key *model.TSIGKey, zones []*model.Zone, err error) {
+	key, err = r.linkedKey(c, false)
+	if key == nil {
+		return nil, nil, err
+	}
+	ids, jsonErr := toManyLinkage(c, "zones")
+	if jsonErr != nil {
+		return nil, nil, JSONAPIError(c, *jsonErr.Status, jsonErr)
+	}
+	zones, found, err := findZones(c, r.db, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, JSONAPIError(c, http.StatusNotFound, missingResources("zones"))
+	}
+	return key, zones, nil
+}
+
+// linkedBackends loads the key of a request changing its backends and the backends of the linkage of the request,
+// keys are only attached to shared backends by the operators. The key is nil when the request was already answered,
+// err is then the one of writing the response.
+func (r *TSIGKeyRoute) linkedBackends(c echo.Context) (key *model.TSIGKey, backends []*model.Backend, err error) {
+	key, err = r.linkedKey(c, false)
+	if key == nil {
+		return nil, nil, err
+	}
+	ids, jsonErr := toManyLinkage(c, "backends")
+	if jsonErr != nil {
+		return nil, nil, JSONAPIError(c, *jsonErr.Status, jsonErr)
+	}
+	backends, found, err := findBackends(c, r.db, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, JSONAPIError(c, http.StatusNotFound, missingResources("backends"))
+	}
+	for _, backend := range backends {
+		if !reaches(c, backend.OrganizationID) {
+			return nil, nil, forbidden(c)
+		}
+	}
+	return key, backends, nil
+}
+
+// linkageIDs reads the ids of a collection of resource identifiers, jsonapi can't unmarshal an empty one
+func linkageIDs(c echo.Context) (ids []string, err error) {
+	var document struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(c.Request().Body).Decode(&document)
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range document.Data {
+		if resource.ID == "" {
+			return nil, errors.New("resource id is required")
+		}
+		ids = append(ids, resource.ID)
+	}
+	return ids, nil
+}
+
+// tsigKeyError converts an invalid name, algorithm or secret into a jsonapi error pointing at the offending attribute
+func tsigKeyError(err error) *jsonapi.Error {
+	var attribute string
+	switch {
+	case errors.Is(err, model.ErrInvalidTSIGName):
+		attribute = "name"
+	case errors.Is(err, model.ErrInvalidTSIGAlgorithm):
+		attribute = "algorithm"
+	case errors.Is(err, model.ErrInvalidTSIGSecret):
+		attribute = "secret"
+	default:
+		return nil
+	}
+	return &jsonapi.Error{
+		Title:  "Invalid TSIG key " + attribute,
+		Detail: err.Error(),
+		Source: &jsonapi.ErrorSource{Pointer: "/data/attributes/" + attribute},
+	}
+}
+
+// tsigKeyName normalises a key name or algorithm the way they are stored, lower case without the trailing dot
+func tsigKeyName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// Register registers the routes for the TSIG keys
+func (r *TSIGKeyRoute) Register(e *echo.Echo) {
+	e.GET("/v1/tsig-keys/:id", r.Get)
+	e.DELETE("/v1/tsig-keys/:id", r.Delete)
+	e.POST("/v1/tsig-keys", r.Create)
+	e.PATCH("/v1/tsig-keys/:id", r.Update)
+	e.GET("/v1/tsig-keys", r.List)
+	// Relationships
+	e.GET("/v1/tsig-keys/:id/zones", r.GetZones)
+	e.POST("/v1/tsig-keys/:id/zones", r.AddZone)
+	e.PATCH("/v1/tsig-keys/:id/zones", r.UpdateZones)
+	e.DELETE("/v1/tsig-keys/:id/zones", r.RemoveZone)
+	e.GET("/v1/tsig-keys/:id/backends", r.GetBackends)
+	e.POST("/v1/tsig-keys/:id/backends", r.AddBackend)
+	e.PATCH("/v1/tsig-keys/:id/backends", r.UpdateBackends)
+	e.DELETE("/v1/tsig-keys/:id/backends", r.RemoveBackend)
+	e.GET("/v1/tsig-keys/:id/relationships/zones", r.GetZonesRelationship)
+	e.POST("/v1/tsig-keys/:id/relationships/zones", r.AddZonesRelationship)
+	e.PATCH("/v1/tsig-keys/:id/relationships/zones", r.UpdateZonesRelationship)
+	e.DELETE("/v1/tsig-keys/:id/relationships/zones", r.RemoveZonesRelationship)
+	e.GET("/v1/tsig-keys/:id/relationships/backends", r.GetBackendsRelationship)
+	e.POST("/v1/tsig-keys/:id/relationships/backends", r.AddBackendsRelationship)
+	e.PATCH("/v1/tsig-keys/:id/relationships/backends", r.UpdateBackendsRelationship)
+	e.DELETE("/v1/tsig-keys/:id/relationships/backends", r.RemoveBackendsRelationship)
+}
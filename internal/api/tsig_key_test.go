@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTSIGKeyRoute_Create(t *testing.T) {
+	defer TearDown()
+
+	tests := []struct {
+		name               string
+		payload            string
+		expectedName       string
+		expectedAlgorithm  string
+		expectedPointer    string
+		expectedStatusCode int
+	}{
+		{
+			name:               "default algorithm",
+			payload:            `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXKEY", "type": "tsig-keys", "attributes": {"name": "Update.Martinez.io."}}}`,
+			expectedName:       "update.martinez.io",
+			expectedAlgorithm:  "hmac-sha256",
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "explicit algorithm",
+			payload:            `{"data": {"type": "tsig-keys", "attributes": {"name": "transfer.martinez.io", "algorithm": "hmac-sha512"}}}`,
+			expectedName:       "transfer.martinez.io",
+			expectedAlgorithm:  "hmac-sha512",
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "invalid algorithm",
+			payload:            `{"data": {"type": "tsig-keys", "attributes": {"name": "md5.martinez.io", "algorithm": "hmac-md5"}}}`,
+			expectedPointer:    "/data/attributes/algorithm",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "missing name",
+			payload:            `{"data": {"type": "tsig-keys", "attributes": {"algorithm": "hmac-sha256"}}}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "existing name",
+			payload:            `{"data": {"type": "tsig-keys", "attributes": {"name": "update.martinez.io"}}}`,
+			expectedStatusCode: http.StatusConflict,
+		},
+	}
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	route := &TSIGKeyRoute{db: db}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, rec := postTestRequest("/v1/tsig-keys", test.payload, e)
+			assert.NoError(t, route.Create(c))
+			assert.Equal(t, test.expectedStatusCode, rec.Code)
+			if test.expectedPointer != "" {
+				var document struct {
+					Errors []struct {
+						Source struct {
+							Pointer string `json:"pointer"`
+						} `json:"source"`
+					} `json:"errors"`
+				}
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+				if assert.Len(t, document.Errors, 1) {
+					assert.Equal(t, test.expectedPointer, document.Errors[0].Source.Pointer)
+				}
+				return
+			}
+			if test.expectedStatusCode == http.StatusConflict {
+				assert.Contains(t, rec.Header().Get(echo.HeaderLocation), "/v1/tsig-keys/01F1ZQZJXQXZJXZJXZJXZJXKEY")
+				return
+			}
+			if test.expectedStatusCode != http.StatusCreated {
+				return
+			}
+			var key model.TSIGKey
+			assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &key))
+			assert.Equal(t, test.expectedName, key.Name)
+			assert.Equal(t, test.expectedAlgorithm, key.Algorithm)
+			assert.NotEmpty(t, key.Secret, "the secret is returned on create")
+		})
+	}
+
+	// The secret is never returned again
+	c, rec := getTestRequest("/v1/tsig-keys/:id", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+	assert.NoError(t, route.Get(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "secret")
+
+	c, rec = getTestRequest("/v1/tsig-keys?filter[name]=update.martinez.io.", e)
+	assert.NoError(t, route.List(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "secret")
+	var keys []model.TSIGKey
+	assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &keys))
+	if assert.Len(t, keys, 1) {
+		assert.Equal(t, "01F1ZQZJXQXZJXZJXZJXZJXKEY", keys[0].ID)
+	}
+
+	c, rec = patchTestRequest("/v1/tsig-keys/:id", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXKEY", "type": "tsig-keys", "attributes": {"secret": "c2VjcmV0"}}}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+	assert.NoError(t, route.Update(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestTSIGKeyRoute_Relationships(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	route := &TSIGKeyRoute{db: db}
+	c, _ := postTestRequest("/v1/tsig-keys", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXKEY", "type": "tsig-keys", "attributes": {"name": "update.martinez.io"}}}`, e)
+	assert.NoError(t, route.Create(c))
+	routeZone := &ZoneRoute{db: db}
+	c, _ = postTestRequest("/v1/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJZONE", "type": "zones", "attributes": {"name": "martinez.io"}}}`, e)
+	assert.NoError(t, routeZone.Create(c))
+	routeBackend := &BackendRoute{db: db}
+	c, _ = postTestRequest("/v1/backends", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "backends", "attributes": {"name": "bind"}}}`, e)
+	assert.NoError(t, routeBackend.Create(c))
+
+	t.Run("zones", func(t *testing.T) {
+		c, rec := postTestRequest("/v1/tsig-keys/:id/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJZONE", "type": "zones"}}`, e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+		assert.NoError(t, route.AddZone(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		c, rec = postTestRequest("/v1/tsig-keys/:id/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJX0NE", "type": "zones"}}`, e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+		assert.NoError(t, route.AddZone(c))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		key, err := model.FindTSIGKey(db, "update.martinez.io")
+		assert.NoError(t, err)
+		allowed, err := key.AllowsZone(db, &model.Zone{ID: "01F1ZQZJXQXZJXZJXZJXZJZONE"})
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+
+		// An empty list revokes every zone
+		c, rec = patchTestRequest("/v1/tsig-keys/:id/zones", `{"data": []}`, e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+		assert.NoError(t, route.UpdateZones(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		allowed, err = key.AllowsZone(db, &model.Zone{ID: "01F1ZQZJXQXZJXZJXZJXZJZONE"})
+		assert.NoError(t, err)
+		assert.False(t, allowed)
+	})
+
+	t.Run("backends", func(t *testing.T) {
+		c, rec := patchTestRequest("/v1/tsig-keys/:id/backends", `{"data": [{"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "backends"}]}`, e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+		assert.NoError(t, route.UpdateBackends(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		// The agent of the backend gets the secrets of its keys
+		c, rec = getTestRequest("/v1/backends/:id/tsig-keys", e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXZJX")
+		assert.NoError(t, routeBackend.GetTSIGKeys(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var keys []model.TSIGKey
+		assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &keys))
+		if assert.Len(t, keys, 1) {
+			assert.Equal(t, "update.martinez.io", keys[0].Name)
+			assert.NotEmpty(t, keys[0].Secret)
+		}
+
+		c, rec = deleteTestRequest("/v1/tsig-keys/:id/backends", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "backends"}}`, e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+		assert.NoError(t, route.RemoveBackend(c))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		c, rec = getTestRequest("/v1/tsig-keys/:id/backends", e)
+		c.SetParamNames("id")
+		c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJXKEY")
+		assert.NoError(t, route.GetBackends(c))
+		assert.JSONEq(t, `{"data": []}`, rec.Body.String())
+	})
+}
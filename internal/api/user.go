@@ -0,0 +1,676 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/model"
+)
+
+type UserRoute struct {
+	db *gorm.DB
+}
+
+// userFilters maps the fields users may be filtered by to their columns
+var userFilters = map[string]filterField{
+	"name":       {column: "name", kind: filterText, normalize: strings.ToLower},
+	"email":      {column: "email", kind: filterText, normalize: strings.ToLower},
+	"created_at": timeFilter("created_at"),
+	"updated_at": timeFilter("updated_at"),
+}
+
+// Create creates a new user, the password is hashed and never returned
+func (r *UserRoute) Create(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	var user model.User
+	if err := c.Bind(&user); err != nil {
+		return err
+	}
+	if user.Name == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Name", "/data/attributes/name"))
+	}
+	if user.Email == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Email", "/data/attributes/email"))
+	}
+	user.OrganizationID = tenant(c)
+	err = r.db.Create(&user).Error
+	if err != nil {
+		if jsonErr := userError(err); jsonErr != nil {
+			return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+		}
+		if err.Error() == "UNIQUE constraint failed: users.name" || err.Error() == "UNIQUE constraint failed: users.email" {
+			var existingUser model.User
+			err = r.db.First(&existingUser, "name = ? OR email = ?", user.Name, user.Email).Error
+			if err != nil {
+				return err
+			}
+			// Names and emails are unique across organizations, the users of others aren't disclosed
+			if !reaches(c, existingUser.OrganizationID) {
+				return JSONAPIError(c, http.StatusConflict, alreadyExists("User"))
+			}
+			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/users/%s", viper.GetString("serviceUrl"), existingUser.ID))
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("User"))
+		} else if err.Error() == "UNIQUE constraint failed: users.id" {
+			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/users/%s", viper.GetString("serviceUrl"), user.ID))
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("User"))
+		}
+		return err
+	}
+	return JSONAPI(c, http.StatusCreated, user)
+}
+
+// List lists all users
+func (r *UserRoute) List(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	var users []model.User
+	query, err := ParseQuery(c)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, invalidQuery(err))
+	}
+	filtering, jsonErr := query.Filtering(userFilters)
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	p, jsonErr := query.Pagination()
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	tx := r.db
+	if organizationID := tenant(c); organizationID != "" {
+		tx = tx.Where("organization_id = ?", organizationID)
+	}
+	tx = tx.Scopes(filtering)
+	err = tx.Scopes(paginate(users, p, tx)).Preload("Zones").Find(&users).Error
+	if err != nil {
+		return err
+	}
+	p.Window(&users)
+	for pos, user := range users {
+		users[pos].Zones = visibleZones(c, user.Zones)
+		if len(users[pos].Zones) == 0 {
+			users[pos].Zones = nil
+		}
+	}
+
+	p.SetLinks(query.Link("/v1/users"))
+	if len(users) == 0 {
+		return JSONAPI(c, http.StatusOK, users)
+	}
+	return JSONAPIPaginated(c, http.StatusOK, users, p.Link(), p.Meta())
+}
+
+// Get gets a user
+func (r *UserRoute) Get(c echo.Context) (err error) {
+	allowed, err := r.allowed(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+	}
+	user.Zones = visibleZones(c, user.Zones)
+	if len(user.Zones) == 0 {
+		user.Zones = nil
+	}
+	return JSONAPI(c, http.StatusOK, user)
+}
+
+// Update changes the name, email or password of a user
+func (r *UserRoute) Update(c echo.Context) (err error) {
+	allowed, err := r.allowed(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+	}
+	var newUser model.User
+	if err := c.Bind(&newUser); err != nil {
+		return err
+	}
+	if newUser.Name == "" && newUser.Email == "" && newUser.Password == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Name, email or password", "/data/attributes"))
+	}
+	err = user.Update(r.db, newUser)
+	if err != nil {
+		if jsonErr := userError(err); jsonErr != nil {
+			return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+		}
+		if err.Error() == "UNIQUE constraint failed: users.name" || err.Error() == "UNIQUE constraint failed: users.email" {
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("User"))
+		}
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, user)
+}
+
+// Delete deletes a user
+func (r *UserRoute) Delete(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return c.NoContent(http.StatusNoContent)
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return c.NoContent(http.StatusNoContent)
+	}
+	err = user.Delete(r.db)
+	if err != nil && err.Error() != "record not found" {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetZones gets the zones a user owns
+func (r *UserRoute) GetZones(c echo.Context) (err error) {
+	allowed, err := r.allowed(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+	}
+	return JSONAPI(c, http.StatusOK, visibleZones(c, user.Zones))
+}
+
+// AddZone makes a user an owner of a zone
+func (r *UserRoute) AddZone(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+	}
+	var zone model.Zone
+	if err := c.Bind(&zone); err != nil {
+		if strings.Contains(err.Error(), "body is not a json:api representation") {
+			return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+		}
+		return err
+	}
+	if zone.ID == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+	}
+	existingZone := model.Zone{ID: zone.ID}
+	err = existingZone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return err
+	}
+	if !reaches(c, existingZone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	err = user.AddZone(r.db, &existingZone)
+	if err != nil {
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, existingZone)
+}
+
+// RemoveZone removes a zone from the zones a user owns
+func (r *UserRoute) RemoveZone(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+	}
+	var zone model.Zone
+	if err := c.Bind(&zone); err != nil {
+		if strings.Contains(err.Error(), "body is not a json:api representation") {
+			return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+		}
+		return err
+	}
+	if zone.ID == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+	}
+	err = user.RemoveZone(r.db, &zone)
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateZones replaces the zones a user owns, an empty list removes every zone
+func (r *UserRoute) UpdateZones(c echo.Context) (err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !perms.IsAdmin() {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+	}
+	ids, err := linkageIDs(c)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, required("Zone ID", "/data"))
+	}
+	zones := make([]*model.Zone, 0)
+	if len(ids) > 0 {
+		err = r.db.Find(&zones, "id IN (?)", ids).Error
+		if err != nil {
+			return err
+		}
+		if len(zones) != len(ids) || len(visibleZones(c, zones)) != len(zones) {
+			return JSONAPIError(c, http.StatusNotFound, missingResources("zones"))
+		}
+	}
+	err = user.ReplaceZones(r.db, zones)
+	if err != nil {
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, zones)
+}
+
+// GetZonesRelationship gets the linkage of the zones a user owns
+func (r *UserRoute) GetZonesRelationship(c echo.Context) (err error) {
+	allowed, err := r.allowed(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+	}
+	return JSONAPILinkage(c, http.StatusOK, user.LinkRelation("zones"), zoneIdentifiers(visibleZones(c, user.Zones)))
+}
+
+// AddZonesRelationship makes a user an owner of the zones of the linkage, zones the user already owns are kept
+func (r *UserRoute) AddZonesRelationship(c echo.Context) (err error) {
+	user, zones, err := r.linkedZones(c)
+	if user == nil {
+		return err
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		for _, zone := range zones {
+			err := user.AddZone(tx, zone)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateZonesRelationship replaces the zones a user owns with the ones of the linkage, an empty linkage removes
+// every zone
+func (r *UserRoute) UpdateZonesRelationship(c echo.Context) (err error) {
+	user, zones, err := r.linkedZones(c)
+	if user == nil {
+		return err
+	}
+	err = user.ReplaceZones(r.db, zones)
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RemoveZonesRelationship removes the zones of the linkage from the zones a user owns, zones the user doesn't
+// own are ignored
+func (r *UserRoute) RemoveZonesRelationship(c echo.Context) (err error) {
+	user, zones, err := r.linkedZones(c)
+	if user == nil {
+		return err
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		for _, zone := range zones {
+			err := user.RemoveZone(tx, zone)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// linkedZones loads the user of a request changing its zones and the zones of the linkage of the request, zone
+// ownerships are managed by the administrators. The user is nil when the request was already answered, err is
+// then the one of writing the response.
+func (r *UserRoute) linkedZones(c echo.Context) (user *model.User, zones []*model.Zone, err error) {
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !perms.IsAdmin() {
+		return nil, nil, forbidden(c)
+	}
+	user = &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return nil, nil, JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return nil, nil, err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return nil, nil, JSONAPIError(c, http.StatusNotFound, notFound("User"))
+	}
+	ids, jsonErr := toManyLinkage(c, "zones")
+	if jsonErr != nil {
+		return nil, nil, JSONAPIError(c, *jsonErr.Status, jsonErr)
+	}
+	zones, found, err := findZones(c, r.db, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, JSONAPIError(c, http.StatusNotFound, missingResources("zones"))
+	}
+	return user, zones, nil
+}
+
+// GetAPIKeys gets the API keys of a user, without their tokens
+func (r *UserRoute) GetAPIKeys(c echo.Context) (err error) {
+	allowed, err := r.allowed(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+	}
+	keys, err := user.APIKeys(r.db)
+	if err != nil {
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, keys)
+}
+
+// CreateAPIKey creates a new API key for a user, the response is the only one holding its token
+func (r *UserRoute) CreateAPIKey(c echo.Context) (err error) {
+	allowed, err := r.allowed(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+	}
+	// The name of the key is optional, so is the body
+	var request model.APIKey
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&request); err != nil {
+			return err
+		}
+	}
+	key, err := user.CreateAPIKey(r.db, request.Name)
+	if err != nil {
+		return err
+	}
+	return JSONAPI(c, http.StatusCreated, key)
+}
+
+// Login trades the name and password of a user for a new API key, the response is the only one holding its token
+func (r *UserRoute) Login(c echo.Context) (err error) {
+	var request model.User
+	err = c.Bind(&request)
+	if err != nil {
+		return err
+	}
+	user, err := model.FindUser(r.db, request.Name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return unauthorized(c, "Invalid name or password")
+		}
+		return err
+	}
+	if !user.CheckPassword(request.Password) {
+		return unauthorized(c, "Invalid name or password")
+	}
+	key, err := user.CreateAPIKey(r.db, "login")
+	if err != nil {
+		return err
+	}
+	return JSONAPI(c, http.StatusCreated, key)
+}
+
+// DeleteAPIKey revokes an API key of a user
+func (r *UserRoute) DeleteAPIKey(c echo.Context) (err error) {
+	allowed, err := r.allowed(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return c.NoContent(http.StatusNoContent)
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return c.NoContent(http.StatusNoContent)
+	}
+	err = user.DeleteAPIKey(r.db, c.Param("key_id"))
+	if err != nil && err.Error() != "record not found" {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetGrants gets the grants given to a user, the zones the user owns aside
+func (r *UserRoute) GetGrants(c echo.Context) (err error) {
+	allowed, err := r.allowed(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return forbidden(c)
+	}
+	user := &model.User{ID: c.Param("id")}
+	err = user.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+		}
+		return err
+	}
+	if !reaches(c, user.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("User"))
+	}
+	grants, err := user.Grants(r.db)
+	if err != nil {
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, grants)
+}
+
+// allowed reports whether the principal may manage the user with the given id, admins manage every user and
+// users manage themselves
+func (r *UserRoute) allowed(c echo.Context, id string) (bool, error) {
+	if user := Principal(c); user != nil && user.ID == id {
+		return true, nil
+	}
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return false, err
+	}
+	return perms.IsAdmin(), nil
+}
+
+// userError converts an invalid user attribute into a jsonapi error pointing at it, other errors give nil
+func userError(err error) *jsonapi.Error {
+	var attribute string
+	switch {
+	case errors.Is(err, model.ErrInvalidUserName):
+		attribute = "name"
+	case errors.Is(err, model.ErrInvalidEmail):
+		attribute = "email"
+	case errors.Is(err, model.ErrInvalidPassword):
+		attribute = "password"
+	default:
+		return nil
+	}
+	return &jsonapi.Error{
+		Title:  "Invalid user " + attribute,
+		Detail: err.Error(),
+		Source: &jsonapi.ErrorSource{Pointer: "/data/attributes/" + attribute},
+	}
+}
+
+// Register registers the routes for the users
+func (r *UserRoute) Register(e *echo.Echo) {
+	e.GET("/v1/users/:id", r.Get)
+	e.DELETE("/v1/users/:id", r.Delete)
+	e.POST("/v1/users", r.Create)
+	e.PATCH("/v1/users/:id", r.Update)
+	e.GET("/v1/users", r.List)
+	// Relationships
+	e.GET("/v1/users/:id/zones", r.GetZones)
+	e.POST("/v1/users/:id/zones", r.AddZone)
+	e.PATCH("/v1/users/:id/zones", r.UpdateZones)
+	e.DELETE("/v1/users/:id/zones", r.RemoveZone)
+	e.GET("/v1/users/:id/relationships/zones", r.GetZonesRelationship)
+	e.POST("/v1/users/:id/relationships/zones", r.AddZonesRelationship)
+	e.PATCH("/v1/users/:id/relationships/zones", r.UpdateZonesRelationship)
+	e.DELETE("/v1/users/:id/relationships/zones", r.RemoveZonesRelationship)
+	// API keys
+	e.GET("/v1/users/:id/api-keys", r.GetAPIKeys)
+	e.POST("/v1/users/:id/api-keys", r.CreateAPIKey)
+	e.DELETE("/v1/users/:id/api-keys/:key_id", r.DeleteAPIKey)
+	e.GET("/v1/users/:id/grants", r.GetGrants)
+	e.POST(loginPath, r.Login)
+}
@@ -0,0 +1,301 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserRoute_Create(t *testing.T) {
+	defer TearDown()
+
+	tests := []struct {
+		name               string
+		payload            string
+		expectedName       string
+		expectedEmail      string
+		expectedPointer    string
+		expectedStatusCode int
+	}{
+		{
+			name:               "valid user",
+			payload:            `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJUSER", "type": "users", "attributes": {"name": "Juliano", "email": "Juliano@Martinez.io", "password": "correct horse"}}}`,
+			expectedName:       "juliano",
+			expectedEmail:      "juliano@martinez.io",
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "short password",
+			payload:            `{"data": {"type": "users", "attributes": {"name": "short", "email": "short@martinez.io", "password": "secret"}}}`,
+			expectedPointer:    "/data/attributes/password",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "invalid email",
+			payload:            `{"data": {"type": "users", "attributes": {"name": "nomail", "email": "nomail"}}}`,
+			expectedPointer:    "/data/attributes/email",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "missing name",
+			payload:            `{"data": {"type": "users", "attributes": {"email": "noname@martinez.io"}}}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "existing name",
+			payload:            `{"data": {"type": "users", "attributes": {"name": "juliano", "email": "other@martinez.io"}}}`,
+			expectedStatusCode: http.StatusConflict,
+		},
+	}
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	route := &UserRoute{db: db}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, rec := postTestRequest("/v1/users", test.payload, e)
+			assert.NoError(t, route.Create(c))
+			assert.Equal(t, test.expectedStatusCode, rec.Code)
+			if test.expectedPointer != "" {
+				var document struct {
+					Errors []struct {
+						Source struct {
+							Pointer string `json:"pointer"`
+						} `json:"source"`
+					} `json:"errors"`
+				}
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+				if assert.Len(t, document.Errors, 1) {
+					assert.Equal(t, test.expectedPointer, document.Errors[0].Source.Pointer)
+				}
+				return
+			}
+			if test.expectedStatusCode == http.StatusConflict {
+				assert.Contains(t, rec.Header().Get(echo.HeaderLocation), "/v1/users/01F1ZQZJXQXZJXZJXZJXZJUSER")
+				return
+			}
+			if test.expectedStatusCode != http.StatusCreated {
+				return
+			}
+			assert.NotContains(t, rec.Body.String(), "password")
+			var user model.User
+			assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &user))
+			assert.Equal(t, test.expectedName, user.Name)
+			assert.Equal(t, test.expectedEmail, user.Email)
+		})
+	}
+
+	c, rec := getTestRequest("/v1/users/:id", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.Get(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "password")
+
+	c, rec = getTestRequest("/v1/users?filter[email]=Juliano@Martinez.io", e)
+	assert.NoError(t, route.List(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var users []model.User
+	assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &users))
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "01F1ZQZJXQXZJXZJXZJXZJUSER", users[0].ID)
+	}
+
+	c, rec = patchTestRequest("/v1/users/:id", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJUSER", "type": "users", "attributes": {"password": "battery staple"}}}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.Update(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "password")
+	user, err := model.FindUser(db, "juliano")
+	assert.NoError(t, err)
+	assert.True(t, user.CheckPassword("battery staple"))
+
+	c, rec = deleteTestRequest("/v1/users/:id", "", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.Delete(c))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	c, rec = getTestRequest("/v1/users/:id", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.Get(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// The name and email of a deleted user can be taken again
+	c, rec = postTestRequest("/v1/users", `{"data": {"type": "users", "attributes": {"name": "juliano", "email": "juliano@martinez.io"}}}`, e)
+	assert.NoError(t, route.Create(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestUserRoute_Zones(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	route := &UserRoute{db: db}
+	c, _ := postTestRequest("/v1/users", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJUSER", "type": "users", "attributes": {"name": "juliano", "email": "juliano@martinez.io"}}}`, e)
+	assert.NoError(t, route.Create(c))
+	routeZone := &ZoneRoute{db: db}
+	c, _ = postTestRequest("/v1/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJZONE", "type": "zones", "attributes": {"name": "martinez.io"}}}`, e)
+	assert.NoError(t, routeZone.Create(c))
+
+	c, rec := postTestRequest("/v1/users/:id/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJZONE", "type": "zones"}}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.AddZone(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	c, rec = postTestRequest("/v1/users/:id/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJX0NE", "type": "zones"}}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.AddZone(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	c, rec = getTestRequest("/v1/users/:id/zones", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.GetZones(c))
+	var zones []model.Zone
+	assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &zones))
+	if assert.Len(t, zones, 1) {
+		assert.Equal(t, "martinez.io", zones[0].Name)
+	}
+
+	// An empty list removes every zone
+	c, rec = patchTestRequest("/v1/users/:id/zones", `{"data": []}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.UpdateZones(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	c, rec = getTestRequest("/v1/users/:id/zones", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.GetZones(c))
+	assert.JSONEq(t, `{"data": []}`, rec.Body.String())
+}
+
+func TestUserRoute_APIKeys(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	route := &UserRoute{db: db}
+	c, _ := postTestRequest("/v1/users", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJUSER", "type": "users", "attributes": {"name": "juliano", "email": "juliano@martinez.io"}}}`, e)
+	assert.NoError(t, route.Create(c))
+
+	c, rec := postTestRequest("/v1/users/:id/api-keys", `{"data": {"type": "api-keys", "attributes": {"name": "ci"}}}`, e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.CreateAPIKey(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var key model.APIKey
+	assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &key))
+	assert.Equal(t, "ci", key.Name)
+	assert.NotEmpty(t, key.Token, "the token is returned on create")
+	authenticated, err := model.AuthenticateAPIKey(db, key.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, "01F1ZQZJXQXZJXZJXZJXZJUSER", authenticated.User.ID)
+
+	// The name and so the body are optional
+	c, rec = postTestRequest("/v1/users/:id/api-keys", "", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.CreateAPIKey(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	// The token is never returned again
+	c, rec = getTestRequest("/v1/users/:id/api-keys", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER")
+	assert.NoError(t, route.GetAPIKeys(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "token")
+	var keys []model.APIKey
+	assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &keys))
+	if assert.Len(t, keys, 2) {
+		assert.Equal(t, key.ID, keys[0].ID)
+		assert.Equal(t, key.Prefix, keys[0].Prefix)
+	}
+
+	c, rec = deleteTestRequest("/v1/users/:id/api-keys/:key_id", "", e)
+	c.SetParamNames("id", "key_id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJUSER", key.ID)
+	assert.NoError(t, route.DeleteAPIKey(c))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	_, err = model.AuthenticateAPIKey(db, key.Token)
+	assert.ErrorIs(t, err, model.ErrInvalidAPIKey)
+
+	c, rec = postTestRequest("/v1/users/:id/api-keys", "", e)
+	c.SetParamNames("id")
+	c.SetParamValues("01F1ZQZJXQXZJXZJXZJXZJZZZZ")
+	assert.NoError(t, route.CreateAPIKey(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUserRoute_Login(t *testing.T) {
+	defer TearDown()
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	user := model.User{Name: "juliano", Email: "juliano@martinez.io", Password: "correct horse"}
+	assert.NoError(t, db.Create(&user).Error)
+	e := New(db)
+
+	login := func(name, password string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"data": {"type": "users", "attributes": {"name": %q, "password": %q}}}`, name, password)
+		req := httptest.NewRequest(http.MethodPost, "/v1/login", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, binder.MIMEApplicationJSONApi)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Logging in needs no API key and returns a new one
+	rec := login("Juliano", "correct horse")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var key model.APIKey
+	assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &key))
+	assert.NotEmpty(t, key.Token)
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/"+user.ID, nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+key.Token)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	for _, credentials := range [][2]string{{"juliano", "battery staple"}, {"nobody", "correct horse"}, {"juliano", ""}} {
+		rec = login(credentials[0], credentials[1])
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, credentials[0])
+		assert.NotContains(t, rec.Body.String(), "token")
+	}
+	keys, err := user.APIKeys(db)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
@@ -4,11 +4,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
-
-	"github.com/ncode/port53/pkg/database"
+	"testing"
 
 	"github.com/labstack/echo/v4"
 	"github.com/ncode/port53/pkg/binder"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"gorm.io/gorm"
 )
 
 func TearDown() {
@@ -19,7 +21,7 @@ func getTestRequest(target string, e *echo.Echo) (c echo.Context, recGet *httpte
 	get := httptest.NewRequest(http.MethodGet, target, nil)
 	get.Header.Set(echo.HeaderContentType, binder.MIMEApplicationJSONApi)
 	recGet = httptest.NewRecorder()
-	return e.NewContext(get, recGet), recGet
+	return trustedContext(e.NewContext(get, recGet)), recGet
 }
 
 func deleteTestRequest(target string, payload string, e *echo.Echo) (c echo.Context, recDelete *httptest.ResponseRecorder) {
@@ -31,19 +33,48 @@ func deleteTestRequest(target string, payload string, e *echo.Echo) (c echo.Cont
 	}
 	del.Header.Set(echo.HeaderContentType, binder.MIMEApplicationJSONApi)
 	recDelete = httptest.NewRecorder()
-	return e.NewContext(del, recDelete), recDelete
+	return trustedContext(e.NewContext(del, recDelete)), recDelete
 }
 
 func patchTestRequest(target string, payload string, e *echo.Echo) (c echo.Context, recPatch *httptest.ResponseRecorder) {
 	patch := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(payload))
 	patch.Header.Set(echo.HeaderContentType, binder.MIMEApplicationJSONApi)
 	recPatch = httptest.NewRecorder()
-	return e.NewContext(patch, recPatch), recPatch
+	return trustedContext(e.NewContext(patch, recPatch)), recPatch
 }
 
 func postTestRequest(target string, payload string, e *echo.Echo) (c echo.Context, recPost *httptest.ResponseRecorder) {
 	post := httptest.NewRequest(http.MethodPost, target, strings.NewReader(payload))
 	post.Header.Set(echo.HeaderContentType, binder.MIMEApplicationJSONApi)
 	recPost = httptest.NewRecorder()
-	return e.NewContext(post, recPost), recPost
+	return trustedContext(e.NewContext(post, recPost)), recPost
+}
+
+// trustedContext lets the route handlers tested directly allow the request of c everything, as nil permissions do
+func trustedContext(c echo.Context) echo.Context {
+	c.Set(permissionsKey, (*model.Permissions)(nil))
+	return c
+}
+
+// setPrincipal authenticates the request of c as user, its permissions are the ones of the grants of user
+func setPrincipal(c echo.Context, user *model.User) {
+	c.Set(principalKey, user)
+	c.Set(permissionsKey, nil)
+}
+
+// operatorKey creates an operator holding the admin role and returns the token of its API key, for the tests
+// going through the authentication of New
+func operatorKey(t *testing.T, db *gorm.DB) string {
+	operator := model.User{Name: "operator", Email: "operator@martinez.io"}
+	if err := db.Create(&operator).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.Grant{Role: model.RoleAdmin, UserID: operator.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	key, err := operator.CreateAPIKey(db, "tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.Token
 }
@@ -2,22 +2,60 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 
+	"github.com/DataDog/jsonapi"
+	"github.com/oklog/ulid/v2"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ncode/port53/internal/dnsserver"
+	"github.com/ncode/port53/pkg/binder"
 	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/rdata"
+	"github.com/ncode/port53/pkg/zonefile"
 )
 
 type ZoneRoute struct {
 	db *gorm.DB
 }
 
+// zoneSorting maps the fields zones may be sorted by to their columns
+var zoneSorting = map[string]string{
+	"name":       "name",
+	"ttl":        "ttl",
+	"serial":     "serial",
+	"refresh":    "refresh",
+	"retry":      "retry",
+	"expire":     "expire",
+	"minimum":    "minimum",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// zoneFilters maps the fields zones may be filtered by to their columns
+var zoneFilters = map[string]filterField{
+	"name":          textFilter("name"),
+	"mname":         textFilter("m_name"),
+	"rname":         textFilter("r_name"),
+	"serial_scheme": textFilter("serial_scheme"),
+	"ttl":           numberFilter("ttl"),
+	"serial":        numberFilter("serial"),
+	"refresh":       numberFilter("refresh"),
+	"retry":         numberFilter("retry"),
+	"expire":        numberFilter("expire"),
+	"minimum":       numberFilter("minimum"),
+	"created_at":    timeFilter("created_at"),
+	"updated_at":    timeFilter("updated_at"),
+}
+
 // Create creates a new zone
 func (r *ZoneRoute) Create(c echo.Context) (err error) {
 	var zone model.Zone
@@ -25,77 +63,101 @@ func (r *ZoneRoute) Create(c echo.Context) (err error) {
 		return err
 	}
 	if zone.Name == "" {
-		return c.String(http.StatusBadRequest, "Name is required")
+		return JSONAPIError(c, http.StatusBadRequest, required("Name", "/data/attributes/name"))
 	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.Allows(model.RoleZoneAdmin, "") {
+		return forbidden(c)
+	}
+	// Zones belong to the organization of their creator, names only have to be unique within it
+	zone.OrganizationID = tenant(c)
 	err = r.db.Create(&zone).Error
 	if err != nil {
-		if err.Error() == "UNIQUE constraint failed: zones.name" {
+		if errors.Is(err, model.ErrInvalidSerialScheme) {
+			return JSONAPIError(c, http.StatusBadRequest, serialSchemeError())
+		}
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		if strings.Contains(err.Error(), "UNIQUE constraint failed: zones.organization_id, zones.name") {
 			var existingZone model.Zone
-			err = r.db.First(&existingZone, "name = ?", zone.Name).Error
+			err = r.db.First(&existingZone, "organization_id = ? AND name = ?", zone.OrganizationID, zone.Name).Error
 			if err != nil {
 				return err
 			}
 			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/zones/%s", viper.GetString("serviceUrl"), existingZone.ID))
-			return c.String(http.StatusConflict, "Zone already exists")
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("Zone"))
 		} else if err.Error() == "UNIQUE constraint failed: zones.id" {
 			c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/v1/zones/%s", viper.GetString("serviceUrl"), zone.ID))
-			return c.String(http.StatusConflict, "Zone already exists")
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("Zone"))
+		}
+		return err
+	}
+	// The creator of a zone owns it
+	if user := Principal(c); user != nil {
+		err = user.AddZone(r.db, &zone)
+		if err != nil {
+			return err
 		}
-		return c.String(http.StatusInternalServerError, err.Error())
 	}
 	return JSONAPI(c, http.StatusCreated, zone)
 }
 
-// List lists all zones
+// List lists all zones, their records and backends are only loaded when included
 func (r *ZoneRoute) List(c echo.Context) (err error) {
 	var zones []model.Zone
 
 	query, err := ParseQuery(c)
 	if err != nil {
-		return c.String(http.StatusBadRequest, "invalid query parameters")
-	}
-
-	p := &pagination{Number: 0, Size: 10}
-	if query.Page != nil {
-		p = &pagination{Number: query.Page.Number, Size: query.Page.Size}
-	}
-
-	if len(query.Filters) > 0 {
-		tx := r.db
-		for filter, content := range query.Filters {
-			// TODO: this is a bit hacky, but it works for now
-			//       find a better way to do this
-			for _, c := range content {
-				var f string
-				switch filter {
-				case "name":
-					f = "name = ?"
-				case "soa":
-					f = "soa = ?"
-				case "ttl":
-					f = "ttl = ?"
-				case "serial":
-					f = "serial = ?"
-				case "refresh":
-					f = "refresh = ?"
-				case "retry":
-					f = "retry = ?"
-				case "expire":
-					f = "expire = ?"
-				case "minimum":
-					f = "minimum = ?"
-				}
-				tx = tx.Where(f, c)
-			}
-		}
-		err = tx.Scopes(paginate(zones, p, tx)).Preload("Backends").Preload("Records").Find(&zones).Error
-	} else {
-		err = r.db.Scopes(paginate(zones, p, r.db)).Preload("Backends").Preload("Records").Find(&zones).Error
+		return JSONAPIError(c, http.StatusBadRequest, invalidQuery(err))
+	}
+	sorting, jsonErr := query.Sorting(zoneSorting)
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+	filtering, jsonErr := query.Filtering(zoneFilters)
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+	included, jsonErr := query.Included("records", "backends")
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	p, jsonErr := query.Pagination()
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
+
+	perms, err := permissions(c, r.db)
+	if err != nil {
+		return err
 	}
+	db := r.db
+	if ids, all := perms.ReadableZones(); !all {
+		db = db.Where("id IN ?", ids)
+	}
+	if organizationID := tenant(c); organizationID != "" {
+		db = db.Where("organization_id = ?", organizationID)
+	}
+
+	if included["backends"] {
+		db = db.Preload("Backends")
+	}
+	if included["records"] {
+		db = db.Preload("Records")
+	}
+	tx := db.Scopes(filtering)
+	err = tx.Scopes(paginate(zones, p, tx), sorting).Find(&zones).Error
 	if err != nil {
 		return err
 	}
+	p.Window(&zones)
 
+	var document compound
 	for pos, zone := range zones {
 		if len(zone.Backends) == 0 {
 			zones[pos].Backends = nil
@@ -103,10 +165,26 @@ func (r *ZoneRoute) List(c echo.Context) (err error) {
 		if len(zone.Records) == 0 {
 			zones[pos].Records = nil
 		}
+		includeZone(c, &document, &zones[pos], included)
 	}
 
-	p.SetLinks(fmt.Sprintf("/v1/zones?%s", query.BuildQuery()))
-	return JSONAPIPaginated(c, http.StatusOK, zones, p.Link())
+	p.SetLinks(query.Link("/v1/zones"))
+	return JSONAPIPaginated(c, http.StatusOK, zones, p.Link(), p.Meta(), document.option())
+}
+
+// includeZone includes the records and backends of zone in document when included asks for them
+func includeZone(c echo.Context, document *compound, zone *model.Zone, included map[string]bool) {
+	if included["records"] {
+		for _, record := range zone.Records {
+			document.add(record.ID, record)
+		}
+	}
+	if included["backends"] {
+		for _, backend := range zone.Backends {
+			redactBackends(c, backend)
+			document.add(backend.ID, backend)
+		}
+	}
 }
 
 // Update updates a zone
@@ -115,19 +193,38 @@ func (r *ZoneRoute) Update(c echo.Context) (err error) {
 	err = zone.Get(r.db, false)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Zone not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
 		}
 		return err
 	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.Allows(model.RoleZoneAdmin, zone.ID) {
+		return forbidden(c)
+	}
 	newZone := model.Zone{}
 	if err := c.Bind(&newZone); err != nil {
 		return err
 	}
 	if newZone.Name == "" {
-		return c.String(http.StatusBadRequest, "Name is required")
+		return JSONAPIError(c, http.StatusBadRequest, required("Name", "/data/attributes/name"))
 	}
 	err = zone.Update(r.db, newZone)
 	if err != nil {
+		if errors.Is(err, model.ErrInvalidSerialScheme) {
+			return JSONAPIError(c, http.StatusBadRequest, serialSchemeError())
+		}
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		if strings.Contains(err.Error(), "UNIQUE constraint failed: zones.organization_id, zones.name") {
+			return JSONAPIError(c, http.StatusConflict, alreadyExists("Zone"))
+		}
 		return err
 	}
 	return JSONAPI(c, http.StatusOK, zone)
@@ -135,45 +232,108 @@ func (r *ZoneRoute) Update(c echo.Context) (err error) {
 
 // Get gets a zone
 func (r *ZoneRoute) Get(c echo.Context) (err error) {
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), binder.MIMETextDNS) {
+		return r.Export(c)
+	}
+	query, err := ParseQuery(c)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, invalidQuery(err))
+	}
+	included, jsonErr := query.Included("records", "backends")
+	if jsonErr != nil {
+		return JSONAPIError(c, http.StatusBadRequest, jsonErr)
+	}
 	zone := model.Zone{ID: c.Param("id")}
 	err = zone.Get(r.db, true)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Backend not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
 		}
 		return err
 	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.CanRead(zone.ID) {
+		return forbidden(c)
+	}
 	if len(zone.Backends) == 0 {
 		zone.Backends = nil
 	}
 	if len(zone.Records) == 0 {
 		zone.Records = nil
 	}
-	return JSONAPI(c, http.StatusOK, zone)
+	var document compound
+	includeZone(c, &document, &zone, included)
+	return JSONAPI(c, http.StatusOK, zone, document.option())
 }
 
 // Delete deletes a zone
 func (r *ZoneRoute) Delete(c echo.Context) (err error) {
-	err = r.db.Where("id = ?", c.Param("id")).Delete(&model.Zone{}).Error
+	zone := &model.Zone{ID: c.Param("id")}
+	err = zone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return c.NoContent(http.StatusNoContent)
+		}
+		return err
+	}
+	if !reaches(c, zone.OrganizationID) {
+		return c.NoContent(http.StatusNoContent)
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.Allows(model.RoleZoneAdmin, zone.ID) {
+		return forbidden(c)
+	}
+	err = r.db.Where("id = ?", zone.ID).Delete(&model.Zone{}).Error
 	if err != nil {
 		return err
 	}
 	return c.NoContent(http.StatusNoContent)
 }
 
-// GetBackends gets a zone's backends
+// GetBackends gets a zone's backends along with the state of the zone on each of them, NOTIFY included
 func (r *ZoneRoute) GetBackends(c echo.Context) (err error) {
 	zone := model.Zone{ID: c.Param("id")}
 	err = zone.Get(r.db, true)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Backend not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
 		}
 		return err
 	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.CanRead(zone.ID) {
+		return forbidden(c)
+	}
 	if len(zone.Backends) == 0 {
 		return JSONAPI(c, http.StatusNotFound, nil)
 	}
+	statuses, err := zone.Statuses(r.db)
+	if err != nil {
+		return err
+	}
+	byBackend := make(map[string]*model.BackendZone, len(statuses))
+	for _, status := range statuses {
+		byBackend[status.BackendID] = status
+	}
+	for _, backend := range zone.Backends {
+		backend.Status = byBackend[backend.ID]
+	}
+	redactBackends(c, zone.Backends...)
 	return JSONAPI(c, http.StatusOK, zone.Backends)
 }
 
@@ -183,33 +343,50 @@ func (r *ZoneRoute) AddBackend(c echo.Context) (err error) {
 	err = zone.Get(r.db, false)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Zone not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
 		}
 		return err
 	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.Allows(model.RoleZoneAdmin, zone.ID) {
+		return forbidden(c)
+	}
 	var backend model.Backend
 	if err := c.Bind(&backend); err != nil {
 		if strings.Contains(err.Error(), "body is not a json:api representation") {
-			return c.String(http.StatusBadRequest, "Backend ID is required")
+			return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
 		}
 		return err
 	}
 	if backend.ID == "" {
-		return c.String(http.StatusBadRequest, "Backend ID is required")
+		return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
 	}
 	existingBackend := model.Backend{ID: backend.ID}
 	err = existingBackend.Get(r.db, false)
-	if err != nil && err.Error() == "record not found" {
+	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Backend not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
 		}
 		return err
 	}
+	if !backendVisible(c, &existingBackend) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Backend"))
+	}
 	err = zone.AddBackend(r.db, &existingBackend)
 	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
 		return err
 	}
 	r.db.Find(&backend, "id = ?", backend.ID)
+	redactBackends(c, &backend)
 	return JSONAPI(c, http.StatusOK, backend)
 }
 
@@ -219,19 +396,29 @@ func (r *ZoneRoute) RemoveBackend(c echo.Context) (err error) {
 	err = zone.Get(r.db, false)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Zone not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
 		}
 		return err
 	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.Allows(model.RoleZoneAdmin, zone.ID) {
+		return forbidden(c)
+	}
 	var backend model.Backend
 	if err := c.Bind(&backend); err != nil {
 		if strings.Contains(err.Error(), "body is not a json:api representation") {
-			return c.String(http.StatusBadRequest, "Backend ID is required")
+			return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
 		}
 		return err
 	}
 	if backend.ID == "" {
-		return c.String(http.StatusBadRequest, "Backend ID is required")
+		return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
 	}
 	err = zone.RemoveBackend(r.db, &backend)
 	if err != nil {
@@ -242,8 +429,9 @@ func (r *ZoneRoute) RemoveBackend(c echo.Context) (err error) {
 		return err
 	}
 	if len(zone.Backends) == 0 {
-		return c.String(http.StatusNoContent, "Zone doesn't have any backends")
+		return c.NoContent(http.StatusNoContent)
 	}
+	redactBackends(c, zone.Backends...)
 	return JSONAPI(c, http.StatusOK, zone.Backends)
 }
 
@@ -253,10 +441,20 @@ func (r *ZoneRoute) UpdateBackends(c echo.Context) (err error) {
 	err = zone.Get(r.db, true)
 	if err != nil {
 		if err.Error() == "record not found" {
-			return c.String(http.StatusNotFound, "Backend not found")
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
 		}
 		return err
 	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.Allows(model.RoleZoneAdmin, zone.ID) {
+		return forbidden(c)
+	}
 	var backends []model.Backend
 	if err := c.Bind(&backends); err != nil {
 		if strings.Contains(err.Error(), "body is not a json:api representation") {
@@ -267,7 +465,7 @@ func (r *ZoneRoute) UpdateBackends(c echo.Context) (err error) {
 					if err != nil {
 						return err
 					}
-					return c.String(http.StatusNoContent, "Removed all backends from zone")
+					return c.NoContent(http.StatusNoContent)
 				}
 			}
 		}
@@ -278,7 +476,7 @@ func (r *ZoneRoute) UpdateBackends(c echo.Context) (err error) {
 	for _, backend := range backends {
 		ids = append(ids, backend.ID)
 		if backend.ID == "" {
-			return c.String(http.StatusBadRequest, "Backend ID is required")
+			return JSONAPIError(c, http.StatusBadRequest, required("Backend ID", "/data"))
 		}
 	}
 	existingBackends := make([]*model.Backend, 0)
@@ -287,15 +485,520 @@ func (r *ZoneRoute) UpdateBackends(c echo.Context) (err error) {
 		return err
 	}
 	if len(existingBackends) == 0 || len(existingBackends) != len(backends) {
-		return c.String(http.StatusNotFound, "All backends must exist")
+		return JSONAPIError(c, http.StatusNotFound, missingResources("backends"))
+	}
+	for _, backend := range existingBackends {
+		if !backendVisible(c, backend) {
+			return JSONAPIError(c, http.StatusNotFound, missingResources("backends"))
+		}
 	}
 	err = zone.ReplaceBackends(r.db, existingBackends)
 	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
 		return err
 	}
+	redactBackends(c, existingBackends...)
 	return JSONAPI(c, http.StatusOK, existingBackends)
 }
 
+// GetBackendsRelationship gets the linkage of the backends of a zone
+func (r *ZoneRoute) GetBackendsRelationship(c echo.Context) (err error) {
+	zone := &model.Zone{ID: c.Param("id")}
+	err = zone.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return err
+	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.CanRead(zone.ID) {
+		return forbidden(c)
+	}
+	return JSONAPILinkage(c, http.StatusOK, zone.LinkRelation("backends"), backendIdentifiers(zone.Backends))
+}
+
+// AddBackendsRelationship adds the backends of the linkage to a zone, backends already serving the zone are kept
+func (r *ZoneRoute) AddBackendsRelationship(c echo.Context) (err error) {
+	zone, backends, err := r.linkedBackends(c)
+	if zone == nil {
+		return err
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		for _, backend := range backends {
+			err := zone.AddBackend(tx, backend)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateBackendsRelationship replaces the backends of a zone with the ones of the linkage, an empty linkage
+// removes every backend
+func (r *ZoneRoute) UpdateBackendsRelationship(c echo.Context) (err error) {
+	zone, backends, err := r.linkedBackends(c)
+	if zone == nil {
+		return err
+	}
+	err = zone.ReplaceBackends(r.db, backends)
+	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RemoveBackendsRelationship removes the backends of the linkage from a zone, backends not serving it are ignored
+func (r *ZoneRoute) RemoveBackendsRelationship(c echo.Context) (err error) {
+	zone, backends, err := r.linkedBackends(c)
+	if zone == nil {
+		return err
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		for _, backend := range backends {
+			err := zone.RemoveBackend(tx, backend)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// linkedBackends loads the zone of a request changing its backends and the backends of the linkage of the
+// request. The zone is nil when the request was already answered, err is then the one of writing the response.
+func (r *ZoneRoute) linkedBackends(c echo.Context) (zone *model.Zone, backends []*model.Backend, err error) {
+	zone = &model.Zone{ID: c.Param("id")}
+	err = zone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return nil, nil, JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return nil, nil, err
+	}
+	if !reaches(c, zone.OrganizationID) {
+		return nil, nil, JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !p.Allows(model.RoleZoneAdmin, zone.ID) {
+		return nil, nil, forbidden(c)
+	}
+	ids, jsonErr := toManyLinkage(c, "backends")
+	if jsonErr != nil {
+		return nil, nil, JSONAPIError(c, *jsonErr.Status, jsonErr)
+	}
+	backends, found, err := findBackends(c, r.db, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, JSONAPIError(c, http.StatusNotFound, missingResources("backends"))
+	}
+	return zone, backends, nil
+}
+
+// GetRecordsRelationship gets the linkage of the records of a zone
+func (r *ZoneRoute) GetRecordsRelationship(c echo.Context) (err error) {
+	zone := &model.Zone{ID: c.Param("id")}
+	err = zone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return err
+	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.CanRead(zone.ID) {
+		return forbidden(c)
+	}
+	// Only the ids are loaded, zones may hold many records
+	var ids []string
+	err = r.db.Model(&model.Record{}).Where("zone_id = ?", zone.ID).Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+	linkage := make([]identifier, 0, len(ids))
+	for _, id := range ids {
+		linkage = append(linkage, identifier{Type: "records", ID: id})
+	}
+	return JSONAPILinkage(c, http.StatusOK, zone.LinkRelation("records"), linkage)
+}
+
+// AddRecordsRelationship moves the records of the linkage to a zone
+func (r *ZoneRoute) AddRecordsRelationship(c echo.Context) (err error) {
+	zone := &model.Zone{ID: c.Param("id")}
+	err = zone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return err
+	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	ids, jsonErr := toManyLinkage(c, "records")
+	if jsonErr != nil {
+		return JSONAPIError(c, *jsonErr.Status, jsonErr)
+	}
+	recordRoute := &RecordRoute{db: r.db}
+	records := make([]*model.Record, 0, len(ids))
+	for _, id := range ids {
+		record := &model.Record{ID: id}
+		err = record.Get(r.db, true)
+		if err != nil {
+			if err.Error() == "record not found" {
+				return JSONAPIError(c, http.StatusNotFound, missingResources("records"))
+			}
+			return err
+		}
+		if !reaches(c, record.Zone.OrganizationID) {
+			return JSONAPIError(c, http.StatusNotFound, missingResources("records"))
+		}
+		allowed, err := recordRoute.movable(c, record, zone.ID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return forbidden(c)
+		}
+		records = append(records, record)
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		for _, record := range records {
+			err := record.ReplaceZone(tx, zone)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateRecordsRelationship refuses to replace the records of a zone, the records left out would be left without
+// a zone. Records are moved through POST or deleted instead.
+func (r *ZoneRoute) UpdateRecordsRelationship(c echo.Context) (err error) {
+	zone := &model.Zone{ID: c.Param("id")}
+	err = zone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return err
+	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	return JSONAPIError(c, http.StatusForbidden, &jsonapi.Error{
+		Title:  "Full replacement refused",
+		Detail: "Replacing the records of a zone would leave the records left out without a zone, add records to the zone through POST and delete the others instead",
+	})
+}
+
+// RemoveRecordsRelationship refuses to remove records from a zone, records always belong to a zone so they are
+// moved to another zone or deleted instead
+func (r *ZoneRoute) RemoveRecordsRelationship(c echo.Context) (err error) {
+	zone := &model.Zone{ID: c.Param("id")}
+	err = zone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return err
+	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	return JSONAPIError(c, http.StatusForbidden, &jsonapi.Error{
+		Title:  "Zone required",
+		Detail: "Records always belong to a zone, move them to another zone or delete them instead",
+	})
+}
+
+// GetRRSets gets a zone's records grouped by name and type
+func (r *ZoneRoute) GetRRSets(c echo.Context) (err error) {
+	zone := model.Zone{ID: c.Param("id")}
+	err = zone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return err
+	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.CanRead(zone.ID) {
+		return forbidden(c)
+	}
+	rrsets, err := zone.RRSets(r.db)
+	if err != nil {
+		return err
+	}
+	return JSONAPI(c, http.StatusOK, rrsets)
+}
+
+// Import replaces the records and SOA fields of a zone with the ones from a RFC 1035 master file
+func (r *ZoneRoute) Import(c echo.Context) (err error) {
+	zone := &model.Zone{ID: c.Param("id")}
+	err = zone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return err
+	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.Allows(model.RoleZoneAdmin, zone.ID) {
+		return forbidden(c)
+	}
+	if !strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), binder.MIMETextDNS) {
+		return echo.ErrUnsupportedMediaType
+	}
+	imported, err := zonefile.Parse(c.Request().Body, zone.Name)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, &jsonapi.Error{Title: "Invalid zone file", Detail: err.Error()})
+	}
+	err = zone.Import(r.db, imported, c.QueryParam("merge") == "true")
+	if err != nil {
+		var validationErr *rdata.Error
+		if errors.As(err, &validationErr) {
+			return JSONAPIError(c, http.StatusBadRequest, &jsonapi.Error{Title: "Invalid zone file", Detail: err.Error()})
+		}
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		return err
+	}
+	err = zone.Get(r.db, true)
+	if err != nil {
+		return err
+	}
+	if len(zone.Backends) == 0 {
+		zone.Backends = nil
+	}
+	if len(zone.Records) == 0 {
+		zone.Records = nil
+	}
+	return JSONAPI(c, http.StatusOK, zone)
+}
+
+// errPrimaryNotAllowed is returned when the primary of a transfer is in the network of the server without being
+// allowed by the config
+var errPrimaryNotAllowed = errors.New("primary not allowed")
+
+// Transfer performs an AXFR of the zone from a primary server and reconciles the transferred records into the zone.
+// Only operators may transfer zones as the server connects to the primary on their behalf.
+func (r *ZoneRoute) Transfer(c echo.Context) (err error) {
+	zone := &model.Zone{ID: c.Param("id")}
+	err = zone.Get(r.db, false)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return err
+	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if tenant(c) != "" || !p.IsAdmin() {
+		return forbidden(c)
+	}
+	var request model.ZoneTransfer
+	if err := c.Bind(&request); err != nil {
+		return err
+	}
+	if request.Primary == "" {
+		return JSONAPIError(c, http.StatusBadRequest, required("Primary", "/data/attributes/primary"))
+	}
+	primary, err := model.DNSAddr(request.Primary)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadRequest, &jsonapi.Error{
+			Title:  "Invalid primary",
+			Detail: err.Error(),
+			Source: &jsonapi.ErrorSource{Pointer: "/data/attributes/primary"},
+		})
+	}
+	acl, err := dnsserver.ParseACL(viper.GetStringSlice("transferPrimaries"))
+	if err != nil {
+		return err
+	}
+	addr, err := resolvePrimary(c.Request().Context(), acl, primary)
+	if err != nil {
+		status, title := http.StatusBadRequest, "Invalid primary"
+		if errors.Is(err, errPrimaryNotAllowed) {
+			status, title = http.StatusForbidden, "Primary not allowed"
+		}
+		return JSONAPIError(c, status, &jsonapi.Error{
+			Title:  title,
+			Detail: err.Error(),
+			Source: &jsonapi.ErrorSource{Pointer: "/data/attributes/primary"},
+		})
+	}
+	var key *model.TSIGKey
+	if request.TSIGKey != "" {
+		key, err = model.FindTSIGKey(r.db, request.TSIGKey)
+		if err == nil && !reaches(c, key.OrganizationID) {
+			err = gorm.ErrRecordNotFound
+		}
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return JSONAPIError(c, http.StatusBadRequest, &jsonapi.Error{
+					Title:  "Invalid TSIG key",
+					Detail: fmt.Sprintf("TSIG key %s not found", request.TSIGKey),
+					Source: &jsonapi.ErrorSource{Pointer: "/data/attributes/tsig_key"},
+				})
+			}
+			return err
+		}
+	}
+
+	transferred, err := zonefile.Transfer(addr, zone.Name, key)
+	if err != nil {
+		return JSONAPIError(c, http.StatusBadGateway, &jsonapi.Error{Title: "Zone transfer failed", Detail: err.Error()})
+	}
+	transfer, err := zone.Reconcile(r.db, transferred)
+	if err != nil {
+		var validationErr *rdata.Error
+		if errors.As(err, &validationErr) {
+			return JSONAPIError(c, http.StatusBadGateway, &jsonapi.Error{Title: "Zone transfer failed", Detail: err.Error()})
+		}
+		if code, jsonErr := organizationError(err); jsonErr != nil {
+			return JSONAPIError(c, code, jsonErr)
+		}
+		return err
+	}
+	transfer.ID = ulid.Make().String()
+	transfer.Primary = primary
+	transfer.TSIGKey = request.TSIGKey
+	return JSONAPI(c, http.StatusOK, transfer)
+}
+
+// resolvePrimary returns the host:port to transfer from for primary, its host resolved to an address so the
+// connection goes to the address checked. Loopback, private, link-local and unspecified addresses are refused
+// unless they are in one of the networks of acl.
+func resolvePrimary(ctx context.Context, acl []*net.IPNet, primary string) (string, error) {
+	host, port, err := net.SplitHostPort(primary)
+	if err != nil {
+		return "", err
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return "", err
+	}
+	for _, ip := range ips {
+		if publicIP(ip) || inACL(acl, ip) {
+			return net.JoinHostPort(ip.String(), port), nil
+		}
+	}
+	return "", fmt.Errorf("%w, %s is in the network of the server and not in the transferPrimaries of its config", errPrimaryNotAllowed, host)
+}
+
+// publicIP reports whether ip is outside the loopback, private, link-local, unspecified and multicast ranges
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsUnspecified() && !ip.IsMulticast()
+}
+
+// inACL reports whether ip is in one of the networks of acl
+func inACL(acl []*net.IPNet, ip net.IP) bool {
+	for _, network := range acl {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Export renders a zone and its records as a RFC 1035 master file
+func (r *ZoneRoute) Export(c echo.Context) (err error) {
+	zone := model.Zone{ID: c.Param("id")}
+	err = zone.Get(r.db, true)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+		}
+		return err
+	}
+	if !reaches(c, zone.OrganizationID) {
+		return JSONAPIError(c, http.StatusNotFound, notFound("Zone"))
+	}
+	p, err := permissions(c, r.db)
+	if err != nil {
+		return err
+	}
+	if !p.CanRead(zone.ID) {
+		return forbidden(c)
+	}
+	content, err := zonefile.Render(&zone)
+	if err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, binder.MIMETextDNS, content)
+}
+
+// serialSchemeError returns the jsonapi error for an invalid serial scheme
+func serialSchemeError() *jsonapi.Error {
+	return &jsonapi.Error{
+		Title:  "Invalid serial scheme",
+		Detail: model.ErrInvalidSerialScheme.Error(),
+		Source: &jsonapi.ErrorSource{Pointer: "/data/attributes/serial_scheme"},
+	}
+}
+
 // Register registers the routes
 func (r *ZoneRoute) Register(e *echo.Echo) {
 	e.GET("/v1/zones/:id", r.Get)
@@ -306,6 +1009,18 @@ func (r *ZoneRoute) Register(e *echo.Echo) {
 	// Relationships
 	e.GET("/v1/zones/:id/backends", r.GetBackends)
 	e.POST("/v1/zones/:id/backends", r.AddBackend)
-	e.PATCH("/v1/backends/:id/backends", r.UpdateBackends)
+	e.PATCH("/v1/zones/:id/backends", r.UpdateBackends)
 	e.DELETE("/v1/zones/:id/backends", r.RemoveBackend)
+	e.GET("/v1/zones/:id/relationships/backends", r.GetBackendsRelationship)
+	e.POST("/v1/zones/:id/relationships/backends", r.AddBackendsRelationship)
+	e.PATCH("/v1/zones/:id/relationships/backends", r.UpdateBackendsRelationship)
+	e.DELETE("/v1/zones/:id/relationships/backends", r.RemoveBackendsRelationship)
+	e.GET("/v1/zones/:id/relationships/records", r.GetRecordsRelationship)
+	e.POST("/v1/zones/:id/relationships/records", r.AddRecordsRelationship)
+	e.PATCH("/v1/zones/:id/relationships/records", r.UpdateRecordsRelationship)
+	e.DELETE("/v1/zones/:id/relationships/records", r.RemoveRecordsRelationship)
+	e.GET("/v1/zones/:id/rrsets", r.GetRRSets)
+	e.POST("/v1/zones/:id/import", r.Import)
+	e.POST("/v1/zones/:id/transfer", r.Transfer)
+	e.GET("/v1/zones/:id/export", r.Export)
 }
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"testing"
 
 	"github.com/DataDog/jsonapi"
 	"github.com/labstack/echo/v4"
+	"github.com/miekg/dns"
 	"github.com/ncode/port53/pkg/binder"
 	"github.com/ncode/port53/pkg/database"
 	"github.com/ncode/port53/pkg/model"
@@ -39,6 +42,11 @@ func TestZonedRoute_Create(t *testing.T) {
 			input:              `{"data": {"type": "zones", "attributes": {"name": ""}}}`,
 			expectedStatusCode: http.StatusBadRequest,
 		},
+		{
+			name:               "invalid serial scheme",
+			input:              `{"data": {"type": "zones", "attributes": {"name": "weekly.martinez.io", "serial_scheme": "weekly"}}}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
 		{
 			name:                   "id conflict",
 			input:                  `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJ1", "type": "zones", "attributes": {"name": "zones"}}}`,
@@ -297,6 +305,92 @@ func TestZoneRoute_List(t *testing.T) {
 	}
 }
 
+func TestZoneRoute_List_Compound(t *testing.T) {
+	defer TearDown()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	route := &ZoneRoute{db: db}
+
+	for _, name := range []string{"a.martinez.io", "c.martinez.io", "b.martinez.io"} {
+		zone := model.Zone{Name: name, TTL: 300}
+		assert.NoError(t, db.Create(&zone).Error)
+		record := model.Record{Name: "www." + name, Type: "A", Content: "192.168.0.1", TTL: 300, ZoneID: zone.ID}
+		assert.NoError(t, record.Create(db))
+	}
+	type document struct {
+		Data []struct {
+			Attributes    map[string]interface{} `json:"attributes"`
+			Relationships map[string]interface{} `json:"relationships"`
+		} `json:"data"`
+		Included []struct {
+			Type string `json:"type"`
+		} `json:"included"`
+	}
+	list := func(query string) (int, document) {
+		c, rec := getTestRequest("/v1/zones?"+query, e)
+		assert.NoError(t, route.List(c))
+		var doc document
+		if rec.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+		}
+		return rec.Code, doc
+	}
+
+	t.Run("records are left out unless included", func(t *testing.T) {
+		code, doc := list("")
+		assert.Equal(t, http.StatusOK, code)
+		if assert.Len(t, doc.Data, 3) {
+			assert.NotContains(t, doc.Data[0].Relationships, "records")
+		}
+		assert.Empty(t, doc.Included)
+	})
+
+	t.Run("include records", func(t *testing.T) {
+		code, doc := list("include=records")
+		assert.Equal(t, http.StatusOK, code)
+		if assert.Len(t, doc.Data, 3) {
+			assert.Contains(t, doc.Data[0].Relationships, "records")
+		}
+		if assert.Len(t, doc.Included, 3) {
+			assert.Equal(t, "records", doc.Included[0].Type)
+		}
+	})
+
+	t.Run("sort by name descending", func(t *testing.T) {
+		code, doc := list("sort=-name")
+		assert.Equal(t, http.StatusOK, code)
+		var names []interface{}
+		for _, zone := range doc.Data {
+			names = append(names, zone.Attributes["name"])
+		}
+		assert.Equal(t, []interface{}{"c.martinez.io", "b.martinez.io", "a.martinez.io"}, names)
+	})
+
+	t.Run("sparse fieldsets", func(t *testing.T) {
+		code, doc := list("fields[zones]=name,ttl")
+		assert.Equal(t, http.StatusOK, code)
+		if assert.Len(t, doc.Data, 3) {
+			assert.Len(t, doc.Data[0].Attributes, 2)
+			assert.Contains(t, doc.Data[0].Attributes, "ttl")
+		}
+	})
+
+	t.Run("sort outside of the whitelist", func(t *testing.T) {
+		code, _ := list("sort=organization_id")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("unknown include", func(t *testing.T) {
+		code, _ := list("include=users")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
 func TestZoneRoute_List_With_Filters(t *testing.T) {
 	defer TearDown()
 
@@ -422,6 +516,10 @@ func TestZonedRoute_GetBackend(t *testing.T) {
 				assert.NoError(t, jsonapi.Unmarshal(recGet.Body.Bytes(), &backends))
 				assert.Equal(t, test.expectedData.ID, backends[0].ID)
 				assert.Equal(t, test.expectedData.Name, backends[0].Name)
+				if assert.NotNil(t, backends[0].Status) {
+					assert.Equal(t, test.id, backends[0].Status.ZoneID)
+					assert.Empty(t, backends[0].Status.NotifyStatus)
+				}
 			}
 		})
 	}
@@ -698,3 +796,436 @@ func TestZoneRoute_UpdateBackends(t *testing.T) {
 		})
 	}
 }
+
+func TestZoneRoute_GetRRSets(t *testing.T) {
+	defer TearDown()
+
+	tests := []struct {
+		name               string
+		input              string
+		recordsInput       []string
+		id                 string
+		expectedData       []model.RRSet
+		expectedStatusCode int
+	}{
+		{
+			name:  "valid input",
+			input: `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "martinez.io"}}}`,
+			recordsInput: []string{
+				`{"data": {"type": "records", "attributes": {"name": "www.martinez.io", "type": "A", "ttl": 300, "content": "192.168.0.1"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+				`{"data": {"type": "records", "attributes": {"name": "www.martinez.io", "type": "A", "ttl": 600, "content": "192.168.0.2"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+				`{"data": {"type": "records", "attributes": {"name": "www.martinez.io", "type": "AAAA", "ttl": 300, "content": "::1"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+			},
+			id: "01F1ZQZJXQXZJXZJXZJXZJXZJX",
+			expectedData: []model.RRSet{
+				{ID: "www.martinez.io/A", Name: "www.martinez.io", Type: "A", TTL: 600, Contents: []string{"192.168.0.1", "192.168.0.2"}},
+				{ID: "www.martinez.io/AAAA", Name: "www.martinez.io", Type: "AAAA", TTL: 300, Contents: []string{"::1"}},
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "nonexistent zone",
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJXZZZ",
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			routeZone := &ZoneRoute{db: db}
+			if test.input != "" {
+				c, _ := postTestRequest("/v1/zones", test.input, e)
+				err = routeZone.Create(c)
+				assert.NoError(t, err)
+			}
+
+			routeRecord := &RecordRoute{db: db}
+			for _, input := range test.recordsInput {
+				c, rec := postTestRequest("/v1/records", input, e)
+				assert.NoError(t, routeRecord.Create(c))
+				assert.Equal(t, http.StatusCreated, rec.Code)
+			}
+
+			c, rec := getTestRequest("/v1/zones/:id/rrsets", e)
+			c.SetParamNames("id")
+			c.SetParamValues(test.id)
+			if assert.NoError(t, routeZone.GetRRSets(c)) {
+				assert.Equal(t, test.expectedStatusCode, rec.Code)
+				if test.expectedData != nil {
+					var rrsets []model.RRSet
+					assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &rrsets))
+					assert.Len(t, rrsets, len(test.expectedData))
+					for pos, rrset := range rrsets {
+						assert.Equal(t, test.expectedData[pos].ID, rrset.ID)
+						assert.Equal(t, test.expectedData[pos].TTL, rrset.TTL)
+						assert.Equal(t, test.expectedData[pos].Contents, rrset.Contents)
+						assert.Len(t, rrset.Records, len(test.expectedData[pos].Contents))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestZoneRoute_Import(t *testing.T) {
+	defer TearDown()
+
+	tests := []struct {
+		name               string
+		input              string
+		id                 string
+		contentType        string
+		zoneFile           string
+		expectedSerial     int
+		expectedRecords    int
+		expectedStatusCode int
+	}{
+		{
+			name:        "valid zone file",
+			input:       `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "martinez.io"}}}`,
+			id:          "01F1ZQZJXQXZJXZJXZJXZJXZJX",
+			contentType: binder.MIMETextDNS,
+			zoneFile: `$TTL 300
+@	IN	SOA	ns1 hostmaster 2023010101 7200 900 1209600 300
+@	IN	NS	ns1
+ns1	IN	A	192.168.0.1
+www	IN	A	192.168.0.10
+www	IN	A	192.168.0.11
+`,
+			expectedSerial:     2023010101,
+			expectedRecords:    4,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "invalid zone file",
+			input:              `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "martinez.io"}}}`,
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJXZJX",
+			contentType:        binder.MIMETextDNS,
+			zoneFile:           "www IN A 192.168.0.10\n",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "nonexistent zone",
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJXZZZ",
+			contentType:        binder.MIMETextDNS,
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			routeZone := &ZoneRoute{db: db}
+			if test.input != "" {
+				c, _ := postTestRequest("/v1/zones", test.input, e)
+				assert.NoError(t, routeZone.Create(c))
+			}
+
+			c, rec := postTestRequest("/v1/zones/:id/import", test.zoneFile, e)
+			c.Request().Header.Set(echo.HeaderContentType, test.contentType)
+			c.SetParamNames("id")
+			c.SetParamValues(test.id)
+			if assert.NoError(t, routeZone.Import(c)) {
+				assert.Equal(t, test.expectedStatusCode, rec.Code)
+				if test.expectedStatusCode == http.StatusOK {
+					var zone model.Zone
+					assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &zone))
+					assert.Equal(t, test.expectedSerial, zone.Serial)
+					assert.Equal(t, "ns1.martinez.io", zone.MName)
+					assert.Len(t, zone.Records, test.expectedRecords)
+				}
+			}
+		})
+	}
+}
+
+func TestZoneRoute_Export(t *testing.T) {
+	defer TearDown()
+
+	tests := []struct {
+		name               string
+		input              string
+		recordInput        string
+		id                 string
+		accept             string
+		expectedContent    string
+		expectedStatusCode int
+	}{
+		{
+			name:        "export route",
+			input:       `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "martinez.io", "mname": "ns1", "rname": "hostmaster", "serial": 2023010101}}}`,
+			recordInput: `{"data": {"type": "records", "attributes": {"name": "www.martinez.io", "type": "A", "ttl": 300, "content": "192.168.0.1"}, "relationships": { "zones": { "data": { "type": "zones", "id": "01F1ZQZJXQXZJXZJXZJXZJXZJX" }}}}}`,
+			id:          "01F1ZQZJXQXZJXZJXZJXZJXZJX",
+			expectedContent: "$ORIGIN martinez.io.\n$TTL 3600\n" +
+				"martinez.io.\t3600\tIN\tSOA\tns1.martinez.io. hostmaster.martinez.io. 2023010102 3600 600 604800 3600\n" +
+				"www.martinez.io.\t300\tIN\tA\t192.168.0.1\n",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:   "content negotiation",
+			id:     "01F1ZQZJXQXZJXZJXZJXZJXZJX",
+			accept: binder.MIMETextDNS,
+			expectedContent: "$ORIGIN martinez.io.\n$TTL 3600\n" +
+				"martinez.io.\t3600\tIN\tSOA\tns1.martinez.io. hostmaster.martinez.io. 2023010102 3600 600 604800 3600\n" +
+				"www.martinez.io.\t300\tIN\tA\t192.168.0.1\n",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "nonexistent zone",
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJXZZZ",
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			routeZone := &ZoneRoute{db: db}
+			if test.input != "" {
+				c, _ := postTestRequest("/v1/zones", test.input, e)
+				assert.NoError(t, routeZone.Create(c))
+			}
+			if test.recordInput != "" {
+				routeRecord := &RecordRoute{db: db}
+				c, _ := postTestRequest("/v1/records", test.recordInput, e)
+				assert.NoError(t, routeRecord.Create(c))
+			}
+
+			c, rec := getTestRequest("/v1/zones/:id/export", e)
+			c.SetParamNames("id")
+			c.SetParamValues(test.id)
+			handler := routeZone.Export
+			if test.accept != "" {
+				c.Request().Header.Set(echo.HeaderAccept, test.accept)
+				handler = routeZone.Get
+			}
+			if assert.NoError(t, handler(c)) {
+				assert.Equal(t, test.expectedStatusCode, rec.Code)
+				if test.expectedContent != "" {
+					assert.Equal(t, binder.MIMETextDNS, rec.Header().Get(echo.HeaderContentType))
+					assert.Equal(t, test.expectedContent, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+// primary is a fake primary server answering AXFR signed with its key
+type primary struct {
+	rrs []dns.RR
+}
+
+func (p *primary) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if r.IsTsig() == nil || w.TsigStatus() != nil || r.Question[0].Qtype != dns.TypeAXFR {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		_ = w.WriteMsg(m)
+		return
+	}
+	ch := make(chan *dns.Envelope, 1)
+	ch <- &dns.Envelope{RR: p.rrs}
+	close(ch)
+	_ = new(dns.Transfer).Out(w, r, ch)
+	_ = w.Close()
+}
+
+func TestZoneRoute_Transfer(t *testing.T) {
+	defer TearDown()
+
+	const secret = "c2VjcmV0LXNoYXJlZC13aXRoLXRoZS1wcmltYXJ5IQ=="
+	rr := func(s string) dns.RR {
+		parsed, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	soa := rr("martinez.io. 3600 IN SOA ns1.martinez.io. hostmaster.martinez.io. 2023010101 7200 900 1209600 300")
+	fake := &primary{rrs: []dns.RR{
+		soa,
+		rr("martinez.io. 300 IN NS ns1.martinez.io."),
+		rr("ns1.martinez.io. 300 IN A 192.168.0.1"),
+		rr("www.martinez.io. 600 IN A 192.168.0.10"),
+		rr("mail.martinez.io. 300 IN A 192.168.0.25"),
+		soa,
+	}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{Listener: listener, Handler: fake, TsigSecret: map[string]string{"primary-key.": secret}, NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	<-started
+	defer func() { _ = server.Shutdown() }()
+
+	e := echo.New()
+	e.Binder = &binder.JsonApiBinder{}
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	routeZone := &ZoneRoute{db: db}
+	c, _ := postTestRequest("/v1/zones", `{"data": {"id":"01F1ZQZJXQXZJXZJXZJXZJXZJX", "type": "zones", "attributes": {"name": "martinez.io"}}}`, e)
+	assert.NoError(t, routeZone.Create(c))
+	zone := model.Zone{ID: "01F1ZQZJXQXZJXZJXZJXZJXZJX"}
+	for _, record := range []*model.Record{
+		{ZoneID: zone.ID, Name: "martinez.io", Type: "NS", Content: "ns1.martinez.io.", TTL: 300},
+		{ZoneID: zone.ID, Name: "ns1.martinez.io", Type: "A", Content: "192.168.0.1", TTL: 300},
+		{ZoneID: zone.ID, Name: "www.martinez.io", Type: "A", Content: "192.168.0.10", TTL: 300},
+		{ZoneID: zone.ID, Name: "old.martinez.io", Type: "A", Content: "192.168.0.9", TTL: 300},
+	} {
+		assert.NoError(t, record.Create(db))
+	}
+	assert.NoError(t, db.Create(&model.TSIGKey{Name: "primary-key", Secret: secret}).Error)
+	// The fake primary listens on loopback, it must be allowed explicitly
+	viper.Set("transferPrimaries", []string{"127.0.0.1"})
+	defer viper.Set("transferPrimaries", nil)
+
+	tests := []struct {
+		name               string
+		id                 string
+		input              string
+		expectedStatusCode int
+		expectedSerial     int
+		expectedAdded      []string
+		expectedChanged    []string
+		expectedRemoved    []string
+	}{
+		{
+			name:               "missing primary",
+			id:                 zone.ID,
+			input:              `{"data": {"type": "zone-transfers", "attributes": {}}}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "invalid primary",
+			id:                 zone.ID,
+			input:              `{"data": {"type": "zone-transfers", "attributes": {"primary": "127.0.0.1:dns"}}}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "unknown TSIG key",
+			id:                 zone.ID,
+			input:              fmt.Sprintf(`{"data": {"type": "zone-transfers", "attributes": {"primary": "%s", "tsig_key": "unknown-key"}}}`, listener.Addr()),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "loopback primary not allowed",
+			id:                 zone.ID,
+			input:              `{"data": {"type": "zone-transfers", "attributes": {"primary": "127.0.0.2"}}}`,
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "private primary not allowed",
+			id:                 zone.ID,
+			input:              `{"data": {"type": "zone-transfers", "attributes": {"primary": "10.0.0.53:5353"}}}`,
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "link-local primary not allowed",
+			id:                 zone.ID,
+			input:              `{"data": {"type": "zone-transfers", "attributes": {"primary": "[fe80::1]"}}}`,
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "refused transfer",
+			id:                 zone.ID,
+			input:              fmt.Sprintf(`{"data": {"type": "zone-transfers", "attributes": {"primary": "%s"}}}`, listener.Addr()),
+			expectedStatusCode: http.StatusBadGateway,
+		},
+		{
+			name:               "transfer signed with a key",
+			id:                 zone.ID,
+			input:              fmt.Sprintf(`{"data": {"type": "zone-transfers", "attributes": {"primary": "%s", "tsig_key": "primary-key"}}}`, listener.Addr()),
+			expectedStatusCode: http.StatusOK,
+			expectedSerial:     2023010101,
+			expectedAdded:      []string{"mail.martinez.io/A"},
+			expectedChanged:    []string{"www.martinez.io/A"},
+			expectedRemoved:    []string{"old.martinez.io/A"},
+		},
+		{
+			name:               "transfer of an up to date zone",
+			id:                 zone.ID,
+			input:              fmt.Sprintf(`{"data": {"type": "zone-transfers", "attributes": {"primary": "%s", "tsig_key": "primary-key"}}}`, listener.Addr()),
+			expectedStatusCode: http.StatusOK,
+			expectedSerial:     2023010101,
+		},
+		{
+			name:               "nonexistent zone",
+			id:                 "01F1ZQZJXQXZJXZJXZJXZJXZZZ",
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, rec := postTestRequest("/v1/zones/:id/transfer", test.input, e)
+			c.SetParamNames("id")
+			c.SetParamValues(test.id)
+			if assert.NoError(t, routeZone.Transfer(c)) {
+				assert.Equal(t, test.expectedStatusCode, rec.Code)
+				if test.expectedStatusCode != http.StatusOK {
+					return
+				}
+				var transfer model.ZoneTransfer
+				assert.NoError(t, jsonapi.Unmarshal(rec.Body.Bytes(), &transfer))
+				assert.Equal(t, test.expectedSerial, transfer.Serial)
+				ids := func(changes []*model.RRSetChange) (ids []string) {
+					for _, change := range changes {
+						ids = append(ids, change.Name+"/"+change.Type)
+					}
+					return ids
+				}
+				assert.Equal(t, test.expectedAdded, ids(transfer.Added))
+				assert.Equal(t, test.expectedChanged, ids(transfer.Changed))
+				assert.Equal(t, test.expectedRemoved, ids(transfer.Removed))
+			}
+		})
+	}
+
+	// Zone admins can't make the server connect to a host of their choice
+	admin := model.User{Name: "zone-admin", Email: "zone-admin@martinez.io"}
+	assert.NoError(t, db.Create(&admin).Error)
+	assert.NoError(t, db.Create(&model.Grant{Role: model.RoleZoneAdmin, UserID: admin.ID, ZoneID: zone.ID}).Error)
+	c, rec := postTestRequest("/v1/zones/:id/transfer", fmt.Sprintf(`{"data": {"type": "zone-transfers", "attributes": {"primary": "%s", "tsig_key": "primary-key"}}}`, listener.Addr()), e)
+	c.SetParamNames("id")
+	c.SetParamValues(zone.ID)
+	setPrincipal(c, &admin)
+	if assert.NoError(t, routeZone.Transfer(c)) {
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	}
+
+	rrsets, err := zone.RRSets(db)
+	assert.NoError(t, err)
+	var found []string
+	for _, rrset := range rrsets {
+		found = append(found, fmt.Sprintf("%s %d %v", rrset.ID, rrset.TTL, rrset.Contents))
+	}
+	assert.Equal(t, []string{
+		"mail.martinez.io/A 300 [192.168.0.25]",
+		"martinez.io/NS 300 [ns1.martinez.io.]",
+		"ns1.martinez.io/A 300 [192.168.0.1]",
+		"www.martinez.io/A 600 [192.168.0.10]",
+	}, found)
+}
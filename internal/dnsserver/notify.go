@@ -0,0 +1,206 @@
+package dnsserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/zonefile"
+	"gorm.io/gorm"
+)
+
+// Notifier sends RFC 1996 NOTIFY messages to the secondary backends of the zones whose serial changed.
+// Each backend is notified of the serials it didn't acknowledge yet, failed attempts are retried with an
+// exponential backoff and the state of each NOTIFY is kept along with the assignment of the zone to the backend.
+type Notifier struct {
+	// Interval between two checks of the serials
+	Interval time.Duration
+	// Retries is the number of retries of a NOTIFY before giving up on its serial
+	Retries int
+	// Backoff is the delay before the first retry, it doubles on every retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout of each NOTIFY exchange
+	Timeout time.Duration
+	Logger  *log.Logger
+
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewNotifier returns a notifier of the zones of db
+func NewNotifier(db *gorm.DB) *Notifier {
+	return &Notifier{
+		Interval:   5 * time.Second,
+		Retries:    5,
+		Backoff:    10 * time.Second,
+		MaxBackoff: 10 * time.Minute,
+		Timeout:    5 * time.Second,
+		Logger:     log.New(os.Stderr, "notify: ", log.LstdFlags),
+		db:         db,
+		now:        time.Now,
+	}
+}
+
+// Run checks the serials every Interval until ctx is done
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.Interval)
+	defer ticker.Stop()
+	for {
+		if err := n.notifyAll(ctx); err != nil {
+			n.Logger.Printf("unable to notify the backends: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// notifyAll sends the NOTIFY due to every secondary backend, a backend failing doesn't keep the next ones from
+// being notified and the errors of every backend are returned together
+func (n *Notifier) notifyAll(ctx context.Context) error {
+	var backends []*model.Backend
+	err := n.db.Find(&backends).Error
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, backend := range backends {
+		if backend.Role() != model.RoleSecondary || backend.Config.Notify == "" {
+			continue
+		}
+		err = n.notifyBackend(ctx, backend)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", backend.Name, err))
+		}
+	}
+	return joinErrors(errs)
+}
+
+// joinErrors returns the errors of errs as one, nil when there are none
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// notifyBackend sends the NOTIFY due to backend
+func (n *Notifier) notifyBackend(ctx context.Context, backend *model.Backend) error {
+	statuses, err := backend.Statuses(n.db)
+	if err != nil {
+		return err
+	}
+	if len(statuses) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		ids = append(ids, status.ZoneID)
+	}
+	var zones []*model.Zone
+	err = n.db.Find(&zones, "id IN ?", ids).Error
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]*model.Zone, len(zones))
+	for _, zone := range zones {
+		byID[zone.ID] = zone
+	}
+	// Failing to load the keys fails the NOTIFY of every zone, they are retried with the usual backoff
+	keys, keysErr := backend.TSIGKeys(n.db)
+
+	var errs []error
+	for _, status := range statuses {
+		zone, ok := byID[status.ZoneID]
+		if !ok || !status.NotifyDue(zone.Serial, n.now()) {
+			continue
+		}
+		notifyErr := keysErr
+		if notifyErr == nil {
+			var key *model.TSIGKey
+			if len(keys) > 0 {
+				key = keys[0]
+			}
+			notifyErr = n.notify(ctx, backend, zone, key)
+		}
+		n.record(status, zone.Serial, notifyErr)
+		if notifyErr != nil {
+			n.Logger.Printf("unable to notify %s of %s serial %d: %v", backend.Name, zone.Name, zone.Serial, notifyErr)
+		}
+		err = status.SaveNotify(n.db)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// notify sends the NOTIFY of zone to backend, signed with key when it isn't nil
+func (n *Notifier) notify(ctx context.Context, backend *model.Backend, zone *model.Zone, key *model.TSIGKey) error {
+	addr, err := backend.Config.NotifyAddr()
+	if err != nil {
+		return err
+	}
+	m := new(dns.Msg)
+	m.SetNotify(dns.Fqdn(zone.Name))
+	m.Answer = []dns.RR{zonefile.SOA(zone)}
+	c := &dns.Client{Net: "udp", Timeout: n.Timeout}
+	if key != nil {
+		name := dns.Fqdn(key.Name)
+		c.TsigSecret = map[string]string{name: key.Secret}
+		m.SetTsig(name, dns.Fqdn(key.Algorithm), 300, n.now().Unix())
+	}
+	r, _, err := c.ExchangeContext(ctx, m, addr)
+	if err != nil {
+		return err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("NOTIFY answered with %s", dns.RcodeToString[r.Rcode])
+	}
+	return nil
+}
+
+// record updates status with the outcome of the NOTIFY of serial, scheduling its retry on failure
+func (n *Notifier) record(status *model.BackendZone, serial int, err error) {
+	now := n.now()
+	if status.NotifySerial != serial || status.NotifyStatus != model.NotifyPending {
+		status.NotifyAttempts = 0
+	}
+	status.NotifySerial = serial
+	status.NotifyAttempts++
+	status.NextNotifyAt = nil
+	if err == nil {
+		status.NotifyStatus = model.NotifyDone
+		status.NotifyError = ""
+		status.NotifiedAt = &now
+		return
+	}
+	status.NotifyError = err.Error()
+	if status.NotifyAttempts > n.Retries {
+		status.NotifyStatus = model.NotifyFailed
+		return
+	}
+	backoff := n.Backoff
+	for attempt := 1; attempt < status.NotifyAttempts && backoff < n.MaxBackoff; attempt++ {
+		backoff *= 2
+	}
+	if backoff > n.MaxBackoff {
+		backoff = n.MaxBackoff
+	}
+	next := now.Add(backoff)
+	status.NotifyStatus = model.NotifyPending
+	status.NextNotifyAt = &next
+}
@@ -0,0 +1,225 @@
+package dnsserver
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// secondary is a fake secondary server recording the NOTIFY it receives
+type secondary struct {
+	mu       sync.Mutex
+	rcode    int
+	serials  []uint32
+	unsigned int
+}
+
+func (s *secondary) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := new(dns.Msg)
+	m.SetRcode(r, s.rcode)
+	if r.Opcode == dns.OpcodeNotify && len(r.Answer) == 1 {
+		s.serials = append(s.serials, r.Answer[0].(*dns.SOA).Serial)
+	}
+	if t := r.IsTsig(); t != nil && w.TsigStatus() == nil {
+		m.SetTsig(t.Hdr.Name, t.Algorithm, 300, time.Now().Unix())
+	} else {
+		s.unsigned++
+	}
+	_ = w.WriteMsg(m)
+}
+
+// received returns the serials notified so far
+func (s *secondary) received() []uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint32(nil), s.serials...)
+}
+
+func (s *secondary) setRcode(rcode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rcode = rcode
+}
+
+func TestNotifier(t *testing.T) {
+	viper.Set("database", "file:dnsserver_notify?mode=memory&cache=shared")
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	defer database.Close()
+
+	fake := &secondary{}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: fake, TsigSecret: map[string]string{"notify-key.": testSecret}, NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	<-started
+	defer func() { _ = server.Shutdown() }()
+
+	zone := model.Zone{Name: "martinez.io"}
+	assert.NoError(t, db.Create(&zone).Error)
+	secondaryBackend := model.Backend{Name: "secondary", Type: model.BackendBind, Config: model.BackendConfig{Role: model.RoleSecondary, Notify: pc.LocalAddr().String()}}
+	primaryBackend := model.Backend{Name: "primary", Type: model.BackendBind}
+	for _, backend := range []*model.Backend{&secondaryBackend, &primaryBackend} {
+		assert.NoError(t, db.Create(backend).Error)
+		assert.NoError(t, backend.AddZone(db, &zone))
+	}
+	key := model.TSIGKey{Name: "notify-key", Secret: testSecret}
+	assert.NoError(t, db.Create(&key).Error)
+	assert.NoError(t, key.AddBackend(db, &secondaryBackend))
+
+	now := time.Now()
+	n := NewNotifier(db)
+	n.Logger = log.New(io.Discard, "", 0)
+	n.Retries = 2
+	n.now = func() time.Time { return now }
+	status := func(backend *model.Backend) *model.BackendZone {
+		statuses, err := backend.Statuses(db)
+		assert.NoError(t, err)
+		if assert.Len(t, statuses, 1) {
+			return statuses[0]
+		}
+		return &model.BackendZone{}
+	}
+
+	t.Run("Secondaries are notified of the current serial", func(t *testing.T) {
+		assert.NoError(t, n.notifyAll(context.Background()))
+		assert.Equal(t, []uint32{uint32(zone.Serial)}, fake.received())
+		assert.Equal(t, 0, fake.unsigned, "NOTIFY are signed with the key of the backend")
+		current := status(&secondaryBackend)
+		assert.Equal(t, model.NotifyDone, current.NotifyStatus)
+		assert.Equal(t, zone.Serial, current.NotifySerial)
+		assert.Equal(t, 1, current.NotifyAttempts)
+		assert.NotNil(t, current.NotifiedAt)
+		assert.Empty(t, status(&primaryBackend).NotifyStatus, "primaries aren't notified")
+	})
+
+	t.Run("Serials are notified once", func(t *testing.T) {
+		assert.NoError(t, n.notifyAll(context.Background()))
+		assert.Len(t, fake.received(), 1)
+	})
+
+	record := model.Record{ZoneID: zone.ID, Name: "www.martinez.io", Type: "A", Content: "192.168.0.1"}
+	assert.NoError(t, record.Create(db))
+	assert.NoError(t, zone.Get(db, false))
+	fake.setRcode(dns.RcodeServerFailure)
+
+	t.Run("Failures are retried with backoff", func(t *testing.T) {
+		assert.NoError(t, n.notifyAll(context.Background()))
+		current := status(&secondaryBackend)
+		assert.Equal(t, model.NotifyPending, current.NotifyStatus)
+		assert.Equal(t, zone.Serial, current.NotifySerial)
+		assert.Equal(t, 1, current.NotifyAttempts)
+		assert.Contains(t, current.NotifyError, "SERVFAIL")
+		if assert.NotNil(t, current.NextNotifyAt) {
+			assert.WithinDuration(t, now.Add(n.Backoff), *current.NextNotifyAt, time.Second)
+		}
+
+		// Nothing is sent before the retry is due
+		assert.NoError(t, n.notifyAll(context.Background()))
+		assert.Len(t, fake.received(), 2)
+
+		now = now.Add(n.Backoff)
+		assert.NoError(t, n.notifyAll(context.Background()))
+		assert.Len(t, fake.received(), 3)
+		current = status(&secondaryBackend)
+		assert.Equal(t, 2, current.NotifyAttempts)
+		if assert.NotNil(t, current.NextNotifyAt) {
+			assert.WithinDuration(t, now.Add(2*n.Backoff), *current.NextNotifyAt, time.Second)
+		}
+
+		now = now.Add(2 * n.Backoff)
+		assert.NoError(t, n.notifyAll(context.Background()))
+		current = status(&secondaryBackend)
+		assert.Equal(t, model.NotifyFailed, current.NotifyStatus)
+		assert.Equal(t, 3, current.NotifyAttempts)
+		assert.Nil(t, current.NextNotifyAt)
+
+		now = now.Add(time.Hour)
+		assert.NoError(t, n.notifyAll(context.Background()))
+		assert.Len(t, fake.received(), 4, "failed serials are given up")
+	})
+
+	t.Run("The next serial starts over", func(t *testing.T) {
+		fake.setRcode(dns.RcodeSuccess)
+		assert.NoError(t, (&model.Record{ID: record.ID}).Delete(db))
+		assert.NoError(t, zone.Get(db, false))
+		assert.NoError(t, n.notifyAll(context.Background()))
+		current := status(&secondaryBackend)
+		assert.Equal(t, model.NotifyDone, current.NotifyStatus)
+		assert.Equal(t, zone.Serial, current.NotifySerial)
+		assert.Equal(t, 1, current.NotifyAttempts)
+		assert.Empty(t, current.NotifyError)
+	})
+}
+
+func TestNotifier_UnreachableBackend(t *testing.T) {
+	viper.Set("database", "file:dnsserver_notify_unreachable?mode=memory&cache=shared")
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	defer database.Close()
+
+	fake := &secondary{}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: fake, NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	<-started
+	defer func() { _ = server.Shutdown() }()
+
+	// Nothing answers on the address of the closed listener
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachableAddr := closed.LocalAddr().String()
+	assert.NoError(t, closed.Close())
+
+	zone := model.Zone{Name: "martinez.io"}
+	assert.NoError(t, db.Create(&zone).Error)
+	unreachable := model.Backend{Name: "unreachable", Type: model.BackendBind, Config: model.BackendConfig{Role: model.RoleSecondary, Notify: unreachableAddr}}
+	reachable := model.Backend{Name: "reachable", Type: model.BackendBind, Config: model.BackendConfig{Role: model.RoleSecondary, Notify: pc.LocalAddr().String()}}
+	for _, backend := range []*model.Backend{&unreachable, &reachable} {
+		assert.NoError(t, db.Create(backend).Error)
+		assert.NoError(t, backend.AddZone(db, &zone))
+	}
+
+	n := NewNotifier(db)
+	n.Logger = log.New(io.Discard, "", 0)
+	n.Timeout = 100 * time.Millisecond
+	assert.NoError(t, n.notifyAll(context.Background()))
+	assert.Equal(t, []uint32{uint32(zone.Serial)}, fake.received(), "the backends after a failing one are notified")
+
+	statuses, err := unreachable.Statuses(db)
+	assert.NoError(t, err)
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, model.NotifyPending, statuses[0].NotifyStatus)
+		assert.NotEmpty(t, statuses[0].NotifyError)
+		assert.NotNil(t, statuses[0].NextNotifyAt)
+	}
+}
@@ -0,0 +1,329 @@
+package dnsserver
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/zonefile"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxChase bounds the number of CNAME records followed while answering a query
+	maxChase = 8
+	// udpSize is the EDNS buffer size advertised by the server, the size recommended to avoid IP fragmentation
+	udpSize = 1232
+)
+
+// query answers a standard query from the zones of the database
+func (s *Server) query(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Compress = true
+	switch {
+	case len(r.Question) != 1:
+		m.Rcode = dns.RcodeFormatError
+	case r.Question[0].Qclass != dns.ClassINET && r.Question[0].Qclass != dns.ClassANY:
+		m.Rcode = dns.RcodeRefused
+	case r.Question[0].Qtype == dns.TypeAXFR || r.Question[0].Qtype == dns.TypeIXFR:
+		s.transfer(w, r)
+		return
+	default:
+		zone, err := s.findZone(r.Question[0].Name)
+		var data *zoneData
+		if err == nil {
+			data, err = s.zoneData(zone)
+		}
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			m.Rcode = dns.RcodeRefused
+		case err != nil:
+			s.Logger.Printf("query for %s: %v", r.Question[0].Name, err)
+			m.Rcode = dns.RcodeServerFailure
+		default:
+			err = data.answer(m, dns.CanonicalName(r.Question[0].Name), r.Question[0].Qtype)
+			if err != nil {
+				s.Logger.Printf("query for %s: %v", r.Question[0].Name, err)
+				m.Rcode = dns.RcodeServerFailure
+			}
+		}
+	}
+
+	if r.IsEdns0() != nil {
+		m.SetEdns0(udpSize, false)
+	}
+	if w.LocalAddr().Network() == "udp" {
+		// Answers not fitting the client buffer are truncated so the client retries over TCP
+		size := dns.MinMsgSize
+		if opt := r.IsEdns0(); opt != nil && int(opt.UDPSize()) > size {
+			size = int(opt.UDPSize())
+		}
+		m.Truncate(size)
+	}
+	s.reply(w, r, m)
+}
+
+// findZone loads the closest zone enclosing name, without its records
+func (s *Server) findZone(name string) (*model.Zone, error) {
+	name = dns.CanonicalName(name)
+	var candidates []string
+	for offset, end := 0, false; !end; offset, end = dns.NextLabel(name, offset) {
+		candidate := zonefile.Name(name[offset:])
+		candidates = append(candidates, candidate, dns.Fqdn(candidate))
+	}
+	candidates = append(candidates, ".")
+
+	var zones []*model.Zone
+	err := s.db.Where("LOWER(name) IN ?", candidates).Find(&zones).Error
+	if err != nil {
+		return nil, err
+	}
+	var closest []*model.Zone
+	for _, zone := range zones {
+		switch {
+		case len(closest) == 0 || dns.CountLabel(dns.Fqdn(zone.Name)) > dns.CountLabel(dns.Fqdn(closest[0].Name)):
+			closest = []*model.Zone{zone}
+		case dns.CountLabel(dns.Fqdn(zone.Name)) == dns.CountLabel(dns.Fqdn(closest[0].Name)):
+			closest = append(closest, zone)
+		}
+	}
+	zone := unambiguous(closest)
+	if zone == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return zone, nil
+}
+
+// zoneData returns the indexed records of zone. They are cached until the serial of the zone changes, so
+// queries don't load and parse every record of the zone again.
+func (s *Server) zoneData(zone *model.Zone) (*zoneData, error) {
+	s.cacheMu.Lock()
+	data, ok := s.cache[zone.ID]
+	s.cacheMu.Unlock()
+	if ok && data.serial == zone.Serial && data.updatedAt.Equal(zone.UpdatedAt) {
+		return data, nil
+	}
+	err := zone.Get(s.db, true)
+	if err != nil {
+		return nil, err
+	}
+	data, err = newZoneData(zone)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if s.cache == nil {
+		s.cache = make(map[string]*zoneData)
+	}
+	s.cache[zone.ID] = data
+	return data, nil
+}
+
+// unambiguous returns the zone answering for a name several organizations may hold zones of. Those zones are
+// served by the backends of their organizations, port53 only answers for the zone without organization among
+// them and returns nil when there is none.
+func unambiguous(zones []*model.Zone) *model.Zone {
+	if len(zones) == 1 {
+		return zones[0]
+	}
+	for _, zone := range zones {
+		if zone.OrganizationID == "" {
+			return zone
+		}
+	}
+	return nil
+}
+
+// zoneData indexes the RRs of a zone by owner name, it is shared by the queries and never changed once built
+type zoneData struct {
+	origin string
+	soa    *dns.SOA
+	names  map[string][]dns.RR
+	// serial and updatedAt are the ones of the zone the data was built from
+	serial    int
+	updatedAt time.Time
+}
+
+// newZoneData indexes the SOA and records of zone
+func newZoneData(zone *model.Zone) (*zoneData, error) {
+	rrs, err := zonefile.RRs(zone)
+	if err != nil {
+		return nil, err
+	}
+	z := &zoneData{
+		origin:    dns.CanonicalName(zone.Name),
+		soa:       zonefile.SOA(zone),
+		names:     make(map[string][]dns.RR),
+		serial:    zone.Serial,
+		updatedAt: zone.UpdatedAt,
+	}
+	for _, rr := range rrs {
+		name := dns.CanonicalName(rr.Header().Name)
+		rr.Header().Name = name
+		z.names[name] = append(z.names[name], rr)
+	}
+	return z, nil
+}
+
+// rrset returns the RRs of name with type rrtype, every RR of name for dns.TypeANY
+func (z *zoneData) rrset(name string, rrtype uint16) (rrs []dns.RR) {
+	for _, rr := range z.names[name] {
+		if rrtype == dns.TypeANY || rr.Header().Rrtype == rrtype {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
+
+// exists reports whether name owns records or is an empty non-terminal of the zone
+func (z *zoneData) exists(name string) bool {
+	if len(z.names[name]) > 0 {
+		return true
+	}
+	suffix := "." + name
+	for owner := range z.names {
+		if strings.HasSuffix(owner, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cut returns the topmost delegation point between the apex, excluded, and name, included
+func (z *zoneData) cut(name string) string {
+	labels := dns.SplitDomainName(name)
+	apexLabels := dns.CountLabel(z.origin)
+	for pos := len(labels) - apexLabels - 1; pos >= 0; pos-- {
+		candidate := dns.Fqdn(strings.Join(labels[pos:], "."))
+		if len(z.rrset(candidate, dns.TypeNS)) > 0 {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// negativeSOA returns the SOA added to the authority section of negative answers, its TTL caps the negative caching
+func (z *zoneData) negativeSOA() dns.RR {
+	soa := dns.Copy(z.soa).(*dns.SOA)
+	if soa.Minttl < soa.Hdr.Ttl {
+		soa.Hdr.Ttl = soa.Minttl
+	}
+	return soa
+}
+
+// answer fills m with the answer for qname and qtype as described in RFC 1034 section 4.3.2
+func (z *zoneData) answer(m *dns.Msg, qname string, qtype uint16) error {
+	m.Authoritative = true
+	for chase := 0; chase < maxChase; chase++ {
+		if !dns.IsSubDomain(z.origin, qname) {
+			// The CNAME chain leaves the zone, the resolver follows it
+			return nil
+		}
+
+		// Names at or below a zone cut are answered with a referral, except for the DS of the cut
+		if cut := z.cut(qname); cut != "" && !(cut == qname && qtype == dns.TypeDS) {
+			m.Authoritative = false
+			m.Ns = append(m.Ns, z.rrset(cut, dns.TypeNS)...)
+			m.Extra = append(m.Extra, z.glue(m.Ns)...)
+			return nil
+		}
+
+		owner := qname
+		if !z.exists(qname) {
+			owner = z.wildcard(qname)
+			if owner == "" {
+				m.Rcode = dns.RcodeNameError
+				m.Ns = append(m.Ns, z.negativeSOA())
+				return nil
+			}
+		}
+
+		if rrs := z.rrset(owner, qtype); len(rrs) > 0 {
+			m.Answer = append(m.Answer, synthesize(rrs, qname)...)
+			if qtype != dns.TypeNS || qname != z.origin {
+				m.Ns = append(m.Ns, z.rrset(z.origin, dns.TypeNS)...)
+			}
+			m.Extra = append(m.Extra, z.glue(m.Answer, m.Ns)...)
+			return nil
+		}
+		if cname := z.rrset(owner, dns.TypeCNAME); len(cname) > 0 {
+			m.Answer = append(m.Answer, synthesize(cname, qname)...)
+			qname = dns.CanonicalName(cname[0].(*dns.CNAME).Target)
+			continue
+		}
+
+		// The name exists without data of the type asked
+		m.Ns = append(m.Ns, z.negativeSOA())
+		return nil
+	}
+	return errors.New("CNAME chain too long")
+}
+
+// wildcard returns the wildcard owner matching qname, if any, as described in RFC 4592
+func (z *zoneData) wildcard(qname string) string {
+	encloser := qname
+	for encloser != z.origin {
+		offset, end := dns.NextLabel(encloser, 0)
+		if end {
+			return ""
+		}
+		encloser = encloser[offset:]
+		if z.exists(encloser) {
+			break
+		}
+	}
+	source := "*." + encloser
+	if len(z.names[source]) == 0 {
+		return ""
+	}
+	return source
+}
+
+// glue returns the address records of the zone for the targets of the NS, MX and SRV records of the sections
+func (z *zoneData) glue(sections ...[]dns.RR) (extra []dns.RR) {
+	var rrs []dns.RR
+	for _, section := range sections {
+		rrs = append(rrs, section...)
+	}
+	seen := make(map[string]bool)
+	for _, rr := range rrs {
+		var target string
+		switch v := rr.(type) {
+		case *dns.NS:
+			target = v.Ns
+		case *dns.MX:
+			target = v.Mx
+		case *dns.SRV:
+			target = v.Target
+		default:
+			continue
+		}
+		target = dns.CanonicalName(target)
+		if seen[target] || !dns.IsSubDomain(z.origin, target) {
+			continue
+		}
+		seen[target] = true
+		extra = append(extra, z.rrset(target, dns.TypeA)...)
+		extra = append(extra, z.rrset(target, dns.TypeAAAA)...)
+	}
+	return extra
+}
+
+// synthesize returns copies of rrs owned by qname, rrs matched through a wildcard are owned by the wildcard
+func synthesize(rrs []dns.RR, qname string) []dns.RR {
+	copies := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		if rr.Header().Name == qname {
+			copies = append(copies, rr)
+			continue
+		}
+		rr = dns.Copy(rr)
+		rr.Header().Name = qname
+		copies = append(copies, rr)
+	}
+	return copies
+}
@@ -0,0 +1,320 @@
+package dnsserver
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// startTCPServer serves s on a random TCP port of the loopback and returns its address
+func startTCPServer(t *testing.T, s *Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := s.newServer("tcp")
+	server.Listener = l
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+	return l.Addr().String()
+}
+
+// names returns the owner, type and rdata of rrs
+func names(rrs []dns.RR) (found []string) {
+	for _, rr := range rrs {
+		header := rr.Header()
+		found = append(found, fmt.Sprintf("%s %s %s", header.Name, dns.TypeToString[header.Rrtype], rr.String()[len(header.String()):]))
+	}
+	return found
+}
+
+func TestServer_Query(t *testing.T) {
+	viper.Set("database", "file:dnsserver_query?mode=memory&cache=shared")
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	defer database.Close()
+
+	zone := model.Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io", TTL: 3600, Minimum: 300}
+	assert.NoError(t, db.Create(&zone).Error)
+	subZone := model.Zone{Name: "internal.martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io"}
+	assert.NoError(t, db.Create(&subZone).Error)
+	records := []*model.Record{
+		{ZoneID: zone.ID, Name: "martinez.io", Type: "NS", Content: "ns1.martinez.io."},
+		{ZoneID: zone.ID, Name: "martinez.io", Type: "MX", Content: "10 mail.martinez.io."},
+		{ZoneID: zone.ID, Name: "ns1.martinez.io", Type: "A", Content: "192.168.0.53"},
+		{ZoneID: zone.ID, Name: "mail.martinez.io", Type: "A", Content: "192.168.0.25"},
+		{ZoneID: zone.ID, Name: "www.martinez.io", Type: "A", Content: "192.168.0.1"},
+		{ZoneID: zone.ID, Name: "alias.martinez.io", Type: "CNAME", Content: "www.martinez.io."},
+		{ZoneID: zone.ID, Name: "chain.martinez.io", Type: "CNAME", Content: "alias.martinez.io."},
+		{ZoneID: zone.ID, Name: "external.martinez.io", Type: "CNAME", Content: "www.example.com."},
+		{ZoneID: zone.ID, Name: "dangling.martinez.io", Type: "CNAME", Content: "missing.martinez.io."},
+		{ZoneID: zone.ID, Name: "host.empty.martinez.io", Type: "A", Content: "192.168.0.2"},
+		{ZoneID: zone.ID, Name: "*.apps.martinez.io", Type: "A", Content: "192.168.0.80"},
+		{ZoneID: zone.ID, Name: "static.apps.martinez.io", Type: "TXT", Content: `"static"`},
+		{ZoneID: zone.ID, Name: "sub.martinez.io", Type: "NS", Content: "ns.sub.martinez.io."},
+		{ZoneID: zone.ID, Name: "ns.sub.martinez.io", Type: "A", Content: "192.168.1.53"},
+		{ZoneID: subZone.ID, Name: "internal.martinez.io", Type: "NS", Content: "ns1.martinez.io."},
+		{ZoneID: subZone.ID, Name: "db.internal.martinez.io", Type: "A", Content: "10.0.0.1"},
+	}
+	for pos := 0; pos < 40; pos++ {
+		records = append(records, &model.Record{ZoneID: zone.ID, Name: "big.martinez.io", Type: "TXT", Content: fmt.Sprintf(`"%040d"`, pos)})
+	}
+	for _, record := range records {
+		assert.NoError(t, record.Create(db))
+	}
+	assert.NoError(t, zone.Get(db, false))
+	soa := fmt.Sprintf("martinez.io. SOA ns1.martinez.io. hostmaster.martinez.io. %d 3600 600 604800 300", zone.Serial)
+
+	s := New(db, Keys{"update": {Algorithm: dns.HmacSHA256, Secret: testSecret}})
+	s.Logger = log.New(io.Discard, "", 0)
+	addr := startServer(t, s)
+
+	tests := []struct {
+		name          string
+		qname         string
+		qtype         uint16
+		rcode         int
+		authoritative bool
+		answer        []string
+		ns            []string
+		extra         []string
+	}{
+		{
+			name:          "Positive answers carry the apex NS",
+			qname:         "WWW.martinez.io.",
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeSuccess,
+			authoritative: true,
+			answer:        []string{"www.martinez.io. A 192.168.0.1"},
+			ns:            []string{"martinez.io. NS ns1.martinez.io."},
+			extra:         []string{"ns1.martinez.io. A 192.168.0.53"},
+		},
+		{
+			name:          "Targets in the zone are added to the additional section",
+			qname:         "martinez.io.",
+			qtype:         dns.TypeMX,
+			rcode:         dns.RcodeSuccess,
+			authoritative: true,
+			answer:        []string{"martinez.io. MX 10 mail.martinez.io."},
+			ns:            []string{"martinez.io. NS ns1.martinez.io."},
+			extra:         []string{"mail.martinez.io. A 192.168.0.25", "ns1.martinez.io. A 192.168.0.53"},
+		},
+		{
+			name:          "SOA",
+			qname:         "martinez.io.",
+			qtype:         dns.TypeSOA,
+			rcode:         dns.RcodeSuccess,
+			authoritative: true,
+			answer:        []string{soa},
+			ns:            []string{"martinez.io. NS ns1.martinez.io."},
+			extra:         []string{"ns1.martinez.io. A 192.168.0.53"},
+		},
+		{
+			name:          "NODATA",
+			qname:         "www.martinez.io.",
+			qtype:         dns.TypeAAAA,
+			rcode:         dns.RcodeSuccess,
+			authoritative: true,
+			ns:            []string{soa},
+		},
+		{
+			name:          "Empty non-terminals are NODATA",
+			qname:         "empty.martinez.io.",
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeSuccess,
+			authoritative: true,
+			ns:            []string{soa},
+		},
+		{
+			name:          "NXDOMAIN",
+			qname:         "missing.martinez.io.",
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeNameError,
+			authoritative: true,
+			ns:            []string{soa},
+		},
+		{
+			name:          "CNAME chains are followed within the zone",
+			qname:         "chain.martinez.io.",
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeSuccess,
+			authoritative: true,
+			answer:        []string{"chain.martinez.io. CNAME alias.martinez.io.", "alias.martinez.io. CNAME www.martinez.io.", "www.martinez.io. A 192.168.0.1"},
+			ns:            []string{"martinez.io. NS ns1.martinez.io."},
+			extra:         []string{"ns1.martinez.io. A 192.168.0.53"},
+		},
+		{
+			name:          "CNAME leaving the zone",
+			qname:         "external.martinez.io.",
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeSuccess,
+			authoritative: true,
+			answer:        []string{"external.martinez.io. CNAME www.example.com."},
+		},
+		{
+			name:          "CNAME to a missing name",
+			qname:         "dangling.martinez.io.",
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeNameError,
+			authoritative: true,
+			answer:        []string{"dangling.martinez.io. CNAME missing.martinez.io."},
+			ns:            []string{soa},
+		},
+		{
+			name:          "CNAME asked for",
+			qname:         "alias.martinez.io.",
+			qtype:         dns.TypeCNAME,
+			rcode:         dns.RcodeSuccess,
+			authoritative: true,
+			answer:        []string{"alias.martinez.io. CNAME www.martinez.io."},
+			ns:            []string{"martinez.io. NS ns1.martinez.io."},
+			extra:         []string{"ns1.martinez.io. A 192.168.0.53"},
+		},
+		{
+			name:          "Wildcards are synthesized",
+			qname:         "blog.apps.martinez.io.",
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeSuccess,
+			authoritative: true,
+			answer:        []string{"blog.apps.martinez.io. A 192.168.0.80"},
+			ns:            []string{"martinez.io. NS ns1.martinez.io."},
+			extra:         []string{"ns1.martinez.io. A 192.168.0.53"},
+		},
+		{
+			name:          "Wildcards don't match existing names",
+			qname:         "static.apps.martinez.io.",
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeSuccess,
+			authoritative: true,
+			ns:            []string{soa},
+		},
+		{
+			name:          "Wildcards only match below the closest encloser",
+			qname:         "blog.static.apps.martinez.io.",
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeNameError,
+			authoritative: true,
+			ns:            []string{soa},
+		},
+		{
+			name:  "Delegations are referrals",
+			qname: "www.sub.martinez.io.",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeSuccess,
+			ns:    []string{"sub.martinez.io. NS ns.sub.martinez.io."},
+			extra: []string{"ns.sub.martinez.io. A 192.168.1.53"},
+		},
+		{
+			name:          "The closest zone answers",
+			qname:         "db.internal.martinez.io.",
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeSuccess,
+			authoritative: true,
+			answer:        []string{"db.internal.martinez.io. A 10.0.0.1"},
+			ns:            []string{"internal.martinez.io. NS ns1.martinez.io."},
+		},
+		{
+			name:  "Unknown zones are refused",
+			qname: "www.example.com.",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name:  "Transfers are refused",
+			qname: "martinez.io.",
+			qtype: dns.TypeAXFR,
+			rcode: dns.RcodeRefused,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := new(dns.Msg)
+			m.SetQuestion(test.qname, test.qtype)
+			r := exchange(t, addr, "", m)
+			assert.Equal(t, dns.RcodeToString[test.rcode], dns.RcodeToString[r.Rcode])
+			assert.Equal(t, test.authoritative, r.Authoritative)
+			assert.Equal(t, test.answer, names(r.Answer))
+			assert.Equal(t, test.ns, names(r.Ns))
+			assert.Equal(t, test.extra, names(r.Extra))
+		})
+	}
+
+	t.Run("Negative answers are cached for the SOA minimum", func(t *testing.T) {
+		m := new(dns.Msg)
+		m.SetQuestion("missing.martinez.io.", dns.TypeA)
+		r := exchange(t, addr, "", m)
+		if assert.Len(t, r.Ns, 1) {
+			assert.Equal(t, uint32(300), r.Ns[0].Header().Ttl)
+		}
+	})
+
+	t.Run("Signed queries get signed answers", func(t *testing.T) {
+		m := new(dns.Msg)
+		m.SetQuestion("www.martinez.io.", dns.TypeA)
+		r := exchange(t, addr, "update.", m)
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		assert.NotNil(t, r.IsTsig())
+	})
+
+	t.Run("Large answers are truncated over UDP and complete over TCP", func(t *testing.T) {
+		m := new(dns.Msg)
+		m.SetQuestion("big.martinez.io.", dns.TypeTXT)
+		r := exchange(t, addr, "", m)
+		assert.True(t, r.Truncated)
+		assert.Less(t, len(r.Answer), 40)
+
+		m = new(dns.Msg)
+		m.SetQuestion("big.martinez.io.", dns.TypeTXT)
+		m.SetEdns0(4096, false)
+		r = exchange(t, addr, "", m)
+		assert.False(t, r.Truncated)
+		assert.Len(t, r.Answer, 40)
+		if assert.NotNil(t, r.IsEdns0()) {
+			assert.Equal(t, uint16(udpSize), r.IsEdns0().UDPSize(), "the server advertises its own buffer size")
+		}
+
+		tcpAddr := startTCPServer(t, s)
+		m = new(dns.Msg)
+		m.SetQuestion("big.martinez.io.", dns.TypeTXT)
+		c := &dns.Client{Net: "tcp"}
+		r, _, err := c.Exchange(m, tcpAddr)
+		if assert.NoError(t, err) {
+			assert.False(t, r.Truncated)
+			assert.Len(t, r.Answer, 40)
+		}
+	})
+	t.Run("Zones are cached until their serial changes", func(t *testing.T) {
+		current := model.Zone{ID: zone.ID}
+		assert.NoError(t, current.Get(db, false))
+		cached, err := s.zoneData(&current)
+		assert.NoError(t, err)
+		again, err := s.zoneData(&current)
+		assert.NoError(t, err)
+		assert.Same(t, cached, again)
+
+		record := model.Record{ZoneID: zone.ID, Name: "new.martinez.io", Type: "A", Content: "192.168.0.7"}
+		assert.NoError(t, record.Create(db))
+		m := new(dns.Msg)
+		m.SetQuestion("new.martinez.io.", dns.TypeA)
+		r := exchange(t, addr, "", m)
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		assert.Equal(t, []string{"new.martinez.io. A 192.168.0.7"}, names(r.Answer))
+	})
+}
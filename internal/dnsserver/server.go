@@ -0,0 +1,121 @@
+// Package dnsserver implements the DNS interface of port53. It answers authoritative queries straight from the
+// zones and records held in the database, and accepts RFC 2136 dynamic updates signed with TSIG applying them
+// to the database, so zones can be managed with nsupdate as well as through the API. Keys are the TSIG keys of
+// the database, a key may only update the zones it is attached to.
+//
+// Zones are also served to secondaries over AXFR, and over IXFR from the journal of their changes, so port53
+// can act as a hidden primary. Transfers are allowed to the networks of an ACL and to the TSIG keys attached
+// to the zone or to one of its backends.
+//
+// Organizations may hold zones of the same name. Signed updates and transfers go to the zone of the
+// organization of their key, queries and unsigned transfers are only answered for the zone without organization.
+package dnsserver
+
+import (
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+)
+
+// Server answers DNS messages on top of the database
+type Server struct {
+	// Keys verify and sign the TSIG protected messages
+	Keys KeyStore
+	// AllowTransfer lists the networks allowed to transfer every zone without TSIG
+	AllowTransfer []*net.IPNet
+	Logger        *log.Logger
+
+	db      *gorm.DB
+	mu      sync.Mutex
+	servers []*dns.Server
+	// cache holds the data of the zones queried by zone id
+	cacheMu sync.Mutex
+	cache   map[string]*zoneData
+}
+
+// New returns a server applying the messages to db and verifying their signatures with keys
+func New(db *gorm.DB, keys KeyStore) *Server {
+	return &Server{
+		Keys:   keys,
+		Logger: log.New(os.Stderr, "dns: ", log.LstdFlags),
+		db:     db,
+	}
+}
+
+// ServeDNS implements dns.Handler
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	switch r.Opcode {
+	case dns.OpcodeQuery:
+		s.query(w, r)
+	case dns.OpcodeUpdate:
+		s.update(w, r)
+	default:
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNotImplemented)
+		s.reply(w, r, m)
+	}
+}
+
+// ListenAndServe listens on addr over UDP and TCP, it blocks until one of the listeners fails or is shut down
+func (s *Server) ListenAndServe(addr string) error {
+	errs := make(chan error, 2)
+	for _, network := range []string{"udp", "tcp"} {
+		server := s.newServer(network)
+		server.Addr = addr
+		s.mu.Lock()
+		s.servers = append(s.servers, server)
+		s.mu.Unlock()
+		go func() {
+			errs <- server.ListenAndServe()
+		}()
+	}
+	return <-errs
+}
+
+// Shutdown stops the listeners started by ListenAndServe
+func (s *Server) Shutdown() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, server := range s.servers {
+		if shutdownErr := server.Shutdown(); shutdownErr != nil {
+			err = shutdownErr
+		}
+	}
+	s.servers = nil
+	return err
+}
+
+// newServer returns a dns.Server for network handled by s
+func (s *Server) newServer(network string) *dns.Server {
+	return &dns.Server{
+		Net:           network,
+		Handler:       s,
+		TsigProvider:  &provider{keys: s.Keys},
+		MsgAcceptFunc: acceptMsg,
+		ReadTimeout:   5 * time.Second,
+		WriteTimeout:  5 * time.Second,
+	}
+}
+
+// acceptMsg accepts updates on top of the messages accepted by dns.DefaultMsgAcceptFunc
+func acceptMsg(dh dns.Header) dns.MsgAcceptAction {
+	if int(dh.Bits>>11)&0xF == dns.OpcodeUpdate && dh.Bits&(1<<15) == 0 {
+		return dns.MsgAccept
+	}
+	return dns.DefaultMsgAcceptFunc(dh)
+}
+
+// reply writes m, signing it with the key of r when r carries a valid signature
+func (s *Server) reply(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	if t := r.IsTsig(); t != nil && w.TsigStatus() == nil {
+		m.SetTsig(t.Hdr.Name, t.Algorithm, t.Fudge, time.Now().Unix())
+	}
+	if err := w.WriteMsg(m); err != nil {
+		s.Logger.Printf("unable to reply to %s: %v", w.RemoteAddr(), err)
+	}
+}
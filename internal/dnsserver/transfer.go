@@ -0,0 +1,239 @@
+package dnsserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/zonefile"
+	"gorm.io/gorm"
+)
+
+// envelopeSize is the size in bytes above which a transfer starts a new message
+const envelopeSize = 16 * 1024
+
+// ParseACL parses addresses and networks in CIDR notation into the networks of an ACL
+func ParseACL(entries []string) (acl []*net.IPNet, err error) {
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			acl = append(acl, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		acl = append(acl, network)
+	}
+	return acl, nil
+}
+
+// transfer answers AXFR and IXFR queries as described in RFC 5936 and RFC 1995
+func (s *Server) transfer(w dns.ResponseWriter, r *dns.Msg) {
+	q := r.Question[0]
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	zones, err := s.zones(q.Name)
+	if err == nil && r.IsTsig() == nil {
+		// Unsigned transfers can't tell apart the zones organizations hold under the same name
+		zones = []*model.Zone{unambiguous(zones)}
+		if zones[0] == nil {
+			zones = nil
+		}
+	}
+	if err == nil && len(zones) == 0 {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			m.Rcode = dns.RcodeNotAuth
+		} else {
+			s.Logger.Printf("transfer of %s: %v", q.Name, err)
+			m.Rcode = dns.RcodeServerFailure
+		}
+		s.reply(w, r, m)
+		return
+	}
+
+	// Signed transfers get the zone of the name their key may transfer
+	var zone *model.Zone
+	rcode := dns.RcodeRefused
+	for _, candidate := range zones {
+		rcode, err = s.allowTransfer(w, r, candidate)
+		if err != nil {
+			s.Logger.Printf("transfer of %s: %v", q.Name, err)
+		}
+		if rcode == dns.RcodeSuccess {
+			zone = candidate
+			break
+		}
+		if rcode != dns.RcodeRefused {
+			break
+		}
+	}
+	if zone == nil {
+		m.Rcode = rcode
+		s.reply(w, r, m)
+		return
+	}
+	err = zone.Get(s.db, true)
+	if err != nil {
+		s.Logger.Printf("transfer of %s: %v", q.Name, err)
+		m.Rcode = dns.RcodeServerFailure
+		s.reply(w, r, m)
+		return
+	}
+
+	soa := zonefile.SOA(zone)
+	if q.Qtype == dns.TypeIXFR {
+		if len(r.Ns) != 1 || r.Ns[0].Header().Rrtype != dns.TypeSOA {
+			m.Rcode = dns.RcodeFormatError
+			s.reply(w, r, m)
+			return
+		}
+		// Up to date clients and UDP clients get the current SOA, the latter retry over TCP
+		serial := r.Ns[0].(*dns.SOA).Serial
+		if !model.SerialGreater(soa.Serial, serial) || w.LocalAddr().Network() == "udp" {
+			m.Authoritative = true
+			m.Answer = []dns.RR{soa}
+			s.reply(w, r, m)
+			return
+		}
+	} else if w.LocalAddr().Network() == "udp" {
+		m.Rcode = dns.RcodeRefused
+		s.reply(w, r, m)
+		return
+	}
+
+	rrs, err := s.transferRRs(zone, q.Qtype, r)
+	if err != nil {
+		s.Logger.Printf("transfer of %s: %v", q.Name, err)
+		m.Rcode = dns.RcodeServerFailure
+		s.reply(w, r, m)
+		return
+	}
+
+	ch := make(chan *dns.Envelope)
+	tr := new(dns.Transfer)
+	errs := make(chan error, 1)
+	go func() {
+		err := tr.Out(w, r, ch)
+		// Drain the envelopes left after a failed write so the sender doesn't block
+		for range ch {
+		}
+		errs <- err
+	}()
+	var envelope []dns.RR
+	size := 0
+	for _, rr := range rrs {
+		envelope = append(envelope, rr)
+		size += dns.Len(rr)
+		if size >= envelopeSize {
+			ch <- &dns.Envelope{RR: envelope}
+			envelope, size = nil, 0
+		}
+	}
+	if len(envelope) > 0 {
+		ch <- &dns.Envelope{RR: envelope}
+	}
+	close(ch)
+	if err := <-errs; err != nil {
+		s.Logger.Printf("transfer of %s: %v", q.Name, err)
+	}
+	_ = w.Close()
+}
+
+// allowTransfer checks the ACL of the transfers, signed requests need a key allowed to transfer the zone and
+// unsigned ones an address of AllowTransfer
+func (s *Server) allowTransfer(w dns.ResponseWriter, r *dns.Msg, zone *model.Zone) (int, error) {
+	if t := r.IsTsig(); t != nil {
+		if w.TsigStatus() != nil {
+			return dns.RcodeNotAuth, nil
+		}
+		allowed, err := s.Keys.AllowedTransfer(t.Hdr.Name, zone)
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		if !allowed {
+			return dns.RcodeRefused, nil
+		}
+		return dns.RcodeSuccess, nil
+	}
+	var ip net.IP
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		ip = addr.IP
+	case *net.TCPAddr:
+		ip = addr.IP
+	}
+	for _, network := range s.AllowTransfer {
+		if ip != nil && network.Contains(ip) {
+			return dns.RcodeSuccess, nil
+		}
+	}
+	return dns.RcodeRefused, nil
+}
+
+// transferRRs returns the RRs of the transfer of zone. IXFR answers with the journal since the serial of the
+// client, or with the whole zone as AXFR does when the journal doesn't go back that far.
+func (s *Server) transferRRs(zone *model.Zone, qtype uint16, r *dns.Msg) ([]dns.RR, error) {
+	soa := zonefile.SOA(zone)
+	if qtype == dns.TypeIXFR {
+		serial := r.Ns[0].(*dns.SOA).Serial
+		changes, ok, err := zone.JournalSince(s.db, int(serial))
+		if err != nil {
+			return nil, err
+		}
+		if ok && len(changes) > 0 && uint32(changes[len(changes)-1].ToSerial) == soa.Serial {
+			return ixfrRRs(soa, changes)
+		}
+	}
+	rrs, err := zonefile.RRs(zone)
+	if err != nil {
+		return nil, err
+	}
+	return append(rrs, soa), nil
+}
+
+// ixfrRRs returns the incremental transfer made of changes, each one is the SOA of its start serial followed by
+// the RRs removed and the SOA of its end serial followed by the RRs added
+func ixfrRRs(soa *dns.SOA, changes []*model.ZoneJournal) (rrs []dns.RR, err error) {
+	serial := func(serial int) *dns.SOA {
+		versioned := dns.Copy(soa).(*dns.SOA)
+		versioned.Serial = uint32(serial)
+		return versioned
+	}
+	rrs = append(rrs, soa)
+	for _, change := range changes {
+		rrs = append(rrs, serial(change.FromSerial))
+		for _, record := range change.Removed {
+			rr, err := zonefile.RR(record.Record(), soa.Hdr.Name)
+			if err != nil {
+				return nil, err
+			}
+			rrs = append(rrs, rr)
+		}
+		rrs = append(rrs, serial(change.ToSerial))
+		for _, record := range change.Added {
+			rr, err := zonefile.RR(record.Record(), soa.Hdr.Name)
+			if err != nil {
+				return nil, err
+			}
+			rrs = append(rrs, rr)
+		}
+	}
+	return append(rrs, soa), nil
+}
@@ -0,0 +1,201 @@
+package dnsserver
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// transfer runs the zone transfer m against addr, signed with the key named key when it isn't empty
+func transfer(t *testing.T, addr string, key string, m *dns.Msg) (rrs []dns.RR, err error) {
+	tr := &dns.Transfer{TsigSecret: map[string]string{"transfer.": testSecret, "backend-key.": testSecret}}
+	if key != "" {
+		m.SetTsig(key, dns.HmacSHA256, 300, time.Now().Unix())
+	}
+	envelopes, err := tr.In(m, addr)
+	if err != nil {
+		return nil, err
+	}
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return rrs, envelope.Error
+		}
+		rrs = append(rrs, envelope.RR...)
+	}
+	return rrs, nil
+}
+
+func TestParseACL(t *testing.T) {
+	acl, err := ParseACL([]string{"192.0.2.53", "10.0.0.0/8", "2001:db8::1"})
+	assert.NoError(t, err)
+	if assert.Len(t, acl, 3) {
+		assert.Equal(t, "192.0.2.53/32", acl[0].String())
+		assert.Equal(t, "10.0.0.0/8", acl[1].String())
+		assert.Equal(t, "2001:db8::1/128", acl[2].String())
+	}
+	_, err = ParseACL([]string{"secondary.martinez.io"})
+	assert.Error(t, err)
+}
+
+func TestServer_Transfer(t *testing.T) {
+	viper.Set("database", "file:dnsserver_transfer?mode=memory&cache=shared")
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	defer database.Close()
+
+	zone := model.Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io"}
+	assert.NoError(t, db.Create(&zone).Error)
+	www := model.Record{ZoneID: zone.ID, Name: "www.martinez.io", Type: "A", Content: "192.168.0.1", TTL: 300}
+	for _, record := range []*model.Record{
+		{ZoneID: zone.ID, Name: "martinez.io", Type: "NS", Content: "ns1.martinez.io.", TTL: 300},
+		{ZoneID: zone.ID, Name: "ns1.martinez.io", Type: "A", Content: "192.168.0.53", TTL: 300},
+		&www,
+	} {
+		assert.NoError(t, record.Create(db))
+	}
+	backend := model.Backend{Name: "secondary"}
+	assert.NoError(t, db.Create(&backend).Error)
+	assert.NoError(t, backend.AddZone(db, &zone))
+	backendKey := model.TSIGKey{Name: "backend-key", Secret: testSecret}
+	assert.NoError(t, db.Create(&backendKey).Error)
+	assert.NoError(t, backendKey.AddBackend(db, &backend))
+
+	s := New(db, KeyStores{DatabaseKeys{DB: db}, Keys{"transfer": {Secret: testSecret}}})
+	s.Logger = log.New(io.Discard, "", 0)
+	tcpAddr := startTCPServer(t, s)
+	udpAddr := startServer(t, s)
+
+	axfr := func() *dns.Msg {
+		m := new(dns.Msg)
+		m.SetAxfr("martinez.io.")
+		return m
+	}
+	ixfr := func(serial uint32) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetIxfr("martinez.io.", serial, "ns1.martinez.io.", "hostmaster.martinez.io.")
+		return m
+	}
+	serial := func() uint32 {
+		var current model.Zone
+		assert.NoError(t, db.First(&current, "id = ?", zone.ID).Error)
+		return uint32(current.Serial)
+	}
+	start := serial()
+
+	t.Run("Transfers are refused outside of the ACL", func(t *testing.T) {
+		_, err := transfer(t, tcpAddr, "", axfr())
+		assert.ErrorContains(t, err, fmt.Sprintf("rcode: %d", dns.RcodeRefused))
+	})
+
+	t.Run("Keys not attached to the zone are refused", func(t *testing.T) {
+		other := model.TSIGKey{Name: "other-key", Secret: testSecret}
+		assert.NoError(t, db.Create(&other).Error)
+		tr := &dns.Transfer{TsigSecret: map[string]string{"other-key.": testSecret}}
+		m := axfr()
+		m.SetTsig("other-key.", dns.HmacSHA256, 300, time.Now().Unix())
+		envelopes, err := tr.In(m, tcpAddr)
+		if assert.NoError(t, err) {
+			envelope := <-envelopes
+			assert.ErrorContains(t, envelope.Error, fmt.Sprintf("rcode: %d", dns.RcodeRefused))
+		}
+	})
+
+	t.Run("AXFR signed with the key of a backend", func(t *testing.T) {
+		rrs, err := transfer(t, tcpAddr, "backend-key.", axfr())
+		assert.NoError(t, err)
+		if assert.Len(t, rrs, 5) {
+			assert.Equal(t, dns.TypeSOA, rrs[0].Header().Rrtype)
+			assert.Equal(t, start, rrs[0].(*dns.SOA).Serial)
+			assert.Equal(t, dns.TypeSOA, rrs[4].Header().Rrtype)
+		}
+	})
+
+	t.Run("AXFR from the ACL", func(t *testing.T) {
+		s.AllowTransfer, err = ParseACL([]string{"127.0.0.0/8"})
+		assert.NoError(t, err)
+		defer func() { s.AllowTransfer = nil }()
+		rrs, err := transfer(t, tcpAddr, "", axfr())
+		assert.NoError(t, err)
+		assert.Len(t, rrs, 5)
+	})
+
+	t.Run("AXFR isn't served over UDP", func(t *testing.T) {
+		r := exchange(t, udpAddr, "transfer.", axfr())
+		assert.Equal(t, dns.RcodeRefused, r.Rcode)
+	})
+
+	t.Run("Unknown zones", func(t *testing.T) {
+		m := new(dns.Msg)
+		m.SetAxfr("www.martinez.io.")
+		_, err := transfer(t, tcpAddr, "", m)
+		assert.ErrorContains(t, err, fmt.Sprintf("rcode: %d", dns.RcodeNotAuth))
+	})
+
+	assert.NoError(t, www.Update(db, model.Record{Content: "192.168.0.2"}))
+	mail := model.Record{ZoneID: zone.ID, Name: "mail.martinez.io", Type: "A", Content: "192.168.0.25", TTL: 300}
+	assert.NoError(t, mail.Create(db))
+	current := serial()
+
+	t.Run("IXFR from the journal", func(t *testing.T) {
+		rrs, err := transfer(t, tcpAddr, "transfer.", ixfr(start))
+		assert.NoError(t, err)
+		expected := []string{
+			dns.TypeToString[dns.TypeSOA], // current
+			dns.TypeToString[dns.TypeSOA], // start
+			"www.martinez.io. A 192.168.0.1",
+			dns.TypeToString[dns.TypeSOA], // start + 1
+			"www.martinez.io. A 192.168.0.2",
+			dns.TypeToString[dns.TypeSOA], // start + 1
+			dns.TypeToString[dns.TypeSOA], // current
+			"mail.martinez.io. A 192.168.0.25",
+			dns.TypeToString[dns.TypeSOA], // current
+		}
+		var found []string
+		var serials []uint32
+		for _, rr := range rrs {
+			if soa, ok := rr.(*dns.SOA); ok {
+				found = append(found, dns.TypeToString[dns.TypeSOA])
+				serials = append(serials, soa.Serial)
+				continue
+			}
+			found = append(found, names([]dns.RR{rr})[0])
+		}
+		assert.Equal(t, expected, found)
+		assert.Equal(t, []uint32{current, start, start + 1, start + 1, current, current}, serials)
+	})
+
+	t.Run("IXFR from a serial missing from the journal falls back to AXFR", func(t *testing.T) {
+		rrs, err := transfer(t, tcpAddr, "transfer.", ixfr(0))
+		assert.NoError(t, err)
+		if assert.Len(t, rrs, 6) {
+			assert.Equal(t, current, rrs[0].(*dns.SOA).Serial)
+			assert.Equal(t, dns.TypeNS, rrs[1].Header().Rrtype)
+		}
+	})
+
+	t.Run("IXFR of an up to date zone", func(t *testing.T) {
+		rrs, err := transfer(t, tcpAddr, "transfer.", ixfr(current))
+		assert.NoError(t, err)
+		if assert.Len(t, rrs, 1) {
+			assert.Equal(t, current, rrs[0].(*dns.SOA).Serial)
+		}
+	})
+
+	t.Run("IXFR over UDP gets the SOA", func(t *testing.T) {
+		r := exchange(t, udpAddr, "transfer.", ixfr(start))
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		if assert.Len(t, r.Answer, 1) {
+			assert.Equal(t, current, r.Answer[0].(*dns.SOA).Serial)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package dnsserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/model"
+	"gorm.io/gorm"
+)
+
+// KeyStore holds the TSIG keys accepted by the server
+type KeyStore interface {
+	// Key returns the algorithm and the base64 encoded secret of the key named name
+	Key(name string) (algorithm string, secret string, err error)
+	// Allowed reports whether the key named name may update zone
+	Allowed(name string, zone *model.Zone) (bool, error)
+	// AllowedTransfer reports whether the key named name may transfer zone
+	AllowedTransfer(name string, zone *model.Zone) (bool, error)
+	// Permissions returns the grants restricting the records the key named name may update, nil when the
+	// key may update every record of the zones it's allowed to update
+	Permissions(name string) (*model.Permissions, error)
+}
+
+// Key is a TSIG key
+type Key struct {
+	Algorithm string `mapstructure:"algorithm"`
+	Secret    string `mapstructure:"secret"`
+}
+
+// Keys is a KeyStore holding keys by name, e.g. the tsigKeys section of the config file.
+// These keys may update every zone.
+type Keys map[string]Key
+
+// Key implements KeyStore
+func (k Keys) Key(name string) (algorithm string, secret string, err error) {
+	for keyName, key := range k {
+		if dns.CanonicalName(keyName) == dns.CanonicalName(name) {
+			if key.Algorithm == "" {
+				key.Algorithm = dns.HmacSHA256
+			}
+			return key.Algorithm, key.Secret, nil
+		}
+	}
+	return "", "", dns.ErrSecret
+}
+
+// Allowed implements KeyStore
+func (k Keys) Allowed(name string, zone *model.Zone) (bool, error) {
+	_, _, err := k.Key(name)
+	return err == nil, nil
+}
+
+// AllowedTransfer implements KeyStore
+func (k Keys) AllowedTransfer(name string, zone *model.Zone) (bool, error) {
+	return k.Allowed(name, zone)
+}
+
+// Permissions implements KeyStore, these keys are unrestricted
+func (k Keys) Permissions(name string) (*model.Permissions, error) {
+	_, _, err := k.Key(name)
+	return nil, err
+}
+
+// DatabaseKeys is a KeyStore backed by the TSIG keys of the database, a key may only update the zones it's attached
+// to and the records its grants cover. Keys of an organization never reach the zones of another one.
+type DatabaseKeys struct {
+	DB *gorm.DB
+}
+
+// Key implements KeyStore
+func (k DatabaseKeys) Key(name string) (algorithm string, secret string, err error) {
+	key, err := model.FindTSIGKey(k.DB, name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", dns.ErrSecret
+		}
+		return "", "", err
+	}
+	return key.Algorithm, key.Secret, nil
+}
+
+// Allowed implements KeyStore
+func (k DatabaseKeys) Allowed(name string, zone *model.Zone) (bool, error) {
+	key, err := model.FindTSIGKey(k.DB, name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !model.Reaches(key.OrganizationID, zone.OrganizationID) {
+		return false, nil
+	}
+	permissions, err := model.TSIGKeyPermissions(k.DB, key)
+	if err != nil {
+		return false, err
+	}
+	return permissions.CanEdit(zone.ID), nil
+}
+
+// AllowedTransfer implements KeyStore, a key may transfer the zones it's attached to and the zones of its backends
+func (k DatabaseKeys) AllowedTransfer(name string, zone *model.Zone) (bool, error) {
+	key, err := model.FindTSIGKey(k.DB, name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !model.Reaches(key.OrganizationID, zone.OrganizationID) {
+		return false, nil
+	}
+	return key.AllowsTransfer(k.DB, zone)
+}
+
+// Permissions implements KeyStore
+func (k DatabaseKeys) Permissions(name string) (*model.Permissions, error) {
+	key, err := model.FindTSIGKey(k.DB, name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, dns.ErrSecret
+		}
+		return nil, err
+	}
+	return model.TSIGKeyPermissions(k.DB, key)
+}
+
+// KeyStores looks keys up in each of its stores in turn
+type KeyStores []KeyStore
+
+// Key implements KeyStore, the first store holding the key wins
+func (k KeyStores) Key(name string) (algorithm string, secret string, err error) {
+	for _, store := range k {
+		algorithm, secret, err = store.Key(name)
+		if err != dns.ErrSecret {
+			return algorithm, secret, err
+		}
+	}
+	return "", "", dns.ErrSecret
+}
+
+// Allowed implements KeyStore, the key is allowed when any of the stores allows it
+func (k KeyStores) Allowed(name string, zone *model.Zone) (bool, error) {
+	for _, store := range k {
+		allowed, err := store.Allowed(name, zone)
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+	return false, nil
+}
+
+// AllowedTransfer implements KeyStore, the key is allowed when any of the stores allows it
+func (k KeyStores) AllowedTransfer(name string, zone *model.Zone) (bool, error) {
+	for _, store := range k {
+		allowed, err := store.AllowedTransfer(name, zone)
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+	return false, nil
+}
+
+// Permissions implements KeyStore, the first store holding the key wins
+func (k KeyStores) Permissions(name string) (*model.Permissions, error) {
+	for _, store := range k {
+		permissions, err := store.Permissions(name)
+		if err != dns.ErrSecret {
+			return permissions, err
+		}
+	}
+	return nil, dns.ErrSecret
+}
+
+// provider implements dns.TsigProvider on top of a KeyStore
+type provider struct {
+	keys KeyStore
+}
+
+// Generate returns the MAC of msg computed with the key named in t
+func (p *provider) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	if p.keys == nil {
+		return nil, dns.ErrSecret
+	}
+	algorithm, secret, err := p.keys.Key(t.Hdr.Name)
+	if err != nil {
+		return nil, dns.ErrSecret
+	}
+	if dns.CanonicalName(algorithm) != dns.CanonicalName(t.Algorithm) {
+		return nil, dns.ErrKeyAlg
+	}
+	raw, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, err
+	}
+	var h hash.Hash
+	switch dns.CanonicalName(algorithm) {
+	case dns.HmacSHA1:
+		h = hmac.New(sha1.New, raw)
+	case dns.HmacSHA224:
+		h = hmac.New(sha256.New224, raw)
+	case dns.HmacSHA256:
+		h = hmac.New(sha256.New, raw)
+	case dns.HmacSHA384:
+		h = hmac.New(sha512.New384, raw)
+	case dns.HmacSHA512:
+		h = hmac.New(sha512.New, raw)
+	default:
+		return nil, dns.ErrKeyAlg
+	}
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// Verify checks the MAC of msg against the one carried by t
+func (p *provider) Verify(msg []byte, t *dns.TSIG) error {
+	expected, err := p.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(strings.ToLower(t.MAC))
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, mac) {
+		return dns.ErrSig
+	}
+	return nil
+}
@@ -0,0 +1,443 @@
+package dnsserver
+
+import (
+	"errors"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/rdata"
+	"github.com/ncode/port53/pkg/zonefile"
+	"gorm.io/gorm"
+)
+
+// rcodeError aborts the transaction of an update with the rcode to answer
+type rcodeError int
+
+// Error implements the error interface
+func (e rcodeError) Error() string {
+	return dns.RcodeToString[int(e)]
+}
+
+// update processes a RFC 2136 dynamic update
+func (s *Server) update(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetRcode(r, s.applyUpdate(w, r))
+	s.reply(w, r, m)
+}
+
+// applyUpdate verifies, checks the prerequisites and applies the update in r, it returns the rcode to answer
+func (s *Server) applyUpdate(w dns.ResponseWriter, r *dns.Msg) int {
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	if r.IsTsig() == nil {
+		return dns.RcodeRefused
+	}
+	if err := w.TsigStatus(); err != nil {
+		s.Logger.Printf("update of %s from %s rejected: %v", r.Question[0].Name, w.RemoteAddr(), err)
+		return dns.RcodeNotAuth
+	}
+	if r.Question[0].Qclass != dns.ClassINET {
+		return dns.RcodeNotAuth
+	}
+
+	zones, err := s.zones(r.Question[0].Name)
+	if err != nil {
+		s.Logger.Printf("update of %s: %v", r.Question[0].Name, err)
+		return dns.RcodeServerFailure
+	}
+	if len(zones) == 0 {
+		return dns.RcodeNotAuth
+	}
+	// Organizations may hold zones of the same name, the key picks the one it may update
+	var zone *model.Zone
+	for _, candidate := range zones {
+		allowed, err := s.Keys.Allowed(r.IsTsig().Hdr.Name, candidate)
+		if err != nil {
+			s.Logger.Printf("update of %s: %v", r.Question[0].Name, err)
+			return dns.RcodeServerFailure
+		}
+		if allowed {
+			zone = candidate
+			break
+		}
+	}
+	if zone == nil {
+		s.Logger.Printf("update of %s refused, key %s is not allowed to update it", r.Question[0].Name, r.IsTsig().Hdr.Name)
+		return dns.RcodeRefused
+	}
+	permissions, err := s.Keys.Permissions(r.IsTsig().Hdr.Name)
+	if err != nil {
+		s.Logger.Printf("update of %s: %v", r.Question[0].Name, err)
+		return dns.RcodeServerFailure
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		u, err := newUpdater(tx, zone)
+		if err != nil {
+			return err
+		}
+		if rcode := u.prerequisites(r.Answer); rcode != dns.RcodeSuccess {
+			return rcodeError(rcode)
+		}
+		if rcode := prescan(u.origin, r.Ns); rcode != dns.RcodeSuccess {
+			return rcodeError(rcode)
+		}
+		if rr := unpermitted(permissions, zone, r.Ns); rr != nil {
+			s.Logger.Printf("update of %s refused, key %s is not allowed to change %s %s", r.Question[0].Name, r.IsTsig().Hdr.Name, rr.Header().Name, dns.TypeToString[rr.Header().Rrtype])
+			return rcodeError(dns.RcodeRefused)
+		}
+		return u.apply(r.Ns)
+	})
+	var rcode rcodeError
+	switch {
+	case errors.As(err, &rcode):
+		return int(rcode)
+	case err != nil:
+		s.Logger.Printf("update of %s: %v", r.Question[0].Name, err)
+		var rdataErr *rdata.Error
+		if errors.As(err, &rdataErr) || errors.Is(err, model.ErrQuotaExceeded) {
+			return dns.RcodeRefused
+		}
+		return dns.RcodeServerFailure
+	}
+	return dns.RcodeSuccess
+}
+
+// zones returns the zones called name, organizations may hold zones of the same name. Zones without organization
+// come first.
+func (s *Server) zones(name string) (zones []*model.Zone, err error) {
+	name = zonefile.Name(dns.CanonicalName(name))
+	err = s.db.Where("LOWER(name) IN ?", []string{name, dns.Fqdn(name)}).Order("organization_id, id").Find(&zones).Error
+	return zones, err
+}
+
+// entry is a record of the zone being updated, indexed by its absolute owner name
+type entry struct {
+	name    string
+	rrtype  string
+	content string
+	record  *model.Record
+}
+
+// updater applies an update to the records of a zone inside a transaction
+type updater struct {
+	tx      *gorm.DB
+	zone    *model.Zone
+	origin  string
+	entries []*entry
+	changed bool
+	serial  bool
+	// from is the serial of the zone before the update
+	from int
+}
+
+// newUpdater loads the records of zone, the SOA of the zone is held as an entry without record
+func newUpdater(tx *gorm.DB, zone *model.Zone) (*updater, error) {
+	var records []*model.Record
+	err := tx.Where("zone_id = ?", zone.ID).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	u := &updater{tx: tx, zone: zone, origin: dns.CanonicalName(zone.Name), from: zone.Serial}
+	u.entries = append(u.entries, &entry{name: u.origin, rrtype: "SOA", content: rdata.Content(zonefile.SOA(zone))})
+	for _, record := range records {
+		u.entries = append(u.entries, &entry{
+			name:    dns.CanonicalName(zonefile.Absolute(record.Name, u.origin)),
+			rrtype:  record.Type,
+			content: record.Content,
+			record:  record,
+		})
+	}
+	return u, nil
+}
+
+// find returns the entries owned by name, restricted to rrtype unless it is empty
+func (u *updater) find(name string, rrtype string) (found []*entry) {
+	for _, e := range u.entries {
+		if e.name == name && (rrtype == "" || e.rrtype == rrtype) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// prerequisites evaluates the prerequisite section as described in RFC 2136 section 3.2
+func (u *updater) prerequisites(rrs []dns.RR) int {
+	rrsets := make(map[[2]string][]string)
+	var order [][2]string
+	for _, rr := range rrs {
+		header := rr.Header()
+		name := dns.CanonicalName(header.Name)
+		rrtype := dns.TypeToString[header.Rrtype]
+		if header.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(u.origin, name) {
+			return dns.RcodeNotZone
+		}
+		switch header.Class {
+		case dns.ClassANY:
+			if header.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if header.Rrtype == dns.TypeANY {
+				if len(u.find(name, "")) == 0 {
+					return dns.RcodeNameError
+				}
+			} else if len(u.find(name, rrtype)) == 0 {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if header.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if header.Rrtype == dns.TypeANY {
+				if len(u.find(name, "")) != 0 {
+					return dns.RcodeYXDomain
+				}
+			} else if len(u.find(name, rrtype)) != 0 {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			if header.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+			key := [2]string{name, rrtype}
+			if _, ok := rrsets[key]; !ok {
+				order = append(order, key)
+			}
+			rrsets[key] = append(rrsets[key], u.content(rrtype, rr))
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	// Value dependent prerequisites must match the whole RRset
+	for _, key := range order {
+		wanted := make(map[string]bool)
+		for _, content := range rrsets[key] {
+			wanted[content] = true
+		}
+		existing := make(map[string]bool)
+		for _, e := range u.find(key[0], key[1]) {
+			existing[e.content] = true
+		}
+		if len(wanted) != len(existing) {
+			return dns.RcodeNXRrset
+		}
+		for content := range wanted {
+			if !existing[content] {
+				return dns.RcodeNXRrset
+			}
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// isMeta reports whether rrtype is a meta type or a query type that can't be stored in a zone
+func isMeta(rrtype uint16) bool {
+	switch rrtype {
+	case dns.TypeANY, dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG, dns.TypeTKEY:
+		return true
+	}
+	return false
+}
+
+// prescan checks the update section as described in RFC 2136 section 3.4.1
+func prescan(origin string, rrs []dns.RR) int {
+	for _, rr := range rrs {
+		header := rr.Header()
+		if !dns.IsSubDomain(origin, dns.CanonicalName(header.Name)) {
+			return dns.RcodeNotZone
+		}
+		switch header.Class {
+		case dns.ClassINET:
+			if isMeta(header.Rrtype) {
+				return dns.RcodeFormatError
+			}
+			if _, ok := rdata.Supported[dns.TypeToString[header.Rrtype]]; !ok && header.Rrtype != dns.TypeSOA {
+				return dns.RcodeRefused
+			}
+		case dns.ClassANY:
+			if header.Ttl != 0 || header.Rdlength != 0 || (isMeta(header.Rrtype) && header.Rrtype != dns.TypeANY) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if header.Ttl != 0 || isMeta(header.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// unpermitted returns the first change of the update section the permissions don't cover, nil when they cover
+// them all. Deleting every RRset of a name takes a grant covering all types, changing the SOA takes zone-admin.
+func unpermitted(permissions *model.Permissions, zone *model.Zone, rrs []dns.RR) dns.RR {
+	for _, rr := range rrs {
+		header := rr.Header()
+		var allowed bool
+		switch header.Rrtype {
+		case dns.TypeSOA:
+			allowed = permissions.Allows(model.RoleZoneAdmin, zone.ID)
+		case dns.TypeANY:
+			allowed = permissions.AllowsRecord(zone.ID, header.Name, "")
+		default:
+			allowed = permissions.AllowsRecord(zone.ID, header.Name, dns.TypeToString[header.Rrtype])
+		}
+		if !allowed {
+			return rr
+		}
+	}
+	return nil
+}
+
+// apply processes the update section as described in RFC 2136 section 3.4.2 and advances the serial of the zone
+func (u *updater) apply(rrs []dns.RR) (err error) {
+	for _, rr := range rrs {
+		header := rr.Header()
+		name := dns.CanonicalName(header.Name)
+		rrtype := dns.TypeToString[header.Rrtype]
+		switch header.Class {
+		case dns.ClassINET:
+			err = u.add(name, rrtype, rr)
+		case dns.ClassANY:
+			if header.Rrtype == dns.TypeANY {
+				rrtype = ""
+			}
+			for _, e := range u.find(name, rrtype) {
+				if name == u.origin && (e.rrtype == "SOA" || e.rrtype == "NS") {
+					continue
+				}
+				if err = u.delete(e); err != nil {
+					return err
+				}
+			}
+		case dns.ClassNONE:
+			if header.Rrtype == dns.TypeSOA {
+				continue
+			}
+			existing := u.find(name, rrtype)
+			if name == u.origin && header.Rrtype == dns.TypeNS && len(existing) == 1 {
+				continue
+			}
+			content := u.content(rrtype, rr)
+			for _, e := range existing {
+				if e.content == content {
+					err = u.delete(e)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !u.changed {
+		return nil
+	}
+	if u.serial {
+		return u.zone.Journal(u.tx, u.from)
+	}
+	return u.zone.BumpSerial(u.tx)
+}
+
+// content returns the rdata of rr normalized the way the records of the zone are stored, so it compares with
+// their content. Rdata failing to normalize can't match a stored record and is returned as is.
+func (u *updater) content(rrtype string, rr dns.RR) string {
+	content := rdata.Content(rr)
+	normalized, err := rdata.Normalize(rrtype, content, u.origin)
+	if err != nil {
+		return content
+	}
+	return normalized
+}
+
+// add adds rr to the zone, updating the TTL of its RRset when the record already exists
+func (u *updater) add(name string, rrtype string, rr dns.RR) error {
+	if soa, ok := rr.(*dns.SOA); ok {
+		return u.replaceSOA(name, soa)
+	}
+	for _, e := range u.find(name, "") {
+		// CNAME records can't coexist with other data
+		if (rrtype == "CNAME") != (e.rrtype == "CNAME") {
+			return nil
+		}
+	}
+
+	content, err := rdata.Normalize(rrtype, rdata.Content(rr), u.origin)
+	if err != nil {
+		return err
+	}
+	ttl := int(rr.Header().Ttl)
+	for _, e := range u.find(name, rrtype) {
+		if e.content == content {
+			if e.record.TTL == ttl {
+				return nil
+			}
+			u.changed = true
+			return model.SetRRSetTTL(u.tx, u.zone.ID, e.record.Name, e.record.Type, ttl)
+		}
+		// A CNAME replaces the existing one
+		if rrtype == "CNAME" {
+			if err = u.delete(e); err != nil {
+				return err
+			}
+		}
+	}
+
+	record := &model.Record{Name: zonefile.Name(name), TTL: ttl, Type: rrtype, Content: content, ZoneID: u.zone.ID}
+	err = u.tx.Create(record).Error
+	if err != nil {
+		return err
+	}
+	u.entries = append(u.entries, &entry{name: name, rrtype: record.Type, content: record.Content, record: record})
+	u.changed = true
+	return nil
+}
+
+// replaceSOA replaces the SOA of the zone when the serial of soa is greater than the current one
+func (u *updater) replaceSOA(name string, soa *dns.SOA) error {
+	if name != u.origin || !model.SerialGreater(soa.Serial, uint32(u.zone.Serial)) {
+		return nil
+	}
+	zone := model.Zone{
+		MName:   zonefile.Name(soa.Ns),
+		RName:   zonefile.Name(soa.Mbox),
+		Serial:  int(soa.Serial),
+		Refresh: int(soa.Refresh),
+		Retry:   int(soa.Retry),
+		Expire:  int(soa.Expire),
+		Minimum: int(soa.Minttl),
+	}
+	err := u.tx.Model(u.zone).Select("MName", "RName", "Serial", "Refresh", "Retry", "Expire", "Minimum").Updates(zone).Error
+	if err != nil {
+		return err
+	}
+	err = u.tx.First(u.zone, "id = ?", u.zone.ID).Error
+	if err != nil {
+		return err
+	}
+	u.find(u.origin, "SOA")[0].content = rdata.Content(zonefile.SOA(u.zone))
+	u.changed = true
+	u.serial = true
+	return nil
+}
+
+// delete removes the record of e from the zone
+func (u *updater) delete(e *entry) error {
+	err := u.tx.Unscoped().Delete(e.record).Error
+	if err != nil {
+		return err
+	}
+	for pos, existing := range u.entries {
+		if existing == e {
+			u.entries = append(u.entries[:pos], u.entries[pos+1:]...)
+			break
+		}
+	}
+	u.changed = true
+	return nil
+}
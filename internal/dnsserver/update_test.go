@@ -0,0 +1,455 @@
+package dnsserver
+
+import (
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/database"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+const testSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LXNlY3JldA=="
+
+// startServer serves s on a random UDP port of the loopback and returns its address
+func startServer(t *testing.T, s *Server) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := s.newServer("udp")
+	server.PacketConn = pc
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+	return pc.LocalAddr().String()
+}
+
+// exchange sends m signed with the key named key, unsigned when key is empty
+func exchange(t *testing.T, addr string, key string, m *dns.Msg) *dns.Msg {
+	c := &dns.Client{TsigSecret: map[string]string{"update.": testSecret, "unknown.": testSecret, "zone-key.": testSecret, "other-key.": testSecret, "transfer.": testSecret, "acme-key.": testSecret}}
+	if key != "" {
+		m.SetTsig(key, dns.HmacSHA256, 300, time.Now().Unix())
+	}
+	r, _, err := c.Exchange(m, addr)
+	if err != nil && r == nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func rr(t *testing.T, s string) dns.RR {
+	record, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func contents(t *testing.T, db *gorm.DB, zone *model.Zone, name string, rrtype string) (found []string) {
+	var records []*model.Record
+	assert.NoError(t, db.Where("zone_id = ? AND name = ? AND type = ?", zone.ID, name, rrtype).Order("content").Find(&records).Error)
+	for _, record := range records {
+		found = append(found, record.Content)
+	}
+	return found
+}
+
+func TestServer_Update(t *testing.T) {
+	viper.Set("database", "file:dnsserver_update?mode=memory&cache=shared")
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	defer database.Close()
+
+	zone := model.Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io"}
+	assert.NoError(t, db.Create(&zone).Error)
+	for _, record := range []*model.Record{
+		{Name: "martinez.io", Type: "NS", Content: "ns1.martinez.io."},
+		{Name: "www.martinez.io", Type: "A", Content: "192.168.0.1"},
+		{Name: "www.martinez.io", Type: "A", Content: "192.168.0.2"},
+	} {
+		record.ZoneID = zone.ID
+		assert.NoError(t, record.Create(db))
+	}
+	assert.NoError(t, zone.Get(db, false))
+
+	zoneKey := model.TSIGKey{Name: "zone-key", Secret: testSecret}
+	assert.NoError(t, db.Create(&zoneKey).Error)
+	otherKey := model.TSIGKey{Name: "other-key", Secret: testSecret}
+	assert.NoError(t, db.Create(&otherKey).Error)
+	assert.NoError(t, zoneKey.AddZone(db, &zone))
+
+	s := New(db, KeyStores{DatabaseKeys{DB: db}, Keys{"update": {Algorithm: dns.HmacSHA256, Secret: testSecret}}})
+	s.Logger = log.New(io.Discard, "", 0)
+	addr := startServer(t, s)
+
+	update := func(prerequisites func(m *dns.Msg), updates func(m *dns.Msg)) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetUpdate("martinez.io.")
+		if prerequisites != nil {
+			prerequisites(m)
+		}
+		if updates != nil {
+			updates(m)
+		}
+		return m
+	}
+	serial := func() int {
+		var current model.Zone
+		assert.NoError(t, db.First(&current, "id = ?", zone.ID).Error)
+		return current.Serial
+	}
+
+	t.Run("Unsigned updates are refused", func(t *testing.T) {
+		r := exchange(t, addr, "", update(nil, func(m *dns.Msg) {
+			m.Insert([]dns.RR{rr(t, "mail.martinez.io. 300 IN A 192.168.0.3")})
+		}))
+		assert.Equal(t, dns.RcodeRefused, r.Rcode)
+		assert.Empty(t, contents(t, db, &zone, "mail.martinez.io", "A"))
+	})
+
+	t.Run("Unknown keys are not authorized", func(t *testing.T) {
+		r := exchange(t, addr, "unknown.", update(nil, func(m *dns.Msg) {
+			m.Insert([]dns.RR{rr(t, "mail.martinez.io. 300 IN A 192.168.0.3")})
+		}))
+		assert.Equal(t, dns.RcodeNotAuth, r.Rcode)
+	})
+
+	t.Run("Keys of the database may only update their zones", func(t *testing.T) {
+		r := exchange(t, addr, "zone-key.", update(nil, func(m *dns.Msg) {
+			m.Insert([]dns.RR{rr(t, "api.martinez.io. 300 IN A 192.168.0.5")})
+		}))
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		assert.Equal(t, []string{"192.168.0.5"}, contents(t, db, &zone, "api.martinez.io", "A"))
+
+		r = exchange(t, addr, "other-key.", update(nil, func(m *dns.Msg) {
+			m.Insert([]dns.RR{rr(t, "admin.martinez.io. 300 IN A 192.168.0.6")})
+		}))
+		assert.Equal(t, dns.RcodeRefused, r.Rcode)
+		assert.Empty(t, contents(t, db, &zone, "admin.martinez.io", "A"))
+	})
+
+	t.Run("Unknown zones are not authorized", func(t *testing.T) {
+		m := new(dns.Msg)
+		m.SetUpdate("example.com.")
+		m.Insert([]dns.RR{rr(t, "www.example.com. 300 IN A 192.168.0.3")})
+		assert.Equal(t, dns.RcodeNotAuth, exchange(t, addr, "update.", m).Rcode)
+	})
+
+	t.Run("Records out of the zone", func(t *testing.T) {
+		r := exchange(t, addr, "update.", update(nil, func(m *dns.Msg) {
+			m.Insert([]dns.RR{rr(t, "www.example.com. 300 IN A 192.168.0.3")})
+		}))
+		assert.Equal(t, dns.RcodeNotZone, r.Rcode)
+	})
+
+	t.Run("Insert records", func(t *testing.T) {
+		previous := serial()
+		r := exchange(t, addr, "update.", update(nil, func(m *dns.Msg) {
+			m.Insert([]dns.RR{
+				rr(t, "mail.martinez.io. 300 IN A 192.168.0.3"),
+				rr(t, "martinez.io. 300 IN MX 10 mail.martinez.io."),
+			})
+		}))
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		assert.NotNil(t, r.IsTsig(), "the reply is signed")
+		assert.Equal(t, []string{"192.168.0.3"}, contents(t, db, &zone, "mail.martinez.io", "A"))
+		assert.Equal(t, []string{"10 mail.martinez.io."}, contents(t, db, &zone, "martinez.io", "MX"))
+		assert.Equal(t, previous+1, serial())
+	})
+
+	t.Run("Prerequisites", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			prerequisites func(m *dns.Msg)
+			rcode         int
+		}{
+			{
+				name: "RRset exists",
+				prerequisites: func(m *dns.Msg) {
+					m.RRsetUsed([]dns.RR{rr(t, "ftp.martinez.io. 0 IN A 0.0.0.0")})
+				},
+				rcode: dns.RcodeNXRrset,
+			},
+			{
+				name: "RRset does not exist",
+				prerequisites: func(m *dns.Msg) {
+					m.RRsetNotUsed([]dns.RR{rr(t, "www.martinez.io. 0 IN A 0.0.0.0")})
+				},
+				rcode: dns.RcodeYXRrset,
+			},
+			{
+				name: "Name is in use",
+				prerequisites: func(m *dns.Msg) {
+					m.NameUsed([]dns.RR{rr(t, "ftp.martinez.io. 0 IN A 0.0.0.0")})
+				},
+				rcode: dns.RcodeNameError,
+			},
+			{
+				name: "Name is not in use",
+				prerequisites: func(m *dns.Msg) {
+					m.NameNotUsed([]dns.RR{rr(t, "www.martinez.io. 0 IN A 0.0.0.0")})
+				},
+				rcode: dns.RcodeYXDomain,
+			},
+			{
+				name: "RRset exists with a partial value",
+				prerequisites: func(m *dns.Msg) {
+					m.Used([]dns.RR{rr(t, "www.martinez.io. 0 IN A 192.168.0.1")})
+				},
+				rcode: dns.RcodeNXRrset,
+			},
+			{
+				name: "Prerequisites with a TTL",
+				prerequisites: func(m *dns.Msg) {
+					m.Answer = append(m.Answer, &dns.RR_Header{Name: "www.martinez.io.", Rrtype: dns.TypeA, Class: dns.ClassANY, Ttl: 300})
+				},
+				rcode: dns.RcodeFormatError,
+			},
+			{
+				name: "RRset exists with the whole value",
+				prerequisites: func(m *dns.Msg) {
+					m.Used([]dns.RR{rr(t, "www.martinez.io. 0 IN A 192.168.0.1"), rr(t, "www.martinez.io. 0 IN A 192.168.0.2")})
+				},
+				rcode: dns.RcodeSuccess,
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				r := exchange(t, addr, "update.", update(test.prerequisites, func(m *dns.Msg) {
+					m.Insert([]dns.RR{rr(t, "ftp.martinez.io. 300 IN CNAME www.martinez.io.")})
+				}))
+				assert.Equal(t, test.rcode, r.Rcode)
+				if test.rcode == dns.RcodeSuccess {
+					assert.Equal(t, []string{"www.martinez.io."}, contents(t, db, &zone, "ftp.martinez.io", "CNAME"))
+				} else {
+					assert.Empty(t, contents(t, db, &zone, "ftp.martinez.io", "CNAME"))
+				}
+			})
+		}
+	})
+
+	t.Run("CNAME records can't coexist with other data", func(t *testing.T) {
+		r := exchange(t, addr, "update.", update(nil, func(m *dns.Msg) {
+			m.Insert([]dns.RR{rr(t, "ftp.martinez.io. 300 IN A 192.168.0.4")})
+		}))
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		assert.Empty(t, contents(t, db, &zone, "ftp.martinez.io", "A"))
+	})
+
+	t.Run("Unsupported types are refused", func(t *testing.T) {
+		r := exchange(t, addr, "update.", update(nil, func(m *dns.Msg) {
+			m.Insert([]dns.RR{rr(t, "www.martinez.io. 300 IN HINFO \"amd64\" \"linux\"")})
+		}))
+		assert.Equal(t, dns.RcodeRefused, r.Rcode)
+	})
+
+	t.Run("Delete records", func(t *testing.T) {
+		previous := serial()
+		r := exchange(t, addr, "update.", update(nil, func(m *dns.Msg) {
+			m.Remove([]dns.RR{rr(t, "www.martinez.io. 0 IN A 192.168.0.1")})
+			m.RemoveRRset([]dns.RR{rr(t, "martinez.io. 0 IN MX 0 .")})
+			m.RemoveName([]dns.RR{rr(t, "ftp.martinez.io. 0 IN A 0.0.0.0")})
+			// The last NS of the apex is kept
+			m.Remove([]dns.RR{rr(t, "martinez.io. 0 IN NS ns1.martinez.io.")})
+		}))
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		assert.Equal(t, []string{"192.168.0.2"}, contents(t, db, &zone, "www.martinez.io", "A"))
+		assert.Empty(t, contents(t, db, &zone, "martinez.io", "MX"))
+		assert.Empty(t, contents(t, db, &zone, "ftp.martinez.io", "CNAME"))
+		assert.Equal(t, []string{"ns1.martinez.io."}, contents(t, db, &zone, "martinez.io", "NS"))
+		assert.Equal(t, previous+1, serial())
+	})
+
+	t.Run("Match records sent in another case than stored", func(t *testing.T) {
+		// The digests of TLSA records are stored upper cased while clients send them lower cased
+		digest := "d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971"
+		r := exchange(t, addr, "update.", update(nil, func(m *dns.Msg) {
+			m.Insert([]dns.RR{rr(t, "_443._tcp.www.martinez.io. 300 IN TLSA 3 1 1 "+digest)})
+		}))
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		assert.Equal(t, []string{"3 1 1 " + strings.ToUpper(digest)}, contents(t, db, &zone, "_443._tcp.www.martinez.io", "TLSA"))
+
+		r = exchange(t, addr, "update.", update(func(m *dns.Msg) {
+			m.Used([]dns.RR{rr(t, "_443._tcp.www.martinez.io. 0 IN TLSA 3 1 1 "+digest)})
+		}, func(m *dns.Msg) {
+			m.Remove([]dns.RR{rr(t, "_443._tcp.www.martinez.io. 0 IN TLSA 3 1 1 "+digest)})
+		}))
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		assert.Empty(t, contents(t, db, &zone, "_443._tcp.www.martinez.io", "TLSA"))
+	})
+
+	t.Run("Delete and add the same record", func(t *testing.T) {
+		r := exchange(t, addr, "update.", update(nil, func(m *dns.Msg) {
+			m.RemoveRRset([]dns.RR{rr(t, "www.martinez.io. 0 IN A 0.0.0.0")})
+			m.Insert([]dns.RR{rr(t, "www.martinez.io. 600 IN A 192.168.0.2")})
+		}))
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		assert.Equal(t, []string{"192.168.0.2"}, contents(t, db, &zone, "www.martinez.io", "A"))
+	})
+
+	t.Run("Replace the SOA", func(t *testing.T) {
+		current := serial()
+		r := exchange(t, addr, "update.", update(nil, func(m *dns.Msg) {
+			m.Insert([]dns.RR{rr(t, "martinez.io. 3600 IN SOA ns2.martinez.io. admin.martinez.io. 1 7200 600 604800 300")})
+		}))
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		assert.Equal(t, current, serial(), "a lower serial is ignored")
+
+		soa := rr(t, "martinez.io. 3600 IN SOA ns2.martinez.io. admin.martinez.io. 1 7200 600 604800 300").(*dns.SOA)
+		soa.Serial = uint32(current + 10)
+		r = exchange(t, addr, "update.", update(nil, func(m *dns.Msg) {
+			m.Insert([]dns.RR{soa})
+		}))
+		assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+		var updated model.Zone
+		assert.NoError(t, db.First(&updated, "id = ?", zone.ID).Error)
+		assert.Equal(t, current+10, updated.Serial)
+		assert.Equal(t, "ns2.martinez.io", updated.MName)
+		assert.Equal(t, 7200, updated.Refresh)
+	})
+}
+
+func TestServer_UpdateGrants(t *testing.T) {
+	viper.Set("database", "file:dnsserver_update_grants?mode=memory&cache=shared")
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	defer database.Close()
+
+	zone := model.Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io"}
+	assert.NoError(t, db.Create(&zone).Error)
+	record := model.Record{Name: "www.martinez.io", Type: "A", Content: "192.168.0.1", ZoneID: zone.ID}
+	assert.NoError(t, record.Create(db))
+
+	// The key isn't attached to the zone, its grant alone allows it to update the TXT records of _acme-challenge
+	acmeKey := model.TSIGKey{Name: "acme-key", Secret: testSecret}
+	assert.NoError(t, db.Create(&acmeKey).Error)
+	grant := model.Grant{Role: model.RoleRecordEditor, TSIGKeyID: acmeKey.ID, ZoneID: zone.ID, Names: []string{"_acme-challenge.martinez.io"}, Types: []string{"TXT"}}
+	assert.NoError(t, db.Create(&grant).Error)
+
+	s := New(db, KeyStores{DatabaseKeys{DB: db}})
+	s.Logger = log.New(io.Discard, "", 0)
+	addr := startServer(t, s)
+
+	tests := []struct {
+		name          string
+		update        func(m *dns.Msg)
+		expectedRcode int
+	}{
+		{
+			name: "TXT record of the grant",
+			update: func(m *dns.Msg) {
+				m.Insert([]dns.RR{rr(t, `_acme-challenge.martinez.io. 60 IN TXT "token"`)})
+			},
+			expectedRcode: dns.RcodeSuccess,
+		},
+		{
+			name: "other type of the grant name",
+			update: func(m *dns.Msg) {
+				m.Insert([]dns.RR{rr(t, "_acme-challenge.martinez.io. 60 IN A 192.168.0.2")})
+			},
+			expectedRcode: dns.RcodeRefused,
+		},
+		{
+			name: "every RRset of the grant name",
+			update: func(m *dns.Msg) {
+				m.RemoveName([]dns.RR{rr(t, "_acme-challenge.martinez.io. 0 IN A 0.0.0.0")})
+			},
+			expectedRcode: dns.RcodeRefused,
+		},
+		{
+			name: "other name",
+			update: func(m *dns.Msg) {
+				m.RemoveRRset([]dns.RR{rr(t, "www.martinez.io. 0 IN A 0.0.0.0")})
+			},
+			expectedRcode: dns.RcodeRefused,
+		},
+		{
+			name: "grant name along with another name",
+			update: func(m *dns.Msg) {
+				m.Insert([]dns.RR{rr(t, `_acme-challenge.martinez.io. 60 IN TXT "other"`), rr(t, "mail.martinez.io. 60 IN A 192.168.0.3")})
+			},
+			expectedRcode: dns.RcodeRefused,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := new(dns.Msg)
+			m.SetUpdate("martinez.io.")
+			test.update(m)
+			r := exchange(t, addr, "acme-key.", m)
+			assert.Equal(t, test.expectedRcode, r.Rcode)
+		})
+	}
+
+	assert.Equal(t, []string{`"token"`}, contents(t, db, &zone, "_acme-challenge.martinez.io", "TXT"))
+	assert.Equal(t, []string{"192.168.0.1"}, contents(t, db, &zone, "www.martinez.io", "A"))
+	assert.Empty(t, contents(t, db, &zone, "mail.martinez.io", "A"))
+}
+
+func TestServer_UpdateOrganizations(t *testing.T) {
+	viper.Set("database", "file:dnsserver_update_organizations?mode=memory&cache=shared")
+	db, err := database.Database()
+	if err != nil {
+		panic(err)
+	}
+	defer database.Close()
+
+	// Both organizations hold a martinez.io zone, the key of the update picks the zone it lands in
+	acme := model.Organization{Name: "acme"}
+	initech := model.Organization{Name: "initech"}
+	assert.NoError(t, db.Create(&initech).Error)
+	assert.NoError(t, db.Create(&acme).Error)
+	acmeZone := model.Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io", OrganizationID: acme.ID}
+	initechZone := model.Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io", OrganizationID: initech.ID}
+	assert.NoError(t, db.Create(&acmeZone).Error)
+	assert.NoError(t, db.Create(&initechZone).Error)
+
+	zoneKey := model.TSIGKey{Name: "zone-key", Secret: testSecret, OrganizationID: initech.ID}
+	assert.NoError(t, db.Create(&zoneKey).Error)
+	assert.NoError(t, zoneKey.AddZone(db, &initechZone))
+	// A key of acme granted admin still can't reach the zones of initech
+	otherKey := model.TSIGKey{Name: "other-key", Secret: testSecret, OrganizationID: acme.ID}
+	assert.NoError(t, db.Create(&otherKey).Error)
+	assert.NoError(t, db.Create(&model.Grant{Role: model.RoleAdmin, TSIGKeyID: otherKey.ID}).Error)
+
+	s := New(db, KeyStores{DatabaseKeys{DB: db}})
+	s.Logger = log.New(io.Discard, "", 0)
+	addr := startServer(t, s)
+
+	update := func(key string, content string) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetUpdate("martinez.io.")
+		m.Insert([]dns.RR{rr(t, "www.martinez.io. 300 IN A "+content)})
+		return exchange(t, addr, key, m)
+	}
+
+	assert.Equal(t, dns.RcodeSuccess, update("zone-key.", "192.168.0.1").Rcode)
+	assert.Equal(t, dns.RcodeSuccess, update("other-key.", "192.168.0.2").Rcode)
+	assert.Equal(t, []string{"192.168.0.1"}, contents(t, db, &initechZone, "www.martinez.io", "A"))
+	assert.Equal(t, []string{"192.168.0.2"}, contents(t, db, &acmeZone, "www.martinez.io", "A"))
+
+	t.Run("Queries for names held by several organizations aren't answered", func(t *testing.T) {
+		m := new(dns.Msg)
+		m.SetQuestion("www.martinez.io.", dns.TypeA)
+		r := exchange(t, addr, "", m)
+		assert.Equal(t, dns.RcodeRefused, r.Rcode)
+	})
+}
@@ -10,6 +10,9 @@ import (
 
 const MIMEApplicationJSONApi string = "application/vnd.api+json"
 
+// MIMETextDNS is the media type of RFC 1035 master files as defined by RFC 4027
+const MIMETextDNS string = "text/dns"
+
 type JsonApiBinder struct{}
 
 // Bind implements the Binder interface.
@@ -23,10 +23,21 @@ func Database() (db *gorm.DB, err error) {
 	}
 
 	// Migrate the schema
-	err = database.AutoMigrate(&model.Backend{}, &model.Zone{}, &model.Record{})
+	err = model.SetupJoinTables(database)
 	if err != nil {
 		return nil, err
 	}
+	err = database.AutoMigrate(&model.Organization{}, &model.Backend{}, &model.Zone{}, &model.Record{}, &model.TSIGKey{}, &model.User{}, &model.APIKey{}, &model.Grant{}, &model.ZoneJournal{}, &model.ZoneChange{})
+	if err != nil {
+		return nil, err
+	}
+	// Zone names used to be unique across organizations, they are now unique within each of them
+	if database.Migrator().HasIndex(&model.Zone{}, "idx_zones_name") {
+		err = database.Migrator().DropIndex(&model.Zone{}, "idx_zones_name")
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if sqlDB, err := database.DB(); err == nil {
 		sqlDB.SetMaxIdleConns(10)
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/oklog/ulid/v2"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+const (
+	// APIKeyPrefix starts every API key token
+	APIKeyPrefix = "p53_"
+	// apiKeyBytes is the number of random bytes of a token
+	apiKeyBytes = 32
+	// apiKeyVisible is the number of characters of a token kept to tell keys apart
+	apiKeyVisible = len(APIKeyPrefix) + 8
+	// apiKeyUseResolution is how stale the last use of a key may get, its use is recorded at most once per period
+	apiKeyUseResolution = time.Minute
+)
+
+// ErrInvalidAPIKey is returned when a token doesn't match the key of an existing user
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKey authenticates the requests of a user to the API as a bearer token. Only the SHA-256 of the token is
+// stored, the token itself is returned once in the response to the creation of the key.
+type APIKey struct {
+	ID        string         `gorm:"primarykey;not null" jsonapi:"primary,api-keys"`
+	CreatedAt time.Time      `jsonapi:"attribute" json:"created_at,omitempty"`
+	UpdatedAt time.Time      `jsonapi:"attribute" json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	// Name describes what the key is used for
+	Name   string `jsonapi:"attribute" json:"name,omitempty"`
+	UserID string `gorm:"index;not null" json:"-"`
+	// Prefix is the start of the token, enough to tell the keys of a user apart
+	Prefix string `gorm:"not null" jsonapi:"attribute" json:"prefix"`
+	Hash   string `gorm:"uniqueIndex;not null" json:"-"`
+	// Token is only set in the response to the creation of the key
+	Token      string     `gorm:"-" jsonapi:"attribute" json:"token,omitempty"`
+	LastUsedAt *time.Time `jsonapi:"attribute" json:"last_used_at,omitempty"`
+	User       *User      `jsonapi:"relationship" json:"user,omitempty"`
+}
+
+// Link returns the link to the resource
+func (k *APIKey) Link() *jsonapi.Link {
+	return &jsonapi.Link{
+		Self: fmt.Sprintf("%s/v1/users/%s/api-keys/%s", viper.GetString("serviceUrl"), k.UserID, k.ID),
+	}
+}
+
+// BeforeCreate generates a new ULID and token for the key
+func (k *APIKey) BeforeCreate(tx *gorm.DB) (err error) {
+	if k.ID == "" {
+		k.ID = ulid.Make().String()
+	} else {
+		_, err = ulid.Parse(k.ID)
+		if err != nil {
+			return err
+		}
+	}
+	secret := make([]byte, apiKeyBytes)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return err
+	}
+	k.Token = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	k.Prefix = k.Token[:apiKeyVisible]
+	k.Hash = hashAPIKey(k.Token)
+	return nil
+}
+
+// hashAPIKey returns the hex encoded SHA-256 of token, tokens are random enough not to need a slow hash
+func hashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthenticateAPIKey returns the key matching token along with its user and records its use, at most once a
+// minute so reads don't all turn into writes
+func AuthenticateAPIKey(db *gorm.DB, token string) (key *APIKey, err error) {
+	if !strings.HasPrefix(token, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	key = &APIKey{}
+	result := db.Preload("User").Limit(1).Find(key, "hash = ?", hashAPIKey(token))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || key.User == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < apiKeyUseResolution {
+		return key, nil
+	}
+	err = db.Model(key).UpdateColumn("last_used_at", now).Error
+	if err != nil {
+		return nil, err
+	}
+	key.LastUsedAt = &now
+	return key, nil
+}
+
+// APIKeys returns the keys of the user
+func (u *User) APIKeys(db *gorm.DB) (keys []*APIKey, err error) {
+	keys = make([]*APIKey, 0)
+	err = db.Where("user_id = ?", u.ID).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// CreateAPIKey creates a new key for the user, its token is only available on the returned key
+func (u *User) CreateAPIKey(db *gorm.DB, name string) (key *APIKey, err error) {
+	key = &APIKey{Name: name, UserID: u.ID}
+	err = db.Create(key).Error
+	return key, err
+}
+
+// DeleteAPIKey revokes the key of the user with the given id
+func (u *User) DeleteAPIKey(db *gorm.DB, id string) (err error) {
+	result := db.Where("user_id = ?", u.ID).Delete(&APIKey{}, "id = ?", id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
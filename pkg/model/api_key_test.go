@@ -0,0 +1,89 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:api_key_model?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&User{}, &APIKey{}, &Grant{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	user := User{Name: "juliano", Email: "juliano@martinez.io"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Error creating test user: %s", err)
+	}
+	key, err := user.CreateAPIKey(db, "ci")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(key.Token, APIKeyPrefix) || !strings.HasPrefix(key.Token, key.Prefix) {
+		t.Errorf("Unexpected token %s with prefix %s", key.Token, key.Prefix)
+	}
+	var stored APIKey
+	if err := db.First(&stored, "id = ?", key.ID).Error; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if stored.Hash == key.Token || strings.Contains(stored.Hash, key.Token) {
+		t.Errorf("Expected the token to be stored hashed")
+	}
+
+	authenticated, err := AuthenticateAPIKey(db, key.Token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if authenticated.User == nil || authenticated.User.ID != user.ID {
+		t.Errorf("Expected the key to authenticate its user, got %+v", authenticated.User)
+	}
+	if authenticated.LastUsedAt == nil {
+		t.Errorf("Expected the use of the key to be recorded")
+	}
+
+	// Uses within a minute of the recorded one aren't written again
+	recorded := time.Now().Add(-30 * time.Second)
+	if err := db.Model(&stored).UpdateColumn("last_used_at", recorded).Error; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	authenticated, err = AuthenticateAPIKey(db, key.Token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !authenticated.LastUsedAt.Equal(recorded) {
+		t.Errorf("Expected the last use %s to be kept, got %s", recorded, authenticated.LastUsedAt)
+	}
+	stale := time.Now().Add(-2 * time.Minute)
+	if err := db.Model(&stored).UpdateColumn("last_used_at", stale).Error; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	authenticated, err = AuthenticateAPIKey(db, key.Token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !authenticated.LastUsedAt.After(stale.Add(time.Minute)) {
+		t.Errorf("Expected the stale last use %s to be updated, got %s", stale, authenticated.LastUsedAt)
+	}
+
+	for _, token := range []string{"", "secret", key.Token + "x", key.Prefix} {
+		if _, err := AuthenticateAPIKey(db, token); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("Unexpected error for %q: got %v, want %v", token, err, ErrInvalidAPIKey)
+		}
+	}
+
+	if err := user.Delete(db); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err := AuthenticateAPIKey(db, key.Token); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected the keys of deleted users to be refused, got %v", err)
+	}
+}
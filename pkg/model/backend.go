@@ -16,7 +16,14 @@ type Backend struct {
 	UpdatedAt time.Time      `jsonapi:"attribute" json:"updated_at,omitempty"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 	Name      string         `gorm:"uniqueIndex;not null" jsonapi:"attribute" json:"name"`
-	Zones     []*Zone        `gorm:"many2many:backend_zones;" jsonapi:"relationship" json:"zones,omitempty"`
+	// Type is the kind of DNS server behind the backend, one of bind, powerdns, nsd or files
+	Type   string        `gorm:"index" jsonapi:"attribute" json:"type,omitempty"`
+	Config BackendConfig `gorm:"serializer:json" jsonapi:"attribute" json:"config,omitempty"`
+	Zones  []*Zone       `gorm:"many2many:backend_zones;" jsonapi:"relationship" json:"zones,omitempty"`
+	// Status is the state of a zone on the backend, only set when listing the backends of a zone
+	Status *BackendZone `gorm:"-" jsonapi:"attribute" json:"status,omitempty"`
+	// OrganizationID is the organization owning the backend, backends without organization are shared
+	OrganizationID string `gorm:"index;not null;default:''" json:"-"`
 }
 
 // Link returns the link to the backend
@@ -34,14 +41,25 @@ func (b *Backend) LinkRelation(relation string) *jsonapi.Link {
 	}
 }
 
-// BeforeCreate generates a new ULID for the backend if needed
+// BeforeCreate generates a new ULID for the backend if needed and validates its configuration
 func (b *Backend) BeforeCreate(tx *gorm.DB) (err error) {
 	if b.ID == "" {
 		b.ID = ulid.Make().String()
 	} else {
 		_, err = ulid.Parse(b.ID)
+		if err != nil {
+			return err
+		}
 	}
-	return err
+	return b.Config.Validate(b.Type)
+}
+
+// Role returns the role of the backend, backends are primaries unless configured otherwise
+func (b *Backend) Role() string {
+	if b.Config.Role == "" {
+		return RolePrimary
+	}
+	return b.Config.Role
 }
 
 // Get returns the backend with the given id
@@ -52,9 +70,13 @@ func (b *Backend) Get(db *gorm.DB, preload bool) (err error) {
 	return db.First(b, "id = ?", b.ID).Error
 }
 
-// AddZone adds a zone to the backend
+// AddZone adds a zone to the backend, the zone must be reachable by the backend and its name free on it
 func (b *Backend) AddZone(db *gorm.DB, zone *Zone) (err error) {
 	return db.Transaction(func(tx *gorm.DB) error {
+		err := checkAssignment(tx, b.ID, zone.ID)
+		if err != nil {
+			return err
+		}
 		return tx.Model(b).Association("Zones").Append(zone)
 	})
 }
@@ -69,7 +91,17 @@ func (b *Backend) RemoveZone(db *gorm.DB, zone *Zone) (err error) {
 // ReplaceZones replaces the zones of the backend
 func (b *Backend) ReplaceZones(db *gorm.DB, zones []*Zone) (err error) {
 	return db.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(b).Association("Zones").Replace(zones)
+		err := tx.Model(b).Association("Zones").Replace(zones)
+		if err != nil {
+			return err
+		}
+		for _, zone := range zones {
+			err = checkAssignment(tx, b.ID, zone.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 }
 
@@ -78,7 +110,30 @@ func (b *Backend) Delete(db *gorm.DB) (err error) {
 	return db.Delete(&b).Error
 }
 
-// Update a backend in the database
+// Update a backend in the database, the configuration is replaced as a whole when given
 func (b *Backend) Update(db *gorm.DB, backend Backend) (err error) {
-	return db.Model(b).Updates(backend).Error
+	err = db.First(b, "id = ?", b.ID).Error
+	if err != nil {
+		return err
+	}
+	backendType, config := b.Type, b.Config
+	if backend.Type != "" {
+		backendType = backend.Type
+	}
+	if !backend.Config.IsZero() {
+		config = backend.Config
+	}
+	err = config.Validate(backendType)
+	if err != nil {
+		return err
+	}
+	columns := []string{"type", "config", "updated_at"}
+	if backend.Name != "" {
+		columns = append(columns, "name")
+	}
+	err = db.Model(b).Select(columns).Updates(Backend{Name: backend.Name, Type: backendType, Config: config}).Error
+	if err != nil {
+		return err
+	}
+	return db.First(b, "id = ?", b.ID).Error
 }
@@ -0,0 +1,198 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Types of backend, each one matches an agent driver
+const (
+	BackendBind     = "bind"
+	BackendPowerDNS = "powerdns"
+	BackendNSD      = "nsd"
+	BackendFiles    = "files"
+)
+
+// Roles of a backend
+const (
+	// RolePrimary backends have their zones pushed by the agent
+	RolePrimary = "primary"
+	// RoleSecondary backends pull their zones from port53
+	RoleSecondary = "secondary"
+)
+
+// backendConfigFields lists the configuration fields accepted by each type of backend
+var backendConfigFields = map[string][]string{
+	BackendBind:     {"role", "notify", "directory", "include", "zone_type", "rndc", "named_checkzone", "named_checkconf"},
+	BackendNSD:      {"role", "notify", "directory", "include", "pattern", "nsd_checkzone", "nsd_control"},
+	BackendPowerDNS: {"role", "notify", "api_url", "api_key", "server_id", "kind"},
+	BackendFiles:    {"role", "directory"},
+}
+
+// BackendConfig is the configuration of a backend, the fields accepted depend on the type of the backend.
+// The json names of the fields are the configuration keys of the matching agent driver.
+type BackendConfig struct {
+	// Role of the backend, primary or secondary
+	Role string `json:"role,omitempty"`
+	// Notify is the address, host or host:port, secondary backends receive the NOTIFY of their zones on
+	Notify string `json:"notify,omitempty"`
+	// Directory holding the zone files, for bind, nsd and files backends
+	Directory string `json:"directory,omitempty"`
+	// Include is the path of the configuration include listing the zones, for bind and nsd backends
+	Include string `json:"include,omitempty"`
+	// ZoneType is the type of the zone statements of bind backends, primary or secondary
+	ZoneType string `json:"zone_type,omitempty"`
+	// Commands used by bind backends
+	Rndc           string `json:"rndc,omitempty"`
+	NamedCheckZone string `json:"named_checkzone,omitempty"`
+	NamedCheckConf string `json:"named_checkconf,omitempty"`
+	// Pattern and commands used by nsd backends
+	Pattern      string `json:"pattern,omitempty"`
+	NSDCheckZone string `json:"nsd_checkzone,omitempty"`
+	NSDControl   string `json:"nsd_control,omitempty"`
+	// API settings of powerdns backends
+	APIURL   string `json:"api_url,omitempty"`
+	APIKey   string `json:"api_key,omitempty"`
+	ServerID string `json:"server_id,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+}
+
+// ConfigError is returned when the type or the configuration of a backend is invalid
+type ConfigError struct {
+	// Field is the path of the invalid attribute, e.g. type or config/api_url
+	Field  string
+	Reason string
+}
+
+// Error implements the error interface
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// BackendTypes returns the sorted list of backend types
+func BackendTypes() (types []string) {
+	for backendType := range backendConfigFields {
+		types = append(types, backendType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ValidBackendType reports whether backendType is a known backend type
+func ValidBackendType(backendType string) bool {
+	_, ok := backendConfigFields[backendType]
+	return ok
+}
+
+// Map returns the fields set in the configuration by name
+func (c BackendConfig) Map() map[string]interface{} {
+	values := make(map[string]interface{})
+	data, err := json.Marshal(c)
+	if err != nil {
+		return values
+	}
+	_ = json.Unmarshal(data, &values)
+	return values
+}
+
+// IsZero reports whether no field of the configuration is set
+func (c BackendConfig) IsZero() bool {
+	return c == BackendConfig{}
+}
+
+// NotifyAddr returns the host:port the NOTIFY are sent to, port 53 unless set
+func (c BackendConfig) NotifyAddr() (string, error) {
+	if c.Notify == "" {
+		return "", nil
+	}
+	return DNSAddr(c.Notify)
+}
+
+// DNSAddr returns the host:port of a DNS server given as host or host:port, port 53 unless set
+func DNSAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = strings.Trim(addr, "[]"), "53"
+	}
+	if host == "" || strings.ContainsAny(host, " /") {
+		return "", fmt.Errorf("invalid host %q", addr)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("invalid port %q", port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// Validate checks the configuration against the fields accepted by backendType
+func (c BackendConfig) Validate(backendType string) error {
+	if backendType == "" {
+		if !c.IsZero() {
+			return &ConfigError{Field: "type", Reason: "is required to set the config"}
+		}
+		return nil
+	}
+	fields, ok := backendConfigFields[backendType]
+	if !ok {
+		return &ConfigError{Field: "type", Reason: fmt.Sprintf("must be one of %v", BackendTypes())}
+	}
+	accepted := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		accepted[field] = true
+	}
+	values := c.Map()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !accepted[name] {
+			return &ConfigError{Field: "config/" + name, Reason: fmt.Sprintf("is not supported by %s backends", backendType)}
+		}
+	}
+
+	switch c.Role {
+	case "", RolePrimary, RoleSecondary:
+	default:
+		return &ConfigError{Field: "config/role", Reason: "must be one of primary or secondary"}
+	}
+	if c.Notify != "" {
+		if c.Role != RoleSecondary {
+			return &ConfigError{Field: "config/notify", Reason: "is only supported by secondary backends"}
+		}
+		if _, err := c.NotifyAddr(); err != nil {
+			return &ConfigError{Field: "config/notify", Reason: "must be a host or host:port"}
+		}
+	}
+	switch c.ZoneType {
+	case "", RolePrimary, RoleSecondary:
+	default:
+		return &ConfigError{Field: "config/zone_type", Reason: "must be one of primary or secondary"}
+	}
+	for name, path := range map[string]string{"directory": c.Directory, "include": c.Include} {
+		if path != "" && !filepath.IsAbs(path) {
+			return &ConfigError{Field: "config/" + name, Reason: "must be an absolute path"}
+		}
+	}
+	if backendType == BackendPowerDNS {
+		if c.APIURL == "" {
+			return &ConfigError{Field: "config/api_url", Reason: "is required"}
+		}
+		u, err := url.Parse(c.APIURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return &ConfigError{Field: "config/api_url", Reason: "must be an http or https url"}
+		}
+		switch c.Kind {
+		case "", "Native", "Master", "Slave":
+		default:
+			return &ConfigError{Field: "config/kind", Reason: "must be one of Native, Master or Slave"}
+		}
+	}
+	return nil
+}
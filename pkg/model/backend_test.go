@@ -310,7 +310,7 @@ func TestBackend_AddZone(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Error setting up test database: %s", err)
 			}
-			err = db.AutoMigrate(&Backend{}, &Zone{})
+			err = db.AutoMigrate(&Backend{}, &Zone{}, &ZoneJournal{}, &ZoneChange{})
 			if err != nil {
 				t.Fatalf("Error running the migration: %s", err)
 			}
@@ -369,7 +369,7 @@ func TestBackend_RemoveZone(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Error setting up test database: %s", err)
 			}
-			err = db.AutoMigrate(&Backend{}, &Zone{})
+			err = db.AutoMigrate(&Backend{}, &Zone{}, &ZoneJournal{}, &ZoneChange{})
 			if err != nil {
 				t.Fatalf("Error running the migration: %s", err)
 			}
@@ -438,7 +438,7 @@ func TestBackend_ReplaceZones(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Error setting up test database: %s", err)
 			}
-			err = db.AutoMigrate(&Backend{}, &Zone{})
+			err = db.AutoMigrate(&Backend{}, &Zone{}, &ZoneJournal{}, &ZoneChange{})
 			if err != nil {
 				t.Fatalf("Error running the migration: %s", err)
 			}
@@ -471,3 +471,187 @@ func TestBackend_ReplaceZones(t *testing.T) {
 		})
 	}
 }
+
+func TestBackendConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name          string
+		backendType   string
+		config        BackendConfig
+		expectedField string
+	}{
+		{
+			name: "No type and no config",
+		},
+		{
+			name:          "Config without type",
+			config:        BackendConfig{Directory: "/var/named"},
+			expectedField: "type",
+		},
+		{
+			name:          "Unknown type",
+			backendType:   "knot",
+			expectedField: "type",
+		},
+		{
+			name:        "Valid bind config",
+			backendType: BackendBind,
+			config:      BackendConfig{Role: RolePrimary, Directory: "/var/named", Rndc: "rndc -c /etc/rndc.conf"},
+		},
+		{
+			name:        "Bind with zone type",
+			backendType: BackendBind,
+			config:      BackendConfig{Role: RoleSecondary, ZoneType: "secondary"},
+		},
+		{
+			name:          "Bind with invalid zone type",
+			backendType:   BackendBind,
+			config:        BackendConfig{ZoneType: "hint"},
+			expectedField: "config/zone_type",
+		},
+		{
+			name:          "Zone type of another type",
+			backendType:   BackendNSD,
+			config:        BackendConfig{ZoneType: "secondary"},
+			expectedField: "config/zone_type",
+		},
+		{
+			name:          "Field of another type",
+			backendType:   BackendBind,
+			config:        BackendConfig{APIURL: "http://127.0.0.1:8081"},
+			expectedField: "config/api_url",
+		},
+		{
+			name:          "Relative directory",
+			backendType:   BackendNSD,
+			config:        BackendConfig{Directory: "zones"},
+			expectedField: "config/directory",
+		},
+		{
+			name:          "Invalid role",
+			backendType:   BackendFiles,
+			config:        BackendConfig{Role: "hidden"},
+			expectedField: "config/role",
+		},
+		{
+			name:          "PowerDNS without api url",
+			backendType:   BackendPowerDNS,
+			config:        BackendConfig{APIKey: "secret"},
+			expectedField: "config/api_url",
+		},
+		{
+			name:          "PowerDNS with invalid api url",
+			backendType:   BackendPowerDNS,
+			config:        BackendConfig{APIURL: "127.0.0.1:8081"},
+			expectedField: "config/api_url",
+		},
+		{
+			name:        "Valid powerdns config",
+			backendType: BackendPowerDNS,
+			config:      BackendConfig{APIURL: "http://127.0.0.1:8081", APIKey: "secret", Kind: "Native"},
+		},
+		{
+			name:        "Secondary with notify address",
+			backendType: BackendNSD,
+			config:      BackendConfig{Role: RoleSecondary, Notify: "192.0.2.53:5353"},
+		},
+		{
+			name:          "Notify address of a primary",
+			backendType:   BackendBind,
+			config:        BackendConfig{Notify: "192.0.2.53"},
+			expectedField: "config/notify",
+		},
+		{
+			name:          "Invalid notify port",
+			backendType:   BackendBind,
+			config:        BackendConfig{Role: RoleSecondary, Notify: "192.0.2.53:domain"},
+			expectedField: "config/notify",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate(test.backendType)
+			if test.expectedField == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				return
+			}
+			configErr, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatalf("Unexpected error: got %v, want a config error", err)
+			}
+			if configErr.Field != test.expectedField {
+				t.Errorf("Unexpected field: got %s, want %s", configErr.Field, test.expectedField)
+			}
+		})
+	}
+}
+
+func TestBackendConfig_NotifyAddr(t *testing.T) {
+	for notify, expected := range map[string]string{
+		"":                 "",
+		"192.0.2.53":       "192.0.2.53:53",
+		"192.0.2.53:5353":  "192.0.2.53:5353",
+		"2001:db8::53":     "[2001:db8::53]:53",
+		"[2001:db8::53]:1": "[2001:db8::53]:1",
+		"ns2.martinez.io":  "ns2.martinez.io:53",
+	} {
+		addr, err := BackendConfig{Notify: notify}.NotifyAddr()
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %s", notify, err)
+		}
+		if addr != expected {
+			t.Errorf("Unexpected address for %q: got %s, want %s", notify, addr, expected)
+		}
+	}
+}
+
+func TestBackend_UpdateConfig(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:backend_config_model?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&Backend{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	backend := Backend{Name: ulid.Make().String(), Type: BackendBind, Config: BackendConfig{Directory: "/var/named"}}
+	if err := db.Create(&backend).Error; err != nil {
+		t.Fatalf("Error creating backend: %s", err)
+	}
+	invalid := Backend{Name: ulid.Make().String(), Type: BackendBind, Config: BackendConfig{Kind: "Native"}}
+	if err := db.Create(&invalid).Error; err == nil {
+		t.Errorf("Expected invalid config to fail")
+	}
+
+	// Changing the type keeps the config, which must be valid for the new type
+	err = backend.Update(db, Backend{Type: BackendNSD})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if backend.Type != BackendNSD || backend.Config.Directory != "/var/named" {
+		t.Errorf("Unexpected backend: got %s %+v", backend.Type, backend.Config)
+	}
+	err = backend.Update(db, Backend{Type: BackendPowerDNS})
+	if _, ok := err.(*ConfigError); !ok {
+		t.Errorf("Unexpected error: got %v, want a config error", err)
+	}
+
+	// The config is replaced as a whole
+	err = backend.Update(db, Backend{Type: BackendPowerDNS, Config: BackendConfig{APIURL: "http://127.0.0.1:8081"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	reloaded := Backend{ID: backend.ID}
+	if err := reloaded.Get(db, false); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := BackendConfig{APIURL: "http://127.0.0.1:8081"}
+	if reloaded.Type != BackendPowerDNS || reloaded.Config != expected {
+		t.Errorf("Unexpected backend: got %s %+v", reloaded.Type, reloaded.Config)
+	}
+	if reloaded.Role() != RolePrimary {
+		t.Errorf("Unexpected role: got %s, want %s", reloaded.Role(), RolePrimary)
+	}
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// States of the NOTIFY of a zone to a secondary backend
+const (
+	// NotifyPending is a NOTIFY waiting for its first attempt or for a retry
+	NotifyPending = "pending"
+	// NotifyDone is a NOTIFY acknowledged by the backend
+	NotifyDone = "notified"
+	// NotifyFailed is a NOTIFY given up after its last retry, the next serial starts over
+	NotifyFailed = "failed"
+)
+
+// BackendZone is the assignment of a zone to a backend along with the state reported by the agent of the backend
+// and, for secondary backends, the state of the NOTIFY of the zone
+type BackendZone struct {
+	ID            string     `gorm:"-" jsonapi:"primary,backend-zones"`
+	BackendID     string     `gorm:"primaryKey" jsonapi:"attribute" json:"backend_id"`
+	ZoneID        string     `gorm:"primaryKey" jsonapi:"attribute" json:"zone_id"`
+	AppliedSerial int        `gorm:"not null;default:0" jsonapi:"attribute" json:"applied_serial"`
+	Error         string     `jsonapi:"attribute" json:"error"`
+	ReportedAt    *time.Time `jsonapi:"attribute" json:"reported_at,omitempty"`
+	// NotifySerial is the serial of the last NOTIFY sent to the backend
+	NotifySerial   int        `gorm:"not null;default:0" jsonapi:"attribute" json:"notify_serial,omitempty"`
+	NotifyStatus   string     `jsonapi:"attribute" json:"notify_status,omitempty"`
+	NotifyAttempts int        `gorm:"not null;default:0" jsonapi:"attribute" json:"notify_attempts,omitempty"`
+	NotifyError    string     `jsonapi:"attribute" json:"notify_error,omitempty"`
+	NotifiedAt     *time.Time `jsonapi:"attribute" json:"notified_at,omitempty"`
+	NextNotifyAt   *time.Time `jsonapi:"attribute" json:"next_notify_at,omitempty"`
+}
+
+// Link returns the link to the status of the zone in the backend
+func (bz *BackendZone) Link() *jsonapi.Link {
+	return &jsonapi.Link{
+		Self: fmt.Sprintf("%s/v1/backends/%s/status/%s", viper.GetString("serviceUrl"), bz.BackendID, bz.ZoneID),
+	}
+}
+
+// AfterFind sets the identifier of the assignment, made of the backend and zone ids
+func (bz *BackendZone) AfterFind(tx *gorm.DB) (err error) {
+	bz.ID = fmt.Sprintf("%s:%s", bz.BackendID, bz.ZoneID)
+	return nil
+}
+
+// SetupJoinTables makes BackendZone the join table between backends and zones, it must be called before migrating
+func SetupJoinTables(db *gorm.DB) (err error) {
+	err = db.SetupJoinTable(&Backend{}, "Zones", &BackendZone{})
+	if err != nil {
+		return err
+	}
+	return db.SetupJoinTable(&Zone{}, "Backends", &BackendZone{})
+}
+
+// Statuses returns the state reported for every zone assigned to the backend
+func (b *Backend) Statuses(db *gorm.DB) (statuses []*BackendZone, err error) {
+	err = db.Where("backend_id = ?", b.ID).Order("zone_id").Find(&statuses).Error
+	return statuses, err
+}
+
+// Statuses returns the state of the zone in every backend it is assigned to
+func (z *Zone) Statuses(db *gorm.DB) (statuses []*BackendZone, err error) {
+	err = db.Where("zone_id = ?", z.ID).Order("backend_id").Find(&statuses).Error
+	return statuses, err
+}
+
+// NotifyDue reports whether serial must be notified to the backend at now, either because it was never
+// notified or because its retry is due
+func (bz *BackendZone) NotifyDue(serial int, now time.Time) bool {
+	if bz.NotifySerial != serial || bz.NotifyStatus == "" {
+		return true
+	}
+	return bz.NotifyStatus == NotifyPending && (bz.NextNotifyAt == nil || !now.Before(*bz.NextNotifyAt))
+}
+
+// SaveNotify stores the state of the NOTIFY of the zone to the backend
+func (bz *BackendZone) SaveNotify(db *gorm.DB) (err error) {
+	return db.Model(&BackendZone{}).
+		Where("backend_id = ? AND zone_id = ?", bz.BackendID, bz.ZoneID).
+		Updates(map[string]interface{}{
+			"notify_serial":   bz.NotifySerial,
+			"notify_status":   bz.NotifyStatus,
+			"notify_attempts": bz.NotifyAttempts,
+			"notify_error":    bz.NotifyError,
+			"notified_at":     bz.NotifiedAt,
+			"next_notify_at":  bz.NextNotifyAt,
+		}).Error
+}
+
+// ReportStatus stores the serial applied by the backend for the zone and the error found applying it, if any
+func (b *Backend) ReportStatus(db *gorm.DB, status *BackendZone) (err error) {
+	result := db.Model(&BackendZone{}).
+		Where("backend_id = ? AND zone_id = ?", b.ID, status.ZoneID).
+		Updates(map[string]interface{}{
+			"applied_serial": status.AppliedSerial,
+			"error":          status.Error,
+			"reported_at":    time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return db.First(status, "backend_id = ? AND zone_id = ?", b.ID, status.ZoneID).Error
+}
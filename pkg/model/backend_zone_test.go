@@ -0,0 +1,79 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/oklog/ulid/v2"
+)
+
+func TestBackend_ReportStatus(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:backend_zone_model?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = SetupJoinTables(db)
+	if err != nil {
+		t.Fatalf("Error setting up the join tables: %s", err)
+	}
+	err = db.AutoMigrate(&Backend{}, &Zone{}, &Record{}, &ZoneJournal{}, &ZoneChange{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	backend := Backend{Name: ulid.Make().String()}
+	zone := Zone{Name: ulid.Make().String()}
+	unassigned := Zone{Name: ulid.Make().String()}
+	for _, value := range []interface{}{&backend, &zone, &unassigned} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatalf("Error creating fixture: %s", err)
+		}
+	}
+	if err := backend.AddZone(db, &zone); err != nil {
+		t.Fatalf("Error adding zone: %s", err)
+	}
+
+	statuses, err := backend.Statuses(db)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(statuses) != 1 || statuses[0].ZoneID != zone.ID || statuses[0].AppliedSerial != 0 {
+		t.Fatalf("Unexpected statuses: %+v", statuses)
+	}
+	if statuses[0].ID != backend.ID+":"+zone.ID {
+		t.Errorf("Unexpected ID: got %s, want %s", statuses[0].ID, backend.ID+":"+zone.ID)
+	}
+
+	status := BackendZone{ZoneID: zone.ID, AppliedSerial: 3, Error: "reload failed"}
+	if err := backend.ReportStatus(db, &status); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if status.BackendID != backend.ID || status.AppliedSerial != 3 || status.Error != "reload failed" || status.ReportedAt == nil {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	err = backend.ReportStatus(db, &BackendZone{ZoneID: unassigned.ID, AppliedSerial: 1})
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Unexpected error for unassigned zone: got %v, want %s", err, gorm.ErrRecordNotFound)
+	}
+
+	// Replacing the zones keeps the status of the zones still assigned
+	if err := backend.ReplaceZones(db, []*Zone{&zone, &unassigned}); err != nil {
+		t.Fatalf("Error replacing zones: %s", err)
+	}
+	statuses, err = backend.Statuses(db)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("Unexpected number of statuses: got %d, want %d", len(statuses), 2)
+	}
+	for _, s := range statuses {
+		if s.ZoneID == zone.ID && s.AppliedSerial != 3 {
+			t.Errorf("Unexpected applied serial after replace: got %d, want %d", s.AppliedSerial, 3)
+		}
+	}
+}
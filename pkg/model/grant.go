@@ -0,0 +1,314 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/miekg/dns"
+	"github.com/oklog/ulid/v2"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// Roles a grant gives, each role includes the permissions of the roles before it
+const (
+	// RoleReadOnly may read zones and their records
+	RoleReadOnly = "read-only"
+	// RoleRecordEditor may also create, update and delete records
+	RoleRecordEditor = "record-editor"
+	// RoleZoneAdmin may also change, import and delete zones and grant roles on them
+	RoleZoneAdmin = "zone-admin"
+	// RoleAdmin may do anything, including managing backends, TSIG keys, users and grants
+	RoleAdmin = "admin"
+)
+
+// roleLevels orders the roles, a role is allowed whatever a lower role is
+var roleLevels = map[string]int{
+	RoleReadOnly:     1,
+	RoleRecordEditor: 2,
+	RoleZoneAdmin:    3,
+	RoleAdmin:        4,
+}
+
+var (
+	// ErrInvalidRole is returned when the role of a grant is unknown
+	ErrInvalidRole = fmt.Errorf("invalid role, must be one of %s, %s, %s or %s", RoleReadOnly, RoleRecordEditor, RoleZoneAdmin, RoleAdmin)
+	// ErrInvalidGrantHolder is returned when a grant isn't given to exactly one user or TSIG key
+	ErrInvalidGrantHolder = errors.New("invalid grant, must be given to either a user or a TSIG key")
+	// ErrInvalidGrantScope is returned when an admin grant is restricted to a zone, names or types
+	ErrInvalidGrantScope = errors.New("invalid grant, the admin role can't be restricted to a zone, names or types")
+	// ErrInvalidGrantName is returned when a name pattern of a grant is not a domain name
+	ErrInvalidGrantName = errors.New("invalid names, must be domain names, optionally starting with *.")
+	// ErrInvalidGrantType is returned when a type of a grant is not a DNS record type
+	ErrInvalidGrantType = errors.New("invalid types, must be DNS record types")
+)
+
+// Grant gives a role to a user or a TSIG key, on every zone or on a single one. Grants may be restricted
+// to owner names matching patterns, e.g. *.dev.example.com, and to record types, e.g. only the TXT records
+// of _acme-challenge.example.com. Restricted grants only apply to records.
+type Grant struct {
+	ID        string         `gorm:"primarykey;not null" jsonapi:"primary,grants"`
+	CreatedAt time.Time      `jsonapi:"attribute" json:"created_at,omitempty"`
+	UpdatedAt time.Time      `jsonapi:"attribute" json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	// Role is one of read-only, record-editor, zone-admin or admin
+	Role string `gorm:"not null" jsonapi:"attribute" json:"role"`
+	// Names are the patterns of the owner names the grant is restricted to, every name when empty
+	Names []string `gorm:"serializer:json" jsonapi:"attribute" json:"names,omitempty"`
+	// Types are the record types the grant is restricted to, every type when empty
+	Types     []string `gorm:"serializer:json" jsonapi:"attribute" json:"types,omitempty"`
+	UserID    string   `gorm:"index" json:"-"`
+	TSIGKeyID string   `gorm:"index" json:"-"`
+	// ZoneID is the zone the grant is restricted to, every zone when empty
+	ZoneID  string   `gorm:"index" json:"-"`
+	User    *User    `gorm:"-" jsonapi:"relationship" json:"user,omitempty"`
+	TSIGKey *TSIGKey `gorm:"-" jsonapi:"relationship" json:"tsig_key,omitempty"`
+	Zone    *Zone    `gorm:"-" jsonapi:"relationship" json:"zone,omitempty"`
+}
+
+// Link returns the link to the resource
+func (g *Grant) Link() *jsonapi.Link {
+	return &jsonapi.Link{
+		Self: fmt.Sprintf("%s/v1/grants/%s", viper.GetString("serviceUrl"), g.ID),
+	}
+}
+
+// BeforeCreate generates a new ULID for the grant if needed and validates it
+func (g *Grant) BeforeCreate(tx *gorm.DB) (err error) {
+	if g.ID == "" {
+		g.ID = ulid.Make().String()
+	} else {
+		_, err = ulid.Parse(g.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return g.Validate()
+}
+
+// Validate checks the role, holder and scope of the grant, normalising its names and types. The ids of the
+// related user, TSIG key and zone are taken from the relationships when they are set.
+func (g *Grant) Validate() error {
+	if g.User != nil {
+		g.UserID = g.User.ID
+	}
+	if g.TSIGKey != nil {
+		g.TSIGKeyID = g.TSIGKey.ID
+	}
+	if g.Zone != nil {
+		g.ZoneID = g.Zone.ID
+	}
+	if _, ok := roleLevels[g.Role]; !ok {
+		return ErrInvalidRole
+	}
+	if (g.UserID == "") == (g.TSIGKeyID == "") {
+		return ErrInvalidGrantHolder
+	}
+	if g.Role == RoleAdmin && (g.ZoneID != "" || len(g.Names) > 0 || len(g.Types) > 0) {
+		return ErrInvalidGrantScope
+	}
+	for pos, name := range g.Names {
+		name = dns.CanonicalName(strings.TrimSpace(name))
+		if _, ok := dns.IsDomainName(strings.TrimPrefix(name, "*.")); !ok || strings.Contains(strings.TrimPrefix(name, "*."), "*") {
+			return ErrInvalidGrantName
+		}
+		g.Names[pos] = name
+	}
+	for pos, rrtype := range g.Types {
+		rrtype = strings.ToUpper(strings.TrimSpace(rrtype))
+		if _, ok := dns.StringToType[rrtype]; !ok {
+			return ErrInvalidGrantType
+		}
+		g.Types[pos] = rrtype
+	}
+	return nil
+}
+
+// AfterFind sets the relationships of the grant from the ids it holds
+func (g *Grant) AfterFind(tx *gorm.DB) (err error) {
+	g.User, g.TSIGKey, g.Zone = nil, nil, nil
+	if g.UserID != "" {
+		g.User = &User{ID: g.UserID}
+	}
+	if g.TSIGKeyID != "" {
+		g.TSIGKey = &TSIGKey{ID: g.TSIGKeyID}
+	}
+	if g.ZoneID != "" {
+		g.Zone = &Zone{ID: g.ZoneID}
+	}
+	return nil
+}
+
+// Get the grant
+func (g *Grant) Get(db *gorm.DB) (err error) {
+	return db.First(g, "id = ?", g.ID).Error
+}
+
+// Scoped reports whether the grant is restricted to names or types
+func (g *Grant) Scoped() bool {
+	return len(g.Names) > 0 || len(g.Types) > 0
+}
+
+// appliesTo reports whether the grant applies to the zone, a global grant applies to every zone
+func (g *Grant) appliesTo(zoneID string) bool {
+	return g.ZoneID == "" || g.ZoneID == zoneID
+}
+
+// matches reports whether the grant covers the record named name of type rrtype, an empty rrtype
+// standing for every type of the name
+func (g *Grant) matches(name string, rrtype string) bool {
+	if len(g.Types) > 0 {
+		found := false
+		for _, t := range g.Types {
+			if t == rrtype {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(g.Names) == 0 {
+		return true
+	}
+	name = dns.CanonicalName(name)
+	for _, pattern := range g.Names {
+		if strings.HasPrefix(pattern, "*.") {
+			parent := strings.TrimPrefix(pattern, "*.")
+			if name != parent && dns.IsSubDomain(parent, name) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions are the grants of a user or a TSIG key. A nil Permissions allows everything while a Permissions
+// without grants allows nothing.
+type Permissions struct {
+	grants []*Grant
+}
+
+// UserPermissions returns the permissions of the user, the zones the user owns count as zone-admin grants
+func UserPermissions(db *gorm.DB, user *User) (*Permissions, error) {
+	var grants []*Grant
+	err := db.Where("user_id = ?", user.ID).Find(&grants).Error
+	if err != nil {
+		return nil, err
+	}
+	var zoneIDs []string
+	err = db.Table("user_zones").Where("user_id = ?", user.ID).Pluck("zone_id", &zoneIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, zoneID := range zoneIDs {
+		grants = append(grants, &Grant{Role: RoleZoneAdmin, UserID: user.ID, ZoneID: zoneID})
+	}
+	return &Permissions{grants: grants}, nil
+}
+
+// TSIGKeyPermissions returns the permissions of the key, the zones the key is attached to count as zone-admin grants
+func TSIGKeyPermissions(db *gorm.DB, key *TSIGKey) (*Permissions, error) {
+	var grants []*Grant
+	err := db.Where("tsig_key_id = ?", key.ID).Find(&grants).Error
+	if err != nil {
+		return nil, err
+	}
+	var zoneIDs []string
+	err = db.Table("zone_tsig_keys").Where("tsig_key_id = ?", key.ID).Pluck("zone_id", &zoneIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, zoneID := range zoneIDs {
+		grants = append(grants, &Grant{Role: RoleZoneAdmin, TSIGKeyID: key.ID, ZoneID: zoneID})
+	}
+	return &Permissions{grants: grants}, nil
+}
+
+// find reports whether a grant of at least role applies to the zone and satisfies match. An empty zoneID
+// only matches global grants.
+func (p *Permissions) find(role string, zoneID string, match func(g *Grant) bool) bool {
+	if p == nil {
+		return true
+	}
+	for _, g := range p.grants {
+		if roleLevels[g.Role] < roleLevels[role] {
+			continue
+		}
+		if zoneID == "" && g.ZoneID != "" || !g.appliesTo(zoneID) {
+			continue
+		}
+		if match(g) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the permissions hold the admin role
+func (p *Permissions) IsAdmin() bool {
+	return p.Allows(RoleAdmin, "")
+}
+
+// Allows reports whether the permissions hold role on the whole zone, an empty zoneID asking for it on every zone
+func (p *Permissions) Allows(role string, zoneID string) bool {
+	return p.find(role, zoneID, func(g *Grant) bool { return !g.Scoped() })
+}
+
+// CanRead reports whether the permissions hold any grant on the zone, restricted grants included
+func (p *Permissions) CanRead(zoneID string) bool {
+	return p.find(RoleReadOnly, zoneID, func(g *Grant) bool { return true })
+}
+
+// CanEdit reports whether the permissions may change some records of the zone
+func (p *Permissions) CanEdit(zoneID string) bool {
+	return p.find(RoleRecordEditor, zoneID, func(g *Grant) bool { return true })
+}
+
+// AllowsRecord reports whether the permissions may change the records of the zone named name of type rrtype.
+// name is a fully qualified domain name, an empty rrtype asks for every type of the name.
+func (p *Permissions) AllowsRecord(zoneID string, name string, rrtype string) bool {
+	return p.find(RoleRecordEditor, zoneID, func(g *Grant) bool { return g.matches(name, rrtype) })
+}
+
+// ReadableZones returns the ids of the zones the permissions may read, all is set when they may read every zone
+func (p *Permissions) ReadableZones() (ids []string, all bool) {
+	return p.zones(RoleReadOnly, false)
+}
+
+// AdministeredZones returns the ids of the zones the permissions hold zone-admin on, all is set when they
+// hold it on every zone
+func (p *Permissions) AdministeredZones() (ids []string, all bool) {
+	return p.zones(RoleZoneAdmin, true)
+}
+
+// zones returns the ids of the zones holding a grant of at least role, unscoped ones only when unscoped is set
+func (p *Permissions) zones(role string, unscoped bool) (ids []string, all bool) {
+	if p == nil {
+		return nil, true
+	}
+	ids = make([]string, 0)
+	for _, g := range p.grants {
+		if roleLevels[g.Role] < roleLevels[role] || unscoped && g.Scoped() {
+			continue
+		}
+		if g.ZoneID == "" {
+			return nil, true
+		}
+		ids = append(ids, g.ZoneID)
+	}
+	return ids, false
+}
+
+// Grants returns the grants given to the user
+func (u *User) Grants(db *gorm.DB) (grants []*Grant, err error) {
+	grants = make([]*Grant, 0)
+	err = db.Where("user_id = ?", u.ID).Order("id").Find(&grants).Error
+	return grants, err
+}
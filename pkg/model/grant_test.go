@@ -0,0 +1,162 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGrant_Validate(t *testing.T) {
+	tests := []struct {
+		name          string
+		grant         Grant
+		expectedNames []string
+		expectedTypes []string
+		expectedErr   error
+	}{
+		{
+			name:          "scoped record editor",
+			grant:         Grant{Role: RoleRecordEditor, UserID: "user", ZoneID: "zone", Names: []string{"*.Dev.Martinez.io"}, Types: []string{"txt"}},
+			expectedNames: []string{"*.dev.martinez.io."},
+			expectedTypes: []string{"TXT"},
+		},
+		{
+			name:        "unknown role",
+			grant:       Grant{Role: "owner", UserID: "user"},
+			expectedErr: ErrInvalidRole,
+		},
+		{
+			name:        "no holder",
+			grant:       Grant{Role: RoleReadOnly},
+			expectedErr: ErrInvalidGrantHolder,
+		},
+		{
+			name:        "both holders",
+			grant:       Grant{Role: RoleReadOnly, UserID: "user", TSIGKeyID: "key"},
+			expectedErr: ErrInvalidGrantHolder,
+		},
+		{
+			name:        "admin of a zone",
+			grant:       Grant{Role: RoleAdmin, UserID: "user", ZoneID: "zone"},
+			expectedErr: ErrInvalidGrantScope,
+		},
+		{
+			name:        "wildcard inside the name",
+			grant:       Grant{Role: RoleRecordEditor, UserID: "user", Names: []string{"dev.*.martinez.io"}},
+			expectedErr: ErrInvalidGrantName,
+		},
+		{
+			name:        "unknown type",
+			grant:       Grant{Role: RoleRecordEditor, UserID: "user", Types: []string{"BOGUS"}},
+			expectedErr: ErrInvalidGrantType,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.grant.Validate()
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("Unexpected error: got %v, want %v", err, test.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			for pos, name := range test.expectedNames {
+				if test.grant.Names[pos] != name {
+					t.Errorf("Unexpected name: got %s, want %s", test.grant.Names[pos], name)
+				}
+			}
+			for pos, rrtype := range test.expectedTypes {
+				if test.grant.Types[pos] != rrtype {
+					t.Errorf("Unexpected type: got %s, want %s", test.grant.Types[pos], rrtype)
+				}
+			}
+		})
+	}
+}
+
+func TestUserPermissions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:grant_model?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&User{}, &Zone{}, &Grant{}, &ZoneJournal{}, &ZoneChange{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	user := User{Name: "juliano", Email: "juliano@martinez.io"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Error creating test user: %s", err)
+	}
+	owned := Zone{Name: "owned.io", MName: "ns1.owned.io", RName: "hostmaster.owned.io"}
+	zone := Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io"}
+	other := Zone{Name: "other.io", MName: "ns1.other.io", RName: "hostmaster.other.io"}
+	for _, z := range []*Zone{&owned, &zone, &other} {
+		if err := db.Create(z).Error; err != nil {
+			t.Fatalf("Error creating test zone: %s", err)
+		}
+	}
+	if err := user.AddZone(db, &owned); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, grant := range []*Grant{
+		{Role: RoleRecordEditor, UserID: user.ID, ZoneID: zone.ID, Names: []string{"*.dev.martinez.io"}},
+		{Role: RoleRecordEditor, UserID: user.ID, ZoneID: zone.ID, Names: []string{"_acme-challenge.martinez.io"}, Types: []string{"TXT"}},
+	} {
+		if err := db.Create(grant).Error; err != nil {
+			t.Fatalf("Error creating test grant: %s", err)
+		}
+	}
+
+	permissions, err := UserPermissions(db, &user)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if permissions.IsAdmin() {
+		t.Errorf("Expected the user not to be an admin")
+	}
+	if !permissions.Allows(RoleZoneAdmin, owned.ID) {
+		t.Errorf("Expected the owner of a zone to administer it")
+	}
+	if permissions.Allows(RoleReadOnly, zone.ID) {
+		t.Errorf("Expected scoped grants not to apply to the whole zone")
+	}
+	if !permissions.CanRead(zone.ID) || permissions.CanRead(other.ID) {
+		t.Errorf("Expected the user to read the zones of its grants only")
+	}
+	ids, all := permissions.ReadableZones()
+	if all || len(ids) != 3 {
+		t.Errorf("Unexpected readable zones: %v, all %v", ids, all)
+	}
+
+	records := []struct {
+		zoneID   string
+		name     string
+		rrtype   string
+		expected bool
+	}{
+		{zone.ID, "www.dev.martinez.io.", "A", true},
+		{zone.ID, "a.b.dev.martinez.io", "CNAME", true},
+		{zone.ID, "www.dev.martinez.io.", "", true},
+		{zone.ID, "dev.martinez.io.", "A", false},
+		{zone.ID, "www.martinez.io.", "A", false},
+		{zone.ID, "_acme-challenge.martinez.io.", "TXT", true},
+		{zone.ID, "_ACME-challenge.martinez.io.", "TXT", true},
+		{zone.ID, "_acme-challenge.martinez.io.", "A", false},
+		{zone.ID, "_acme-challenge.martinez.io.", "", false},
+		{other.ID, "www.dev.martinez.io.", "A", false},
+		{owned.ID, "www.owned.io.", "A", true},
+	}
+	for _, record := range records {
+		if allowed := permissions.AllowsRecord(record.zoneID, record.name, record.rrtype); allowed != record.expected {
+			t.Errorf("Unexpected permission for %s %s: got %v, want %v", record.name, record.rrtype, allowed, record.expected)
+		}
+	}
+
+	var unrestricted *Permissions
+	if !unrestricted.IsAdmin() || !unrestricted.AllowsRecord(other.ID, "www.other.io.", "A") {
+		t.Errorf("Expected nil permissions to allow everything")
+	}
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JournalSize is the number of changes kept in the journal of each zone
+const JournalSize = 100
+
+// JournalRecord is a record as stored in the journal of a zone
+type JournalRecord struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	TTL     int    `json:"ttl"`
+	Content string `json:"content"`
+}
+
+// Record returns the journaled record as a Record
+func (r JournalRecord) Record() *Record {
+	return &Record{Name: r.Name, Type: r.Type, TTL: r.TTL, Content: r.Content}
+}
+
+// ZoneJournal is a change of a zone from a serial to the next, IXFR serves it to the secondaries
+type ZoneJournal struct {
+	ID         uint            `gorm:"primarykey"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ZoneID     string          `gorm:"index;not null" json:"-"`
+	FromSerial int             `gorm:"not null" json:"from_serial"`
+	ToSerial   int             `gorm:"not null" json:"to_serial"`
+	Removed    []JournalRecord `gorm:"serializer:json" json:"removed"`
+	Added      []JournalRecord `gorm:"serializer:json" json:"added"`
+}
+
+// ZoneChange is a record removed from or added to a zone since its last journaled serial. The record hooks
+// write them as they know the rows they change, the next journal entry of the zone folds them.
+type ZoneChange struct {
+	ID            uint   `gorm:"primarykey"`
+	ZoneID        string `gorm:"index;not null"`
+	Removed       bool   `gorm:"not null"`
+	JournalRecord `gorm:"embedded"`
+}
+
+// Journal records the changes of the zone from serial from to its current serial. The changes stay pending
+// while the serial doesn't move. Only the changes are kept, AXFR serves the records themselves.
+func (z *Zone) Journal(tx *gorm.DB, from int) (err error) {
+	var current Zone
+	result := tx.Select("id", "serial").Limit(1).Find(&current, "id = ?", z.ID)
+	if result.Error != nil || result.RowsAffected == 0 || current.Serial == from {
+		return result.Error
+	}
+	var changes []*ZoneChange
+	err = tx.Where("zone_id = ?", z.ID).Order("id").Find(&changes).Error
+	if err != nil {
+		return err
+	}
+	removed, added := foldChanges(changes)
+	err = tx.Create(&ZoneJournal{
+		ZoneID:     z.ID,
+		FromSerial: from,
+		ToSerial:   current.Serial,
+		Removed:    removed,
+		Added:      added,
+	}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("zone_id = ?", z.ID).Delete(&ZoneChange{}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("zone_id = ? AND id NOT IN (?)", z.ID,
+		tx.Model(&ZoneJournal{}).Select("id").Where("zone_id = ?", z.ID).Order("id DESC").Limit(JournalSize),
+	).Delete(&ZoneJournal{}).Error
+}
+
+// JournalSince returns the changes bringing the zone from serial to its last journaled serial.
+// ok is false when the journal doesn't go back to serial.
+func (z *Zone) JournalSince(db *gorm.DB, serial int) (changes []*ZoneJournal, ok bool, err error) {
+	var entries []*ZoneJournal
+	err = db.Where("zone_id = ?", z.ID).Order("id").Find(&entries).Error
+	if err != nil {
+		return nil, false, err
+	}
+	// The latest change from serial wins, a serial may come back after the zone was set to a lower one
+	for pos := len(entries) - 1; pos >= 0; pos-- {
+		if entries[pos].FromSerial != serial {
+			continue
+		}
+		changes = entries[pos:]
+		for next := 1; next < len(changes); next++ {
+			if changes[next].FromSerial != changes[next-1].ToSerial {
+				return nil, false, nil
+			}
+		}
+		return changes, true, nil
+	}
+	return nil, false, nil
+}
+
+// journalChange records that the records were removed from or added to their zone, records without zone
+// aren't journaled
+func journalChange(tx *gorm.DB, removed bool, records ...*Record) error {
+	var changes []*ZoneChange
+	for _, record := range records {
+		if record.ZoneID == "" {
+			continue
+		}
+		changes = append(changes, &ZoneChange{
+			ZoneID:        record.ZoneID,
+			Removed:       removed,
+			JournalRecord: JournalRecord{Name: record.Name, Type: record.Type, TTL: record.TTL, Content: record.Content},
+		})
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return tx.Create(changes).Error
+}
+
+// foldChanges returns the records the changes removed and added in the order they were first changed. A record
+// added then removed, or removed then added back, cancels out.
+func foldChanges(changes []*ZoneChange) (removed []JournalRecord, added []JournalRecord) {
+	net := make(map[JournalRecord]int, len(changes))
+	var order []JournalRecord
+	for _, change := range changes {
+		if _, ok := net[change.JournalRecord]; !ok {
+			order = append(order, change.JournalRecord)
+		}
+		if change.Removed {
+			net[change.JournalRecord]--
+		} else {
+			net[change.JournalRecord]++
+		}
+	}
+	for _, record := range order {
+		switch {
+		case net[record] < 0:
+			removed = append(removed, record)
+		case net[record] > 0:
+			added = append(added, record)
+		}
+	}
+	return removed, added
+}
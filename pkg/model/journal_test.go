@@ -0,0 +1,150 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestZone_Journal(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:journal_model?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&Zone{}, &Record{}, &ZoneJournal{}, &ZoneChange{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	zone := Zone{Name: ulid.Make().String()}
+	if err := db.Create(&zone).Error; err != nil {
+		t.Fatalf("Error creating test zone: %s", err)
+	}
+	www := Record{Name: "www.journal.martinez.io", Type: "A", Content: "192.168.0.1", TTL: 300, ZoneID: zone.ID}
+	mail := Record{Name: "mail.journal.martinez.io", Type: "A", Content: "192.168.0.25", TTL: 300, ZoneID: zone.ID}
+	for _, change := range []func() error{
+		func() error { return www.Create(db) },
+		func() error { return mail.Create(db) },
+		func() error { return www.Update(db, Record{Content: "192.168.0.2"}) },
+		func() error { return (&Record{ID: mail.ID}).Delete(db) },
+		func() error {
+			return (&Record{Name: www.Name, Type: "A", Content: "192.168.0.3", TTL: 600, ZoneID: zone.ID}).Create(db)
+		},
+	} {
+		if err := change(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	changes, ok, err := zone.JournalSince(db, 1)
+	if err != nil || !ok {
+		t.Fatalf("Unexpected journal: %t, %v", ok, err)
+	}
+	expected := []struct {
+		from, to       int
+		removed, added []JournalRecord
+	}{
+		{from: 1, to: 2, added: []JournalRecord{{Name: www.Name, Type: "A", TTL: 300, Content: "192.168.0.1"}}},
+		{from: 2, to: 3, added: []JournalRecord{{Name: mail.Name, Type: "A", TTL: 300, Content: "192.168.0.25"}}},
+		{
+			from:    3,
+			to:      4,
+			removed: []JournalRecord{{Name: www.Name, Type: "A", TTL: 300, Content: "192.168.0.1"}},
+			added:   []JournalRecord{{Name: www.Name, Type: "A", TTL: 300, Content: "192.168.0.2"}},
+		},
+		{from: 4, to: 5, removed: []JournalRecord{{Name: mail.Name, Type: "A", TTL: 300, Content: "192.168.0.25"}}},
+		{
+			from:    5,
+			to:      6,
+			removed: []JournalRecord{{Name: www.Name, Type: "A", TTL: 300, Content: "192.168.0.2"}},
+			added: []JournalRecord{
+				{Name: www.Name, Type: "A", TTL: 600, Content: "192.168.0.3"},
+				{Name: www.Name, Type: "A", TTL: 600, Content: "192.168.0.2"},
+			},
+		},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Unexpected number of changes: got %d, want %d", len(changes), len(expected))
+	}
+	for pos, change := range changes {
+		if change.FromSerial != expected[pos].from || change.ToSerial != expected[pos].to {
+			t.Errorf("Unexpected serials of change %d: got %d-%d, want %d-%d", pos, change.FromSerial, change.ToSerial, expected[pos].from, expected[pos].to)
+		}
+		if !reflect.DeepEqual(change.Removed, expected[pos].removed) {
+			t.Errorf("Unexpected records removed by change %d: %+v", pos, change.Removed)
+		}
+		if !reflect.DeepEqual(change.Added, expected[pos].added) {
+			t.Errorf("Unexpected records added by change %d: %+v", pos, change.Added)
+		}
+	}
+
+	var pending int64
+	db.Model(&ZoneChange{}).Where("zone_id = ?", zone.ID).Count(&pending)
+	if pending != 0 {
+		t.Errorf("Expected the journaled changes not to stay pending, got %d", pending)
+	}
+
+	changes, ok, err = zone.JournalSince(db, 3)
+	if err != nil || !ok || len(changes) != 3 {
+		t.Errorf("Unexpected journal since 3: %d changes, %t, %v", len(changes), ok, err)
+	}
+	if _, ok, _ := zone.JournalSince(db, 42); ok {
+		t.Errorf("Expected the journal not to go back to serial 42")
+	}
+
+	// Only the last JournalSize changes are kept
+	for pos := 0; pos < JournalSize; pos++ {
+		if err := zone.BumpSerial(db); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	if _, ok, _ := zone.JournalSince(db, 1); ok {
+		t.Errorf("Expected the oldest changes to be pruned")
+	}
+	var count int64
+	db.Model(&ZoneJournal{}).Where("zone_id = ?", zone.ID).Count(&count)
+	if count != JournalSize {
+		t.Errorf("Unexpected journal size: got %d, want %d", count, JournalSize)
+	}
+}
+
+func TestZone_JournalImport(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:journal_import_model?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&Zone{}, &Record{}, &ZoneJournal{}, &ZoneChange{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	zone := Zone{Name: "import.martinez.io", Records: []*Record{
+		{Name: "www", Type: "A", Content: "192.168.0.1", TTL: 300},
+		{Name: "mail", Type: "A", Content: "192.168.0.25", TTL: 300},
+	}}
+	if err := db.Create(&zone).Error; err != nil {
+		t.Fatalf("Error creating test zone: %s", err)
+	}
+	imported := &Zone{Serial: 10, Records: []*Record{
+		{Name: "www", Type: "A", Content: "192.168.0.1", TTL: 300},
+		{Name: "mail", Type: "A", Content: "192.168.0.26", TTL: 300},
+	}}
+	if err := zone.Import(db, imported, false); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// The records recreated as they were aren't changes
+	changes, ok, err := zone.JournalSince(db, 1)
+	if err != nil || !ok || len(changes) != 1 {
+		t.Fatalf("Unexpected journal: %d changes, %t, %v", len(changes), ok, err)
+	}
+	if expected := []JournalRecord{{Name: "mail", Type: "A", TTL: 300, Content: "192.168.0.25"}}; !reflect.DeepEqual(changes[0].Removed, expected) {
+		t.Errorf("Unexpected records removed: %+v", changes[0].Removed)
+	}
+	if expected := []JournalRecord{{Name: "mail", Type: "A", TTL: 300, Content: "192.168.0.26"}}; !reflect.DeepEqual(changes[0].Added, expected) {
+		t.Errorf("Unexpected records added: %+v", changes[0].Added)
+	}
+}
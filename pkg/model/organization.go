@@ -0,0 +1,319 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/oklog/ulid/v2"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidOrganizationName is returned when the name of an organization is empty or holds spaces
+	ErrInvalidOrganizationName = errors.New("invalid name, must be a non empty string without spaces")
+	// ErrInvalidQuota is returned when a quota of an organization is negative
+	ErrInvalidQuota = errors.New("invalid quota, must be zero for unlimited or a positive number")
+	// ErrQuotaExceeded is returned when a zone or a record would take an organization over its quota
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrOrganizationMismatch is returned when a zone is assigned to a backend of another organization
+	ErrOrganizationMismatch = errors.New("the zone and the backend belong to different organizations")
+	// ErrZoneNameTaken is returned when a backend would serve two zones with the same name
+	ErrZoneNameTaken = errors.New("the backend already serves a zone with the same name")
+	// ErrOrganizationNotEmpty is returned when deleting an organization that still owns resources
+	ErrOrganizationNotEmpty = errors.New("the organization still owns zones, backends, TSIG keys or users")
+)
+
+// Organization is a tenant of port53, it owns zones, backends, TSIG keys and users. Users of an organization
+// only see its resources, users and keys without organization are the operators of port53 and see them all.
+// Backends without organization are shared, the zones of every organization may be assigned to them.
+type Organization struct {
+	ID        string         `gorm:"primarykey;not null" jsonapi:"primary,organizations"`
+	CreatedAt time.Time      `jsonapi:"attribute" json:"created_at,omitempty"`
+	UpdatedAt time.Time      `jsonapi:"attribute" json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Name      string         `gorm:"uniqueIndex;not null" jsonapi:"attribute" json:"name"`
+	// MaxZones is the number of zones the organization may hold, unlimited when zero
+	MaxZones int `gorm:"not null;default:0" jsonapi:"attribute" json:"max_zones"`
+	// MaxRecords is the number of records the zones of the organization may hold together, unlimited when zero
+	MaxRecords int `gorm:"not null;default:0" jsonapi:"attribute" json:"max_records"`
+}
+
+// Link returns the link to the resource
+func (o *Organization) Link() *jsonapi.Link {
+	return &jsonapi.Link{
+		Self: fmt.Sprintf("%s/v1/organizations/%s", viper.GetString("serviceUrl"), o.ID),
+	}
+}
+
+// BeforeCreate generates a new ULID for the organization if needed and validates it
+func (o *Organization) BeforeCreate(tx *gorm.DB) (err error) {
+	if o.ID == "" {
+		o.ID = ulid.Make().String()
+	} else {
+		_, err = ulid.Parse(o.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return o.Validate()
+}
+
+// Validate checks the name and quotas of the organization, normalising the name
+func (o *Organization) Validate() error {
+	name := strings.ToLower(strings.TrimSpace(o.Name))
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return ErrInvalidOrganizationName
+	}
+	if o.MaxZones < 0 || o.MaxRecords < 0 {
+		return ErrInvalidQuota
+	}
+	o.Name = name
+	return nil
+}
+
+// Get the organization
+func (o *Organization) Get(db *gorm.DB) (err error) {
+	return db.First(o, "id = ?", o.ID).Error
+}
+
+// Update changes the name and quotas of the organization, the name is kept when left empty while the
+// quotas are always replaced
+func (o *Organization) Update(db *gorm.DB, organization Organization) (err error) {
+	err = db.First(o, "id = ?", o.ID).Error
+	if err != nil {
+		return err
+	}
+	if organization.Name == "" {
+		organization.Name = o.Name
+	}
+	err = organization.Validate()
+	if err != nil {
+		return err
+	}
+	err = db.Model(o).Select("name", "max_zones", "max_records", "updated_at").Updates(organization).Error
+	if err != nil {
+		return err
+	}
+	return db.First(o, "id = ?", o.ID).Error
+}
+
+// Delete the organization, organizations still owning zones, backends, TSIG keys or users can't be deleted.
+// Organizations are removed for good, a soft deleted organization would keep its name taken in its unique index.
+func (o *Organization) Delete(db *gorm.DB) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, resource := range []interface{}{&Zone{}, &Backend{}, &TSIGKey{}, &User{}} {
+			var count int64
+			err := tx.Model(resource).Where("organization_id = ?", o.ID).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrOrganizationNotEmpty
+			}
+		}
+		return tx.Unscoped().Delete(o).Error
+	})
+}
+
+// Zones returns the zones of the organization
+func (o *Organization) Zones(db *gorm.DB) (zones []*Zone, err error) {
+	zones = make([]*Zone, 0)
+	err = db.Where("organization_id = ?", o.ID).Order("name").Find(&zones).Error
+	return zones, err
+}
+
+// Backends returns the backends of the organization, shared backends aside
+func (o *Organization) Backends(db *gorm.DB) (backends []*Backend, err error) {
+	backends = make([]*Backend, 0)
+	err = db.Where("organization_id = ?", o.ID).Order("name").Find(&backends).Error
+	return backends, err
+}
+
+// Users returns the users of the organization
+func (o *Organization) Users(db *gorm.DB) (users []*User, err error) {
+	users = make([]*User, 0)
+	err = db.Where("organization_id = ?", o.ID).Order("name").Find(&users).Error
+	return users, err
+}
+
+// AddZone moves the zone into the organization. The zone must fit in the quotas of the organization and
+// its backends must be shared or belong to the organization.
+func (o *Organization) AddZone(db *gorm.DB, zone *Zone) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(o, "id = ?", o.ID).Error
+		if err != nil {
+			return err
+		}
+		err = tx.First(zone, "id = ?", zone.ID).Error
+		if err != nil || zone.OrganizationID == o.ID {
+			return err
+		}
+		err = checkZoneQuota(tx, o.ID, 1)
+		if err != nil {
+			return err
+		}
+		var records int64
+		err = tx.Model(&Record{}).Where("zone_id = ?", zone.ID).Count(&records).Error
+		if err != nil {
+			return err
+		}
+		err = checkRecordQuota(tx, o.ID, records)
+		if err != nil {
+			return err
+		}
+		var backends []*Backend
+		err = tx.Model(zone).Association("Backends").Find(&backends)
+		if err != nil {
+			return err
+		}
+		for _, backend := range backends {
+			if !Reaches(backend.OrganizationID, o.ID) {
+				return ErrOrganizationMismatch
+			}
+		}
+		err = tx.Model(zone).Update("organization_id", o.ID).Error
+		if err != nil {
+			return err
+		}
+		zone.OrganizationID = o.ID
+		return nil
+	})
+}
+
+// AddBackend moves the backend into the organization, every zone of the backend must belong to the organization
+func (o *Organization) AddBackend(db *gorm.DB, backend *Backend) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(o, "id = ?", o.ID).Error
+		if err != nil {
+			return err
+		}
+		err = tx.First(backend, "id = ?", backend.ID).Error
+		if err != nil {
+			return err
+		}
+		var zones []*Zone
+		err = tx.Model(backend).Association("Zones").Find(&zones)
+		if err != nil {
+			return err
+		}
+		for _, zone := range zones {
+			if zone.OrganizationID != o.ID {
+				return ErrOrganizationMismatch
+			}
+		}
+		err = tx.Model(backend).Update("organization_id", o.ID).Error
+		if err != nil {
+			return err
+		}
+		backend.OrganizationID = o.ID
+		return nil
+	})
+}
+
+// AddUser moves the user into the organization
+func (o *Organization) AddUser(db *gorm.DB, user *User) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(o, "id = ?", o.ID).Error
+		if err != nil {
+			return err
+		}
+		err = tx.First(user, "id = ?", user.ID).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(user).Update("organization_id", o.ID).Error
+		if err != nil {
+			return err
+		}
+		user.OrganizationID = o.ID
+		return nil
+	})
+}
+
+// Reaches reports whether a holder of the organization holder may reach a resource of the organization
+// resource. Holders without organization reach every organization.
+func Reaches(holder string, resource string) bool {
+	return holder == "" || holder == resource
+}
+
+// checkZoneQuota returns ErrQuotaExceeded when adding zones to the organization takes it over the number of
+// zones it may hold. Quotas are checked once the rows are written, zones saved again through an association
+// don't count twice.
+func checkZoneQuota(tx *gorm.DB, organizationID string, zones int64) error {
+	if organizationID == "" {
+		return nil
+	}
+	var organization Organization
+	err := tx.First(&organization, "id = ?", organizationID).Error
+	if err != nil || organization.MaxZones == 0 {
+		return err
+	}
+	var count int64
+	err = tx.Model(&Zone{}).Where("organization_id = ?", organizationID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count+zones > int64(organization.MaxZones) {
+		return fmt.Errorf("%w, organization %s may hold %d zones", ErrQuotaExceeded, organization.Name, organization.MaxZones)
+	}
+	return nil
+}
+
+// checkRecordQuota returns ErrQuotaExceeded when adding records to the zones of the organization takes it
+// over the number of records it may hold
+func checkRecordQuota(tx *gorm.DB, organizationID string, records int64) error {
+	if organizationID == "" {
+		return nil
+	}
+	var organization Organization
+	err := tx.First(&organization, "id = ?", organizationID).Error
+	if err != nil || organization.MaxRecords == 0 {
+		return err
+	}
+	var count int64
+	err = tx.Model(&Record{}).
+		Where("zone_id IN (?)", tx.Model(&Zone{}).Select("id").Where("organization_id = ?", organizationID)).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count+records > int64(organization.MaxRecords) {
+		return fmt.Errorf("%w, organization %s may hold %d records", ErrQuotaExceeded, organization.Name, organization.MaxRecords)
+	}
+	return nil
+}
+
+// checkAssignment returns ErrOrganizationMismatch when the zone can't be served by the backend because they
+// belong to different organizations, and ErrZoneNameTaken when the backend already serves another zone with
+// the name of the zone
+func checkAssignment(tx *gorm.DB, backendID string, zoneID string) error {
+	var backend Backend
+	err := tx.Select("id", "organization_id").First(&backend, "id = ?", backendID).Error
+	if err != nil {
+		return err
+	}
+	var zone Zone
+	err = tx.Select("id", "name", "organization_id").First(&zone, "id = ?", zoneID).Error
+	if err != nil {
+		return err
+	}
+	if !Reaches(backend.OrganizationID, zone.OrganizationID) {
+		return ErrOrganizationMismatch
+	}
+	var count int64
+	err = tx.Model(&Zone{}).
+		Joins("JOIN backend_zones ON backend_zones.zone_id = zones.id").
+		Where("backend_zones.backend_id = ? AND zones.id <> ? AND RTRIM(LOWER(zones.name), '.') = ?", backendID, zoneID, strings.TrimSuffix(strings.ToLower(zone.Name), ".")).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrZoneNameTaken
+	}
+	return nil
+}
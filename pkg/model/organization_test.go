@@ -0,0 +1,186 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestOrganization_Validate(t *testing.T) {
+	tests := []struct {
+		name         string
+		organization Organization
+		expectedName string
+		expectedErr  error
+	}{
+		{
+			name:         "valid organization",
+			organization: Organization{Name: " Martinez ", MaxZones: 10},
+			expectedName: "martinez",
+		},
+		{
+			name:         "empty name",
+			organization: Organization{Name: " "},
+			expectedErr:  ErrInvalidOrganizationName,
+		},
+		{
+			name:         "name with spaces",
+			organization: Organization{Name: "juliano martinez"},
+			expectedErr:  ErrInvalidOrganizationName,
+		},
+		{
+			name:         "negative quota",
+			organization: Organization{Name: "martinez", MaxRecords: -1},
+			expectedErr:  ErrInvalidQuota,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.organization.Validate()
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("Unexpected error: got %v, want %v", err, test.expectedErr)
+			}
+			if err == nil && test.organization.Name != test.expectedName {
+				t.Errorf("Unexpected name: got %s, want %s", test.organization.Name, test.expectedName)
+			}
+		})
+	}
+}
+
+func TestOrganization_Quotas(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:organization_quotas?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&Organization{}, &Zone{}, &Record{}, &ZoneJournal{}, &ZoneChange{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	organization := Organization{Name: "martinez", MaxZones: 1, MaxRecords: 1}
+	if err := db.Create(&organization).Error; err != nil {
+		t.Fatalf("Error creating test organization: %s", err)
+	}
+	zone := Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io", OrganizationID: organization.ID}
+	if err := db.Create(&zone).Error; err != nil {
+		t.Fatalf("Error creating test zone: %s", err)
+	}
+	second := Zone{Name: "other.io", MName: "ns1.other.io", RName: "hostmaster.other.io", OrganizationID: organization.ID}
+	if err := db.Create(&second).Error; !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Unexpected error creating a zone over the quota: got %v, want %v", err, ErrQuotaExceeded)
+	}
+
+	www := Record{Name: "www.martinez.io", Type: "A", Content: "192.168.0.1", TTL: 300, ZoneID: zone.ID}
+	if err := db.Create(&www).Error; err != nil {
+		t.Fatalf("Error creating test record: %s", err)
+	}
+	mail := Record{Name: "mail.martinez.io", Type: "A", Content: "192.168.0.25", TTL: 300, ZoneID: zone.ID}
+	if err := db.Create(&mail).Error; !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Unexpected error creating a record over the quota: got %v, want %v", err, ErrQuotaExceeded)
+	}
+
+	shared := Zone{Name: "shared.io", MName: "ns1.shared.io", RName: "hostmaster.shared.io"}
+	if err := db.Create(&shared).Error; err != nil {
+		t.Fatalf("Error creating test zone: %s", err)
+	}
+	if err := organization.AddZone(db, &shared); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Unexpected error moving a zone over the quota: got %v, want %v", err, ErrQuotaExceeded)
+	}
+
+	err = organization.Update(db, Organization{MaxZones: 2, MaxRecords: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if organization.Name != "martinez" {
+		t.Errorf("Expected the name to be kept, got %s", organization.Name)
+	}
+	if err := organization.AddZone(db, &shared); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := organization.Delete(db); !errors.Is(err, ErrOrganizationNotEmpty) {
+		t.Errorf("Unexpected error deleting an organization with zones: got %v, want %v", err, ErrOrganizationNotEmpty)
+	}
+}
+
+func TestOrganization_Delete(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:organization_delete?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&Organization{}, &Backend{}, &Zone{}, &TSIGKey{}, &User{}, &ZoneJournal{}, &ZoneChange{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	organization := Organization{Name: "martinez"}
+	if err := db.Create(&organization).Error; err != nil {
+		t.Fatalf("Error creating test organization: %s", err)
+	}
+	if err := organization.Delete(db); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	var count int64
+	db.Unscoped().Model(&Organization{}).Where("id = ?", organization.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the organization to be removed for good")
+	}
+
+	// The name of a deleted organization may be taken again
+	if err := db.Create(&Organization{Name: "martinez"}).Error; err != nil {
+		t.Errorf("Unexpected error creating an organization of a deleted name: %s", err)
+	}
+}
+
+func TestOrganization_Assignment(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:organization_assignment?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&Organization{}, &Backend{}, &Zone{}, &Record{}, &ZoneJournal{}, &ZoneChange{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	acme := Organization{Name: "acme"}
+	initech := Organization{Name: "initech"}
+	for _, organization := range []*Organization{&acme, &initech} {
+		if err := db.Create(organization).Error; err != nil {
+			t.Fatalf("Error creating test organization: %s", err)
+		}
+	}
+	shared := Backend{Name: "shared"}
+	private := Backend{Name: "private", OrganizationID: acme.ID}
+	for _, backend := range []*Backend{&shared, &private} {
+		if err := db.Create(backend).Error; err != nil {
+			t.Fatalf("Error creating test backend: %s", err)
+		}
+	}
+	acmeZone := Zone{Name: "martinez.io", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io", OrganizationID: acme.ID}
+	initechZone := Zone{Name: "martinez.io.", MName: "ns1.martinez.io", RName: "hostmaster.martinez.io", OrganizationID: initech.ID}
+	for _, zone := range []*Zone{&acmeZone, &initechZone} {
+		if err := db.Create(zone).Error; err != nil {
+			t.Fatalf("Error creating test zone: %s", err)
+		}
+	}
+
+	if err := private.AddZone(db, &acmeZone); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := private.AddZone(db, &initechZone); !errors.Is(err, ErrOrganizationMismatch) {
+		t.Errorf("Unexpected error assigning a zone of another organization: got %v, want %v", err, ErrOrganizationMismatch)
+	}
+	if err := shared.AddZone(db, &acmeZone); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := shared.AddZone(db, &initechZone); !errors.Is(err, ErrZoneNameTaken) {
+		t.Errorf("Unexpected error assigning a zone name twice: got %v, want %v", err, ErrZoneNameTaken)
+	}
+	if err := initech.AddBackend(db, &private); !errors.Is(err, ErrOrganizationMismatch) {
+		t.Errorf("Unexpected error moving a backend with zones of another organization: got %v, want %v", err, ErrOrganizationMismatch)
+	}
+	if err := initech.AddZone(db, &acmeZone); !errors.Is(err, ErrOrganizationMismatch) {
+		t.Errorf("Unexpected error moving a zone served by a backend of another organization: got %v, want %v", err, ErrOrganizationMismatch)
+	}
+}
@@ -1,10 +1,14 @@
 package model
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/DataDog/jsonapi"
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/rdata"
 	"github.com/oklog/ulid/v2"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
@@ -15,12 +19,12 @@ type Record struct {
 	CreatedAt time.Time      `jsonapi:"attribute" json:"created_at,omitempty"`
 	UpdatedAt time.Time      `jsonapi:"attribute" json:"updated_at,omitempty"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	Name      string         `gorm:"uniqueIndex;not null" jsonapi:"attribute" json:"name"`
+	Name      string         `gorm:"uniqueIndex:idx_records_content;index:idx_records_rrset;not null" jsonapi:"attribute" json:"name"`
 	TTL       int            `gorm:"not null;default:3600" jsonapi:"attribute" json:"ttl"`
-	Type      string         `gorm:"not null" jsonapi:"attribute" json:"type"`
-	Content   string         `gorm:"not null" jsonapi:"attribute" json:"content"`
+	Type      string         `gorm:"uniqueIndex:idx_records_content;index:idx_records_rrset;not null" jsonapi:"attribute" json:"type"`
+	Content   string         `gorm:"uniqueIndex:idx_records_content;not null" jsonapi:"attribute" json:"content"`
 	Zone      *Zone          `gorm:"-" jsonapi:"relationship" json:"zones"`
-	ZoneID    string         `gorm:"foreignKey:ZoneID" json:"-"`
+	ZoneID    string         `gorm:"uniqueIndex:idx_records_content,priority:1;index:idx_records_rrset,priority:1" json:"-"`
 }
 
 // Link returns the link to the resource
@@ -38,15 +42,114 @@ func (r *Record) LinkRelation(relation string) *jsonapi.Link {
 	}
 }
 
-// BeforeCreate generates a new ULID for the record if needed
-// TOOO: Implement data validation for the record type and content
+// BeforeCreate generates a new ULID for the record if needed and validates its content
 func (r *Record) BeforeCreate(tx *gorm.DB) (err error) {
 	if r.ID == "" {
 		r.ID = ulid.Make().String()
 	} else {
 		_, err = ulid.Parse(r.ID)
+		if err != nil {
+			return err
+		}
+	}
+	origin, err := recordOrigin(tx, r.ZoneID)
+	if err != nil {
+		return err
+	}
+	return r.Validate(origin)
+}
+
+// Validate checks the record type and content, normalising the content into canonical presentation format.
+// Relative names in the content are taken as relative to the zone origin.
+func (r *Record) Validate(origin string) error {
+	content, err := rdata.Normalize(r.Type, r.Content, origin)
+	if err != nil {
+		return err
+	}
+	r.Type = strings.ToUpper(strings.TrimSpace(r.Type))
+	r.Content = content
+	return nil
+}
+
+// recordOrigin returns the origin of the zone holding the record, empty when the record has no zone
+func recordOrigin(tx *gorm.DB, zoneID string) (string, error) {
+	if zoneID == "" {
+		return "", nil
+	}
+	var names []string
+	err := tx.Model(&Zone{}).Where("id = ?", zoneID).Pluck("name", &names).Error
+	if err != nil || len(names) == 0 {
+		return "", err
+	}
+	return dns.Fqdn(names[0]), nil
+}
+
+// AfterCreate checks the record quota of the organization of the zone, journals the new record and makes its
+// TTL the TTL of its whole RRset
+func (r *Record) AfterCreate(tx *gorm.DB) (err error) {
+	var organizationIDs []string
+	err = tx.Model(&Zone{}).Where("id = ?", r.ZoneID).Pluck("organization_id", &organizationIDs).Error
+	if err != nil {
+		return err
+	}
+	if len(organizationIDs) > 0 {
+		err = checkRecordQuota(tx, organizationIDs[0], 0)
+		if err != nil {
+			return err
+		}
+	}
+	err = journalChange(tx, false, r)
+	if err != nil {
+		return err
 	}
-	return err
+	return r.syncRRSetTTL(tx)
+}
+
+// AfterDelete journals the removal of the record, records must be loaded to be deleted so their zone knows what
+// it lost
+func (r *Record) AfterDelete(tx *gorm.DB) (err error) {
+	return journalChange(tx, true, r)
+}
+
+// deleteRecords deletes the records matching the conditions for good
+func deleteRecords(tx *gorm.DB, query interface{}, args ...interface{}) error {
+	var records []*Record
+	err := tx.Where(query, args...).Find(&records).Error
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	return tx.Unscoped().Delete(&records).Error
+}
+
+// syncRRSetTTL applies the record TTL to every record sharing its zone, name and type
+func (r *Record) syncRRSetTTL(tx *gorm.DB) error {
+	if r.TTL == 0 {
+		return nil
+	}
+	return SetRRSetTTL(tx, r.ZoneID, r.Name, r.Type, r.TTL)
+}
+
+// SetRRSetTTL sets the TTL of the records of the zone called name of type rrtype, their change is journaled
+func SetRRSetTTL(tx *gorm.DB, zoneID string, name string, rrtype string, ttl int) error {
+	var records []*Record
+	err := tx.Where("zone_id = ? AND name = ? AND type = ? AND ttl <> ?", zoneID, name, rrtype, ttl).Find(&records).Error
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	err = journalChange(tx, true, records...)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+		record.TTL = ttl
+	}
+	err = tx.Model(&Record{}).Where("id IN ?", ids).Update("ttl", ttl).Error
+	if err != nil {
+		return err
+	}
+	return journalChange(tx, false, records...)
 }
 
 // Get the record
@@ -62,25 +165,129 @@ func (r *Record) Get(db *gorm.DB, preload bool) error {
 	return db.First(r).Error
 }
 
-// Delete the record
+// Create the record and advance the serial of its zone
+func (r *Record) Create(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(r).Error
+		if err != nil {
+			return err
+		}
+		return bumpZoneSerials(tx, r.ZoneID)
+	})
+}
+
+// Delete the record and advance the serial of its zone. Records are removed for good, a soft deleted
+// record would keep its content taken in the unique index of the zone.
 func (r *Record) Delete(db *gorm.DB) error {
-	return db.Delete(r).Error
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(r, "id = ?", r.ID).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		err = tx.Unscoped().Delete(r).Error
+		if err != nil {
+			return err
+		}
+		return bumpZoneSerials(tx, r.ZoneID)
+	})
 }
 
-// Update the record
+// Update the record and advance the serial of its zone
 func (r *Record) Update(db *gorm.DB, record Record) error {
 	return db.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(r).Updates(record).Error
+		err := tx.First(r, "id = ?", r.ID).Error
+		if err != nil {
+			return err
+		}
+		previous := *r
+		if record.Type != "" || record.Content != "" {
+			updated := Record{Type: r.Type, Content: r.Content}
+			if record.Type != "" {
+				updated.Type = record.Type
+			}
+			if record.Content != "" {
+				updated.Content = record.Content
+			}
+			zoneID := r.ZoneID
+			if record.ZoneID != "" {
+				zoneID = record.ZoneID
+			}
+			origin, err := recordOrigin(tx, zoneID)
+			if err != nil {
+				return err
+			}
+			if err = updated.Validate(origin); err != nil {
+				return err
+			}
+			record.Type, record.Content = updated.Type, updated.Content
+		}
+		err = tx.Model(r).Updates(record).Error
+		if err != nil {
+			return err
+		}
+		err = tx.First(r, "id = ?", r.ID).Error
+		if err != nil {
+			return err
+		}
+		err = r.journalUpdate(tx, &previous)
+		if err != nil {
+			return err
+		}
+		return bumpZoneSerials(tx, previous.ZoneID, r.ZoneID)
 	})
 }
 
-// ReplaceZone replaces the zone of the record
+// ReplaceZone replaces the zone of the record and advances the serial of both zones
 func (r *Record) ReplaceZone(db *gorm.DB, zone *Zone) error {
 	return db.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(r).Updates(Record{ZoneID: zone.ID}).Error
+		err := tx.First(r, "id = ?", r.ID).Error
+		if err != nil {
+			return err
+		}
+		previousZoneID := r.ZoneID
+		err = r.moveZone(tx, zone.ID)
+		if err != nil {
+			return err
+		}
+		return bumpZoneSerials(tx, previousZoneID, r.ZoneID)
 	})
 }
 
+// moveZone moves the loaded record to the zone
+func (r *Record) moveZone(tx *gorm.DB, zoneID string) error {
+	previous := *r
+	err := tx.Model(r).Updates(Record{ZoneID: zoneID}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.First(r, "id = ?", r.ID).Error
+	if err != nil {
+		return err
+	}
+	return r.journalUpdate(tx, &previous)
+}
+
+// journalUpdate journals the record replacing its previous version when they differ, the TTL of the record
+// becomes the TTL of its RRset
+func (r *Record) journalUpdate(tx *gorm.DB, previous *Record) error {
+	if previous.ZoneID == r.ZoneID && previous.Name == r.Name && previous.Type == r.Type &&
+		previous.TTL == r.TTL && previous.Content == r.Content {
+		return nil
+	}
+	err := journalChange(tx, true, previous)
+	if err != nil {
+		return err
+	}
+	err = journalChange(tx, false, r)
+	if err != nil {
+		return err
+	}
+	return r.syncRRSetTTL(tx)
+}
+
 // DeleteZone deletes the zone of the record
 func (r *Record) DeleteZone(db *gorm.DB) error {
 	return db.Model(r).Association("Zone").Clear()
@@ -1,11 +1,13 @@
 package model
 
 import (
+	"errors"
 	"testing"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
+	"github.com/ncode/port53/pkg/rdata"
 	"github.com/oklog/ulid/v2"
 )
 
@@ -18,14 +20,18 @@ func TestRecode_BeforeCreate(t *testing.T) {
 		{
 			name: "Before create with empty ID",
 			record: Record{
-				ID: "",
+				ID:      "",
+				Type:    "A",
+				Content: "192.168.0.1",
 			},
 			expectedError: nil,
 		},
 		{
 			name: "Before create with valid ID",
 			record: Record{
-				ID: "01D4K0Z5V5J9G5J5H5R5F5E5B5",
+				ID:      "01D4K0Z5V5J9G5J5H5R5F5E5B5",
+				Type:    "A",
+				Content: "192.168.0.1",
 			},
 			expectedError: nil,
 		},
@@ -117,7 +123,9 @@ func TestRecord_ReplaceZone(t *testing.T) {
 		{
 			name: "Update with valid ID",
 			record: Record{
-				ID: ulid.Make().String(),
+				ID:      ulid.Make().String(),
+				Type:    "A",
+				Content: "192.168.0.1",
 			},
 			Zone: Zone{
 				ID:   ulid.Make().String(),
@@ -131,7 +139,7 @@ func TestRecord_ReplaceZone(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error setting up test database: %s", err)
 	}
-	err = db.AutoMigrate(&Record{}, &Zone{})
+	err = db.AutoMigrate(&Record{}, &Zone{}, &ZoneJournal{}, &ZoneChange{})
 	if err != nil {
 		t.Fatalf("Error running the migration: %s", err)
 	}
@@ -176,8 +184,10 @@ func TestRecord_Get(t *testing.T) {
 		{
 			name: "Get with valid ID",
 			record: Record{
-				ID:   ulid.Make().String(),
-				Name: ulid.Make().String(),
+				ID:      ulid.Make().String(),
+				Name:    ulid.Make().String(),
+				Type:    "A",
+				Content: "192.168.0.1",
 			},
 			Zone: Zone{
 				ID:   ulid.Make().String(),
@@ -191,7 +201,7 @@ func TestRecord_Get(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error setting up test database: %s", err)
 	}
-	err = db.AutoMigrate(&Record{}, &Zone{})
+	err = db.AutoMigrate(&Record{}, &Zone{}, &ZoneJournal{}, &ZoneChange{})
 	if err != nil {
 		t.Fatalf("Error running the migration: %s", err)
 	}
@@ -215,3 +225,66 @@ func TestRecord_Get(t *testing.T) {
 		})
 	}
 }
+
+func TestRecord_Validate(t *testing.T) {
+	tests := []struct {
+		name            string
+		record          Record
+		expectedType    string
+		expectedContent string
+		expectedField   string
+	}{
+		{
+			name:            "Valid A record",
+			record:          Record{Type: "a", Content: "192.168.0.1"},
+			expectedType:    "A",
+			expectedContent: "192.168.0.1",
+		},
+		{
+			name:            "MX record is normalised",
+			record:          Record{Type: "MX", Content: "10   mail.martinez.io."},
+			expectedType:    "MX",
+			expectedContent: "10 mail.martinez.io.",
+		},
+		{
+			name:            "Relative target is taken from the origin",
+			record:          Record{Type: "CNAME", Content: "www"},
+			expectedType:    "CNAME",
+			expectedContent: "www.martinez.io.",
+		},
+		{
+			name:          "Unsupported type",
+			record:        Record{Type: "BOGUS", Content: "192.168.0.1"},
+			expectedField: "type",
+		},
+		{
+			name:          "Invalid content",
+			record:        Record{Type: "AAAA", Content: "192.168.0.1"},
+			expectedField: "content",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.record.Validate("martinez.io.")
+			if test.expectedField != "" {
+				var validationErr *rdata.Error
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("Unexpected error: got %v, want a validation error", err)
+				}
+				if validationErr.Field != test.expectedField {
+					t.Errorf("Unexpected field: got %s, want %s", validationErr.Field, test.expectedField)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if test.record.Type != test.expectedType {
+				t.Errorf("Unexpected type: got %s, want %s", test.record.Type, test.expectedType)
+			}
+			if test.record.Content != test.expectedContent {
+				t.Errorf("Unexpected content: got %s, want %s", test.record.Content, test.expectedContent)
+			}
+		})
+	}
+}
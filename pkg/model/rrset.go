@@ -0,0 +1,69 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// RRSet is a read-only view grouping the records of a zone that share the same name and type
+type RRSet struct {
+	ID       string    `jsonapi:"primary,rrsets"`
+	Name     string    `jsonapi:"attribute" json:"name"`
+	Type     string    `jsonapi:"attribute" json:"type"`
+	TTL      int       `jsonapi:"attribute" json:"ttl"`
+	Contents []string  `jsonapi:"attribute" json:"contents"`
+	Records  []*Record `jsonapi:"relationship" json:"records,omitempty"`
+}
+
+// rrsetID returns the identifier of the RRset with the given name and type
+func rrsetID(name, rrtype string) string {
+	return fmt.Sprintf("%s/%s", name, rrtype)
+}
+
+// GroupRRSets groups records into RRsets, records are expected to be sorted by name and type
+func GroupRRSets(records []*Record) (rrsets []*RRSet) {
+	rrsets = make([]*RRSet, 0)
+	var current *RRSet
+	for _, record := range records {
+		if current == nil || current.Name != record.Name || current.Type != record.Type {
+			current = &RRSet{
+				ID:   rrsetID(record.Name, record.Type),
+				Name: record.Name,
+				Type: record.Type,
+				TTL:  record.TTL,
+			}
+			rrsets = append(rrsets, current)
+		}
+		current.Contents = append(current.Contents, record.Content)
+		current.Records = append(current.Records, record)
+	}
+	return rrsets
+}
+
+// RRSets returns the records of the zone grouped by name and type
+func (z *Zone) RRSets(db *gorm.DB) (rrsets []*RRSet, err error) {
+	var records []*Record
+	err = db.Where("zone_id = ?", z.ID).Order("name, type, content").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return GroupRRSets(records), nil
+}
+
+// sortedRecords returns a copy of records sorted by name, type and content
+func sortedRecords(records []*Record) []*Record {
+	sorted := make([]*Record, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		if sorted[i].Type != sorted[j].Type {
+			return sorted[i].Type < sorted[j].Type
+		}
+		return sorted[i].Content < sorted[j].Content
+	})
+	return sorted
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/oklog/ulid/v2"
+)
+
+func TestGroupRRSets(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  []*Record
+		expected []*RRSet
+	}{
+		{
+			name:     "No records",
+			records:  []*Record{},
+			expected: []*RRSet{},
+		},
+		{
+			name: "Records grouped by name and type",
+			records: []*Record{
+				{Name: "www.martinez.io", Type: "A", TTL: 300, Content: "192.168.0.1"},
+				{Name: "www.martinez.io", Type: "A", TTL: 300, Content: "192.168.0.2"},
+				{Name: "www.martinez.io", Type: "AAAA", TTL: 600, Content: "::1"},
+			},
+			expected: []*RRSet{
+				{ID: "www.martinez.io/A", Name: "www.martinez.io", Type: "A", TTL: 300, Contents: []string{"192.168.0.1", "192.168.0.2"}},
+				{ID: "www.martinez.io/AAAA", Name: "www.martinez.io", Type: "AAAA", TTL: 600, Contents: []string{"::1"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rrsets := GroupRRSets(test.records)
+			if len(rrsets) != len(test.expected) {
+				t.Fatalf("Unexpected number of rrsets: got %d, want %d", len(rrsets), len(test.expected))
+			}
+			for pos, rrset := range rrsets {
+				expected := test.expected[pos]
+				if rrset.ID != expected.ID || rrset.TTL != expected.TTL {
+					t.Errorf("Unexpected rrset: got %s/%d, want %s/%d", rrset.ID, rrset.TTL, expected.ID, expected.TTL)
+				}
+				if len(rrset.Contents) != len(expected.Contents) || len(rrset.Records) != len(expected.Contents) {
+					t.Errorf("Unexpected contents: got %v, want %v", rrset.Contents, expected.Contents)
+				}
+			}
+		})
+	}
+}
+
+func TestRecord_RRSetTTL(t *testing.T) {
+	zone := Zone{ID: ulid.Make().String(), Name: "rrset.martinez.io"}
+	first := Record{Name: "www.rrset.martinez.io", Type: "A", TTL: 300, Content: "192.168.0.1", ZoneID: zone.ID}
+	second := Record{Name: "www.rrset.martinez.io", Type: "A", TTL: 600, Content: "192.168.0.2", ZoneID: zone.ID}
+	other := Record{Name: "www.rrset.martinez.io", Type: "AAAA", TTL: 900, Content: "::1", ZoneID: zone.ID}
+
+	db, err := gorm.Open(sqlite.Open("file:rrset_model?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&Record{}, &Zone{}, &ZoneJournal{}, &ZoneChange{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+	for _, record := range []*Record{&first, &second, &other} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("Error creating record: %s", err)
+		}
+	}
+
+	duplicated := Record{Name: "www.rrset.martinez.io", Type: "A", Content: "192.168.0.1", ZoneID: zone.ID}
+	if err := db.Create(&duplicated).Error; err == nil {
+		t.Errorf("Expected duplicated record to fail")
+	}
+
+	rrsets, err := zone.RRSets(db)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(rrsets) != 2 {
+		t.Fatalf("Unexpected number of rrsets: got %d, want %d", len(rrsets), 2)
+	}
+	if rrsets[0].TTL != 600 || len(rrsets[0].Records) != 2 {
+		t.Errorf("Unexpected A rrset: got ttl %d with %d records", rrsets[0].TTL, len(rrsets[0].Records))
+	}
+	for _, record := range rrsets[0].Records {
+		if record.TTL != 600 {
+			t.Errorf("Unexpected TTL for %s: got %d, want %d", record.Content, record.TTL, 600)
+		}
+	}
+	if rrsets[1].TTL != 900 {
+		t.Errorf("Unexpected AAAA TTL: got %d, want %d", rrsets[1].TTL, 900)
+	}
+
+	err = first.Update(db, Record{TTL: 120})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := second.Get(db, false); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if second.TTL != 120 {
+		t.Errorf("Unexpected TTL after update: got %d, want %d", second.TTL, 120)
+	}
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Serial schemes supported by the zones
+const (
+	// SerialIncrement adds one to the serial on every change
+	SerialIncrement = "increment"
+	// SerialDate uses the YYYYMMDDnn format
+	SerialDate = "date"
+	// SerialUnixTime uses the number of seconds since the unix epoch
+	SerialUnixTime = "unixtime"
+)
+
+// ErrInvalidSerialScheme is returned when a zone uses an unknown serial scheme
+var ErrInvalidSerialScheme = errors.New("invalid serial scheme, must be one of increment, date or unixtime")
+
+// ValidSerialScheme reports whether scheme is a known serial scheme
+func ValidSerialScheme(scheme string) bool {
+	switch scheme {
+	case SerialIncrement, SerialDate, SerialUnixTime:
+		return true
+	}
+	return false
+}
+
+// SerialGreater reports whether s1 is greater than s2 using RFC 1982 serial number arithmetic
+func SerialGreater(s1, s2 uint32) bool {
+	return s1 != s2 && s1-s2 < 1<<31
+}
+
+// NextSerial returns the serial following current for the given scheme.
+// Date and time based schemes fall back to an increment when their candidate is not greater than current.
+func NextSerial(current uint32, scheme string, now time.Time) uint32 {
+	var candidate uint32
+	switch scheme {
+	case SerialDate:
+		date, err := strconv.ParseUint(fmt.Sprintf("%s00", now.UTC().Format("20060102")), 10, 32)
+		if err == nil {
+			candidate = uint32(date)
+		}
+	case SerialUnixTime:
+		candidate = uint32(now.Unix())
+	}
+	if candidate != 0 && SerialGreater(candidate, current) {
+		return candidate
+	}
+	return current + 1
+}
+
+// BumpSerial advances the serial of the zone according to its serial scheme
+func (z *Zone) BumpSerial(tx *gorm.DB) (err error) {
+	var current Zone
+	err = tx.Select("id", "serial", "serial_scheme").First(&current, "id = ?", z.ID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	serial := int(NextSerial(uint32(current.Serial), current.SerialScheme, time.Now()))
+	err = tx.Model(&Zone{}).Where("id = ?", z.ID).Update("serial", serial).Error
+	if err != nil {
+		return err
+	}
+	z.Serial = serial
+	return z.Journal(tx, current.Serial)
+}
+
+// bumpZoneSerials advances the serial of every distinct zone in ids
+func bumpZoneSerials(tx *gorm.DB, ids ...string) error {
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if err := (&Zone{ID: id}).BumpSerial(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/oklog/ulid/v2"
+)
+
+func TestSerialGreater(t *testing.T) {
+	tests := []struct {
+		name     string
+		s1       uint32
+		s2       uint32
+		expected bool
+	}{
+		{name: "Equal serials", s1: 1, s2: 1, expected: false},
+		{name: "Simple increment", s1: 2, s2: 1, expected: true},
+		{name: "Simple decrement", s1: 1, s2: 2, expected: false},
+		{name: "Wraparound", s1: 0, s2: 4294967295, expected: true},
+		{name: "Wraparound reversed", s1: 4294967295, s2: 0, expected: false},
+		{name: "Largest increment", s1: 2147483647, s2: 0, expected: true},
+		{name: "Beyond the largest increment", s1: 2147483649, s2: 0, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SerialGreater(test.s1, test.s2); got != test.expected {
+				t.Errorf("SerialGreater(%d, %d) = %t, want %t", test.s1, test.s2, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestNextSerial(t *testing.T) {
+	now := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		current  uint32
+		scheme   string
+		expected uint32
+	}{
+		{name: "Increment", current: 1, scheme: SerialIncrement, expected: 2},
+		{name: "Increment wraps around", current: 4294967295, scheme: SerialIncrement, expected: 0},
+		{name: "Unknown scheme increments", current: 10, scheme: "", expected: 11},
+		{name: "Date from an older day", current: 2023010105, scheme: SerialDate, expected: 2023010200},
+		{name: "Date on the same day", current: 2023010200, scheme: SerialDate, expected: 2023010201},
+		{name: "Date with the counter exhausted", current: 2023010299, scheme: SerialDate, expected: 2023010300},
+		{name: "Date from an increment serial", current: 1, scheme: SerialDate, expected: 2023010200},
+		{name: "Date behind a serial in the future", current: 2024010100, scheme: SerialDate, expected: 2024010101},
+		{name: "Unix time", current: 1, scheme: SerialUnixTime, expected: 1672671845},
+		{name: "Unix time in the same second", current: 1672671845, scheme: SerialUnixTime, expected: 1672671846},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := NextSerial(test.current, test.scheme, now); got != test.expected {
+				t.Errorf("NextSerial(%d, %s) = %d, want %d", test.current, test.scheme, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestValidSerialScheme(t *testing.T) {
+	for _, scheme := range []string{SerialIncrement, SerialDate, SerialUnixTime} {
+		if !ValidSerialScheme(scheme) {
+			t.Errorf("Expected %s to be valid", scheme)
+		}
+	}
+	if ValidSerialScheme("weekly") {
+		t.Errorf("Expected weekly to be invalid")
+	}
+}
+
+func TestZone_SerialOnChanges(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:serial_model?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&Zone{}, &Record{}, &ZoneJournal{}, &ZoneChange{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	zone := Zone{ID: ulid.Make().String(), Name: ulid.Make().String()}
+	other := Zone{ID: ulid.Make().String(), Name: ulid.Make().String()}
+	for _, z := range []*Zone{&zone, &other} {
+		if err := db.Create(z).Error; err != nil {
+			t.Fatalf("Error creating test zone: %s", err)
+		}
+	}
+
+	serialOf := func(z *Zone) int {
+		var current Zone
+		if err := db.First(&current, "id = ?", z.ID).Error; err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		return current.Serial
+	}
+
+	record := Record{Name: "www.serial.martinez.io", Type: "A", Content: "192.168.0.1", ZoneID: zone.ID}
+	steps := []struct {
+		name           string
+		change         func() error
+		expectedSerial int
+		expectedOther  int
+	}{
+		{name: "Create record", change: func() error { return record.Create(db) }, expectedSerial: 2, expectedOther: 1},
+		{name: "Update record", change: func() error { return record.Update(db, Record{Content: "192.168.0.2"}) }, expectedSerial: 3, expectedOther: 1},
+		{name: "Replace zone", change: func() error { return record.ReplaceZone(db, &other) }, expectedSerial: 4, expectedOther: 2},
+		{name: "Add record", change: func() error { return zone.AddRecord(db, &record) }, expectedSerial: 5, expectedOther: 3},
+		{name: "Replace records", change: func() error { return zone.ReplaceRecords(db, []*Record{}) }, expectedSerial: 6, expectedOther: 3},
+		{name: "Update zone", change: func() error { return zone.Update(db, Zone{Refresh: 7200}) }, expectedSerial: 7, expectedOther: 3},
+		{name: "Update zone with serial", change: func() error { return zone.Update(db, Zone{Serial: 100}) }, expectedSerial: 100, expectedOther: 3},
+		{name: "Add record back", change: func() error { return zone.AddRecord(db, &record) }, expectedSerial: 101, expectedOther: 3},
+		{name: "Delete record", change: func() error { return (&Record{ID: record.ID}).Delete(db) }, expectedSerial: 102, expectedOther: 3},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if err := step.change(); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if got := serialOf(&zone); got != step.expectedSerial {
+				t.Errorf("Unexpected serial: got %d, want %d", got, step.expectedSerial)
+			}
+			if got := serialOf(&other); got != step.expectedOther {
+				t.Errorf("Unexpected serial of the other zone: got %d, want %d", got, step.expectedOther)
+			}
+		})
+	}
+}
+
+func TestZone_SerialScheme(t *testing.T) {
+	zone := Zone{SerialScheme: SerialDate}
+	if err := zone.BeforeCreate(nil); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := NextSerial(0, SerialDate, time.Now())
+	if uint32(zone.Serial) != expected {
+		t.Errorf("Unexpected initial serial: got %d, want %d", zone.Serial, expected)
+	}
+
+	zone = Zone{SerialScheme: "weekly"}
+	if err := zone.BeforeCreate(nil); err != ErrInvalidSerialScheme {
+		t.Errorf("Unexpected error: got %v, want %s", err, ErrInvalidSerialScheme)
+	}
+}
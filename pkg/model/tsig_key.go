@@ -0,0 +1,243 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/miekg/dns"
+	"github.com/oklog/ulid/v2"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// tsigAlgorithms maps the TSIG algorithms to the size in bytes of the secrets generated for them
+var tsigAlgorithms = map[string]int{
+	"hmac-sha1":   20,
+	"hmac-sha224": 28,
+	"hmac-sha256": 32,
+	"hmac-sha384": 48,
+	"hmac-sha512": 64,
+}
+
+var (
+	// ErrInvalidTSIGAlgorithm is returned when the algorithm of a key is not supported
+	ErrInvalidTSIGAlgorithm = fmt.Errorf("invalid algorithm, must be one of %s", strings.Join(TSIGAlgorithms(), ", "))
+	// ErrInvalidTSIGName is returned when the name of a key is not a domain name
+	ErrInvalidTSIGName = errors.New("invalid name, must be a domain name")
+	// ErrInvalidTSIGSecret is returned when the secret of a key is not base64 encoded
+	ErrInvalidTSIGSecret = errors.New("invalid secret, must be base64 encoded")
+)
+
+// TSIGKey is a shared secret signing DNS messages. Keys attached to a zone may update it through nsupdate,
+// keys attached to a backend sign the transfers and notifies between port53 and the backend.
+type TSIGKey struct {
+	ID        string         `gorm:"primarykey;not null" jsonapi:"primary,tsig-keys"`
+	CreatedAt time.Time      `jsonapi:"attribute" json:"created_at,omitempty"`
+	UpdatedAt time.Time      `jsonapi:"attribute" json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	// Name of the key, a domain name without the trailing dot
+	Name string `gorm:"uniqueIndex;not null" jsonapi:"attribute" json:"name"`
+	// Algorithm is one of hmac-sha1, hmac-sha224, hmac-sha256, hmac-sha384 or hmac-sha512
+	Algorithm string `gorm:"not null;default:hmac-sha256" jsonapi:"attribute" json:"algorithm"`
+	// Secret is the base64 encoded secret, it is generated on create and only returned then
+	Secret   string     `gorm:"not null" jsonapi:"attribute" json:"secret,omitempty"`
+	Zones    []*Zone    `gorm:"many2many:zone_tsig_keys;" jsonapi:"relationship" json:"zones,omitempty"`
+	Backends []*Backend `gorm:"many2many:backend_tsig_keys;" jsonapi:"relationship" json:"backends,omitempty"`
+	// OrganizationID is the organization owning the key, keys of an organization only reach its zones
+	OrganizationID string `gorm:"index;not null;default:''" json:"-"`
+}
+
+// TSIGAlgorithms returns the sorted list of supported TSIG algorithms
+func TSIGAlgorithms() (algorithms []string) {
+	for algorithm := range tsigAlgorithms {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
+
+// Link returns the link to the resource
+func (k *TSIGKey) Link() *jsonapi.Link {
+	return &jsonapi.Link{
+		Self: fmt.Sprintf("%s/v1/tsig-keys/%s", viper.GetString("serviceUrl"), k.ID),
+	}
+}
+
+// LinkRelation returns the link to the related resource
+func (k *TSIGKey) LinkRelation(relation string) *jsonapi.Link {
+	return &jsonapi.Link{
+		Self:    fmt.Sprintf("%s/v1/tsig-keys/%s/relationships/%s", viper.GetString("serviceUrl"), k.ID, relation),
+		Related: fmt.Sprintf("%s/v1/tsig-keys/%s/%s", viper.GetString("serviceUrl"), k.ID, relation),
+	}
+}
+
+// BeforeCreate generates a new ULID and secret for the key if needed and validates its name and algorithm
+func (k *TSIGKey) BeforeCreate(tx *gorm.DB) (err error) {
+	if k.ID == "" {
+		k.ID = ulid.Make().String()
+	} else {
+		_, err = ulid.Parse(k.ID)
+		if err != nil {
+			return err
+		}
+	}
+	if k.Algorithm == "" {
+		k.Algorithm = "hmac-sha256"
+	}
+	err = k.Validate()
+	if err != nil {
+		return err
+	}
+	if k.Secret != "" {
+		return nil
+	}
+	secret := make([]byte, tsigAlgorithms[k.Algorithm])
+	_, err = rand.Read(secret)
+	if err != nil {
+		return err
+	}
+	k.Secret = base64.StdEncoding.EncodeToString(secret)
+	return nil
+}
+
+// Validate checks the name, algorithm and secret of the key, normalising the name and algorithm
+func (k *TSIGKey) Validate() error {
+	name := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(k.Name)), ".")
+	// Names end up quoted in the configuration of the DNS servers, characters breaking it out are refused
+	if _, ok := dns.IsDomainName(name); !ok || name == "" || strings.ContainsAny(name, " \t\"\\;{}()") {
+		return ErrInvalidTSIGName
+	}
+	algorithm := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(k.Algorithm)), ".")
+	if _, ok := tsigAlgorithms[algorithm]; !ok {
+		return ErrInvalidTSIGAlgorithm
+	}
+	if k.Secret != "" {
+		if _, err := base64.StdEncoding.DecodeString(k.Secret); err != nil {
+			return ErrInvalidTSIGSecret
+		}
+	}
+	k.Name, k.Algorithm = name, algorithm
+	return nil
+}
+
+// Get the key
+func (k *TSIGKey) Get(db *gorm.DB, preload bool) (err error) {
+	if preload {
+		return db.Preload("Zones").Preload("Backends").First(k, "id = ?", k.ID).Error
+	}
+	return db.First(k, "id = ?", k.ID).Error
+}
+
+// FindTSIGKey returns the key with the given name, with or without its trailing dot
+func FindTSIGKey(db *gorm.DB, name string) (key *TSIGKey, err error) {
+	key = &TSIGKey{}
+	// Names are looked up for every signed message, Find doesn't log the keys missing from the database
+	result := db.Limit(1).Find(key, "name = ?", strings.TrimSuffix(strings.ToLower(name), "."))
+	if result.Error == nil && result.RowsAffected == 0 {
+		return key, gorm.ErrRecordNotFound
+	}
+	return key, result.Error
+}
+
+// Update renames the key, the algorithm and secret of a key can't be changed
+func (k *TSIGKey) Update(db *gorm.DB, key TSIGKey) (err error) {
+	updated := TSIGKey{Name: key.Name, Algorithm: "hmac-sha256"}
+	err = updated.Validate()
+	if err != nil {
+		return err
+	}
+	err = db.Model(k).Updates(TSIGKey{Name: updated.Name}).Error
+	if err != nil {
+		return err
+	}
+	return db.First(k, "id = ?", k.ID).Error
+}
+
+// Delete the key along with its grants
+func (k *TSIGKey) Delete(db *gorm.DB) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("tsig_key_id = ?", k.ID).Delete(&Grant{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&k).Error
+	})
+}
+
+// AddZone allows the key to update the zone
+func (k *TSIGKey) AddZone(db *gorm.DB, zone *Zone) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(k).Association("Zones").Append(zone)
+	})
+}
+
+// RemoveZone revokes the permission of the key to update the zone
+func (k *TSIGKey) RemoveZone(db *gorm.DB, zone *Zone) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(k).Association("Zones").Delete(zone)
+	})
+}
+
+// ReplaceZones replaces the zones the key may update
+func (k *TSIGKey) ReplaceZones(db *gorm.DB, zones []*Zone) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(k).Association("Zones").Replace(zones)
+	})
+}
+
+// AddBackend attaches the key to the backend
+func (k *TSIGKey) AddBackend(db *gorm.DB, backend *Backend) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(k).Association("Backends").Append(backend)
+	})
+}
+
+// RemoveBackend detaches the key from the backend
+func (k *TSIGKey) RemoveBackend(db *gorm.DB, backend *Backend) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(k).Association("Backends").Delete(backend)
+	})
+}
+
+// ReplaceBackends replaces the backends the key is attached to
+func (k *TSIGKey) ReplaceBackends(db *gorm.DB, backends []*Backend) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(k).Association("Backends").Replace(backends)
+	})
+}
+
+// AllowsZone reports whether the key is attached to the zone
+func (k *TSIGKey) AllowsZone(db *gorm.DB, zone *Zone) (bool, error) {
+	var count int64
+	err := db.Table("zone_tsig_keys").Where("tsig_key_id = ? AND zone_id = ?", k.ID, zone.ID).Count(&count).Error
+	return count > 0, err
+}
+
+// AllowsTransfer reports whether the key may transfer the zone, the key being attached to the zone or to one of its backends
+func (k *TSIGKey) AllowsTransfer(db *gorm.DB, zone *Zone) (bool, error) {
+	allowed, err := k.AllowsZone(db, zone)
+	if err != nil || allowed {
+		return allowed, err
+	}
+	var count int64
+	err = db.Table("backend_tsig_keys").
+		Joins("JOIN backend_zones ON backend_zones.backend_id = backend_tsig_keys.backend_id").
+		Where("backend_tsig_keys.tsig_key_id = ? AND backend_zones.zone_id = ?", k.ID, zone.ID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// TSIGKeys returns the keys attached to the backend, secrets included
+func (b *Backend) TSIGKeys(db *gorm.DB) (keys []*TSIGKey, err error) {
+	err = db.Joins("JOIN backend_tsig_keys ON backend_tsig_keys.tsig_key_id = tsig_keys.id").
+		Where("backend_tsig_keys.backend_id = ?", b.ID).
+		Order("tsig_keys.name").
+		Find(&keys).Error
+	return keys, err
+}
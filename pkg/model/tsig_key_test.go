@@ -0,0 +1,180 @@
+package model
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/oklog/ulid/v2"
+)
+
+func TestTSIGKey_BeforeCreate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:tsig_key_create?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&TSIGKey{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	tests := []struct {
+		name       string
+		key        TSIGKey
+		algorithm  string
+		secretSize int
+		err        error
+	}{
+		{
+			name:       "Default algorithm",
+			key:        TSIGKey{Name: "Update.Martinez.io."},
+			algorithm:  "hmac-sha256",
+			secretSize: 32,
+		},
+		{
+			name:       "Explicit algorithm",
+			key:        TSIGKey{Name: "transfer.martinez.io", Algorithm: "HMAC-SHA512."},
+			algorithm:  "hmac-sha512",
+			secretSize: 64,
+		},
+		{
+			name:       "Given secret",
+			key:        TSIGKey{Name: "imported.martinez.io", Secret: base64.StdEncoding.EncodeToString([]byte("secret"))},
+			algorithm:  "hmac-sha256",
+			secretSize: 6,
+		},
+		{
+			name: "Invalid algorithm",
+			key:  TSIGKey{Name: "md5.martinez.io", Algorithm: "hmac-md5"},
+			err:  ErrInvalidTSIGAlgorithm,
+		},
+		{
+			name: "Invalid name",
+			key:  TSIGKey{Name: ""},
+			err:  ErrInvalidTSIGName,
+		},
+		{
+			name: "Invalid secret",
+			key:  TSIGKey{Name: "broken.martinez.io", Secret: "not base64!"},
+			err:  ErrInvalidTSIGSecret,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key := test.key
+			err := db.Create(&key).Error
+			if err != test.err {
+				t.Fatalf("Unexpected error: got %v, want %v", err, test.err)
+			}
+			if test.err != nil {
+				return
+			}
+			if _, err := ulid.Parse(key.ID); err != nil {
+				t.Errorf("Invalid ID: %s", key.ID)
+			}
+			if key.Algorithm != test.algorithm {
+				t.Errorf("Unexpected algorithm: got %s, want %s", key.Algorithm, test.algorithm)
+			}
+			secret, err := base64.StdEncoding.DecodeString(key.Secret)
+			if err != nil || len(secret) != test.secretSize {
+				t.Errorf("Unexpected secret %q: %v", key.Secret, err)
+			}
+		})
+	}
+
+	key, err := FindTSIGKey(db, "update.martinez.io.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if key.Name != "update.martinez.io" {
+		t.Errorf("Unexpected name: %s", key.Name)
+	}
+}
+
+func TestTSIGKey_Attachments(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:tsig_key_attachments?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = SetupJoinTables(db)
+	if err != nil {
+		t.Fatalf("Error setting up the join tables: %s", err)
+	}
+	err = db.AutoMigrate(&Backend{}, &Zone{}, &Record{}, &TSIGKey{}, &ZoneJournal{}, &ZoneChange{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	key := TSIGKey{Name: "update.martinez.io"}
+	backend := Backend{Name: ulid.Make().String()}
+	zone := Zone{Name: ulid.Make().String()}
+	other := Zone{Name: ulid.Make().String()}
+	for _, value := range []interface{}{&key, &backend, &zone, &other} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatalf("Error creating fixture: %s", err)
+		}
+	}
+
+	if err := key.AddZone(db, &zone); err != nil {
+		t.Fatalf("Error adding zone: %s", err)
+	}
+	for _, test := range []struct {
+		zone    *Zone
+		allowed bool
+	}{{&zone, true}, {&other, false}} {
+		allowed, err := key.AllowsZone(db, test.zone)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if allowed != test.allowed {
+			t.Errorf("Unexpected permission on %s: got %t, want %t", test.zone.Name, allowed, test.allowed)
+		}
+	}
+	if err := key.ReplaceZones(db, []*Zone{&other}); err != nil {
+		t.Fatalf("Error replacing zones: %s", err)
+	}
+	if allowed, _ := key.AllowsZone(db, &zone); allowed {
+		t.Errorf("Zone %s is still allowed after being replaced", zone.Name)
+	}
+
+	if err := key.AddBackend(db, &backend); err != nil {
+		t.Fatalf("Error adding backend: %s", err)
+	}
+	keys, err := backend.TSIGKeys(db)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(keys) != 1 || keys[0].ID != key.ID || keys[0].Secret != key.Secret {
+		t.Errorf("Unexpected keys: %+v", keys)
+	}
+	if allowed, _ := key.AllowsTransfer(db, &zone); allowed {
+		t.Errorf("Zone %s may be transferred before being added to the backend", zone.Name)
+	}
+	if err := backend.AddZone(db, &zone); err != nil {
+		t.Fatalf("Error adding zone to the backend: %s", err)
+	}
+	for _, z := range []*Zone{&zone, &other} {
+		if allowed, err := key.AllowsTransfer(db, z); err != nil || !allowed {
+			t.Errorf("Unexpected transfer permission on %s: %t, %v", z.Name, allowed, err)
+		}
+	}
+	if err := key.RemoveBackend(db, &backend); err != nil {
+		t.Fatalf("Error removing backend: %s", err)
+	}
+	keys, err = backend.TSIGKeys(db)
+	if err != nil || len(keys) != 0 {
+		t.Errorf("Unexpected keys after removal: %+v, %v", keys, err)
+	}
+
+	if err := key.Update(db, TSIGKey{Name: "Renamed.martinez.io."}); err != nil {
+		t.Fatalf("Error updating key: %s", err)
+	}
+	if key.Name != "renamed.martinez.io" {
+		t.Errorf("Unexpected name after update: %s", key.Name)
+	}
+	if err := key.Update(db, TSIGKey{Name: "not a name"}); err != ErrInvalidTSIGName {
+		t.Errorf("Unexpected error renaming the key: %v", err)
+	}
+}
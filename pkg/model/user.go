@@ -0,0 +1,202 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/DataDog/jsonapi"
+	"github.com/oklog/ulid/v2"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// MinPasswordLength is the minimum number of characters of a password
+const MinPasswordLength = 8
+
+var (
+	// ErrInvalidUserName is returned when the name of a user is empty or holds spaces
+	ErrInvalidUserName = errors.New("invalid name, must be a non empty string without spaces")
+	// ErrInvalidEmail is returned when the email of a user is not an email address
+	ErrInvalidEmail = errors.New("invalid email, must be an email address")
+	// ErrInvalidPassword is returned when a password is too short
+	ErrInvalidPassword = fmt.Errorf("invalid password, must be at least %d characters long", MinPasswordLength)
+)
+
+// User is a person managing zones through the API. Passwords are only kept as bcrypt hashes for the
+// interactive login, the zones of a user are the zones they own.
+type User struct {
+	ID        string         `gorm:"primarykey;not null" jsonapi:"primary,users"`
+	CreatedAt time.Time      `jsonapi:"attribute" json:"created_at,omitempty"`
+	UpdatedAt time.Time      `jsonapi:"attribute" json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	// Name is the login of the user
+	Name  string `gorm:"uniqueIndex;not null" jsonapi:"attribute" json:"name"`
+	Email string `gorm:"uniqueIndex;not null" jsonapi:"attribute" json:"email"`
+	// Password is only read from requests, it is hashed into PasswordHash on create and update
+	Password     string  `gorm:"-" jsonapi:"attribute" json:"password,omitempty"`
+	PasswordHash string  `gorm:"not null" json:"-"`
+	Zones        []*Zone `gorm:"many2many:user_zones;" jsonapi:"relationship" json:"zones,omitempty"`
+	// OrganizationID is the organization of the user, users without organization operate port53
+	OrganizationID string `gorm:"index;not null;default:''" json:"-"`
+}
+
+// Link returns the link to the resource
+func (u *User) Link() *jsonapi.Link {
+	return &jsonapi.Link{
+		Self: fmt.Sprintf("%s/v1/users/%s", viper.GetString("serviceUrl"), u.ID),
+	}
+}
+
+// LinkRelation returns the link to the related resource
+func (u *User) LinkRelation(relation string) *jsonapi.Link {
+	return &jsonapi.Link{
+		Self:    fmt.Sprintf("%s/v1/users/%s/relationships/%s", viper.GetString("serviceUrl"), u.ID, relation),
+		Related: fmt.Sprintf("%s/v1/users/%s/%s", viper.GetString("serviceUrl"), u.ID, relation),
+	}
+}
+
+// BeforeCreate generates a new ULID for the user if needed, validates it and hashes its password
+func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
+	if u.ID == "" {
+		u.ID = ulid.Make().String()
+	} else {
+		_, err = ulid.Parse(u.ID)
+		if err != nil {
+			return err
+		}
+	}
+	err = u.Validate()
+	if err != nil {
+		return err
+	}
+	if u.Password == "" {
+		return nil
+	}
+	return u.SetPassword(u.Password)
+}
+
+// Validate checks the name and email of the user, normalising both
+func (u *User) Validate() error {
+	name := strings.ToLower(strings.TrimSpace(u.Name))
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return ErrInvalidUserName
+	}
+	email := strings.ToLower(strings.TrimSpace(u.Email))
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return ErrInvalidEmail
+	}
+	u.Name, u.Email = name, email
+	return nil
+}
+
+// SetPassword hashes password into the password hash of the user, the password itself is cleared
+func (u *User) SetPassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.Password, u.PasswordHash = "", string(hash)
+	return nil
+}
+
+// CheckPassword reports whether password is the password of the user, users without password can't log in
+func (u *User) CheckPassword(password string) bool {
+	if u.PasswordHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// Get the user
+func (u *User) Get(db *gorm.DB, preload bool) (err error) {
+	if preload {
+		return db.Preload("Zones").First(u, "id = ?", u.ID).Error
+	}
+	return db.First(u, "id = ?", u.ID).Error
+}
+
+// FindUser returns the user with the given name
+func FindUser(db *gorm.DB, name string) (user *User, err error) {
+	user = &User{}
+	err = db.First(user, "name = ?", strings.ToLower(strings.TrimSpace(name))).Error
+	return user, err
+}
+
+// Update changes the name, email and password of the user, the fields left empty are kept
+func (u *User) Update(db *gorm.DB, user User) (err error) {
+	err = db.First(u, "id = ?", u.ID).Error
+	if err != nil {
+		return err
+	}
+	updated := User{Name: u.Name, Email: u.Email, PasswordHash: u.PasswordHash}
+	if user.Name != "" {
+		updated.Name = user.Name
+	}
+	if user.Email != "" {
+		updated.Email = user.Email
+	}
+	err = updated.Validate()
+	if err != nil {
+		return err
+	}
+	if user.Password != "" {
+		err = updated.SetPassword(user.Password)
+		if err != nil {
+			return err
+		}
+	}
+	err = db.Model(u).Select("name", "email", "password_hash", "updated_at").Updates(updated).Error
+	if err != nil {
+		return err
+	}
+	return db.First(u, "id = ?", u.ID).Error
+}
+
+// Delete the user along with its API keys, grants and zone ownerships. Users are removed for good, a soft
+// deleted user would keep its name and email taken in their unique indexes.
+func (u *User) Delete(db *gorm.DB) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("user_id = ?", u.ID).Delete(&APIKey{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Where("user_id = ?", u.ID).Delete(&Grant{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(u).Association("Zones").Clear()
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(u).Error
+	})
+}
+
+// AddZone makes the user an owner of the zone
+func (u *User) AddZone(db *gorm.DB, zone *Zone) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(u).Association("Zones").Append(zone)
+	})
+}
+
+// RemoveZone removes the zone from the zones the user owns
+func (u *User) RemoveZone(db *gorm.DB, zone *Zone) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(u).Association("Zones").Delete(zone)
+	})
+}
+
+// ReplaceZones replaces the zones the user owns
+func (u *User) ReplaceZones(db *gorm.DB, zones []*Zone) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(u).Association("Zones").Replace(zones)
+	})
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestUser_BeforeCreate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:user_create?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&User{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		user  User
+		email string
+		err   error
+	}{
+		{
+			name:  "Valid user",
+			user:  User{Name: "Juliano", Email: "Juliano@Martinez.io", Password: "correct horse"},
+			email: "juliano@martinez.io",
+		},
+		{
+			name:  "User without password",
+			user:  User{Name: "robot", Email: "robot@martinez.io"},
+			email: "robot@martinez.io",
+		},
+		{
+			name: "Invalid name",
+			user: User{Name: "juliano martinez", Email: "jm@martinez.io"},
+			err:  ErrInvalidUserName,
+		},
+		{
+			name: "Invalid email",
+			user: User{Name: "nomail", Email: "Juliano <juliano@martinez.io>"},
+			err:  ErrInvalidEmail,
+		},
+		{
+			name: "Short password",
+			user: User{Name: "short", Email: "short@martinez.io", Password: "secret"},
+			err:  ErrInvalidPassword,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			password := test.user.Password
+			err := db.Create(&test.user).Error
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Unexpected error: got %v, want %v", err, test.err)
+			}
+			if test.err != nil {
+				return
+			}
+			if test.user.Email != test.email {
+				t.Errorf("Unexpected email: got %s, want %s", test.user.Email, test.email)
+			}
+			if test.user.Password != "" {
+				t.Errorf("Expected the password to be cleared once hashed")
+			}
+			var stored User
+			if err := db.First(&stored, "id = ?", test.user.ID).Error; err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if password == "" {
+				if stored.CheckPassword("") {
+					t.Errorf("Expected users without password not to log in")
+				}
+				return
+			}
+			if stored.PasswordHash == password || !stored.CheckPassword(password) {
+				t.Errorf("Expected the password to be stored hashed")
+			}
+			if stored.CheckPassword("wrong password") {
+				t.Errorf("Expected a wrong password to be refused")
+			}
+		})
+	}
+}
+
+func TestUser_Update(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:user_update?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&User{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	user := User{Name: "juliano", Email: "juliano@martinez.io", Password: "correct horse"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Error creating test user: %s", err)
+	}
+	if err := user.Update(db, User{Email: "jm@martinez.io"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if user.Name != "juliano" || user.Email != "jm@martinez.io" || !user.CheckPassword("correct horse") {
+		t.Errorf("Expected only the email to change, got %+v", user)
+	}
+	if err := user.Update(db, User{Password: "battery staple"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !user.CheckPassword("battery staple") || user.CheckPassword("correct horse") {
+		t.Errorf("Expected the password to change")
+	}
+	if err := user.Update(db, User{Password: "short"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Unexpected error: got %v, want %v", err, ErrInvalidPassword)
+	}
+}
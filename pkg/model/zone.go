@@ -15,7 +15,7 @@ type Zone struct {
 	CreatedAt time.Time      `jsonapi:"attribute" json:"created_at,omitempty"`
 	UpdatedAt time.Time      `jsonapi:"attribute" json:"updated_at,omitempty"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	Name      string         `gorm:"uniqueIndex;not null" jsonapi:"attribute" json:"name"`
+	Name      string         `gorm:"uniqueIndex:idx_zones_organization_name;not null" jsonapi:"attribute" json:"name"`
 	TTL       int            `gorm:"default:3600" jsonapi:"attribute" json:"ttl"`
 	MName     string         `gorm:"default:@;not null" jsonapi:"attribute" json:"mname"`
 	RName     string         `gorm:"default:admin;not null" jsonapi:"attribute" json:"rname"`
@@ -24,8 +24,12 @@ type Zone struct {
 	Retry     int            `gorm:"default:600" jsonapi:"attribute" json:"retry"`
 	Expire    int            `gorm:"default:604800" jsonapi:"attribute" json:"expire"`
 	Minimum   int            `gorm:"default:3600" jsonapi:"attribute" json:"minimum"`
-	Records   []*Record      `gorm:"foreignKey:ZoneID" jsonapi:"relationship" json:"records,omitempty"`
-	Backends  []*Backend     `gorm:"many2many:backend_zones;" jsonapi:"relationship" json:"backends,omitempty"`
+	// SerialScheme defines how the serial is advanced on changes, one of increment, date or unixtime
+	SerialScheme string     `gorm:"default:increment;not null" jsonapi:"attribute" json:"serial_scheme"`
+	Records      []*Record  `gorm:"foreignKey:ZoneID" jsonapi:"relationship" json:"records,omitempty"`
+	Backends     []*Backend `gorm:"many2many:backend_zones;" jsonapi:"relationship" json:"backends,omitempty"`
+	// OrganizationID is the organization owning the zone, names are only unique within an organization
+	OrganizationID string `gorm:"uniqueIndex:idx_zones_organization_name,priority:1;not null;default:''" json:"-"`
 }
 
 // Link returns the link to the resource
@@ -43,14 +47,36 @@ func (z *Zone) LinkRelation(relation string) *jsonapi.Link {
 	}
 }
 
-// BeforeCreate generates a new ULID for the zone if needed
+// BeforeCreate generates a new ULID for the zone if needed and sets the initial serial of its scheme
 func (z *Zone) BeforeCreate(tx *gorm.DB) (err error) {
 	if z.ID == "" {
 		z.ID = ulid.Make().String()
 	} else {
 		_, err = ulid.Parse(z.ID)
+		if err != nil {
+			return err
+		}
+	}
+	if z.SerialScheme == "" {
+		return nil
+	}
+	if !ValidSerialScheme(z.SerialScheme) {
+		return ErrInvalidSerialScheme
+	}
+	if z.Serial == 0 && z.SerialScheme != SerialIncrement {
+		z.Serial = int(NextSerial(0, z.SerialScheme, time.Now()))
+	}
+	return nil
+}
+
+// AfterCreate checks the zone quota of the organization of the zone. The records created with the zone are where
+// its journal starts, they aren't changes.
+func (z *Zone) AfterCreate(tx *gorm.DB) (err error) {
+	err = checkZoneQuota(tx, z.OrganizationID, 0)
+	if err != nil {
+		return err
 	}
-	return err
+	return tx.Where("zone_id = ?", z.ID).Delete(&ZoneChange{}).Error
 }
 
 // Get a zone
@@ -61,14 +87,37 @@ func (z *Zone) Get(db *gorm.DB, preload bool) (err error) {
 	return db.First(z, "id = ?", z.ID).Error
 }
 
-// Update a zone
+// Update a zone, the serial is advanced unless the update sets it. A renamed zone must not take the name of
+// another zone of its backends.
 func (z *Zone) Update(db *gorm.DB, zone Zone) (err error) {
+	if zone.SerialScheme != "" && !ValidSerialScheme(zone.SerialScheme) {
+		return ErrInvalidSerialScheme
+	}
 	return db.Transaction(func(tx *gorm.DB) error {
+		var previous Zone
+		err = tx.Select("serial").First(&previous, "id = ?", z.ID).Error
+		if err != nil {
+			return err
+		}
 		err = tx.Model(z).Updates(zone).Error
 		if err != nil {
 			return err
 		}
-		return nil
+		var backendIDs []string
+		err = tx.Table("backend_zones").Where("zone_id = ?", z.ID).Pluck("backend_id", &backendIDs).Error
+		if err != nil {
+			return err
+		}
+		for _, backendID := range backendIDs {
+			err = checkAssignment(tx, backendID, z.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if zone.Serial != 0 {
+			return z.Journal(tx, previous.Serial)
+		}
+		return z.BumpSerial(tx)
 	})
 }
 
@@ -77,9 +126,13 @@ func (z *Zone) Delete(db *gorm.DB) (err error) {
 	return db.Delete(&z).Error
 }
 
-// AddBackend adds a zone to the zone
+// AddBackend adds a zone to the zone, the backend must reach the zone and not serve another zone of its name
 func (z *Zone) AddBackend(db *gorm.DB, backend *Backend) (err error) {
 	return db.Transaction(func(tx *gorm.DB) error {
+		err := checkAssignment(tx, backend.ID, z.ID)
+		if err != nil {
+			return err
+		}
 		return tx.Model(z).Association("Backends").Append(backend)
 	})
 }
@@ -94,27 +147,182 @@ func (z *Zone) RemoveBackend(db *gorm.DB, backend *Backend) (err error) {
 // ReplaceBackends replaces all backends of the zone
 func (z *Zone) ReplaceBackends(db *gorm.DB, backends []*Backend) (err error) {
 	return db.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(z).Association("Backends").Replace(backends)
+		err := tx.Model(z).Association("Backends").Replace(backends)
+		if err != nil {
+			return err
+		}
+		for _, backend := range backends {
+			err = checkAssignment(tx, backend.ID, z.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 }
 
-// AddRecord adds a record to the zone
+// AddRecord adds a record to the zone, an existing record is moved from its zone
 func (z *Zone) AddRecord(db *gorm.DB, record *Record) (err error) {
 	return db.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(z).Association("Records").Append(record)
+		previousZoneID, err := z.addRecord(tx, record)
+		if err != nil {
+			return err
+		}
+		return bumpZoneSerials(tx, z.ID, previousZoneID)
 	})
 }
 
-// RemoveRecord removes a record from the zone
+// addRecord creates the record in the zone or moves it there when it exists, it returns the zone the record
+// was moved from
+func (z *Zone) addRecord(tx *gorm.DB, record *Record) (previousZoneID string, err error) {
+	if record.ID != "" {
+		var existing Record
+		result := tx.Limit(1).Find(&existing, "id = ?", record.ID)
+		if result.Error != nil {
+			return "", result.Error
+		}
+		if result.RowsAffected > 0 {
+			*record = existing
+			return existing.ZoneID, record.moveZone(tx, z.ID)
+		}
+	}
+	record.ZoneID = z.ID
+	return "", tx.Create(record).Error
+}
+
+// RemoveRecord removes a record from the zone, the record is kept without zone
 func (z *Zone) RemoveRecord(db *gorm.DB, record *Record) (err error) {
 	return db.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(z).Association("Records").Delete(record)
+		var records []*Record
+		err = tx.Where("id = ? AND zone_id = ?", record.ID, z.ID).Find(&records).Error
+		if err != nil {
+			return err
+		}
+		err = removeRecords(tx, records)
+		if err != nil {
+			return err
+		}
+		return z.BumpSerial(tx)
 	})
 }
 
-// ReplaceRecords replaces all records of the zone
+// ReplaceRecords replaces all records of the zone, the records left out are kept without zone
 func (z *Zone) ReplaceRecords(db *gorm.DB, records []*Record) (err error) {
 	return db.Transaction(func(tx *gorm.DB) error {
-		return tx.Model(z).Association("Records").Replace(records)
+		var existing []*Record
+		err = tx.Where("zone_id = ?", z.ID).Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		zoneIDs := []string{z.ID}
+		kept := make(map[string]bool, len(records))
+		for _, record := range records {
+			previousZoneID, err := z.addRecord(tx, record)
+			if err != nil {
+				return err
+			}
+			zoneIDs = append(zoneIDs, previousZoneID)
+			kept[record.ID] = true
+		}
+		var removed []*Record
+		for _, record := range existing {
+			if !kept[record.ID] {
+				removed = append(removed, record)
+			}
+		}
+		err = removeRecords(tx, removed)
+		if err != nil {
+			return err
+		}
+		return bumpZoneSerials(tx, zoneIDs...)
+	})
+}
+
+// removeRecords removes the records from their zone, the records are kept without zone
+func removeRecords(tx *gorm.DB, records []*Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	err := tx.Model(&Record{}).Where("id IN ?", ids).Update("zone_id", nil).Error
+	if err != nil {
+		return err
+	}
+	return journalChange(tx, true, records...)
+}
+
+// Import sets the SOA fields and records of the zone from an imported zone in a single transaction.
+// When merge is false every existing record is replaced, otherwise only the RRsets found in the import are.
+// The imported serial is kept when it is greater than the current one, otherwise the current serial is advanced.
+func (z *Zone) Import(db *gorm.DB, imported *Zone, merge bool) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		current, err := z.importSOA(tx, imported)
+		if err != nil {
+			return err
+		}
+
+		if merge {
+			for _, rrset := range GroupRRSets(sortedRecords(imported.Records)) {
+				err = deleteRecords(tx, "zone_id = ? AND name = ? AND type = ?", z.ID, rrset.Name, rrset.Type)
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			err = deleteRecords(tx, "zone_id = ?", z.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, record := range imported.Records {
+			record.ID = ""
+			record.ZoneID = z.ID
+		}
+		if len(imported.Records) > 0 {
+			err = tx.Create(imported.Records).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return z.importSerial(tx, current, imported)
 	})
 }
+
+// importSOA sets the SOA fields of the zone from an imported zone and returns the zone as it was before
+func (z *Zone) importSOA(tx *gorm.DB, imported *Zone) (current Zone, err error) {
+	err = tx.First(&current, "id = ?", z.ID).Error
+	if err != nil {
+		return current, err
+	}
+	err = tx.Model(z).Select("TTL", "MName", "RName", "Serial", "Refresh", "Retry", "Expire", "Minimum").Updates(Zone{
+		TTL:     imported.TTL,
+		MName:   imported.MName,
+		RName:   imported.RName,
+		Serial:  imported.Serial,
+		Refresh: imported.Refresh,
+		Retry:   imported.Retry,
+		Expire:  imported.Expire,
+		Minimum: imported.Minimum,
+	}).Error
+	return current, err
+}
+
+// importSerial keeps the imported serial when it is greater than the current one, otherwise the current serial
+// is advanced, and journals the import
+func (z *Zone) importSerial(tx *gorm.DB, current Zone, imported *Zone) error {
+	if SerialGreater(uint32(imported.Serial), uint32(current.Serial)) {
+		return z.Journal(tx, current.Serial)
+	}
+	serial := int(NextSerial(uint32(current.Serial), current.SerialScheme, time.Now()))
+	err := tx.Model(z).Update("serial", serial).Error
+	if err != nil {
+		return err
+	}
+	z.Serial = serial
+	return z.Journal(tx, current.Serial)
+}
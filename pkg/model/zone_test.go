@@ -90,7 +90,7 @@ func TestZone_Delete(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error setting up test database: %s", err)
 	}
-	err = db.AutoMigrate(&Zone{})
+	err = db.AutoMigrate(&Zone{}, &ZoneJournal{}, &ZoneChange{})
 	if err != nil {
 		t.Fatalf("Error running the migration: %s", err)
 	}
@@ -158,7 +158,7 @@ func TestZone_Get(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Error setting up test database: %s", err)
 			}
-			err = db.AutoMigrate(&Zone{}, &Record{})
+			err = db.AutoMigrate(&Zone{}, &Record{}, &ZoneJournal{}, &ZoneChange{})
 			if err != nil {
 				t.Fatalf("Error running the migration: %s", err)
 			}
@@ -206,3 +206,79 @@ func TestZone_Get(t *testing.T) {
 		})
 	}
 }
+
+func TestZone_Import(t *testing.T) {
+	tests := []struct {
+		name            string
+		merge           bool
+		imported        []*Record
+		expectedRecords map[string]int
+	}{
+		{
+			name:  "Replace all records",
+			merge: false,
+			imported: []*Record{
+				{Name: "www.import.martinez.io", Type: "A", TTL: 300, Content: "192.168.0.2"},
+			},
+			expectedRecords: map[string]int{"www.import.martinez.io/A": 1},
+		},
+		{
+			name:  "Merge records",
+			merge: true,
+			imported: []*Record{
+				{Name: "www.import.martinez.io", Type: "A", TTL: 300, Content: "192.168.0.2"},
+				{Name: "www.import.martinez.io", Type: "A", TTL: 300, Content: "192.168.0.3"},
+			},
+			expectedRecords: map[string]int{"www.import.martinez.io/A": 2, "mail.import.martinez.io/A": 1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := gorm.Open(sqlite.Open("file:zone_import_model?mode=memory&cache=shared"), &gorm.Config{})
+			if err != nil {
+				t.Fatalf("Error setting up test database: %s", err)
+			}
+			err = db.AutoMigrate(&Zone{}, &Record{}, &ZoneJournal{}, &ZoneChange{})
+			if err != nil {
+				t.Fatalf("Error running the migration: %s", err)
+			}
+			zone := Zone{ID: ulid.Make().String(), Name: ulid.Make().String()}
+			if err := db.Create(&zone).Error; err != nil {
+				t.Fatalf("Error creating test zone: %s", err)
+			}
+			existing := []*Record{
+				{Name: "www.import.martinez.io", Type: "A", Content: "192.168.0.1", ZoneID: zone.ID},
+				{Name: "mail.import.martinez.io", Type: "A", Content: "192.168.0.1", ZoneID: zone.ID},
+			}
+			if err := db.Create(existing).Error; err != nil {
+				t.Fatalf("Error creating test records: %s", err)
+			}
+
+			imported := &Zone{MName: "ns1.import.martinez.io", RName: "hostmaster.import.martinez.io", Serial: 2023010101, Refresh: 7200, Retry: 900, Expire: 1209600, Minimum: 300, TTL: 600, Records: test.imported}
+			err = zone.Import(db, imported, test.merge)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			err = zone.Get(db, false)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if zone.Serial != 2023010101 || zone.MName != "ns1.import.martinez.io" || zone.Minimum != 300 {
+				t.Errorf("Unexpected SOA fields: got %d %s %d", zone.Serial, zone.MName, zone.Minimum)
+			}
+			rrsets, err := zone.RRSets(db)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if len(rrsets) != len(test.expectedRecords) {
+				t.Fatalf("Unexpected number of rrsets: got %d, want %d", len(rrsets), len(test.expectedRecords))
+			}
+			for _, rrset := range rrsets {
+				if len(rrset.Records) != test.expectedRecords[rrset.ID] {
+					t.Errorf("Unexpected number of records for %s: got %d, want %d", rrset.ID, len(rrset.Records), test.expectedRecords[rrset.ID])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package model
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// ZoneTransfer is an AXFR of a zone from a primary server reconciled into the records of the zone. It isn't
+// stored, the response to the transfer reports the RRsets it added, changed and removed.
+type ZoneTransfer struct {
+	ID string `jsonapi:"primary,zone-transfers"`
+	// Primary is the host:port the zone is transferred from, port 53 unless set
+	Primary string `jsonapi:"attribute" json:"primary"`
+	// TSIGKey is the name of the key signing the transfer, the transfer isn't signed when empty
+	TSIGKey string `jsonapi:"attribute" json:"tsig_key,omitempty"`
+	// Serial of the zone after the transfer
+	Serial  int            `jsonapi:"attribute" json:"serial"`
+	Added   []*RRSetChange `jsonapi:"attribute" json:"added"`
+	Changed []*RRSetChange `jsonapi:"attribute" json:"changed"`
+	Removed []*RRSetChange `jsonapi:"attribute" json:"removed"`
+	Zone    *Zone          `jsonapi:"relationship" json:"zone,omitempty"`
+}
+
+// RRSetChange is an RRset added, changed or removed, changed RRsets also carry their previous TTL and contents
+type RRSetChange struct {
+	Name             string   `json:"name"`
+	Type             string   `json:"type"`
+	TTL              int      `json:"ttl"`
+	Contents         []string `json:"contents"`
+	PreviousTTL      int      `json:"previous_ttl,omitempty"`
+	PreviousContents []string `json:"previous_contents,omitempty"`
+}
+
+// recordKey identifies a record by its content within a zone
+type recordKey struct {
+	name, rrtype, content string
+}
+
+// Reconcile brings the SOA fields and records of the zone to the ones of a transferred zone in a single
+// transaction, only the records that differ are created, updated or deleted. The zone is left untouched
+// when nothing differs, otherwise its serial is set as Import does.
+func (z *Zone) Reconcile(db *gorm.DB, transferred *Zone) (transfer *ZoneTransfer, err error) {
+	transfer = &ZoneTransfer{Zone: z}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing []*Record
+		err := tx.Where("zone_id = ?", z.ID).Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		transfer.Added, transfer.Changed, transfer.Removed = diffRRSets(existing, transferred.Records)
+
+		var current Zone
+		err = tx.First(&current, "id = ?", z.ID).Error
+		if err != nil {
+			return err
+		}
+		if len(transfer.Added)+len(transfer.Changed)+len(transfer.Removed) == 0 && sameSOA(&current, transferred) {
+			transfer.Serial = current.Serial
+			return nil
+		}
+		current, err = z.importSOA(tx, transferred)
+		if err != nil {
+			return err
+		}
+
+		kept := make(map[recordKey]*Record, len(transferred.Records))
+		for _, record := range transferred.Records {
+			kept[recordKey{record.Name, record.Type, record.Content}] = record
+		}
+		for _, record := range existing {
+			key := recordKey{record.Name, record.Type, record.Content}
+			update, ok := kept[key]
+			if !ok {
+				err = tx.Unscoped().Delete(record).Error
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			delete(kept, key)
+			if update.TTL != record.TTL {
+				err = SetRRSetTTL(tx, z.ID, record.Name, record.Type, update.TTL)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		var created []*Record
+		for _, record := range transferred.Records {
+			if _, ok := kept[recordKey{record.Name, record.Type, record.Content}]; ok {
+				created = append(created, &Record{ZoneID: z.ID, Name: record.Name, Type: record.Type, TTL: record.TTL, Content: record.Content})
+			}
+		}
+		if len(created) > 0 {
+			err = tx.Create(created).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		err = z.importSerial(tx, current, transferred)
+		if err != nil {
+			return err
+		}
+		err = tx.Select("serial").First(&current, "id = ?", z.ID).Error
+		transfer.Serial = current.Serial
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// sameSOA reports whether the SOA fields of both zones are the same
+func sameSOA(z1, z2 *Zone) bool {
+	return z1.TTL == z2.TTL && z1.MName == z2.MName && z1.RName == z2.RName && z1.Serial == z2.Serial &&
+		z1.Refresh == z2.Refresh && z1.Retry == z2.Retry && z1.Expire == z2.Expire && z1.Minimum == z2.Minimum
+}
+
+// diffRRSets compares the RRsets of the previous and current records, the changes are sorted by name and type
+func diffRRSets(previous, current []*Record) (added, changed, removed []*RRSetChange) {
+	before := make(map[string]*RRSet)
+	for _, rrset := range GroupRRSets(sortedRecords(previous)) {
+		before[rrset.ID] = rrset
+	}
+	after := GroupRRSets(sortedRecords(current))
+	for _, rrset := range after {
+		old, ok := before[rrset.ID]
+		if !ok {
+			added = append(added, &RRSetChange{Name: rrset.Name, Type: rrset.Type, TTL: rrset.TTL, Contents: rrset.Contents})
+			continue
+		}
+		delete(before, rrset.ID)
+		if old.TTL != rrset.TTL || !reflect.DeepEqual(old.Contents, rrset.Contents) {
+			changed = append(changed, &RRSetChange{
+				Name:             rrset.Name,
+				Type:             rrset.Type,
+				TTL:              rrset.TTL,
+				Contents:         rrset.Contents,
+				PreviousTTL:      old.TTL,
+				PreviousContents: old.Contents,
+			})
+		}
+	}
+	for _, rrset := range GroupRRSets(sortedRecords(previous)) {
+		if _, ok := before[rrset.ID]; ok {
+			removed = append(removed, &RRSetChange{Name: rrset.Name, Type: rrset.Type, TTL: rrset.TTL, Contents: rrset.Contents})
+		}
+	}
+	return added, changed, removed
+}
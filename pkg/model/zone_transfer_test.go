@@ -0,0 +1,62 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestZone_Reconcile(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:zone_transfer_model?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error setting up test database: %s", err)
+	}
+	err = db.AutoMigrate(&Zone{}, &Record{}, &ZoneJournal{}, &ZoneChange{})
+	if err != nil {
+		t.Fatalf("Error running the migration: %s", err)
+	}
+
+	name := ulid.Make().String()
+	zone := Zone{Name: name, Serial: 10}
+	if err := db.Create(&zone).Error; err != nil {
+		t.Fatalf("Error creating test zone: %s", err)
+	}
+	www := Record{Name: "www." + name, Type: "A", Content: "192.168.0.1", TTL: 300, ZoneID: zone.ID}
+	if err := www.Create(db); err != nil {
+		t.Fatalf("Error creating test record: %s", err)
+	}
+	if err := zone.Get(db, false); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	transferred := Zone{TTL: zone.TTL, MName: zone.MName, RName: zone.RName, Serial: 5, Refresh: zone.Refresh, Retry: zone.Retry, Expire: zone.Expire, Minimum: zone.Minimum}
+	transferred.Records = []*Record{{Name: "www." + name, Type: "A", Content: "192.168.0.1", TTL: 600}}
+	transfer, err := zone.Reconcile(db, &transferred)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(transfer.Added) != 0 || len(transfer.Removed) != 0 || len(transfer.Changed) != 1 {
+		t.Fatalf("Unexpected diff: %+v", transfer)
+	}
+	if changed := transfer.Changed[0]; changed.TTL != 600 || changed.PreviousTTL != 300 {
+		t.Errorf("Unexpected change: %+v", changed)
+	}
+	if transfer.Serial != 12 {
+		t.Errorf("Expected the serial to advance past the lower transferred one, got %d", transfer.Serial)
+	}
+	var record Record
+	if err := db.First(&record, "id = ?", www.ID).Error; err != nil || record.TTL != 600 {
+		t.Errorf("Expected the TTL of the existing record to be updated, got %d, %v", record.TTL, err)
+	}
+
+	transferred.Serial = transfer.Serial
+	transfer, err = zone.Reconcile(db, &transferred)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(transfer.Added)+len(transfer.Changed)+len(transfer.Removed) != 0 || transfer.Serial != 12 {
+		t.Errorf("Expected the zone to be left untouched, got %+v", transfer)
+	}
+}
@@ -0,0 +1,170 @@
+package rdata
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Supported lists the record types that can be managed through port53
+var Supported = map[string]uint16{
+	"A":     dns.TypeA,
+	"AAAA":  dns.TypeAAAA,
+	"CAA":   dns.TypeCAA,
+	"CNAME": dns.TypeCNAME,
+	"DS":    dns.TypeDS,
+	"HTTPS": dns.TypeHTTPS,
+	"MX":    dns.TypeMX,
+	"NAPTR": dns.TypeNAPTR,
+	"NS":    dns.TypeNS,
+	"PTR":   dns.TypePTR,
+	"SRV":   dns.TypeSRV,
+	"SSHFP": dns.TypeSSHFP,
+	"SVCB":  dns.TypeSVCB,
+	"TLSA":  dns.TypeTLSA,
+	"TXT":   dns.TypeTXT,
+}
+
+// Error is returned when a record type or content is not valid
+type Error struct {
+	Field  string
+	Reason string
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// Parse parses the content of a record of the given type into its typed rdata, relative names in the
+// content are taken as relative to origin and rejected when origin is empty
+func Parse(rrtype, content, origin string) (rr dns.RR, err error) {
+	rrtype = strings.ToUpper(strings.TrimSpace(rrtype))
+	if rrtype == "" {
+		return nil, &Error{Field: "type", Reason: "type is required"}
+	}
+	if _, ok := Supported[rrtype]; !ok {
+		return nil, &Error{Field: "type", Reason: fmt.Sprintf("unsupported record type %s", rrtype)}
+	}
+
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, &Error{Field: "content", Reason: "content is required"}
+	}
+	if strings.ContainsAny(content, "\n\r") {
+		return nil, &Error{Field: "content", Reason: "content must be a single line"}
+	}
+	if rrtype == "TXT" && !strings.HasPrefix(content, `"`) {
+		content = quote(content)
+	}
+
+	zp := dns.NewZoneParser(strings.NewReader(fmt.Sprintf(". 3600 IN %s %s\n", rrtype, content)), origin, "")
+	rr, _ = zp.Next()
+	if err = zp.Err(); err != nil {
+		return nil, &Error{Field: "content", Reason: parseReason(err)}
+	}
+	if rr == nil {
+		return nil, &Error{Field: "content", Reason: "content is required"}
+	}
+	if err = check(rr); err != nil {
+		return nil, err
+	}
+	return rr, nil
+}
+
+// Normalize validates the content of a record of the zone origin and returns it in canonical presentation format
+func Normalize(rrtype, content, origin string) (string, error) {
+	rr, err := Parse(rrtype, content, origin)
+	if err != nil {
+		return "", err
+	}
+	return Content(rr), nil
+}
+
+// Content returns the rdata of rr in presentation format
+func Content(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// check applies the semantic checks the parser leaves out and upper cases hex digests
+func check(rr dns.RR) error {
+	switch v := rr.(type) {
+	case *dns.A:
+		if v.A == nil || v.A.To4() == nil {
+			return &Error{Field: "content", Reason: "A records require an IPv4 address"}
+		}
+	case *dns.AAAA:
+		if v.AAAA == nil || v.AAAA.To4() != nil {
+			return &Error{Field: "content", Reason: "AAAA records require an IPv6 address"}
+		}
+	case *dns.CAA:
+		v.Tag = strings.ToLower(v.Tag)
+		if !caaTag.MatchString(v.Tag) {
+			return &Error{Field: "content", Reason: fmt.Sprintf("invalid CAA tag %s", v.Tag)}
+		}
+	case *dns.DS:
+		v.Digest = strings.ToUpper(v.Digest)
+		if err := checkDigest(v.Digest, dsDigestSizes[v.DigestType]); err != nil {
+			return err
+		}
+	case *dns.SSHFP:
+		v.FingerPrint = strings.ToUpper(v.FingerPrint)
+		if err := checkDigest(v.FingerPrint, sshfpDigestSizes[v.Type]); err != nil {
+			return err
+		}
+	case *dns.TLSA:
+		v.Certificate = strings.ToUpper(v.Certificate)
+		if err := checkDigest(v.Certificate, tlsaDigestSizes[v.MatchingType]); err != nil {
+			return err
+		}
+	case *dns.TXT:
+		if len(v.Txt) == 0 {
+			return &Error{Field: "content", Reason: "TXT records require at least one string"}
+		}
+	case *dns.SVCB:
+		if v.Priority != 0 && v.Target == "" {
+			return &Error{Field: "content", Reason: "SVCB records require a target"}
+		}
+	case *dns.HTTPS:
+		if v.Priority != 0 && v.Target == "" {
+			return &Error{Field: "content", Reason: "HTTPS records require a target"}
+		}
+	}
+	return nil
+}
+
+// Expected digest sizes in hex characters, indexed by digest, fingerprint or matching type
+var (
+	dsDigestSizes    = map[uint8]int{dns.SHA1: 40, dns.SHA256: 64, dns.SHA384: 96}
+	sshfpDigestSizes = map[uint8]int{1: 40, 2: 64}
+	tlsaDigestSizes  = map[uint8]int{1: 64, 2: 128}
+)
+
+// caaTag matches the tags allowed by RFC 8659, unknown tags are kept since critical ones are flagged by the issuer
+var caaTag = regexp.MustCompile(`^[a-z0-9]{1,15}$`)
+
+// checkDigest verifies the length of a hex digest when its algorithm is known
+func checkDigest(digest string, size int) error {
+	if size != 0 && len(digest) != size {
+		return &Error{Field: "content", Reason: fmt.Sprintf("digest must have %d hex characters, got %d", size, len(digest))}
+	}
+	return nil
+}
+
+// quote turns free text into a single TXT character string
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// parseReason strips the position information from the parser errors
+func parseReason(err error) string {
+	reason := strings.TrimPrefix(err.Error(), "dns: ")
+	if pos := strings.Index(reason, " at line:"); pos != -1 {
+		reason = reason[:pos]
+	}
+	return strings.TrimSpace(reason)
+}
@@ -0,0 +1,91 @@
+package rdata
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name          string
+		rrtype        string
+		content       string
+		origin        string
+		expected      string
+		expectedField string
+	}{
+		{name: "A", rrtype: "A", content: "192.168.0.1", expected: "192.168.0.1"},
+		{name: "A lowercase type", rrtype: "a", content: " 192.168.0.1 ", expected: "192.168.0.1"},
+		{name: "A with IPv6", rrtype: "A", content: "::1", expectedField: "content"},
+		{name: "A truncated", rrtype: "A", content: "192.168.0", expectedField: "content"},
+		{name: "AAAA", rrtype: "AAAA", content: "2001:DB8::1", expected: "2001:db8::1"},
+		{name: "AAAA with IPv4", rrtype: "AAAA", content: "192.168.0.1", expectedField: "content"},
+		{name: "CNAME", rrtype: "CNAME", content: "www.martinez.io.", expected: "www.martinez.io."},
+		{name: "CNAME relative", rrtype: "CNAME", content: "www", origin: "martinez.io", expected: "www.martinez.io."},
+		{name: "CNAME apex", rrtype: "CNAME", content: "@", origin: "martinez.io.", expected: "martinez.io."},
+		{name: "CNAME relative without origin", rrtype: "CNAME", content: "www", expectedField: "content"},
+		{name: "CNAME with garbage", rrtype: "CNAME", content: "www.martinez.io. extra", expectedField: "content"},
+		{name: "MX", rrtype: "MX", content: "10 mail.martinez.io.", expected: "10 mail.martinez.io."},
+		{name: "MX relative", rrtype: "MX", content: "10 mail", origin: "martinez.io.", expected: "10 mail.martinez.io."},
+		{name: "MX relative without origin", rrtype: "MX", content: "10 mail", expectedField: "content"},
+		{name: "MX without preference", rrtype: "MX", content: "mail.martinez.io.", expectedField: "content"},
+		{name: "TXT unquoted", rrtype: "TXT", content: `v=spf1 include:"_spf" -all`, expected: `"v=spf1 include:\"_spf\" -all"`},
+		{name: "TXT quoted", rrtype: "TXT", content: `"first" "second"`, expected: `"first" "second"`},
+		{name: "SRV", rrtype: "SRV", content: "10 5 5060 sip.martinez.io.", expected: "10 5 5060 sip.martinez.io."},
+		{name: "SRV relative", rrtype: "SRV", content: "10 5 5060 sip", origin: "martinez.io.", expected: "10 5 5060 sip.martinez.io."},
+		{name: "SRV relative without origin", rrtype: "SRV", content: "10 5 5060 sip", expectedField: "content"},
+		{name: "SRV out of range", rrtype: "SRV", content: "10 5 70000 sip.martinez.io.", expectedField: "content"},
+		{name: "CAA", rrtype: "CAA", content: `0 issue "letsencrypt.org"`, expected: `0 issue "letsencrypt.org"`},
+		{name: "CAA upper case tag", rrtype: "CAA", content: `0 ISSUE "letsencrypt.org"`, expected: `0 issue "letsencrypt.org"`},
+		{name: "CAA issuemail", rrtype: "CAA", content: `0 issuemail "letsencrypt.org"`, expected: `0 issuemail "letsencrypt.org"`},
+		{name: "CAA unknown tag", rrtype: "CAA", content: `128 bogus "letsencrypt.org"`, expected: `128 bogus "letsencrypt.org"`},
+		{name: "CAA invalid tag", rrtype: "CAA", content: `0 is-sue "letsencrypt.org"`, expectedField: "content"},
+		{name: "NS", rrtype: "NS", content: "ns1.martinez.io.", expected: "ns1.martinez.io."},
+		{name: "NS relative", rrtype: "NS", content: "ns1", origin: "martinez.io.", expected: "ns1.martinez.io."},
+		{name: "NS relative without origin", rrtype: "NS", content: "ns1", expectedField: "content"},
+		{name: "PTR", rrtype: "PTR", content: "host.martinez.io.", expected: "host.martinez.io."},
+		{name: "SSHFP", rrtype: "SSHFP", content: "1 1 123456789abcdef67890123456789abcdef67890", expected: "1 1 123456789ABCDEF67890123456789ABCDEF67890"},
+		{name: "SSHFP short digest", rrtype: "SSHFP", content: "1 2 123456789abcdef", expectedField: "content"},
+		{name: "TLSA", rrtype: "TLSA", content: "3 1 1 0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6", expected: "3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6"},
+		{name: "TLSA short digest", rrtype: "TLSA", content: "3 1 1 0C72", expectedField: "content"},
+		{name: "DS", rrtype: "DS", content: "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118", expected: "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118"},
+		{name: "DS short digest", rrtype: "DS", content: "60485 5 2 2BB183AF", expectedField: "content"},
+		{name: "HTTPS", rrtype: "HTTPS", content: "1 . alpn=h2,h3", expected: `1 . alpn="h2,h3"`},
+		{name: "SVCB alias", rrtype: "SVCB", content: "0 svc", origin: "martinez.io.", expected: "0 svc.martinez.io."},
+		{name: "NAPTR", rrtype: "NAPTR", content: `100 10 "u" "E2U+sip" "!^.*$!sip:info@martinez.io!" .`, expected: `100 10 "u" "E2U+sip" "!^.*$!sip:info@martinez.io!" .`},
+		{name: "Missing type", rrtype: "", content: "192.168.0.1", expectedField: "type"},
+		{name: "Unsupported type", rrtype: "SOA", content: "ns1. admin. 1 2 3 4 5", expectedField: "type"},
+		{name: "Missing content", rrtype: "A", content: "", expectedField: "content"},
+		{name: "Multiline content", rrtype: "TXT", content: "first\nsecond", expectedField: "content"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := Normalize(test.rrtype, test.content, test.origin)
+			if test.expectedField != "" {
+				var validationErr *Error
+				if assert.True(t, errors.As(err, &validationErr)) {
+					assert.Equal(t, test.expectedField, validationErr.Field)
+					assert.NotEmpty(t, validationErr.Reason)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, content)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	rr, err := Parse("MX", "10 mail", "martinez.io.")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "10 mail.martinez.io.", Content(rr))
+		assert.Equal(t, Supported["MX"], rr.Header().Rrtype)
+	}
+}
+
+func TestError(t *testing.T) {
+	err := &Error{Field: "content", Reason: "bad A A: \"::1\""}
+	assert.Equal(t, `invalid content: bad A A: "::1"`, err.Error())
+}
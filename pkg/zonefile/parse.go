@@ -0,0 +1,112 @@
+package zonefile
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/rdata"
+)
+
+// Error is returned when a master file can't be imported
+type Error struct {
+	Reason string
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Reason
+}
+
+// Parse reads a RFC 1035 master file for the zone origin and returns a zone carrying
+// the SOA fields and records found in the file. $INCLUDE directives are not allowed.
+func Parse(r io.Reader, origin string) (zone *model.Zone, err error) {
+	b := newBuilder(origin)
+	zp := dns.NewZoneParser(r, b.origin, "")
+	zp.SetIncludeAllowed(false)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		err = b.add(rr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, &Error{Reason: strings.TrimPrefix(err.Error(), "dns: ")}
+	}
+	return b.build()
+}
+
+// builder builds a zone out of its RRs
+type builder struct {
+	origin   string
+	zone     *model.Zone
+	foundSOA bool
+}
+
+// newBuilder returns a builder of the zone origin
+func newBuilder(origin string) *builder {
+	origin = dns.CanonicalName(origin)
+	return &builder{origin: origin, zone: &model.Zone{Name: Name(origin)}}
+}
+
+// add sets the SOA fields of the zone from a SOA record or appends any other record to the zone
+func (b *builder) add(rr dns.RR) error {
+	header := rr.Header()
+	owner := dns.CanonicalName(header.Name)
+	if !dns.IsSubDomain(b.origin, owner) {
+		return &Error{Reason: fmt.Sprintf("%s is outside of the zone %s", owner, b.origin)}
+	}
+	if header.Class != dns.ClassINET {
+		return &Error{Reason: fmt.Sprintf("%s has unsupported class %s", owner, dns.ClassToString[header.Class])}
+	}
+
+	if soa, ok := rr.(*dns.SOA); ok {
+		if owner != b.origin {
+			return &Error{Reason: fmt.Sprintf("SOA record found at %s instead of %s", owner, b.origin)}
+		}
+		if b.foundSOA {
+			return &Error{Reason: "multiple SOA records found"}
+		}
+		b.foundSOA = true
+		b.zone.TTL = int(header.Ttl)
+		b.zone.MName = Name(soa.Ns)
+		b.zone.RName = Name(soa.Mbox)
+		b.zone.Serial = int(soa.Serial)
+		b.zone.Refresh = int(soa.Refresh)
+		b.zone.Retry = int(soa.Retry)
+		b.zone.Expire = int(soa.Expire)
+		b.zone.Minimum = int(soa.Minttl)
+		return nil
+	}
+
+	rrtype := dns.TypeToString[header.Rrtype]
+	content, err := rdata.Normalize(rrtype, rdata.Content(rr), b.origin)
+	if err != nil {
+		return &Error{Reason: fmt.Sprintf("%s %s: %s", owner, rrtype, err)}
+	}
+	b.zone.Records = append(b.zone.Records, &model.Record{
+		Name:    Name(owner),
+		TTL:     int(header.Ttl),
+		Type:    rrtype,
+		Content: content,
+	})
+	return nil
+}
+
+// build returns the zone, which must have a SOA record
+func (b *builder) build() (*model.Zone, error) {
+	if !b.foundSOA {
+		return nil, &Error{Reason: "no SOA record found"}
+	}
+	return b.zone, nil
+}
+
+// Name converts a fully qualified domain name into the form used by port53, without the trailing dot
+func Name(fqdn string) string {
+	if fqdn == "." {
+		return fqdn
+	}
+	return strings.TrimSuffix(fqdn, ".")
+}
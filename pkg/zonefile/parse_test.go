@@ -0,0 +1,123 @@
+package zonefile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testZone = `$ORIGIN martinez.io.
+$TTL 300
+@	3600	IN	SOA	ns1 hostmaster (
+			2023010101 ; serial
+			7200       ; refresh
+			900        ; retry
+			1209600    ; expire
+			300 )      ; minimum
+	IN	NS	ns1
+	IN	NS	ns2.martinez.io.
+	IN	MX	10 mail
+ns1	IN	A	192.168.0.1
+ns2	IN	A	192.168.0.2
+www	600	IN	A	192.168.0.10
+www		IN	A	192.168.0.11
+txt		IN	TXT	"v=spf1 -all"
+$ORIGIN internal.martinez.io.
+db		IN	CNAME	www.martinez.io.
+`
+
+func TestParse(t *testing.T) {
+	zone, err := Parse(strings.NewReader(testZone), "martinez.io")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "martinez.io", zone.Name)
+	assert.Equal(t, 3600, zone.TTL)
+	assert.Equal(t, "ns1.martinez.io", zone.MName)
+	assert.Equal(t, "hostmaster.martinez.io", zone.RName)
+	assert.Equal(t, 2023010101, zone.Serial)
+	assert.Equal(t, 7200, zone.Refresh)
+	assert.Equal(t, 900, zone.Retry)
+	assert.Equal(t, 1209600, zone.Expire)
+	assert.Equal(t, 300, zone.Minimum)
+
+	expected := []struct {
+		name    string
+		ttl     int
+		rrtype  string
+		content string
+	}{
+		{"martinez.io", 300, "NS", "ns1.martinez.io."},
+		{"martinez.io", 300, "NS", "ns2.martinez.io."},
+		{"martinez.io", 300, "MX", "10 mail.martinez.io."},
+		{"ns1.martinez.io", 300, "A", "192.168.0.1"},
+		{"ns2.martinez.io", 300, "A", "192.168.0.2"},
+		{"www.martinez.io", 600, "A", "192.168.0.10"},
+		{"www.martinez.io", 300, "A", "192.168.0.11"},
+		{"txt.martinez.io", 300, "TXT", `"v=spf1 -all"`},
+		{"db.internal.martinez.io", 300, "CNAME", "www.martinez.io."},
+	}
+	if assert.Len(t, zone.Records, len(expected)) {
+		for pos, record := range zone.Records {
+			assert.Equal(t, expected[pos].name, record.Name)
+			assert.Equal(t, expected[pos].ttl, record.TTL)
+			assert.Equal(t, expected[pos].rrtype, record.Type)
+			assert.Equal(t, expected[pos].content, record.Content)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	soa := "@ IN SOA ns1 hostmaster 1 7200 900 1209600 300\n"
+	tests := []struct {
+		name          string
+		input         string
+		expectedError string
+	}{
+		{
+			name:          "missing SOA",
+			input:         "www IN A 192.168.0.1\n",
+			expectedError: "no SOA record found",
+		},
+		{
+			name:          "multiple SOA",
+			input:         soa + soa,
+			expectedError: "multiple SOA records found",
+		},
+		{
+			name:          "include is not allowed",
+			input:         soa + "$INCLUDE /etc/passwd\n",
+			expectedError: "$INCLUDE directive not allowed",
+		},
+		{
+			name:          "record outside of the zone",
+			input:         soa + "www.example.com. IN A 192.168.0.1\n",
+			expectedError: "www.example.com. is outside of the zone martinez.io.",
+		},
+		{
+			name:          "unsupported type",
+			input:         soa + "www IN HINFO \"cpu\" \"os\"\n",
+			expectedError: "www.martinez.io. HINFO: invalid type: unsupported record type HINFO",
+		},
+		{
+			name:          "invalid content",
+			input:         soa + "www IN A 192.168.0\n",
+			expectedError: "bad A A",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader("$ORIGIN martinez.io.\n$TTL 300\n"+test.input), "martinez.io")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.expectedError)
+			}
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "martinez.io", Name("martinez.io."))
+	assert.Equal(t, "martinez.io", Name("martinez.io"))
+	assert.Equal(t, ".", Name("."))
+}
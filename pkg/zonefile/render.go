@@ -0,0 +1,111 @@
+package zonefile
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/ncode/port53/pkg/rdata"
+)
+
+// Render returns the zone with its SOA and records as a RFC 1035 master file.
+// Every name is fully qualified and records are sorted in canonical order so renders can be diffed.
+func Render(zone *model.Zone) ([]byte, error) {
+	rrs, err := RRs(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "$ORIGIN %s\n", dns.Fqdn(zone.Name))
+	fmt.Fprintf(&b, "$TTL %d\n", zone.TTL)
+	for _, rr := range rrs {
+		b.WriteString(rr.String())
+		b.WriteString("\n")
+	}
+	return b.Bytes(), nil
+}
+
+// RRs returns the SOA followed by the records of the zone sorted in canonical order
+func RRs(zone *model.Zone) (rrs []dns.RR, err error) {
+	origin := dns.Fqdn(zone.Name)
+	rrs = append(rrs, SOA(zone))
+
+	records := make([]dns.RR, 0, len(zone.Records))
+	for _, record := range zone.Records {
+		rr, err := RR(record, origin)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rr)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return Less(records[i], records[j])
+	})
+	return append(rrs, records...), nil
+}
+
+// RR returns the record as a RR of the zone origin
+func RR(record *model.Record, origin string) (dns.RR, error) {
+	rr, err := rdata.Parse(record.Type, record.Content, origin)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", record.Name, record.Type, err)
+	}
+	rr.Header().Name = Absolute(record.Name, origin)
+	rr.Header().Ttl = uint32(record.TTL)
+	return rr, nil
+}
+
+// SOA returns the SOA record of the zone
+func SOA(zone *model.Zone) *dns.SOA {
+	origin := dns.Fqdn(zone.Name)
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: origin, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: uint32(zone.TTL)},
+		Ns:      Absolute(zone.MName, origin),
+		Mbox:    Absolute(zone.RName, origin),
+		Serial:  uint32(zone.Serial),
+		Refresh: uint32(zone.Refresh),
+		Retry:   uint32(zone.Retry),
+		Expire:  uint32(zone.Expire),
+		Minttl:  uint32(zone.Minimum),
+	}
+}
+
+// Absolute returns name as a fully qualified domain name, names outside of origin are taken as relative to it
+func Absolute(name string, origin string) string {
+	switch {
+	case name == "" || name == "@":
+		return origin
+	case dns.IsFqdn(name):
+		return name
+	case dns.IsSubDomain(origin, dns.Fqdn(name)):
+		return dns.Fqdn(name)
+	}
+	return dns.Fqdn(name) + origin
+}
+
+// Less reports whether a sorts before b in canonical order, by owner name, type and rdata
+func Less(a, b dns.RR) bool {
+	if c := compareNames(a.Header().Name, b.Header().Name); c != 0 {
+		return c < 0
+	}
+	if a.Header().Rrtype != b.Header().Rrtype {
+		return a.Header().Rrtype < b.Header().Rrtype
+	}
+	return rdata.Content(a) < rdata.Content(b)
+}
+
+// compareNames compares two domain names label by label starting from the root as described in RFC 4034
+func compareNames(a, b string) int {
+	la := dns.SplitDomainName(strings.ToLower(a))
+	lb := dns.SplitDomainName(strings.ToLower(b))
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
@@ -0,0 +1,90 @@
+package zonefile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	zone := &model.Zone{
+		Name:    "martinez.io",
+		TTL:     3600,
+		MName:   "ns1",
+		RName:   "hostmaster.martinez.io",
+		Serial:  2023010101,
+		Refresh: 7200,
+		Retry:   900,
+		Expire:  1209600,
+		Minimum: 300,
+		Records: []*model.Record{
+			{Name: "www.martinez.io", TTL: 300, Type: "A", Content: "192.168.0.11"},
+			{Name: "db.internal.martinez.io", TTL: 300, Type: "CNAME", Content: "www.martinez.io."},
+			{Name: "martinez.io", TTL: 300, Type: "NS", Content: "ns1.martinez.io."},
+			{Name: "www", TTL: 300, Type: "A", Content: "192.168.0.10"},
+			{Name: "martinez.io", TTL: 300, Type: "A", Content: "192.168.0.1"},
+			{Name: "a.martinez.io", TTL: 300, Type: "TXT", Content: `"v=spf1 -all"`},
+		},
+	}
+	expected := "$ORIGIN martinez.io.\n" +
+		"$TTL 3600\n" +
+		"martinez.io.\t3600\tIN\tSOA\tns1.martinez.io. hostmaster.martinez.io. 2023010101 7200 900 1209600 300\n" +
+		"martinez.io.\t300\tIN\tA\t192.168.0.1\n" +
+		"martinez.io.\t300\tIN\tNS\tns1.martinez.io.\n" +
+		"a.martinez.io.\t300\tIN\tTXT\t\"v=spf1 -all\"\n" +
+		"db.internal.martinez.io.\t300\tIN\tCNAME\twww.martinez.io.\n" +
+		"www.martinez.io.\t300\tIN\tA\t192.168.0.10\n" +
+		"www.martinez.io.\t300\tIN\tA\t192.168.0.11\n"
+
+	content, err := Render(zone)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, string(content))
+	}
+
+	parsed, err := Parse(strings.NewReader(string(content)), zone.Name)
+	if assert.NoError(t, err) {
+		assert.Equal(t, zone.Serial, parsed.Serial)
+		assert.Equal(t, "ns1.martinez.io", parsed.MName)
+		assert.Len(t, parsed.Records, len(zone.Records))
+	}
+}
+
+func TestRender_InvalidRecord(t *testing.T) {
+	zone := &model.Zone{Name: "martinez.io", Records: []*model.Record{{Name: "www", Type: "A", Content: "::1"}}}
+	_, err := Render(zone)
+	assert.Error(t, err)
+}
+
+func TestAbsolute(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "@", expected: "martinez.io."},
+		{name: "", expected: "martinez.io."},
+		{name: "admin", expected: "admin.martinez.io."},
+		{name: "ns1.martinez.io", expected: "ns1.martinez.io."},
+		{name: "ns1.example.com.", expected: "ns1.example.com."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Absolute(test.name, "martinez.io."))
+		})
+	}
+}
+
+func TestLess(t *testing.T) {
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		assert.NoError(t, err)
+		return r
+	}
+	assert.True(t, Less(rr("martinez.io. 300 IN A 192.168.0.1"), rr("a.martinez.io. 300 IN A 192.168.0.1")))
+	assert.True(t, Less(rr("z.martinez.io. 300 IN A 192.168.0.1"), rr("a.z.martinez.io. 300 IN A 192.168.0.1")))
+	assert.True(t, Less(rr("a.martinez.io. 300 IN A 192.168.0.1"), rr("a.martinez.io. 300 IN NS ns1.martinez.io.")))
+	assert.True(t, Less(rr("a.martinez.io. 300 IN A 192.168.0.1"), rr("a.martinez.io. 300 IN A 192.168.0.2")))
+	assert.False(t, Less(rr("b.martinez.io. 300 IN A 192.168.0.1"), rr("a.martinez.io. 300 IN A 192.168.0.1")))
+}
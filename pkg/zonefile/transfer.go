@@ -0,0 +1,49 @@
+package zonefile
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ncode/port53/pkg/model"
+)
+
+// Transfer performs an AXFR of the zone origin from the primary server at addr and returns a zone carrying
+// the SOA fields and records transferred, as Parse does. The transfer is signed with key when it isn't nil.
+func Transfer(addr string, origin string, key *model.TSIGKey) (zone *model.Zone, err error) {
+	b := newBuilder(origin)
+	m := new(dns.Msg)
+	m.SetAxfr(b.origin)
+	tr := new(dns.Transfer)
+	if key != nil {
+		name := dns.Fqdn(key.Name)
+		tr.TsigSecret = map[string]string{name: key.Secret}
+		m.SetTsig(name, dns.Fqdn(key.Algorithm), 300, time.Now().Unix())
+	}
+	envelopes, err := tr.In(m, addr)
+	if err != nil {
+		return nil, err
+	}
+	// Drain the envelopes left after an invalid RR so the transfer doesn't block
+	defer func() {
+		go func() {
+			for range envelopes {
+			}
+		}()
+	}()
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, envelope.Error
+		}
+		for _, rr := range envelope.RR {
+			// The transfer ends with the SOA it starts with
+			if _, ok := rr.(*dns.SOA); ok && b.foundSOA {
+				return b.build()
+			}
+			err = b.add(rr)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.build()
+}